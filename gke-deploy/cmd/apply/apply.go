@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
 
 const (
@@ -16,7 +18,16 @@ const (
 	long  = `Apply Kubernetes configuration files. Skip prepare.
 
 - Apply Kubernetes configuration files to the target cluster with the provided namespace.
+- Apply Kubernetes configuration files to multiple clusters concurrently, if more than one [--cluster|-c] or a [--targets-file] is provided, or one at a time if [--sequential] is set.
+- Refuse to apply over deployed objects that are managed by another tool (e.g., Helm or Config Sync) or belong to another application, according to their 'app.kubernetes.io/managed-by' and 'app.kubernetes.io/name' labels, unless [--adopt] is set.
+- Wait for other deployments of the application to the same namespace to finish, unless [--lock=false] is set.
+- Use server-side apply with the "gke-deploy" field manager, if [--server-side] is set.
 - Wait for deployed Kubernetes configuration files to be ready before exiting.
+- Delete objects of the application that are no longer in the configuration files once the deployed objects are ready, if [--prune] is set.
+- Roll back to the previously deployed objects if they are not ready in time, if [--rollback-on-failure] is set.
+- Record a release of the application in the cluster, so that it can be listed with "gke-deploy history" and rolled back to with "gke-deploy rollback", unless [--record-release=false] is set.
+- Report progress as a stream of JSON events on stdout, if [--output-format=json] is set.
+- Save a JSON file with the results of the deployment, e.g., the readiness and images of deployed objects and the duration of each phase, to [--results-file], if provided.
 `
 	example = `  # Apply only.
   gke-deploy apply -f configs -c my-cluster -n my-namespace -c my-cluster -l us-east1-b
@@ -26,21 +37,43 @@ const (
   cat expanded/*
   gke-deploy apply -f expanded -c my-cluster -n my-namespace -c my-cluster -l us-east1-b  # Pass expanded directory to -f
 
+  # Build a kustomization and deploy its output.
+  gke-deploy apply -f overlays/staging -c my-cluster -l us-east1-b
+
+  # Deploy to clusters in two regions, one at a time, and stop after the first cluster that fails.
+  gke-deploy apply -f configs -c prod-us -l us-central1 -c prod-eu -l europe-west1 --sequential
+
   # Pipe output from another templating engine to gke-deploy apply.
-  kustomize build overlays/staging | gke-deploy apply -f - -c my-cluster -l us-east1-b
   helm template charts/prometheus | gke-deploy apply -f - -c my-cluster -l us-east1-b  # No need to run Tiller in cluster`
 )
 
 type options struct {
-	filename        string
-	clusterLocation string
-	clusterName     string
-	clusterProject  string
-	namespace       string
-	verbose         bool
-	waitTimeout     time.Duration
-	recursive       bool
-	serverDryRun    bool
+	filename               string
+	clusterLocation        []string
+	clusterName            []string
+	clusterProject         string
+	targetsFile            string
+	sequential             bool
+	maxUnavailableClusters int
+	namespace              string
+	verbose                bool
+	kubernetesBackend      string
+	waitTimeout            time.Duration
+	recursive              bool
+	serverDryRun           bool
+	prune                  bool
+	pruneClusterScoped     bool
+	rollbackOnFailure      bool
+	serverSide             bool
+	forceConflicts         bool
+	resultsFile            string
+	recordRelease          bool
+	historyMax             int
+	adopt                  bool
+	lock                   bool
+	lockTimeout            time.Duration
+	lockDuration           time.Duration
+	outputFormat           string
 }
 
 // NewApplyCommand creates the `gke-deploy apply` subcommand.
@@ -59,15 +92,32 @@ func NewApplyCommand() *cobra.Command {
 		SilenceUsage: true,
 	}
 
-	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). Prefix this value with \"gs://\" to indicate a GCS path.")
-	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster to deploy to.")
-	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster to deploy to.")
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). If this path is a kustomization file or a directory with a kustomization file (e.g., \"kustomization.yaml\"), the kustomization is built and its output is used. Prefix this value with \"gs://\" to indicate a GCS path.")
+	cmd.Flags().StringSliceVarP(&options.clusterLocation, "location", "l", nil, "Region/zone of GKE cluster to deploy to. Set one location per cluster provided by --cluster, in the same order.")
+	cmd.Flags().StringSliceVarP(&options.clusterName, "cluster", "c", nil, "Name of GKE cluster to deploy to. Clusters can be set comma-delimited or as separate flags to deploy to multiple clusters.")
 	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster to deploy to. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVar(&options.targetsFile, "targets-file", "", "Path to a YAML file that lists GKE clusters to deploy to, each with \"cluster\", \"location\", and optional \"project\" fields. Clusters are deployed to in addition to those provided by --cluster.")
+	cmd.Flags().BoolVar(&options.sequential, "sequential", false, "Deploy to multiple clusters one at a time, in the order they are provided, instead of concurrently. Remaining clusters are skipped after more than --max-unavailable-clusters clusters fail.")
+	cmd.Flags().IntVar(&options.maxUnavailableClusters, "max-unavailable-clusters", 0, "Number of clusters that can fail to deploy before remaining clusters are skipped. Requires --sequential.")
 	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of GKE cluster to deploy to. If omitted, the namespace(s) specified in each Kubernetes configuration file is used.")
 	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
 	cmd.Flags().DurationVarP(&options.waitTimeout, "timeout", "t", 5*time.Minute, "Timeout limit for waiting for Kubernetes objects to finish applying.")
 	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", false, "Recursively search through the provided path in --filename for all YAML files.")
 	cmd.Flags().BoolVarP(&options.serverDryRun, "server-dry-run", "D", false, "Perform kubectl apply server dry run to validate configurations without persisting resources.")
+	cmd.Flags().BoolVar(&options.prune, "prune", false, "Delete deployed objects that have the 'app.kubernetes.io/managed-by=gcp-cloud-build-deploy' label and the same 'app.kubernetes.io/name' label as the applied objects, but are no longer in the Kubernetes configuration files. Only objects of the kinds of the applied objects and of common kinds (e.g., Deployments, Services, ConfigMaps) are deleted, and objects that controllers create with copied labels (Endpoints, EndpointSlices, Events) never are. Objects are only deleted once the deployed objects are ready, and are only looked for in the namespaces of the deployed objects. With --server-dry-run, the objects that would be deleted are listed instead.")
+	cmd.Flags().BoolVar(&options.pruneClusterScoped, "prune-cluster-scoped", false, "Also delete cluster-scoped objects (e.g., Namespaces, ClusterRoles) when pruning. Requires --prune.")
+	cmd.Flags().BoolVar(&options.rollbackOnFailure, "rollback-on-failure", false, "If deployed objects are not ready before --timeout, re-apply the previously applied configuration of objects that existed before applying, without taking over fields set by other managers, delete objects that did not exist, and wait for the restored objects to be ready.")
+	cmd.Flags().BoolVar(&options.adopt, "adopt", false, "Apply over deployed objects whose 'app.kubernetes.io/managed-by' label is not 'gcp-cloud-build-deploy' or whose 'app.kubernetes.io/name' label is not the application's, e.g., objects created by Helm, Config Sync, or another application's pipeline. Without this flag, such objects are listed and nothing is applied.")
+	cmd.Flags().BoolVar(&options.lock, "lock", true, "Hold a coordination.k8s.io/v1 Lease named after the application in the target namespace while applying and waiting, so that concurrent deployments of the application are serialized. The holder of the Lease is $BUILD_ID. Requires objects to have the same 'app.kubernetes.io/name' label, and permission to manage Leases. The Lease is applied with server-side apply. If the Lease is lost while it is held, the deployment is canceled. Set --lock=false to deploy without a Lease, e.g., if the account running gke-deploy cannot manage Leases.")
+	cmd.Flags().DurationVar(&options.lockTimeout, "lock-timeout", deployer.DefaultLockTimeout, "Timeout limit for waiting for another deployment of the application to release its Lease.")
+	cmd.Flags().DurationVar(&options.lockDuration, "lock-duration", deployer.DefaultLockDuration, "Time after which a Lease that has not been renewed is stale and is taken over, e.g., if the deployment holding it was cancelled. The Lease is renewed while it is held.")
+	cmd.Flags().BoolVar(&options.serverSide, "server-side", false, "Apply Kubernetes configuration files with server-side apply, using \"gke-deploy\" as the field manager. Fields managed by other field managers are reported as conflicts.")
+	cmd.Flags().BoolVar(&options.forceConflicts, "force-conflicts", false, "Take ownership of fields that conflict with other field managers when using server-side apply. Requires --server-side.")
+	cmd.Flags().StringVar(&options.resultsFile, "results-file", "", "Local or GCS path to save a JSON file with the results of the deployment to, including the readiness, addresses, and images of each deployed object, the duration of each phase, and the final status and error. Prefix this value with \"gs://\" to indicate a GCS path. The file is saved even if the deployment fails.")
+	cmd.Flags().StringVar(&options.outputFormat, "output-format", common.OutputFormatText, "Format of the progress output. With \"json\", events (phase started, object applied, object ready, object failed, warning, and summary) are written to stdout as one JSON object per line, and human-readable output is written to stderr instead. Cannot be used with --verbose.")
+	cmd.Flags().BoolVar(&options.recordRelease, "record-release", true, "Record a release of the application with the deployed Kubernetes configuration files, version, images, and build ID as a Secret in the target namespace after deployed objects are ready, so that it can be listed with \"gke-deploy history\" and rolled back to with \"gke-deploy rollback\". Requires objects to have the same 'app.kubernetes.io/name' label. The Secret is applied with server-side apply. Set --record-release=false to deploy without recording a release, e.g., if the account running gke-deploy cannot manage Secrets.")
+	cmd.Flags().IntVar(&options.historyMax, "history-max", deployer.DefaultReleaseHistoryMax, "Number of releases of the application to keep in the cluster. Older releases are deleted. Use 0 for no limit.")
 
 	return cmd
 }
@@ -78,26 +128,95 @@ func apply(_ *cobra.Command, options *options) error {
 	if options.filename == "" {
 		return fmt.Errorf("required -f|--filename flag is not set")
 	}
-	if options.clusterName != "" && options.clusterLocation == "" {
+	if len(options.clusterName) > 0 && len(options.clusterLocation) == 0 {
 		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
 	}
-	if options.clusterLocation != "" && options.clusterName == "" {
+	if len(options.clusterLocation) > 0 && len(options.clusterName) == 0 {
 		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
 	}
+	if options.maxUnavailableClusters < 0 {
+		return fmt.Errorf("value of --max-unavailable-clusters must be >= 0")
+	}
+	if options.maxUnavailableClusters > 0 && !options.sequential {
+		return fmt.Errorf("you must set --sequential flag because --max-unavailable-clusters flag is set")
+	}
+	targets, err := common.CreateClusterTargets(options.clusterName, options.clusterLocation, options.targetsFile)
+	if err != nil {
+		return err
+	}
+	multiCluster := len(targets) > 1 || options.targetsFile != ""
+	if options.pruneClusterScoped && !options.prune {
+		return fmt.Errorf("you must set --prune flag because --prune-cluster-scoped flag is set")
+	}
+	if options.forceConflicts && !options.serverSide {
+		return fmt.Errorf("you must set --server-side flag because --force-conflicts flag is set")
+	}
+	if options.historyMax < 0 {
+		return fmt.Errorf("value of --history-max must be >= 0")
+	}
+	if options.lockTimeout < 0 {
+		return fmt.Errorf("value of --lock-timeout must be >= 0")
+	}
+	if options.lockDuration <= 0 {
+		return fmt.Errorf("value of --lock-duration must be > 0")
+	}
+	if options.verbose && options.outputFormat == common.OutputFormatJSON {
+		return fmt.Errorf("-V|--verbose cannot be used with --output-format=json because underlying commands are printed to stdout")
+	}
 
 	useGcloud := common.GcloudInPath()
-	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+	if !useGcloud && len(targets) > 0 {
 		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
 	}
 
-	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, options.serverDryRun)
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, options.serverDryRun, options.kubernetesBackend)
 	if err != nil {
 		return err
 	}
+	if err := common.SetOutputFormat(d, options.outputFormat); err != nil {
+		return err
+	}
+	d.Prune = options.prune
+	d.PruneClusterScoped = options.pruneClusterScoped
+	d.RollbackOnFailure = options.rollbackOnFailure
+	d.ServerSideApply = options.serverSide
+	d.ForceConflicts = options.forceConflicts
+	d.CheckOwnership = !options.adopt
+	d.Lock = options.lock
+	d.LockTimeout = options.lockTimeout
+	d.LockDuration = options.lockDuration
+	d.RecordRelease = options.recordRelease
+	d.ReleaseHistoryMax = options.historyMax
+
+	if options.resultsFile != "" {
+		d.Results = deployer.NewResults()
+	}
+	err = deploy(ctx, d, targets, multiCluster, options)
+	if options.resultsFile != "" {
+		if saveErr := d.SaveResults(ctx, options.resultsFile, err); saveErr != nil {
+			if err != nil {
+				return fmt.Errorf("%v, and failed to save results: %v", err, saveErr)
+			}
+			return fmt.Errorf("failed to save results: %v", saveErr)
+		}
+	}
+	return err
+}
 
-	if err := d.Apply(ctx, options.clusterName, options.clusterLocation, options.clusterProject, options.filename, options.namespace, options.waitTimeout, options.recursive); err != nil {
+// deploy applies the deployment to each target cluster.
+func deploy(ctx context.Context, d *deployer.Deployer, targets []deployer.ClusterTarget, multiCluster bool, options *options) error {
+	if multiCluster {
+		if err := d.ApplyToClusters(ctx, targets, options.clusterProject, options.filename, options.namespace, options.waitTimeout, options.recursive, options.sequential, options.maxUnavailableClusters); err != nil {
+			return fmt.Errorf("failed to apply deployment: %v", err)
+		}
+		return nil
+	}
+	var clusterName, clusterLocation string
+	if len(targets) == 1 {
+		clusterName, clusterLocation = targets[0].Name, targets[0].Location
+	}
+	if err := d.Apply(ctx, clusterName, clusterLocation, options.clusterProject, options.filename, options.namespace, options.waitTimeout, options.recursive); err != nil {
 		return fmt.Errorf("failed to apply deployment: %v", err)
 	}
-
 	return nil
 }
@@ -4,15 +4,25 @@ package common
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/url"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/event"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/image"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/openapi"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/policy"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/google/go-containerregistry/pkg/name"
 	applicationsv1beta1 "github.com/kubernetes-sigs/application/pkg/apis/app/v1beta1"
+	"sigs.k8s.io/yaml"
 )
 
 // CreateApplicationLinksListFromEqualDelimitedStrings creates a []applicationsv1beta1.Link from a slice
@@ -72,9 +82,249 @@ func CreateMapFromEqualDelimitedStrings(labels []string) (map[string]string, err
 	return labelsMap, nil
 }
 
-// CreateDeployer creates a Deployer with initialized clients.
-func CreateDeployer(ctx context.Context, useGcloud, verbose bool, serverDryRun bool) (*deployer.Deployer, error) {
-	c, err := services.NewClients(ctx, useGcloud, verbose, serverDryRun)
+// CreateImageMappings creates a []*image.Mapping from a slice of image references and an images file.
+// The images file is a YAML map from names of images in configuration files to the image references
+// that they are set to, e.g., `my-app: gcr.io/my-project/my-app:1.0.0`. An error is returned if
+// more than one image reference is set for the same image name.
+func CreateImageMappings(images []string, imagesFile string) ([]*image.Mapping, error) {
+	var mappings []*image.Mapping
+	for _, im := range images {
+		im = strings.TrimSpace(im)
+		if im == "" {
+			continue
+		}
+		ref, err := name.ParseReference(im)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, image.NewMapping(ref))
+	}
+
+	if imagesFile != "" {
+		contents, err := ioutil.ReadFile(imagesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read images file %q: %v", imagesFile, err)
+		}
+		var imagesMap map[string]string
+		if err := yaml.Unmarshal(contents, &imagesMap); err != nil {
+			return nil, fmt.Errorf("failed to parse images file %q: %v", imagesFile, err)
+		}
+		imageNames := make([]string, 0, len(imagesMap))
+		for k := range imagesMap {
+			imageNames = append(imageNames, k)
+		}
+		sort.Strings(imageNames)
+		for _, k := range imageNames {
+			m, err := image.ParseMapping(k, imagesMap[k])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse images file %q: %v", imagesFile, err)
+			}
+			mappings = append(mappings, m)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range mappings {
+		if seen[m.Name] {
+			return nil, fmt.Errorf("image %q must not be set more than once", m.Name)
+		}
+		seen[m.Name] = true
+	}
+	return mappings, nil
+}
+
+// CreatePodTemplatePaths creates the pod template paths of custom resources listed in a YAML file,
+// so that container images, labels, and annotations in their pod templates are updated. If the file
+// is not set, only the pod template paths of well-known custom resources are used.
+func CreatePodTemplatePaths(podTemplatePathsFile string) (resource.PodTemplatePaths, error) {
+	if podTemplatePathsFile == "" {
+		return nil, nil
+	}
+	contents, err := ioutil.ReadFile(podTemplatePathsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pod template paths file %q: %v", podTemplatePathsFile, err)
+	}
+	paths, err := resource.ParsePodTemplatePaths(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pod template paths file %q: %v", podTemplatePathsFile, err)
+	}
+	return paths, nil
+}
+
+// CreatePolicy creates a policy from a YAML policy file that sets the severity of rules. If the file
+// is not set, the default policy is returned.
+func CreatePolicy(policyFile string) (policy.Policy, error) {
+	if policyFile == "" {
+		return policy.DefaultPolicy(), nil
+	}
+	contents, err := ioutil.ReadFile(policyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file %q: %v", policyFile, err)
+	}
+	p, err := policy.ParsePolicy(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %q: %v", policyFile, err)
+	}
+	return p, nil
+}
+
+// CreateValidator creates a validator of objects from an OpenAPI v2 schema file (e.g., the
+// api/openapi-spec/swagger.json file of a Kubernetes release) and CustomResourceDefinition files or
+// directories of files. Either can be empty.
+func CreateValidator(ctx context.Context, openAPISchemaFile string, crdFiles []string) (*openapi.Validator, error) {
+	v := openapi.NewValidator()
+	if openAPISchemaFile != "" {
+		contents, err := ioutil.ReadFile(openAPISchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OpenAPI schema file %q: %v", openAPISchemaFile, err)
+		}
+		if err := v.AddOpenAPISchema(contents); err != nil {
+			return nil, fmt.Errorf("failed to add OpenAPI schema file %q: %v", openAPISchemaFile, err)
+		}
+	}
+
+	if len(crdFiles) > 0 {
+		oss, err := services.NewOS(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create os: %v", err)
+		}
+		for _, f := range crdFiles {
+			objs, err := resource.ParseConfigs(ctx, f, oss, nil, nil, nil, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CustomResourceDefinition files %q: %v", f, err)
+			}
+			for _, obj := range objs {
+				if resource.ObjectKind(obj) != "CustomResourceDefinition" {
+					continue
+				}
+				if err := v.AddCustomResourceDefinition(obj); err != nil {
+					return nil, fmt.Errorf("failed to add schema of CustomResourceDefinition in %q: %v", f, err)
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+// buildSubstitutions are the Cloud Build substitutions whose environment variables are used as
+// values of variables in configuration files. User-defined substitutions, which begin with an
+// underscore, are not taken from the environment, so that unrelated environment variables are not
+// substituted; they must be set with --var or --vars-file.
+var buildSubstitutions = []string{
+	"PROJECT_ID",
+	"PROJECT_NUMBER",
+	"LOCATION",
+	"BUILD_ID",
+	"REPO_NAME",
+	"BRANCH_NAME",
+	"TAG_NAME",
+	"REVISION_ID",
+	"COMMIT_SHA",
+	"SHORT_SHA",
+}
+
+// CreateVariables creates the variables used to expand ${VAR} placeholders in configuration files.
+// Values are taken from the environment variables of buildSubstitutions, then from a vars file that is
+// a YAML map of variable names to values, then from a slice of "="-delimited strings, with later
+// values overriding earlier ones.
+func CreateVariables(vars []string, varsFile string, strict bool) (*resource.Variables, error) {
+	values := make(map[string]string)
+	for _, k := range buildSubstitutions {
+		if v, ok := os.LookupEnv(k); ok {
+			values[k] = v
+		}
+	}
+
+	if varsFile != "" {
+		contents, err := ioutil.ReadFile(varsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vars file %q: %v", varsFile, err)
+		}
+		var varsMap map[string]string
+		if err := yaml.Unmarshal(contents, &varsMap); err != nil {
+			return nil, fmt.Errorf("failed to parse vars file %q: %v", varsFile, err)
+		}
+		for k, v := range varsMap {
+			values[k] = v
+		}
+	}
+
+	varsMap, err := CreateMapFromEqualDelimitedStrings(vars)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range varsMap {
+		values[k] = v
+	}
+
+	return &resource.Variables{
+		Values: values,
+		Strict: strict,
+	}, nil
+}
+
+// CreateClusterTargets creates the clusters to deploy to from slices of cluster names and locations,
+// where each name is paired with the location at the same index, and from a targets file that is a
+// YAML list of clusters with "cluster", "location", and optional "project" fields.
+func CreateClusterTargets(clusters, locations []string, targetsFile string) ([]deployer.ClusterTarget, error) {
+	if len(clusters) != len(locations) {
+		return nil, fmt.Errorf("number of clusters (%d) must match number of locations (%d)", len(clusters), len(locations))
+	}
+	var targets []deployer.ClusterTarget
+	for i, c := range clusters {
+		if c == "" || locations[i] == "" {
+			return nil, fmt.Errorf("cluster %q with location %q must set both a name and a location", c, locations[i])
+		}
+		targets = append(targets, deployer.ClusterTarget{
+			Name:     c,
+			Location: locations[i],
+		})
+	}
+
+	if targetsFile != "" {
+		contents, err := ioutil.ReadFile(targetsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read targets file %q: %v", targetsFile, err)
+		}
+		var fileTargets []deployer.ClusterTarget
+		if err := yaml.UnmarshalStrict(contents, &fileTargets); err != nil {
+			return nil, fmt.Errorf("failed to parse targets file %q: %v", targetsFile, err)
+		}
+		for _, t := range fileTargets {
+			if t.Name == "" || t.Location == "" {
+				return nil, fmt.Errorf("cluster %q with location %q in targets file %q must set both a name and a location", t.Name, t.Location, targetsFile)
+			}
+		}
+		targets = append(targets, fileTargets...)
+	}
+
+	seen := make(map[deployer.ClusterTarget]bool)
+	for _, t := range targets {
+		k := deployer.ClusterTarget{Name: t.Name, Location: t.Location}
+		if seen[k] {
+			return nil, fmt.Errorf("%s is listed more than once", t)
+		}
+		seen[k] = true
+	}
+	return targets, nil
+}
+
+// CreateSelector creates a label selector of deployed objects from an application name and a label
+// selector, either of which can be empty. If both are set, objects must match both.
+func CreateSelector(appName, selector string) string {
+	if appName == "" {
+		return selector
+	}
+	if selector == "" {
+		return deployer.AppSelector(appName)
+	}
+	return fmt.Sprintf("%s,%s", deployer.AppSelector(appName), selector)
+}
+
+// CreateDeployer creates a Deployer with initialized clients. kubernetesBackend is how requests are
+// sent to the Kubernetes API server, one of the services.KubernetesBackend* values.
+func CreateDeployer(ctx context.Context, useGcloud, verbose bool, serverDryRun bool, kubernetesBackend string) (*deployer.Deployer, error) {
+	c, err := services.NewClients(ctx, useGcloud, verbose, serverDryRun, kubernetesBackend)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize Clients: %v", err)
 	}
@@ -82,10 +332,37 @@ func CreateDeployer(ctx context.Context, useGcloud, verbose bool, serverDryRun b
 		Clients:      c,
 		UseGcloud:    useGcloud,
 		ServerDryRun: serverDryRun,
+		BuildID:      os.Getenv("BUILD_ID"),
+		NewClusterClients: func(ctx context.Context, kubeconfig string) (*services.Clients, error) {
+			return services.NewClientsWithKubeconfig(ctx, kubeconfig, useGcloud, verbose, serverDryRun, kubernetesBackend)
+		},
 	}
 	return d, nil
 }
 
+const (
+	// OutputFormatText is the default output format, which is human-readable.
+	OutputFormatText = "text"
+	// OutputFormatJSON is the output format that reports the progress of a deployment as one JSON
+	// event per line.
+	OutputFormatJSON = "json"
+)
+
+// SetOutputFormat sets how d reports the progress of a deployment. With the "json" format, events
+// are written to stdout as lines of JSON, and human-readable output is written to stderr instead,
+// so that stdout only has events.
+func SetOutputFormat(d *deployer.Deployer, format string) error {
+	switch format {
+	case OutputFormatText:
+	case OutputFormatJSON:
+		d.Events = event.NewJSONLines(os.Stdout)
+		d.Out = os.Stderr
+	default:
+		return fmt.Errorf("value of --output-format must be %q or %q, got %q", OutputFormatText, OutputFormatJSON, format)
+	}
+	return nil
+}
+
 // SuggestedOutputPath takes a root output directory and returns the path where
 // suggested configs should be stored.
 func SuggestedOutputPath(root string) string {
@@ -98,6 +375,21 @@ func ExpandedOutputPath(root string) string {
 	return join(root, "expanded")
 }
 
+// ExitError is an error that makes gke-deploy exit with a specific status code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
 // GcloudInPath returns true if the `gcloud` command is in this machine's PATH.
 func GcloudInPath() bool {
 	if _, err := exec.LookPath("gcloud"); err != nil {
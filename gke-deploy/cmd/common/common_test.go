@@ -1,10 +1,15 @@
 package common
 
 import (
+	"context"
+	"os"
 	"reflect"
 	"testing"
 
 	applicationsv1beta1 "github.com/kubernetes-sigs/application/pkg/apis/app/v1beta1"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/policy"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
 )
 
 func TestCreateApplicationLinksListFromEqualDelimitedStrings(t *testing.T) {
@@ -247,3 +252,455 @@ func TestCreateMapFromEqualDelimitedStringsErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateImageMappings(t *testing.T) {
+	tests := []struct {
+		name string
+
+		images     []string
+		imagesFile string
+
+		want []string
+	}{{
+		name: "No images",
+
+		want: nil,
+	}, {
+		name: "Images",
+
+		images: []string{
+			"gcr.io/my-project/my-app:1.0.0",
+			"gcr.io/my-project/my-worker@sha256:929665b8eb2bb286535d29cd73c71808d7e1ad830046333f6cf0ce497996eb79",
+		},
+
+		want: []string{
+			"gcr.io/my-project/my-app=gcr.io/my-project/my-app:1.0.0",
+			"gcr.io/my-project/my-worker=gcr.io/my-project/my-worker@sha256:929665b8eb2bb286535d29cd73c71808d7e1ad830046333f6cf0ce497996eb79",
+		},
+	}, {
+		name: "Images file",
+
+		imagesFile: "testing/images.yaml",
+
+		want: []string{
+			"gcr.io/my-project/my-worker=gcr.io/my-project/my-worker:1.0.0",
+			"index.docker.io/library/my-app=gcr.io/my-project/my-app:1.0.0",
+		},
+	}, {
+		name: "Images and images file",
+
+		images: []string{
+			"gcr.io/my-project/my-sidecar:1.0.0",
+		},
+		imagesFile: "testing/images.yaml",
+
+		want: []string{
+			"gcr.io/my-project/my-sidecar=gcr.io/my-project/my-sidecar:1.0.0",
+			"gcr.io/my-project/my-worker=gcr.io/my-project/my-worker:1.0.0",
+			"index.docker.io/library/my-app=gcr.io/my-project/my-app:1.0.0",
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mappings, err := CreateImageMappings(tc.images, tc.imagesFile)
+			if err != nil {
+				t.Fatalf("CreateImageMappings(%v, %s) = _, %v; want _, <nil>", tc.images, tc.imagesFile, err)
+			}
+			var got []string
+			for _, m := range mappings {
+				got = append(got, m.Name+"="+m.Ref.String())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("CreateImageMappings(%v, %s) = %v, <nil>; want %v, <nil>", tc.images, tc.imagesFile, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateImageMappingsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		images     []string
+		imagesFile string
+	}{{
+		name: "Invalid image",
+
+		images: []string{
+			"gcr.io/my-project/my-app:1.0.0!",
+		},
+	}, {
+		name: "Missing images file",
+
+		imagesFile: "testing/does-not-exist.yaml",
+	}, {
+		name: "Invalid image in images file",
+
+		imagesFile: "testing/images-invalid.yaml",
+	}, {
+		name: "Image set more than once",
+
+		images: []string{
+			"gcr.io/my-project/my-app:2.0.0",
+		},
+		imagesFile: "testing/images-duplicate.yaml",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := CreateImageMappings(tc.images, tc.imagesFile); got != nil || err == nil {
+				t.Errorf("CreateImageMappings(%v, %s) = %v, %v; want <nil>, err", tc.images, tc.imagesFile, got, err)
+			}
+		})
+	}
+}
+
+func TestCreatePodTemplatePaths(t *testing.T) {
+	paths, err := CreatePodTemplatePaths("testing/pod-template-paths.yaml")
+	if err != nil {
+		t.Errorf("CreatePodTemplatePaths(testing/pod-template-paths.yaml) = _, %v; want _, <nil>", err)
+	}
+	if len(paths) == 0 {
+		t.Errorf("CreatePodTemplatePaths(testing/pod-template-paths.yaml) = %v, _; want non-empty paths", paths)
+	}
+	if paths, err := CreatePodTemplatePaths(""); paths != nil || err != nil {
+		t.Errorf("CreatePodTemplatePaths(\"\") = %v, %v; want <nil>, <nil>", paths, err)
+	}
+	if _, err := CreatePodTemplatePaths("testing/does-not-exist.yaml"); err == nil {
+		t.Errorf("CreatePodTemplatePaths(testing/does-not-exist.yaml) = _, <nil>; want _, error")
+	}
+	if _, err := CreatePodTemplatePaths("testing/images.yaml"); err == nil {
+		t.Errorf("CreatePodTemplatePaths(testing/images.yaml) = _, <nil>; want _, error")
+	}
+}
+
+func TestCreateVariables(t *testing.T) {
+	for k, v := range map[string]string{
+		"SHORT_SHA":   "abc1234",
+		"BRANCH_NAME": "master",
+		"_REGION":     "us-central1",
+	} {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		vars     []string
+		varsFile string
+
+		want map[string]string
+	}{{
+		name: "Substitutions",
+
+		// User-defined substitutions in the environment are not used unless they are set with
+		// --var or --vars-file.
+		want: map[string]string{
+			"SHORT_SHA":   "abc1234",
+			"BRANCH_NAME": "master",
+		},
+	}, {
+		name: "Vars file overrides substitutions",
+
+		varsFile: "testing/vars.yaml",
+
+		want: map[string]string{
+			"SHORT_SHA":   "abc1234",
+			"BRANCH_NAME": "release",
+			"REPLICAS":    "3",
+			"ENVIRONMENT": "staging",
+		},
+	}, {
+		name: "Vars override vars file",
+
+		vars: []string{
+			"ENVIRONMENT=production",
+			"_REGION=europe-west1",
+		},
+		varsFile: "testing/vars.yaml",
+
+		want: map[string]string{
+			"SHORT_SHA":   "abc1234",
+			"BRANCH_NAME": "release",
+			"_REGION":     "europe-west1",
+			"REPLICAS":    "3",
+			"ENVIRONMENT": "production",
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CreateVariables(tc.vars, tc.varsFile, true)
+			if err != nil {
+				t.Fatalf("CreateVariables(%v, %s, true) = _, %v; want _, <nil>", tc.vars, tc.varsFile, err)
+			}
+			if !got.Strict {
+				t.Errorf("CreateVariables(%v, %s, true) returned non-strict variables", tc.vars, tc.varsFile)
+			}
+			for k, v := range tc.want {
+				if got.Values[k] != v {
+					t.Errorf("CreateVariables(%v, %s, true) has value %q for %s; want %q", tc.vars, tc.varsFile, got.Values[k], k, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateVariablesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		vars     []string
+		varsFile string
+	}{{
+		name: "Invalid var",
+
+		vars: []string{
+			"ENVIRONMENT",
+		},
+	}, {
+		name: "Missing vars file",
+
+		varsFile: "testing/does-not-exist.yaml",
+	}, {
+		name: "Invalid vars file",
+
+		varsFile: "testing/vars-invalid.yaml",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := CreateVariables(tc.vars, tc.varsFile, false); got != nil || err == nil {
+				t.Errorf("CreateVariables(%v, %s, false) = %v, %v; want <nil>, err", tc.vars, tc.varsFile, got, err)
+			}
+		})
+	}
+}
+
+func TestCreatePolicy(t *testing.T) {
+	if got, err := CreatePolicy(""); err != nil || !reflect.DeepEqual(got, policy.DefaultPolicy()) {
+		t.Errorf("CreatePolicy(\"\") = %v, %v; want %v, <nil>", got, err, policy.DefaultPolicy())
+	}
+	if _, err := CreatePolicy("testing/policy.yaml"); err != nil {
+		t.Errorf("CreatePolicy(testing/policy.yaml) = _, %v; want _, <nil>", err)
+	}
+	if got, err := CreatePolicy("testing/does-not-exist.yaml"); got != nil || err == nil {
+		t.Errorf("CreatePolicy(testing/does-not-exist.yaml) = %v, %v; want <nil>, error", got, err)
+	}
+	if got, err := CreatePolicy("testing/images.yaml"); got != nil || err == nil {
+		t.Errorf("CreatePolicy(testing/images.yaml) = %v, %v; want <nil>, error", got, err)
+	}
+}
+
+func TestCreateValidator(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		openAPISchemaFile string
+		crdFiles          []string
+
+		wantErr bool
+	}{{
+		name: "No schemas",
+	}, {
+		name: "OpenAPI schema and CustomResourceDefinitions",
+
+		openAPISchemaFile: "testing/swagger.json",
+		crdFiles:          []string{"testing/crd.yaml"},
+	}, {
+		name: "Missing OpenAPI schema file",
+
+		openAPISchemaFile: "testing/does-not-exist.json",
+
+		wantErr: true,
+	}, {
+		name: "Invalid OpenAPI schema file",
+
+		openAPISchemaFile: "testing/images.yaml",
+
+		wantErr: true,
+	}, {
+		name: "Missing CustomResourceDefinition file",
+
+		crdFiles: []string{"testing/does-not-exist.yaml"},
+
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CreateValidator(ctx, tc.openAPISchemaFile, tc.crdFiles)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("CreateValidator(ctx, %s, %v) = %v, %v; want error %t", tc.openAPISchemaFile, tc.crdFiles, got, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateClusterTargets(t *testing.T) {
+	tests := []struct {
+		name string
+
+		clusters    []string
+		locations   []string
+		targetsFile string
+
+		want []deployer.ClusterTarget
+	}{{
+		name: "No clusters",
+	}, {
+		name: "Clusters and locations",
+
+		clusters:  []string{"staging", "prod"},
+		locations: []string{"us-east1-b", "us-central1"},
+
+		want: []deployer.ClusterTarget{{
+			Name:     "staging",
+			Location: "us-east1-b",
+		}, {
+			Name:     "prod",
+			Location: "us-central1",
+		}},
+	}, {
+		name: "Clusters and targets file",
+
+		clusters:    []string{"staging"},
+		locations:   []string{"us-east1-b"},
+		targetsFile: "testing/targets.yaml",
+
+		want: []deployer.ClusterTarget{{
+			Name:     "staging",
+			Location: "us-east1-b",
+		}, {
+			Name:     "prod-us",
+			Location: "us-central1",
+		}, {
+			Name:     "prod-eu",
+			Location: "europe-west1",
+			Project:  "my-eu-project",
+		}},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CreateClusterTargets(tc.clusters, tc.locations, tc.targetsFile)
+			if err != nil {
+				t.Fatalf("CreateClusterTargets(%v, %v, %s) = _, %v; want _, <nil>", tc.clusters, tc.locations, tc.targetsFile, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("CreateClusterTargets(%v, %v, %s) = %v; want %v", tc.clusters, tc.locations, tc.targetsFile, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateClusterTargetsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		clusters    []string
+		locations   []string
+		targetsFile string
+	}{{
+		name: "Mismatched clusters and locations",
+
+		clusters:  []string{"staging", "prod"},
+		locations: []string{"us-east1-b"},
+	}, {
+		name: "Empty location",
+
+		clusters:  []string{"staging"},
+		locations: []string{""},
+	}, {
+		name: "Duplicate clusters",
+
+		clusters:  []string{"staging", "staging"},
+		locations: []string{"us-east1-b", "us-east1-b"},
+	}, {
+		name: "Missing targets file",
+
+		targetsFile: "testing/does-not-exist.yaml",
+	}, {
+		name: "Invalid targets file",
+
+		targetsFile: "testing/targets-invalid.yaml",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := CreateClusterTargets(tc.clusters, tc.locations, tc.targetsFile); got != nil || err == nil {
+				t.Errorf("CreateClusterTargets(%v, %v, %s) = %v, %v; want <nil>, error", tc.clusters, tc.locations, tc.targetsFile, got, err)
+			}
+		})
+	}
+}
+
+func TestSetOutputFormat(t *testing.T) {
+	stdout := os.Stdout
+
+	d := &deployer.Deployer{}
+	if err := SetOutputFormat(d, OutputFormatText); err != nil || d.Events != nil || d.Out != nil {
+		t.Errorf("SetOutputFormat(d, %s) = %v and set events %v and output %v; want <nil> and no events and default output", OutputFormatText, err, d.Events, d.Out)
+	}
+	if err := SetOutputFormat(d, OutputFormatJSON); err != nil || d.Events == nil {
+		t.Errorf("SetOutputFormat(d, %s) = %v and set events %v; want <nil> and events", OutputFormatJSON, err, d.Events)
+	}
+	if d.Out != os.Stderr {
+		t.Errorf("SetOutputFormat(d, %s) did not write human-readable output to stderr", OutputFormatJSON)
+	}
+	if os.Stdout != stdout {
+		t.Errorf("SetOutputFormat(d, %s) changed os.Stdout; want it unchanged", OutputFormatJSON)
+	}
+	if err := SetOutputFormat(d, "yaml"); err == nil {
+		t.Errorf("SetOutputFormat(d, yaml) = <nil>; want error")
+	}
+}
+
+func TestCreateSelector(t *testing.T) {
+	tests := []struct {
+		name string
+
+		appName  string
+		selector string
+
+		want string
+	}{{
+		name: "No app name or selector",
+	}, {
+		name: "App name",
+
+		appName: "test-app",
+
+		want: "app.kubernetes.io/name=test-app",
+	}, {
+		name: "Selector",
+
+		selector: "tier=frontend",
+
+		want: "tier=frontend",
+	}, {
+		name: "App name and selector",
+
+		appName:  "test-app",
+		selector: "tier=frontend",
+
+		want: "app.kubernetes.io/name=test-app,tier=frontend",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CreateSelector(tc.appName, tc.selector); got != tc.want {
+				t.Errorf("CreateSelector(%q, %q) = %q; want %q", tc.appName, tc.selector, got, tc.want)
+			}
+		})
+	}
+}
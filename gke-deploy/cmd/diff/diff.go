@@ -0,0 +1,112 @@
+// Package diff contains the logic for `gke-deploy diff` subcommand.
+package diff
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	// exitDifferences is the exit status when configuration files differ from deployed objects.
+	exitDifferences = 1
+	// exitFailure is the exit status when the diff fails.
+	exitFailure = 2
+)
+
+const (
+	short = "Show differences between configuration files and deployed objects"
+	long  = `Show differences between Kubernetes configuration files and the objects deployed to the target cluster.
+
+- Get the deployed state of each object in the Kubernetes configuration files from the target cluster.
+- Print a unified diff for each object that differs from its deployed state. Fields populated by the server (e.g., status, resourceVersion, uid, managedFields) and fields not set in the configuration files are ignored.
+- Exit with status 1 if any object differs from its deployed state or is not deployed, and with status 2 if the diff fails, like "kubectl diff".
+`
+	example = `  # Show differences between expanded configuration files and deployed objects.
+  gke-deploy diff -f expanded -c my-cluster -l us-east1-b
+
+  # Review changes before applying.
+  gke-deploy prepare -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o expanded -n my-namespace
+  gke-deploy diff -f expanded -n my-namespace -c my-cluster -l us-east1-b`
+)
+
+type options struct {
+	filename          string
+	clusterLocation   string
+	clusterName       string
+	clusterProject    string
+	namespace         string
+	verbose           bool
+	kubernetesBackend string
+	recursive         bool
+}
+
+// NewDiffCommand creates the `gke-deploy diff` subcommand.
+func NewDiffCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "diff",
+		Aliases: []string{"d"},
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			changed, err := diff(cmd, options)
+			if err != nil {
+				return &common.ExitError{Code: exitFailure, Err: err}
+			}
+			if changed {
+				return &common.ExitError{Code: exitDifferences, Err: fmt.Errorf("configuration files differ from deployed objects")}
+			}
+			return nil
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to compare with deployed Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). If this path is a kustomization file or a directory with a kustomization file (e.g., \"kustomization.yaml\"), the kustomization is built and its output is used. Prefix this value with \"gs://\" to indicate a GCS path.")
+	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster to compare with.")
+	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster to compare with.")
+	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster to compare with. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of GKE cluster to compare with. If omitted, the namespace(s) specified in each Kubernetes configuration file is used.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
+	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", false, "Recursively search through the provided path in --filename for all YAML files.")
+
+	return cmd
+}
+
+func diff(_ *cobra.Command, options *options) (bool, error) {
+	ctx := context.Background()
+
+	if options.filename == "" {
+		return false, fmt.Errorf("required -f|--filename flag is not set")
+	}
+	if options.clusterName != "" && options.clusterLocation == "" {
+		return false, fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
+	}
+	if options.clusterLocation != "" && options.clusterName == "" {
+		return false, fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
+	}
+
+	useGcloud := common.GcloudInPath()
+	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+		return false, fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
+	}
+
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, false, options.kubernetesBackend)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := d.Diff(ctx, options.clusterName, options.clusterLocation, options.clusterProject, options.filename, options.namespace, options.recursive)
+	if err != nil {
+		return false, fmt.Errorf("failed to diff deployment: %v", err)
+	}
+
+	return changed, nil
+}
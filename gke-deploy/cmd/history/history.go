@@ -0,0 +1,92 @@
+// Package history contains the logic for `gke-deploy history` subcommand.
+package history
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	short = "List the releases of an application"
+	long  = `List the releases of an application deployed by gke-deploy to the target cluster.
+
+- Get the releases of the application provided by [--app|-a] in the provided namespace. A release is recorded each time the application is applied, unless [--record-release=false] is set.
+- Print the revision, deploy time, version, build ID, description, and images of each release, from oldest to newest.
+`
+	example = `  # List the releases of an application.
+  gke-deploy history -a my-app -n my-namespace -c my-cluster -l us-east1-b
+
+  # Roll back to the release before the latest one.
+  gke-deploy rollback -a my-app -n my-namespace -c my-cluster -l us-east1-b`
+)
+
+type options struct {
+	appName           string
+	clusterLocation   string
+	clusterName       string
+	clusterProject    string
+	namespace         string
+	verbose           bool
+	kubernetesBackend string
+}
+
+// NewHistoryCommand creates the `gke-deploy history` subcommand.
+func NewHistoryCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "history",
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return history(cmd, options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name to list the releases of.")
+	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster the application is deployed to.")
+	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster the application is deployed to.")
+	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster the application is deployed to. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace the releases of the application are recorded in. If omitted, the current context's namespace is used.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
+
+	return cmd
+}
+
+func history(_ *cobra.Command, options *options) error {
+	ctx := context.Background()
+
+	if options.appName == "" {
+		return fmt.Errorf("required -a|--app flag is not set")
+	}
+	if options.clusterName != "" && options.clusterLocation == "" {
+		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
+	}
+	if options.clusterLocation != "" && options.clusterName == "" {
+		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
+	}
+
+	useGcloud := common.GcloudInPath()
+	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
+	}
+
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, false, options.kubernetesBackend)
+	if err != nil {
+		return err
+	}
+
+	if err := d.History(ctx, options.clusterName, options.clusterLocation, options.clusterProject, options.appName, options.namespace); err != nil {
+		return fmt.Errorf("failed to list releases: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+// Package lint contains the logic for `gke-deploy lint` subcommand.
+package lint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	short = "Check configuration files against policy rules"
+	long  = `Check Kubernetes configuration files against policy rules, without deploying them.
+
+- Check the pod templates of Kubernetes configuration files against policy rules:
+  - resource-requests (warning): Containers must set resource requests.
+  - resource-limits (warning): Containers must set resource limits.
+  - image-digest (warning): Container images must be pinned to a digest.
+  - no-latest-tag (error): Container images must not use the latest tag.
+  - no-host-network (error): Pods must not use the host's network.
+  - no-privileged (error): Containers must not be privileged.
+  - liveness-probe (warning): Containers must set a liveness probe, except in Jobs and CronJobs.
+  - readiness-probe (warning): Containers must set a readiness probe, except in Jobs and CronJobs.
+- Use the severity of rules set in [--policy-file], if provided. Rules have "error", "warning", or "ignore" severity.
+- Save a JSON report of violations to [--report], if provided.
+- Exit with a non-zero status if any violation with error severity is found.
+`
+	example = `  # Check configuration files against the default policy.
+  gke-deploy lint -f configs
+
+  # Check expanded configuration files against a policy file, and save a report.
+  gke-deploy prepare -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o output
+  gke-deploy lint -f output/expanded --policy-file policy.yaml --report policy-report.json`
+)
+
+type options struct {
+	filename   string
+	policyFile string
+	report     string
+	verbose    bool
+	recursive  bool
+}
+
+// NewLintCommand creates the `gke-deploy lint` subcommand.
+func NewLintCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "lint",
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return lint(cmd, options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to check (file or files in directory must end in \".yml\" or \".yaml\"). If this path is a kustomization file or a directory with a kustomization file (e.g., \"kustomization.yaml\"), the kustomization is built and its output is used. Prefix this value with \"gs://\" to indicate a GCS path.")
+	cmd.Flags().StringVar(&options.policyFile, "policy-file", "", "Path to a YAML file that sets the severity (\"error\", \"warning\", or \"ignore\") of policy rules. Rules that are not listed keep their default severity.")
+	cmd.Flags().StringVar(&options.report, "report", "", "Path to a file to save a JSON report of policy violations to.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", false, "Recursively search through the provided path in --filename for all YAML files.")
+
+	return cmd
+}
+
+func lint(_ *cobra.Command, options *options) error {
+	ctx := context.Background()
+
+	if options.filename == "" {
+		return fmt.Errorf("required -f|--filename flag is not set")
+	}
+
+	p, err := common.CreatePolicy(options.policyFile)
+	if err != nil {
+		return err
+	}
+
+	d, err := common.CreateDeployer(ctx, false /* useGcloud */, options.verbose, false /* serverDryRun */, services.KubernetesBackendAuto)
+	if err != nil {
+		return err
+	}
+	d.Policy = p
+
+	report, err := d.Lint(ctx, options.filename, options.report, options.recursive)
+	if err != nil {
+		return fmt.Errorf("failed to lint configuration files: %v", err)
+	}
+	if report.Errors > 0 {
+		return fmt.Errorf("found %d policy violation(s) with error severity", report.Errors)
+	}
+
+	return nil
+}
@@ -5,48 +5,74 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/spf13/cobra"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
 
 const (
 	short = "Execute prepare phase and skip apply phase"
 	long  = `Prepare to deploy to GKE by generating expanded Kubernetes configuration files. Skip apply.
 
+- Substitute ${VAR} placeholders in Kubernetes configuration files with the values of [--var], [--vars-file], and Cloud Build substitutions, if [--expand-vars], [--var], or [--vars-file] is set.
+- Validate Kubernetes configuration files against the schemas in [--openapi-schema] and [--crd-schemas], if provided.
 - Expand Kubernetes configuration files to:
-  - Set the digest of images that match the [--image|-i] flag, if provided.
+  - Set the digest of images that match the [--image|-i] or [--images-file] flags, if provided.
+  - Set the digest of all other container images, including init containers, if [--pin-all-images] is set.
   - Add app.kubernetes.io/name=[--app|-a] label, if provided.
   - Add app.kubernetes.io/version=[--version|-v] label, if provided.
+- Check expanded Kubernetes configuration files against policy rules, if [--check-policy] or [--policy-file] is set. Violations with error severity fail preparation, unless [--allow-policy-violations] is set.
 `
 	example = `  # Prepare only.
   gke-deploy prepare -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o expanded -n my-namespace
 
+  # Prepare with multiple images, mapping image names in configuration files to images to be deployed.
+  gke-deploy prepare -f configs -i gcr.io/my-project/my-worker:1.0.0 --images-file images.yaml -a my-app -v 1.0.0
+
   # Execute prepare and apply, with an intermediary step in between (e.g., manually check expanded YAMLs)
   gke-deploy prepare -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o expanded -n my-namespace
   cat expanded/*
   gke-deploy apply -f expanded -c my-cluster -n my-namespace -c my-cluster -l us-east1-b  # Pass expanded directory to -f
 
-  # Pipe output from another templating engine to gke-deploy prepare.
-  kustomize build overlays/staging | gke-deploy prepare -f - -a my-app
-  helm template charts/prometheus | gke-deploy prepare -f - -a prometheus`
+  # Build a kustomization and prepare its output.
+  gke-deploy prepare -f overlays/staging -a my-app
+
+  # Render a Helm chart and prepare its output.
+  gke-deploy prepare --chart charts/prometheus --values values.yaml -a prometheus`
 )
 
 type options struct {
-	appName             string
-	appVersion          string
-	filename            string
-	image               string
-	labels              []string
-	annotations         []string
-	namespace           string
-	output              string
-	exposePort          int
-	createApplicationCR bool
-	applicationLinks    []string
-	verbose             bool
-	recursive           bool
+	appName               string
+	appVersion            string
+	filename              string
+	chart                 string
+	chartValues           []string
+	chartSetValues        []string
+	images                []string
+	imagesFile            string
+	pinAllImages          bool
+	pinImagesPolicy       string
+	podTemplatePaths      string
+	vars                  []string
+	varsFile              string
+	expandVars            bool
+	strictVars            bool
+	checkPolicy           bool
+	policyFile            string
+	allowPolicyViolations bool
+	openAPISchema         string
+	crdSchemas            []string
+	labels                []string
+	annotations           []string
+	namespace             string
+	output                string
+	exposePort            int
+	createApplicationCR   bool
+	applicationLinks      []string
+	verbose               bool
+	recursive             bool
 }
 
 // NewPrepareCommand creates the `gke-deploy prepare` subcommand.
@@ -67,8 +93,24 @@ func NewPrepareCommand() *cobra.Command {
 
 	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name of the Kubernetes deployment.")
 	cmd.Flags().StringVarP(&options.appVersion, "version", "v", "", "Version of the Kubernetes deployment.")
-	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). Prefix this value with \"gs://\" to indicate a GCS path. If this field is not provided, a Deployment (with image provided by --image) and a HorizontalPodAutoscaler are created as suggested based configs. The application's name is inferred from the image name's suffix.")
-	cmd.Flags().StringVarP(&options.image, "image", "i", "", "Image to be deployed.")
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). If this path is a kustomization file or a directory with a kustomization file (e.g., \"kustomization.yaml\"), the kustomization is built and its output is used. Prefix this value with \"gs://\" to indicate a GCS path. If this field is not provided, a Deployment (with image provided by --image) and a HorizontalPodAutoscaler are created as suggested based configs. The application's name is inferred from the image name's suffix.")
+	cmd.Flags().StringVar(&options.chart, "chart", "", "Path to a local Helm chart directory or packaged chart (.tgz) to render Kubernetes configuration files from, instead of --filename. The chart is rendered in-process like \"helm template\", so helm does not need to be installed, with the name provided by --app as the release name.")
+	cmd.Flags().StringSliceVar(&options.chartValues, "values", nil, "Path(s) to YAML files with values for the chart provided by --chart. Values files can be set comma-delimited or as separate flags.")
+	cmd.Flags().StringArrayVar(&options.chartSetValues, "set", nil, "Value(s) for the chart provided by --chart (key=value), in the format of \"helm --set\". Can be set as separate flags.")
+	cmd.Flags().StringSliceVarP(&options.images, "image", "i", nil, "Image(s) to be deployed. Images can be set comma-delimited or as separate flags. Containers with images of the same name are set to each image's digest.")
+	cmd.Flags().StringVar(&options.imagesFile, "images-file", "", "Path to a YAML file that maps names of images in Kubernetes configuration files to images to be deployed (e.g., \"my-app: gcr.io/my-project/my-app:1.0.0\"). Containers with images of a mapped name are set to the digest of the image it maps to.")
+	cmd.Flags().BoolVar(&options.pinAllImages, "pin-all-images", false, "Set the image of every container, init container, and ephemeral container that is not already pinned to a digest to its digest.")
+	cmd.Flags().StringVar(&options.pinImagesPolicy, "pin-images-policy", "", "What to do when the digest of an image cannot be resolved with --pin-all-images: \"fail\" (default), \"warn\", or \"skip\". Requires --pin-all-images.")
+	cmd.Flags().StringVar(&options.podTemplatePaths, "pod-template-paths", "", "Path to a YAML file that lists the group, kind, and dot-delimited path of the pod template (e.g., \"spec.template\") of custom resources, so that their container images and labels are updated like those of Deployments.")
+	cmd.Flags().StringArrayVar(&options.vars, "var", nil, "Variable(s) to substitute for ${VAR} placeholders in Kubernetes configuration files (VAR=value). Can be set as separate flags. Overrides values from --vars-file and Cloud Build substitutions.")
+	cmd.Flags().StringVar(&options.varsFile, "vars-file", "", "Path to a YAML file that maps names of variables to values to substitute for ${VAR} placeholders in Kubernetes configuration files. Overrides values from Cloud Build substitutions.")
+	cmd.Flags().BoolVar(&options.expandVars, "expand-vars", false, "Substitute ${VAR} placeholders in string values of Kubernetes configuration files with the values of built-in Cloud Build substitutions set as environment variables (e.g., $SHORT_SHA and $BRANCH_NAME). User-defined substitutions must be set with --var or --vars-file. Implied by --var and --vars-file. Use $${VAR} to leave a placeholder as is.")
+	cmd.Flags().BoolVar(&options.strictVars, "strict-vars", false, "Fail if a ${VAR} placeholder in Kubernetes configuration files has no value, instead of leaving it as is. Requires --expand-vars, --var, or --vars-file.")
+	cmd.Flags().BoolVar(&options.checkPolicy, "check-policy", false, "Check expanded Kubernetes configuration files against policy rules (e.g., no privileged containers, no images with the latest tag) and save a report to \"<output>/expanded/policy-report.json\". Violations with error severity fail the deployment. Implied by --policy-file.")
+	cmd.Flags().StringVar(&options.policyFile, "policy-file", "", "Path to a YAML file that sets the severity (\"error\", \"warning\", or \"ignore\") of policy rules to check expanded Kubernetes configuration files against. Rules that are not listed keep their default severity.")
+	cmd.Flags().BoolVar(&options.allowPolicyViolations, "allow-policy-violations", false, "Do not fail the deployment if policy violations with error severity are found. Requires --check-policy or --policy-file.")
+	cmd.Flags().StringVar(&options.openAPISchema, "openapi-schema", "", "Path to an OpenAPI v2 schema file of the target Kubernetes version (e.g., the api/openapi-spec/swagger.json file of a Kubernetes release, or the output of \"kubectl get --raw /openapi/v2\") to validate Kubernetes configuration files against before they are expanded. Unknown fields, fields of the wrong type, and missing required fields fail preparation.")
+	cmd.Flags().StringSliceVar(&options.crdSchemas, "crd-schemas", nil, "Path(s) to CustomResourceDefinition files or directories of files whose schemas custom resources in Kubernetes configuration files are validated against. Paths can be set comma-delimited or as separate flags.")
 	cmd.Flags().StringSliceVarP(&options.labels, "label", "L", nil, "Label(s) to add to Kubernetes objects (k1=v1). Labels can be set comma-delimited or as separate flags. If two or more labels with the same key are listed, the last one is used.")
 	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of GKE cluster to deploy to. Creates a namespace Kubernetes configuration file to reflect this and updates the namespace field of each supplied Kubernetes configuration file.")
 	cmd.Flags().StringSliceVarP(&options.annotations, "annotation", "A", nil, "Annotation(s) to add to Kubernetes configuration files (k1=v1). Annotations can be set comma-delimited or as separate flags. If two or more annotations with the same key are listed, the last one is used.")
@@ -85,21 +127,52 @@ func NewPrepareCommand() *cobra.Command {
 func prepare(_ *cobra.Command, options *options) error {
 	ctx := context.Background()
 
-	var im name.Reference
-	if options.image != "" {
-		ref, err := name.ParseReference(options.image)
-		if err != nil {
-			return err
-		}
-		im = ref
+	images, err := common.CreateImageMappings(options.images, options.imagesFile)
+	if err != nil {
+		return err
+	}
+	podTemplatePaths, err := common.CreatePodTemplatePaths(options.podTemplatePaths)
+	if err != nil {
+		return err
 	}
 
-	if options.filename == "" && options.image == "" {
+	if options.filename != "" && options.chart != "" {
+		return fmt.Errorf("-f|--filename and --chart cannot both be set")
+	}
+	if options.filename == "" && options.chart == "" && len(images) == 0 {
 		return fmt.Errorf("omitting -f|--filename requires -i|--image to be set")
 	}
+	if options.filename == "" && options.chart == "" && len(images) > 1 {
+		return fmt.Errorf("omitting -f|--filename requires only one image to be set")
+	}
+	if options.chart != "" && options.appName == "" {
+		return fmt.Errorf("rendering a chart requires -a|--app to be set")
+	}
+	if len(options.chartValues) > 0 && options.chart == "" {
+		return fmt.Errorf("you must set --chart flag because --values flag is set")
+	}
+	if len(options.chartSetValues) > 0 && options.chart == "" {
+		return fmt.Errorf("you must set --chart flag because --set flag is set")
+	}
 	if options.output == "" {
 		return fmt.Errorf("value of -o|--output cannot be empty")
 	}
+	expandVars := options.expandVars || len(options.vars) > 0 || options.varsFile != ""
+	if options.strictVars && !expandVars {
+		return fmt.Errorf("you must set --expand-vars, --var, or --vars-file flag because --strict-vars flag is set")
+	}
+	checkPolicy := options.checkPolicy || options.policyFile != ""
+	if options.allowPolicyViolations && !checkPolicy {
+		return fmt.Errorf("you must set --check-policy or --policy-file flag because --allow-policy-violations flag is set")
+	}
+	if options.pinImagesPolicy != "" && !options.pinAllImages {
+		return fmt.Errorf("you must set --pin-all-images flag because --pin-images-policy flag is set")
+	}
+	switch options.pinImagesPolicy {
+	case "", deployer.PinImagesPolicyFail, deployer.PinImagesPolicyWarn, deployer.PinImagesPolicySkip:
+	default:
+		return fmt.Errorf("value of --pin-images-policy must be one of %q, %q, or %q", deployer.PinImagesPolicyFail, deployer.PinImagesPolicyWarn, deployer.PinImagesPolicySkip)
+	}
 
 	if options.exposePort < 0 {
 		return fmt.Errorf("value of -x|--expose must be > 0")
@@ -124,12 +197,45 @@ func prepare(_ *cobra.Command, options *options) error {
 	if err != nil {
 		return err
 	}
-	d, err := common.CreateDeployer(ctx, false /* useGcloud */, options.verbose, false /* serverDryRun */)
+	d, err := common.CreateDeployer(ctx, false /* useGcloud */, options.verbose, false /* serverDryRun */, services.KubernetesBackendAuto)
 	if err != nil {
 		return err
 	}
+	if expandVars {
+		vars, err := common.CreateVariables(options.vars, options.varsFile, options.strictVars)
+		if err != nil {
+			return err
+		}
+		d.Variables = vars
+	}
+	if checkPolicy {
+		p, err := common.CreatePolicy(options.policyFile)
+		if err != nil {
+			return err
+		}
+		d.CheckPolicy = true
+		d.Policy = p
+		d.AllowPolicyViolations = options.allowPolicyViolations
+	}
+	if options.openAPISchema != "" || len(options.crdSchemas) > 0 {
+		v, err := common.CreateValidator(ctx, options.openAPISchema, options.crdSchemas)
+		if err != nil {
+			return err
+		}
+		d.Validator = v
+	}
+	d.PodTemplatePaths = podTemplatePaths
+	d.PinAllImages = options.pinAllImages
+	d.PinImagesPolicy = options.pinImagesPolicy
+	if options.chart != "" {
+		d.Chart = &deployer.Chart{
+			Path:        options.chart,
+			ValuesFiles: options.chartValues,
+			SetValues:   options.chartSetValues,
+		}
+	}
 
-	if err := d.Prepare(ctx, im, options.appName, options.appVersion, options.filename, common.SuggestedOutputPath(options.output), common.ExpandedOutputPath(options.output), options.namespace, labelsMap, annotationsMap, options.exposePort, options.recursive, options.createApplicationCR, applicationLinks); err != nil {
+	if err := d.Prepare(ctx, images, options.appName, options.appVersion, options.filename, common.SuggestedOutputPath(options.output), common.ExpandedOutputPath(options.output), options.namespace, labelsMap, annotationsMap, options.exposePort, options.recursive, options.createApplicationCR, applicationLinks); err != nil {
 		return fmt.Errorf("failed to prepare deployment: %v", err)
 	}
 
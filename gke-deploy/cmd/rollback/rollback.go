@@ -0,0 +1,115 @@
+// Package rollback contains the logic for `gke-deploy rollback` subcommand.
+package rollback
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	short = "Redeploy an earlier release of an application"
+	long  = `Redeploy an earlier release of an application deployed by gke-deploy to the target cluster.
+
+- Get the release of the application provided by [--app|-a] with the revision provided by [--to], or the release before the latest one if [--to] is not set. Use "gke-deploy history" to list releases.
+- Wait for other deployments of the application to the same namespace to finish.
+- Apply the Kubernetes configuration files of the release to the target cluster, in the namespaces they were deployed to.
+- Wait for deployed Kubernetes configuration files to be ready before exiting.
+- Record a new release, so that the rollback can be rolled back too.
+`
+	example = `  # Roll back to the release before the latest one.
+  gke-deploy rollback -a my-app -n my-namespace -c my-cluster -l us-east1-b
+
+  # Roll back to revision 3.
+  gke-deploy history -a my-app -n my-namespace -c my-cluster -l us-east1-b
+  gke-deploy rollback -a my-app -n my-namespace -c my-cluster -l us-east1-b --to 3`
+)
+
+type options struct {
+	appName           string
+	revision          int
+	clusterLocation   string
+	clusterName       string
+	clusterProject    string
+	namespace         string
+	verbose           bool
+	kubernetesBackend string
+	waitTimeout       time.Duration
+	historyMax        int
+}
+
+// NewRollbackCommand creates the `gke-deploy rollback` subcommand.
+func NewRollbackCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "rollback",
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return rollback(cmd, options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name to roll back.")
+	cmd.Flags().IntVar(&options.revision, "to", 0, "Revision of the release to roll back to. If omitted, the release before the latest one is used.")
+	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster the application is deployed to.")
+	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster the application is deployed to.")
+	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster the application is deployed to. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace the releases of the application are recorded in. If omitted, the current context's namespace is used.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
+	cmd.Flags().DurationVarP(&options.waitTimeout, "timeout", "t", 5*time.Minute, "Timeout limit for waiting for Kubernetes objects to finish applying.")
+	cmd.Flags().IntVar(&options.historyMax, "history-max", deployer.DefaultReleaseHistoryMax, "Number of releases of the application to keep in the cluster. Older releases are deleted. Use 0 for no limit.")
+
+	return cmd
+}
+
+func rollback(_ *cobra.Command, options *options) error {
+	ctx := context.Background()
+
+	if options.appName == "" {
+		return fmt.Errorf("required -a|--app flag is not set")
+	}
+	if options.revision < 0 {
+		return fmt.Errorf("value of --to must be > 0")
+	}
+	if options.historyMax < 0 {
+		return fmt.Errorf("value of --history-max must be >= 0")
+	}
+	if options.clusterName != "" && options.clusterLocation == "" {
+		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
+	}
+	if options.clusterLocation != "" && options.clusterName == "" {
+		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
+	}
+
+	useGcloud := common.GcloudInPath()
+	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
+	}
+
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, false, options.kubernetesBackend)
+	if err != nil {
+		return err
+	}
+	d.RecordRelease = true
+	d.ReleaseHistoryMax = options.historyMax
+	d.Lock = true
+	d.LockTimeout = deployer.DefaultLockTimeout
+	d.LockDuration = deployer.DefaultLockDuration
+
+	if err := d.RollbackToRevision(ctx, options.clusterName, options.clusterLocation, options.clusterProject, options.appName, options.namespace, options.revision, options.waitTimeout); err != nil {
+		return fmt.Errorf("failed to roll back deployment: %v", err)
+	}
+
+	return nil
+}
@@ -5,8 +5,14 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/apply"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/diff"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/history"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/lint"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/prepare"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/rollback"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/run"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/status"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/wait"
 )
 
 const (
@@ -14,14 +20,28 @@ const (
 	long  = `Deploy to GKE in two phases, which will do the following:
 
 Prepare Phase:
+  - Render Kubernetes configuration files from the Helm chart provided by [--chart], if set, using [--app|-a] as the release name.
+  - Substitute ${VAR} placeholders in Kubernetes configuration files with the values of [--var], [--vars-file], and Cloud Build substitutions, if [--expand-vars], [--var], or [--vars-file] is set.
+  - Validate Kubernetes configuration files against the schemas in [--openapi-schema] and [--crd-schemas], if provided.
   - Expand Kubernetes configuration files:
-    - Set the digest of images that match the [--image|-i] flag, if provided.
+    - Set the digest of images that match the [--image|-i] or [--images-file] flags, if provided.
+    - Set the digest of all other container images, including init containers, if [--pin-all-images] is set.
     - Add app.kubernetes.io/name=[--app|-a] label, if provided.
     - Add app.kubernetes.io/version=[--version|-v] label, if provided.
+  - Check expanded Kubernetes configuration files against policy rules, if [--check-policy] or [--policy-file] is set. Violations with error severity block the apply phase, unless [--allow-policy-violations] is set.
 
 Apply Phase:
   - Apply Kubernetes configuration files to the target cluster with the provided namespace.
+  - Apply Kubernetes configuration files to multiple clusters concurrently, if more than one [--cluster|-c] or a [--targets-file] is provided, or one at a time if [--sequential] is set.
+  - Refuse to apply over deployed objects that are managed by another tool (e.g., Helm or Config Sync) or belong to another application, according to their 'app.kubernetes.io/managed-by' and 'app.kubernetes.io/name' labels, unless [--adopt] is set.
+  - Wait for other deployments of the application to the same namespace to finish, unless [--lock=false] is set.
+  - Use server-side apply with the "gke-deploy" field manager, if [--server-side] is set.
+  - Delete objects of the application that are no longer in the configuration files, if [--prune] is set.
   - Wait for deployed Kubernetes configuration files to be ready before exiting.
+  - Roll back to the previously deployed objects if they are not ready in time, if [--rollback-on-failure] is set.
+  - Record a release of the application in the cluster, so that it can be listed with "gke-deploy history" and rolled back to with "gke-deploy rollback", unless [--record-release=false] is set.
+  - Report progress as a stream of JSON events on stdout, if [--output-format=json] is set.
+  - Save a JSON file with the results of the deployment, e.g., the readiness and images of deployed objects and the duration of each phase, to [--results-file], if provided.
 `
 	example = `  # Expand Kubernetes configuration files and deploy to GKE cluster.
   gke-deploy run -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o expanded -n my-namespace -c my-cluster -l us-east1-b
@@ -43,8 +63,24 @@ Apply Phase:
   cat expanded/*
   gke-deploy apply -f expanded -c my-cluster -n my-namespace -c my-cluster -l us-east1-b  # Pass expanded directory to -f
 
+  # Show differences between expanded configuration files and deployed objects before applying.
+  gke-deploy diff -f expanded -n my-namespace -c my-cluster -l us-east1-b
+
+  # List the releases of an application and roll back to the release before the latest one.
+  gke-deploy history -a my-app -n my-namespace -c my-cluster -l us-east1-b
+  gke-deploy rollback -a my-app -n my-namespace -c my-cluster -l us-east1-b
+
+  # Wait for objects deployed by another tool to be ready, and print the status of an application.
+  gke-deploy wait -a my-app -n my-namespace -c my-cluster -l us-east1-b -t 10m
+  gke-deploy status -a my-app -n my-namespace -c my-cluster -l us-east1-b
+
+  # Check configuration files against policy rules.
+  gke-deploy lint -f configs --policy-file policy.yaml
+
+  # Build a kustomization and deploy its output.
+  gke-deploy run -f overlays/staging -a my-app -c my-cluster -l us-east1-b
+
   # Pipe output from another templating engine to gke-deploy.
-  kustomize build overlays/staging | gke-deploy run -f - -a my-app -c my-cluster -l us-east1-b
   helm template charts/prometheus | gke-deploy apply -f - -c my-cluster -l us-east1-b  # No need to run Tiller in cluster`
 	version = "" // TODO(joonlim): Create plan for versioning.
 )
@@ -57,11 +93,21 @@ func NewCommand() *cobra.Command {
 		Long:    long,
 		Example: example,
 		Version: version,
+		// gke-deploy runs as a build step, so cobra's shell completion command is not added.
+		CompletionOptions: cobra.CompletionOptions{
+			DisableDefaultCmd: true,
+		},
 	}
 
 	cmd.AddCommand(apply.NewApplyCommand())
+	cmd.AddCommand(diff.NewDiffCommand())
+	cmd.AddCommand(history.NewHistoryCommand())
+	cmd.AddCommand(lint.NewLintCommand())
 	cmd.AddCommand(prepare.NewPrepareCommand())
+	cmd.AddCommand(rollback.NewRollbackCommand())
 	cmd.AddCommand(run.NewRunCommand())
+	cmd.AddCommand(status.NewStatusCommand())
+	cmd.AddCommand(wait.NewWaitCommand())
 
 	return cmd
 }
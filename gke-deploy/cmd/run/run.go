@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/google/go-containerregistry/pkg/name"
+	applicationsv1beta1 "github.com/kubernetes-sigs/application/pkg/apis/app/v1beta1"
 	"github.com/spf13/cobra"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/image"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/deployer"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
 
 const (
@@ -17,48 +20,100 @@ const (
 	long  = `Deploy to GKE in two phases, which will do the following:
 
 Prepare Phase:
+  - Render Kubernetes configuration files from the Helm chart provided by [--chart], if set, using [--app|-a] as the release name.
+  - Substitute ${VAR} placeholders in Kubernetes configuration files with the values of [--var], [--vars-file], and Cloud Build substitutions, if [--expand-vars], [--var], or [--vars-file] is set.
+  - Validate Kubernetes configuration files against the schemas in [--openapi-schema] and [--crd-schemas], if provided.
   - Expand Kubernetes configuration files:
-    - Set the digest of images that match the [--image|-i] flag, if provided.
+    - Set the digest of images that match the [--image|-i] or [--images-file] flags, if provided.
+    - Set the digest of all other container images, including init containers, if [--pin-all-images] is set.
     - Add app.kubernetes.io/name=[--app|-a] label, if provided.
     - Add app.kubernetes.io/version=[--version|-v] label, if provided.
+  - Check expanded Kubernetes configuration files against policy rules, if [--check-policy] or [--policy-file] is set. Violations with error severity block the apply phase, unless [--allow-policy-violations] is set.
 
 Apply Phase:
   - Apply Kubernetes configuration files to the target cluster with the provided namespace.
+  - Apply Kubernetes configuration files to multiple clusters concurrently, if more than one [--cluster|-c] or a [--targets-file] is provided, or one at a time if [--sequential] is set.
+  - Refuse to apply over deployed objects that are managed by another tool (e.g., Helm or Config Sync) or belong to another application, according to their 'app.kubernetes.io/managed-by' and 'app.kubernetes.io/name' labels, unless [--adopt] is set.
+  - Wait for other deployments of the application to the same namespace to finish, unless [--lock=false] is set.
+  - Use server-side apply with the "gke-deploy" field manager, if [--server-side] is set.
   - Wait for deployed Kubernetes configuration files to be ready before exiting.
+  - Delete objects of the application that are no longer in the configuration files once the deployed objects are ready, if [--prune] is set.
+  - Roll back to the previously deployed objects if they are not ready in time, if [--rollback-on-failure] is set.
+  - Record a release of the application in the cluster, so that it can be listed with "gke-deploy history" and rolled back to with "gke-deploy rollback", unless [--record-release=false] is set.
+  - Report progress as a stream of JSON events on stdout, if [--output-format=json] is set.
+  - Save a JSON file with the results of the deployment, e.g., the readiness and images of deployed objects and the duration of each phase, to [--results-file], if provided.
 `
 	example = `  # Expand Kubernetes configuration files and deploy to GKE cluster.
   gke-deploy run -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 -o expanded -n my-namespace -c my-cluster -l us-east1-b
 
+  # Expand Kubernetes configuration files and deploy to every GKE cluster listed in a targets file.
+  gke-deploy run -f configs -i gcr.io/my-project/my-app:1.0.0 -a my-app -v 1.0.0 --targets-file targets.yaml
+
   # Deploy to GKE cluster that kubectl is currently targeting.
   gke-deploy run -f configs
 
   # Deploy to GKE cluster that kubectl is currently targeting without supplying any Kubernetes configuration files. Have gke-deploy generate suggested Kubernetes configuration files for your application using an image, app name, and service port.
   gke-deploy run -i nginx -a nginx -x 80
 
-  # Pipe output from another templating engine to gke-deploy run.
-  kustomize build overlays/staging | gke-deploy run -f - -a my-app -c my-cluster -l us-east1-b
-  helm template charts/prometheus | gke-deploy run -f - -a prometheus -c my-cluster -l us-east1-b  # No need to run Tiller in cluster`
+  # Build a kustomization and deploy its output.
+  gke-deploy run -f overlays/staging -a my-app -c my-cluster -l us-east1-b
+
+  # Render a Helm chart and deploy its output.
+  gke-deploy run --chart charts/prometheus --values values.yaml --set server.replicaCount=2 -a prometheus -c my-cluster -l us-east1-b  # No need to run Tiller in cluster`
 )
 
 type options struct {
-	appName             string
-	appVersion          string
-	filename            string
-	clusterLocation     string
-	clusterName         string
-	clusterProject      string
-	image               string
-	labels              []string
-	annotations         []string
-	namespace           string
-	output              string
-	exposePort          int
-	createApplicationCR bool
-	applicationLinks    []string
-	verbose             bool
-	waitTimeout         time.Duration
-	recursive           bool
-	serverDryRun        bool
+	appName                string
+	appVersion             string
+	filename               string
+	chart                  string
+	chartValues            []string
+	chartSetValues         []string
+	clusterLocation        []string
+	clusterName            []string
+	clusterProject         string
+	targetsFile            string
+	sequential             bool
+	maxUnavailableClusters int
+	images                 []string
+	imagesFile             string
+	pinAllImages           bool
+	pinImagesPolicy        string
+	podTemplatePaths       string
+	vars                   []string
+	varsFile               string
+	expandVars             bool
+	strictVars             bool
+	checkPolicy            bool
+	policyFile             string
+	allowPolicyViolations  bool
+	openAPISchema          string
+	crdSchemas             []string
+	labels                 []string
+	annotations            []string
+	namespace              string
+	output                 string
+	exposePort             int
+	createApplicationCR    bool
+	applicationLinks       []string
+	verbose                bool
+	kubernetesBackend      string
+	waitTimeout            time.Duration
+	recursive              bool
+	serverDryRun           bool
+	prune                  bool
+	pruneClusterScoped     bool
+	rollbackOnFailure      bool
+	serverSide             bool
+	forceConflicts         bool
+	resultsFile            string
+	recordRelease          bool
+	historyMax             int
+	adopt                  bool
+	lock                   bool
+	lockTimeout            time.Duration
+	lockDuration           time.Duration
+	outputFormat           string
 }
 
 // NewRunCommand creates the `gke-deploy run` subcommand.
@@ -79,22 +134,55 @@ func NewRunCommand() *cobra.Command {
 
 	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name of the Kubernetes deployment.")
 	cmd.Flags().StringVarP(&options.appVersion, "version", "v", "", "Version of the Kubernetes deployment.")
-	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). Prefix this value with \"gs://\" to indicate a GCS path. If this field is not provided, a Deployment (with image provided by --image) and a HorizontalPodAutoscaler are created as suggested based configs. The application's name is inferred from the image name's suffix.")
-	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster to deploy to.")
-	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster to deploy to.")
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files to use to create Kubernetes objects (file or files in directory must end in \".yml\" or \".yaml\"). If this path is a kustomization file or a directory with a kustomization file (e.g., \"kustomization.yaml\"), the kustomization is built and its output is used. Prefix this value with \"gs://\" to indicate a GCS path. If this field is not provided, a Deployment (with image provided by --image) and a HorizontalPodAutoscaler are created as suggested based configs. The application's name is inferred from the image name's suffix.")
+	cmd.Flags().StringVar(&options.chart, "chart", "", "Path to a local Helm chart directory or packaged chart (.tgz) to render Kubernetes configuration files from, instead of --filename. The chart is rendered in-process like \"helm template\", so helm does not need to be installed, with the name provided by --app as the release name.")
+	cmd.Flags().StringSliceVar(&options.chartValues, "values", nil, "Path(s) to YAML files with values for the chart provided by --chart. Values files can be set comma-delimited or as separate flags.")
+	cmd.Flags().StringArrayVar(&options.chartSetValues, "set", nil, "Value(s) for the chart provided by --chart (key=value), in the format of \"helm --set\". Can be set as separate flags.")
+	cmd.Flags().StringSliceVarP(&options.clusterLocation, "location", "l", nil, "Region/zone of GKE cluster to deploy to. Set one location per cluster provided by --cluster, in the same order.")
+	cmd.Flags().StringSliceVarP(&options.clusterName, "cluster", "c", nil, "Name of GKE cluster to deploy to. Clusters can be set comma-delimited or as separate flags to deploy to multiple clusters.")
 	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster to deploy to. If this field is not provided, the current set GCP project is used.")
-	cmd.Flags().StringVarP(&options.image, "image", "i", "", "Image to be deployed.")
+	cmd.Flags().StringVar(&options.targetsFile, "targets-file", "", "Path to a YAML file that lists GKE clusters to deploy to, each with \"cluster\", \"location\", and optional \"project\" fields. Clusters are deployed to in addition to those provided by --cluster.")
+	cmd.Flags().BoolVar(&options.sequential, "sequential", false, "Deploy to multiple clusters one at a time, in the order they are provided, instead of concurrently. Remaining clusters are skipped after more than --max-unavailable-clusters clusters fail.")
+	cmd.Flags().IntVar(&options.maxUnavailableClusters, "max-unavailable-clusters", 0, "Number of clusters that can fail to deploy before remaining clusters are skipped. Requires --sequential.")
+	cmd.Flags().StringSliceVarP(&options.images, "image", "i", nil, "Image(s) to be deployed. Images can be set comma-delimited or as separate flags. Containers with images of the same name are set to each image's digest.")
+	cmd.Flags().StringVar(&options.imagesFile, "images-file", "", "Path to a YAML file that maps names of images in Kubernetes configuration files to images to be deployed (e.g., \"my-app: gcr.io/my-project/my-app:1.0.0\"). Containers with images of a mapped name are set to the digest of the image it maps to.")
+	cmd.Flags().BoolVar(&options.pinAllImages, "pin-all-images", false, "Set the image of every container, init container, and ephemeral container that is not already pinned to a digest to its digest.")
+	cmd.Flags().StringVar(&options.pinImagesPolicy, "pin-images-policy", "", "What to do when the digest of an image cannot be resolved with --pin-all-images: \"fail\" (default), \"warn\", or \"skip\". Requires --pin-all-images.")
+	cmd.Flags().StringVar(&options.podTemplatePaths, "pod-template-paths", "", "Path to a YAML file that lists the group, kind, and dot-delimited path of the pod template (e.g., \"spec.template\") of custom resources, so that their container images and labels are updated like those of Deployments.")
+	cmd.Flags().StringArrayVar(&options.vars, "var", nil, "Variable(s) to substitute for ${VAR} placeholders in Kubernetes configuration files (VAR=value). Can be set as separate flags. Overrides values from --vars-file and Cloud Build substitutions.")
+	cmd.Flags().StringVar(&options.varsFile, "vars-file", "", "Path to a YAML file that maps names of variables to values to substitute for ${VAR} placeholders in Kubernetes configuration files. Overrides values from Cloud Build substitutions.")
+	cmd.Flags().BoolVar(&options.expandVars, "expand-vars", false, "Substitute ${VAR} placeholders in string values of Kubernetes configuration files with the values of built-in Cloud Build substitutions set as environment variables (e.g., $SHORT_SHA and $BRANCH_NAME). User-defined substitutions must be set with --var or --vars-file. Implied by --var and --vars-file. Use $${VAR} to leave a placeholder as is.")
+	cmd.Flags().BoolVar(&options.strictVars, "strict-vars", false, "Fail if a ${VAR} placeholder in Kubernetes configuration files has no value, instead of leaving it as is. Requires --expand-vars, --var, or --vars-file.")
+	cmd.Flags().BoolVar(&options.checkPolicy, "check-policy", false, "Check expanded Kubernetes configuration files against policy rules (e.g., no privileged containers, no images with the latest tag) and save a report to \"<output>/expanded/policy-report.json\". Violations with error severity fail the deployment. Implied by --policy-file.")
+	cmd.Flags().StringVar(&options.policyFile, "policy-file", "", "Path to a YAML file that sets the severity (\"error\", \"warning\", or \"ignore\") of policy rules to check expanded Kubernetes configuration files against. Rules that are not listed keep their default severity.")
+	cmd.Flags().BoolVar(&options.allowPolicyViolations, "allow-policy-violations", false, "Do not fail the deployment if policy violations with error severity are found. Requires --check-policy or --policy-file.")
+	cmd.Flags().StringVar(&options.openAPISchema, "openapi-schema", "", "Path to an OpenAPI v2 schema file of the target Kubernetes version (e.g., the api/openapi-spec/swagger.json file of a Kubernetes release, or the output of \"kubectl get --raw /openapi/v2\") to validate Kubernetes configuration files against before they are expanded. Unknown fields, fields of the wrong type, and missing required fields fail preparation.")
+	cmd.Flags().StringSliceVar(&options.crdSchemas, "crd-schemas", nil, "Path(s) to CustomResourceDefinition files or directories of files whose schemas custom resources in Kubernetes configuration files are validated against. Paths can be set comma-delimited or as separate flags.")
 	cmd.Flags().StringSliceVarP(&options.labels, "label", "L", nil, "Label(s) to add to Kubernetes configuration files (k1=v1). Labels can be set comma-delimited or as separate flags. If two or more labels with the same key are listed, the last one is used.")
 	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of GKE cluster to deploy to. If omitted, the namespace(s) specified in each Kubernetes configuration file is used.")
 	cmd.Flags().StringSliceVarP(&options.annotations, "annotation", "A", nil, "Annotation(s) to add to Kubernetes configuration files (k1=v1). Annotations can be set comma-delimited or as separate flags. If two or more annotations with the same key are listed, the last one is used.")
 	cmd.Flags().StringVarP(&options.output, "output", "o", "./output", "Target directory or GCS path to store suggested and expanded Kubernetes configuration files. Prefix this value with \"gs://\" to indicate a GCS path. Suggested files will be stored in \"<output>/suggested\" and expanded files will be stored in \"<output>/expanded\".")
 	cmd.Flags().IntVarP(&options.exposePort, "expose", "x", 0, "Creates a Service object that connects to a deployed workload object using a selector that matches the label with key as 'app.kubernetes.io/name' and value specified by --app. The port provided will be used to expose the deployed workload object (i.e., port and targetPort will be set to the value provided in this flag).")
 	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
 	cmd.Flags().DurationVarP(&options.waitTimeout, "timeout", "t", 5*time.Minute, "Timeout limit for waiting for Kubernetes objects to finish applying.")
 	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", false, "Recursively search through the provided path in --filename for all YAML files.")
 	cmd.Flags().BoolVar(&options.createApplicationCR, "create-application-cr", false, "Creates an Application CR object with the name provided by --app and connects to deployed objects using a selector that matches the label with key as 'app.kubernetes.io/name' and value specified by --app.")
 	cmd.Flags().StringSliceVar(&options.applicationLinks, "links", nil, "Links(s) to add to the spec.descriptor.links field of an Application CR generated with the --create-application-cr flag or provided via the --filename flag (description=URL). Links can be set comma-delimited or as separate flags.")
 	cmd.Flags().BoolVarP(&options.serverDryRun, "server-dry-run", "D", false, "Perform kubectl apply server dry run to validate configurations without persisting resources.")
+	cmd.Flags().BoolVar(&options.prune, "prune", false, "Delete deployed objects that have the 'app.kubernetes.io/managed-by=gcp-cloud-build-deploy' label and the same 'app.kubernetes.io/name' label as the applied objects, but are no longer in the Kubernetes configuration files. Only objects of the kinds of the applied objects and of common kinds (e.g., Deployments, Services, ConfigMaps) are deleted, and objects that controllers create with copied labels (Endpoints, EndpointSlices, Events) never are. Objects are only deleted once the deployed objects are ready, and are only looked for in the namespaces of the deployed objects. With --server-dry-run, the objects that would be deleted are listed instead.")
+	cmd.Flags().BoolVar(&options.pruneClusterScoped, "prune-cluster-scoped", false, "Also delete cluster-scoped objects (e.g., Namespaces, ClusterRoles) when pruning. Requires --prune.")
+	cmd.Flags().BoolVar(&options.rollbackOnFailure, "rollback-on-failure", false, "If deployed objects are not ready before --timeout, re-apply the previously applied configuration of objects that existed before applying, without taking over fields set by other managers, delete objects that did not exist, and wait for the restored objects to be ready.")
+	cmd.Flags().BoolVar(&options.adopt, "adopt", false, "Apply over deployed objects whose 'app.kubernetes.io/managed-by' label is not 'gcp-cloud-build-deploy' or whose 'app.kubernetes.io/name' label is not the application's, e.g., objects created by Helm, Config Sync, or another application's pipeline. Without this flag, such objects are listed and nothing is applied.")
+	cmd.Flags().BoolVar(&options.lock, "lock", true, "Hold a coordination.k8s.io/v1 Lease named after the application in the target namespace while applying and waiting, so that concurrent deployments of the application are serialized. The holder of the Lease is $BUILD_ID. Requires objects to have the same 'app.kubernetes.io/name' label, and permission to manage Leases. The Lease is applied with server-side apply. If the Lease is lost while it is held, the deployment is canceled. Set --lock=false to deploy without a Lease, e.g., if the account running gke-deploy cannot manage Leases.")
+	cmd.Flags().DurationVar(&options.lockTimeout, "lock-timeout", deployer.DefaultLockTimeout, "Timeout limit for waiting for another deployment of the application to release its Lease.")
+	cmd.Flags().DurationVar(&options.lockDuration, "lock-duration", deployer.DefaultLockDuration, "Time after which a Lease that has not been renewed is stale and is taken over, e.g., if the deployment holding it was cancelled. The Lease is renewed while it is held.")
+	cmd.Flags().BoolVar(&options.serverSide, "server-side", false, "Apply Kubernetes configuration files with server-side apply, using \"gke-deploy\" as the field manager. Fields managed by other field managers are reported as conflicts.")
+	cmd.Flags().BoolVar(&options.forceConflicts, "force-conflicts", false, "Take ownership of fields that conflict with other field managers when using server-side apply. Requires --server-side.")
+	cmd.Flags().StringVar(&options.resultsFile, "results-file", "", "Local or GCS path to save a JSON file with the results of the deployment to, including the readiness, addresses, and images of each deployed object, the duration of each phase, and the final status and error. Prefix this value with \"gs://\" to indicate a GCS path. The file is saved even if the deployment fails.")
+	cmd.Flags().StringVar(&options.outputFormat, "output-format", common.OutputFormatText, "Format of the progress output. With \"json\", events (phase started, object applied, object ready, object failed, warning, and summary) are written to stdout as one JSON object per line, and human-readable output is written to stderr instead. Cannot be used with --verbose.")
+	cmd.Flags().BoolVar(&options.recordRelease, "record-release", true, "Record a release of the application with the deployed Kubernetes configuration files, version, images, and build ID as a Secret in the target namespace after deployed objects are ready, so that it can be listed with \"gke-deploy history\" and rolled back to with \"gke-deploy rollback\". Requires objects to have the same 'app.kubernetes.io/name' label. The Secret is applied with server-side apply. Set --record-release=false to deploy without recording a release, e.g., if the account running gke-deploy cannot manage Secrets.")
+	cmd.Flags().IntVar(&options.historyMax, "history-max", deployer.DefaultReleaseHistoryMax, "Number of releases of the application to keep in the cluster. Older releases are deleted. Use 0 for no limit.")
 
 	return cmd
 }
@@ -102,30 +190,90 @@ func NewRunCommand() *cobra.Command {
 func run(_ *cobra.Command, options *options) error {
 	ctx := context.Background()
 
-	var im name.Reference
-	if options.image != "" {
-		ref, err := name.ParseReference(options.image)
-		if err != nil {
-			return err
-		}
-		im = ref
+	images, err := common.CreateImageMappings(options.images, options.imagesFile)
+	if err != nil {
+		return err
+	}
+	podTemplatePaths, err := common.CreatePodTemplatePaths(options.podTemplatePaths)
+	if err != nil {
+		return err
 	}
 
-	if options.filename == "" && options.image == "" {
+	if options.filename != "" && options.chart != "" {
+		return fmt.Errorf("-f|--filename and --chart cannot both be set")
+	}
+	if options.filename == "" && options.chart == "" && len(images) == 0 {
 		return fmt.Errorf("omitting -f|--filename requires -i|--image to be set")
 	}
+	if options.filename == "" && options.chart == "" && len(images) > 1 {
+		return fmt.Errorf("omitting -f|--filename requires only one image to be set")
+	}
+	if options.chart != "" && options.appName == "" {
+		return fmt.Errorf("rendering a chart requires -a|--app to be set")
+	}
+	if len(options.chartValues) > 0 && options.chart == "" {
+		return fmt.Errorf("you must set --chart flag because --values flag is set")
+	}
+	if len(options.chartSetValues) > 0 && options.chart == "" {
+		return fmt.Errorf("you must set --chart flag because --set flag is set")
+	}
 	if options.output == "" {
 		return fmt.Errorf("value of -o|--output cannot be empty")
 	}
-	if options.clusterName != "" && options.clusterLocation == "" {
+	expandVars := options.expandVars || len(options.vars) > 0 || options.varsFile != ""
+	if options.strictVars && !expandVars {
+		return fmt.Errorf("you must set --expand-vars, --var, or --vars-file flag because --strict-vars flag is set")
+	}
+	checkPolicy := options.checkPolicy || options.policyFile != ""
+	if options.allowPolicyViolations && !checkPolicy {
+		return fmt.Errorf("you must set --check-policy or --policy-file flag because --allow-policy-violations flag is set")
+	}
+	if options.pinImagesPolicy != "" && !options.pinAllImages {
+		return fmt.Errorf("you must set --pin-all-images flag because --pin-images-policy flag is set")
+	}
+	switch options.pinImagesPolicy {
+	case "", deployer.PinImagesPolicyFail, deployer.PinImagesPolicyWarn, deployer.PinImagesPolicySkip:
+	default:
+		return fmt.Errorf("value of --pin-images-policy must be one of %q, %q, or %q", deployer.PinImagesPolicyFail, deployer.PinImagesPolicyWarn, deployer.PinImagesPolicySkip)
+	}
+	if len(options.clusterName) > 0 && len(options.clusterLocation) == 0 {
 		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
 	}
-	if options.clusterLocation != "" && options.clusterName == "" {
+	if len(options.clusterLocation) > 0 && len(options.clusterName) == 0 {
 		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
 	}
+	if options.maxUnavailableClusters < 0 {
+		return fmt.Errorf("value of --max-unavailable-clusters must be >= 0")
+	}
+	if options.maxUnavailableClusters > 0 && !options.sequential {
+		return fmt.Errorf("you must set --sequential flag because --max-unavailable-clusters flag is set")
+	}
+	targets, err := common.CreateClusterTargets(options.clusterName, options.clusterLocation, options.targetsFile)
+	if err != nil {
+		return err
+	}
+	multiCluster := len(targets) > 1 || options.targetsFile != ""
+	if options.pruneClusterScoped && !options.prune {
+		return fmt.Errorf("you must set --prune flag because --prune-cluster-scoped flag is set")
+	}
+	if options.forceConflicts && !options.serverSide {
+		return fmt.Errorf("you must set --server-side flag because --force-conflicts flag is set")
+	}
+	if options.historyMax < 0 {
+		return fmt.Errorf("value of --history-max must be >= 0")
+	}
+	if options.lockTimeout < 0 {
+		return fmt.Errorf("value of --lock-timeout must be >= 0")
+	}
+	if options.lockDuration <= 0 {
+		return fmt.Errorf("value of --lock-duration must be > 0")
+	}
+	if options.verbose && options.outputFormat == common.OutputFormatJSON {
+		return fmt.Errorf("-V|--verbose cannot be used with --output-format=json because underlying commands are printed to stdout")
+	}
 
 	useGcloud := common.GcloudInPath()
-	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+	if !useGcloud && len(targets) > 0 {
 		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
 	}
 
@@ -152,18 +300,91 @@ func run(_ *cobra.Command, options *options) error {
 	if err != nil {
 		return err
 	}
-	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, options.serverDryRun)
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, options.serverDryRun, options.kubernetesBackend)
 	if err != nil {
 		return err
 	}
+	if err := common.SetOutputFormat(d, options.outputFormat); err != nil {
+		return err
+	}
+	d.Prune = options.prune
+	d.PruneClusterScoped = options.pruneClusterScoped
+	d.RollbackOnFailure = options.rollbackOnFailure
+	d.ServerSideApply = options.serverSide
+	d.ForceConflicts = options.forceConflicts
+	d.CheckOwnership = !options.adopt
+	d.Lock = options.lock
+	d.LockTimeout = options.lockTimeout
+	d.LockDuration = options.lockDuration
+	d.RecordRelease = options.recordRelease
+	d.ReleaseHistoryMax = options.historyMax
+	if expandVars {
+		vars, err := common.CreateVariables(options.vars, options.varsFile, options.strictVars)
+		if err != nil {
+			return err
+		}
+		d.Variables = vars
+	}
+	if checkPolicy {
+		p, err := common.CreatePolicy(options.policyFile)
+		if err != nil {
+			return err
+		}
+		d.CheckPolicy = true
+		d.Policy = p
+		d.AllowPolicyViolations = options.allowPolicyViolations
+	}
+	if options.openAPISchema != "" || len(options.crdSchemas) > 0 {
+		v, err := common.CreateValidator(ctx, options.openAPISchema, options.crdSchemas)
+		if err != nil {
+			return err
+		}
+		d.Validator = v
+	}
+	d.PodTemplatePaths = podTemplatePaths
+	d.PinAllImages = options.pinAllImages
+	d.PinImagesPolicy = options.pinImagesPolicy
+	if options.chart != "" {
+		d.Chart = &deployer.Chart{
+			Path:        options.chart,
+			ValuesFiles: options.chartValues,
+			SetValues:   options.chartSetValues,
+		}
+	}
 
+	if options.resultsFile != "" {
+		d.Results = deployer.NewResults()
+	}
+	err = deploy(ctx, d, targets, multiCluster, options, images, labelsMap, annotationsMap, applicationLinks)
+	if options.resultsFile != "" {
+		if saveErr := d.SaveResults(ctx, options.resultsFile, err); saveErr != nil {
+			if err != nil {
+				return fmt.Errorf("%v, and failed to save results: %v", err, saveErr)
+			}
+			return fmt.Errorf("failed to save results: %v", saveErr)
+		}
+	}
+	return err
+}
+
+// deploy prepares the deployment and applies it to each target cluster.
+func deploy(ctx context.Context, d *deployer.Deployer, targets []deployer.ClusterTarget, multiCluster bool, options *options, images []*image.Mapping, labelsMap, annotationsMap map[string]string, applicationLinks []applicationsv1beta1.Link) error {
 	expandedOutput := common.ExpandedOutputPath(options.output)
-	if err := d.Prepare(ctx, im, options.appName, options.appVersion, options.filename, common.SuggestedOutputPath(options.output), expandedOutput, options.namespace, labelsMap, annotationsMap, options.exposePort, options.recursive, options.createApplicationCR, applicationLinks); err != nil {
+	if err := d.Prepare(ctx, images, options.appName, options.appVersion, options.filename, common.SuggestedOutputPath(options.output), expandedOutput, options.namespace, labelsMap, annotationsMap, options.exposePort, options.recursive, options.createApplicationCR, applicationLinks); err != nil {
 		return fmt.Errorf("failed to prepare deployment: %v", err)
 	}
-	if err := d.Apply(ctx, options.clusterName, options.clusterLocation, options.clusterProject, expandedOutput, options.namespace, options.waitTimeout, options.recursive); err != nil {
+	if multiCluster {
+		if err := d.ApplyToClusters(ctx, targets, options.clusterProject, expandedOutput, options.namespace, options.waitTimeout, options.recursive, options.sequential, options.maxUnavailableClusters); err != nil {
+			return fmt.Errorf("failed to apply deployment: %v", err)
+		}
+		return nil
+	}
+	var clusterName, clusterLocation string
+	if len(targets) == 1 {
+		clusterName, clusterLocation = targets[0].Name, targets[0].Location
+	}
+	if err := d.Apply(ctx, clusterName, clusterLocation, options.clusterProject, expandedOutput, options.namespace, options.waitTimeout, options.recursive); err != nil {
 		return fmt.Errorf("failed to apply deployment: %v", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,92 @@
+// Package status contains the logic for `gke-deploy status` subcommand.
+package status
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	short = "Print the status of deployed objects"
+	long  = `Print the status of the deployed objects of an application, without applying anything.
+
+- Get the deployed objects of the application provided by [--app|-a] and/or matching the label selector provided by [--selector] in the provided namespace.
+- Print a summary of the objects, including whether they are ready.
+`
+	example = `  # Print the status of an application.
+  gke-deploy status -a my-app -n my-namespace -c my-cluster -l us-east1-b`
+)
+
+type options struct {
+	appName           string
+	selector          string
+	clusterLocation   string
+	clusterName       string
+	clusterProject    string
+	namespace         string
+	verbose           bool
+	kubernetesBackend string
+}
+
+// NewStatusCommand creates the `gke-deploy status` subcommand.
+func NewStatusCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "status",
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return status(cmd, options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name to print the status of, i.e., of the objects with the 'app.kubernetes.io/name' label set to this value.")
+	cmd.Flags().StringVar(&options.selector, "selector", "", "Label selector of the deployed objects to print the status of, e.g., \"tier=frontend\". If --app is also set, objects must match both.")
+	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster the objects are deployed to.")
+	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster the objects are deployed to.")
+	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster the objects are deployed to. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of the objects. If omitted, the current context's namespace is used.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
+
+	return cmd
+}
+
+func status(_ *cobra.Command, options *options) error {
+	ctx := context.Background()
+
+	selector := common.CreateSelector(options.appName, options.selector)
+	if selector == "" {
+		return fmt.Errorf("you must set -a|--app or --selector flag")
+	}
+	if options.clusterName != "" && options.clusterLocation == "" {
+		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
+	}
+	if options.clusterLocation != "" && options.clusterName == "" {
+		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
+	}
+
+	useGcloud := common.GcloudInPath()
+	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
+	}
+
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, false, options.kubernetesBackend)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Status(ctx, options.clusterName, options.clusterLocation, options.clusterProject, selector, options.namespace); err != nil {
+		return fmt.Errorf("failed to get status of deployed objects: %v", err)
+	}
+
+	return nil
+}
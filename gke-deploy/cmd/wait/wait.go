@@ -0,0 +1,112 @@
+// Package wait contains the logic for `gke-deploy wait` subcommand.
+package wait
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	short = "Wait for deployed objects to be ready"
+	long  = `Wait for Kubernetes objects that were deployed by another tool to be ready. Skip prepare and apply.
+
+- Get the objects to wait for from the Kubernetes configuration files provided by [--filename|-f], or the deployed objects of the application provided by [--app|-a] and/or matching the label selector provided by [--selector] in the provided namespace.
+- Wait for the objects to be ready in the target cluster, and exit with an error if any object fails or is not ready before [--timeout|-t].
+- Print a summary of the objects.
+`
+	example = `  # Wait for the objects in configuration files to be ready.
+  gke-deploy wait -f configs -n my-namespace -c my-cluster -l us-east1-b
+
+  # Wait for the deployed objects of an application to be ready.
+  gke-deploy wait -a my-app -n my-namespace -c my-cluster -l us-east1-b -t 10m
+
+  # Wait for the deployed objects matching a label selector to be ready.
+  gke-deploy wait --selector tier=frontend -n my-namespace`
+)
+
+type options struct {
+	filename          string
+	appName           string
+	selector          string
+	clusterLocation   string
+	clusterName       string
+	clusterProject    string
+	namespace         string
+	verbose           bool
+	kubernetesBackend string
+	waitTimeout       time.Duration
+	recursive         bool
+}
+
+// NewWaitCommand creates the `gke-deploy wait` subcommand.
+func NewWaitCommand() *cobra.Command {
+	options := &options{}
+
+	cmd := &cobra.Command{
+		Use:     "wait",
+		Short:   short,
+		Long:    long,
+		Example: example,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return wait(cmd, options)
+		},
+		SilenceUsage: true,
+	}
+
+	cmd.Flags().StringVarP(&options.filename, "filename", "f", "", "Local or GCS path to configuration file or directory of configuration files of the objects to wait for (file or files in directory must end in \".yml\" or \".yaml\"). Prefix this value with \"gs://\" to indicate a GCS path.")
+	cmd.Flags().StringVarP(&options.appName, "app", "a", "", "Application name to wait for the deployed objects of, i.e., the objects with the 'app.kubernetes.io/name' label set to this value.")
+	cmd.Flags().StringVar(&options.selector, "selector", "", "Label selector of the deployed objects to wait for, e.g., \"tier=frontend\". If --app is also set, objects must match both.")
+	cmd.Flags().StringVarP(&options.clusterLocation, "location", "l", "", "Region/zone of GKE cluster the objects are deployed to.")
+	cmd.Flags().StringVarP(&options.clusterName, "cluster", "c", "", "Name of GKE cluster the objects are deployed to.")
+	cmd.Flags().StringVarP(&options.clusterProject, "project", "p", "", "Project of GKE cluster the objects are deployed to. If this field is not provided, the current set GCP project is used.")
+	cmd.Flags().StringVarP(&options.namespace, "namespace", "n", "", "Namespace of the objects to wait for. If omitted, the namespace(s) specified in each Kubernetes configuration file is used, or the current context's namespace when waiting for objects matching --app or --selector.")
+	cmd.Flags().BoolVarP(&options.verbose, "verbose", "V", false, "Prints underlying commands being called to stdout.")
+	cmd.Flags().StringVar(&options.kubernetesBackend, "kubernetes-backend", services.KubernetesBackendAuto, "How to send requests to the Kubernetes API server of the target cluster: \"kubectl\" runs the kubectl binary, \"api\" sends requests to the API server directly, and \"auto\" uses kubectl if it is installed, else sends requests directly.")
+	cmd.Flags().DurationVarP(&options.waitTimeout, "timeout", "t", 5*time.Minute, "Timeout limit for waiting for Kubernetes objects to be ready.")
+	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", false, "Recursively search through the provided path in --filename for all YAML files.")
+
+	return cmd
+}
+
+func wait(_ *cobra.Command, options *options) error {
+	ctx := context.Background()
+
+	selector := common.CreateSelector(options.appName, options.selector)
+	if options.filename == "" && selector == "" {
+		return fmt.Errorf("you must set -f|--filename, -a|--app, or --selector flag")
+	}
+	if options.filename != "" && selector != "" {
+		return fmt.Errorf("-f|--filename flag cannot be set with -a|--app or --selector flag")
+	}
+	if options.recursive && options.filename == "" {
+		return fmt.Errorf("you must set -f|--filename flag because -R|--recursive flag is set")
+	}
+	if options.clusterName != "" && options.clusterLocation == "" {
+		return fmt.Errorf("you must set -c|--cluster flag because -l|--location flag is set")
+	}
+	if options.clusterLocation != "" && options.clusterName == "" {
+		return fmt.Errorf("you must set -l|--location flag because -c|--cluster flag is set")
+	}
+
+	useGcloud := common.GcloudInPath()
+	if !useGcloud && options.clusterName != "" && options.clusterLocation != "" {
+		return fmt.Errorf("gcloud must be installed and in PATH to use -c|--cluster and -l|--location")
+	}
+
+	d, err := common.CreateDeployer(ctx, useGcloud, options.verbose, false, options.kubernetesBackend)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Wait(ctx, options.clusterName, options.clusterLocation, options.clusterProject, options.filename, selector, options.namespace, options.waitTimeout, options.recursive); err != nil {
+		return fmt.Errorf("failed to wait for deployed objects: %v", err)
+	}
+
+	return nil
+}
@@ -4,11 +4,16 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
 
+// FieldManager is the name of the field manager that owns the fields of objects applied with
+// server-side apply.
+const FieldManager = "gke-deploy"
+
 // AuthorizeAccess authorizes kubectl to the cluster. In doing so, this also verifies the cluster
 // exists.
 func AuthorizeAccess(ctx context.Context, clusterName, clusterLocation, clusterProject string, gs services.GcloudService) error {
@@ -21,7 +26,17 @@ func AuthorizeAccess(ctx context.Context, clusterName, clusterLocation, clusterP
 // ApplyConfigFromString applies a config string to the current context's cluster.
 func ApplyConfigFromString(ctx context.Context, configString, namespace string, ks services.KubectlService) error {
 	if err := ks.ApplyFromString(ctx, configString, namespace); err != nil {
-		return fmt.Errorf("failed to apply config from string: %v", err)
+		return fmt.Errorf("failed to apply config from string: %w", err)
+	}
+	return nil
+}
+
+// ServerSideApplyConfigFromString applies a config string to the current context's cluster with
+// server-side apply, using FieldManager as the field manager. If forceConflicts is true, fields
+// managed by other field managers are taken over instead of failing with a conflict.
+func ServerSideApplyConfigFromString(ctx context.Context, configString, namespace string, forceConflicts bool, ks services.KubectlService) error {
+	if err := ks.ServerSideApplyFromString(ctx, configString, namespace, FieldManager, forceConflicts); err != nil {
+		return fmt.Errorf("failed to server-side apply config from string: %w", err)
 	}
 	return nil
 }
@@ -30,7 +45,20 @@ func ApplyConfigFromString(ctx context.Context, configString, namespace string,
 func GetDeployedObject(ctx context.Context, kind, name, namespace string, ks services.KubectlService) (*resource.Object, error) {
 	objYaml, err := ks.Get(ctx, kind, name, namespace, "yaml", false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get config of deployed object: %v", err)
+		return nil, fmt.Errorf("failed to get config of deployed object: %w", err)
+	}
+	return resource.DecodeFromYAML(ctx, []byte(objYaml))
+}
+
+// GetDeployedObjectIfExists gets an object deployed to the current context's cluster with a single
+// request, or returns nil if the object does not exist.
+func GetDeployedObjectIfExists(ctx context.Context, kind, name, namespace string, ks services.KubectlService) (*resource.Object, error) {
+	objYaml, err := ks.Get(ctx, kind, name, namespace, "yaml", false)
+	if services.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config of deployed object: %w", err)
 	}
 	return resource.DecodeFromYAML(ctx, []byte(objYaml))
 }
@@ -40,10 +68,93 @@ func GetDeployedObject(ctx context.Context, kind, name, namespace string, ks ser
 func DeployedObjectExists(ctx context.Context, kind, name, namespace string, ks services.KubectlService) (bool, error) {
 	objYaml, err := ks.Get(ctx, kind, name, namespace, "yaml", true)
 	if err != nil {
-		return false, fmt.Errorf("failed to get config of deployed object: %v", err)
+		return false, fmt.Errorf("failed to get config of deployed object: %w", err)
 	}
 	if objYaml == "" {
 		return false, nil
 	}
 	return true, nil
 }
+
+// GetDeployedObjectsWithSelector gets all objects with any of the provided kinds that match a label
+// selector in the current context's cluster.
+func GetDeployedObjectsWithSelector(ctx context.Context, kinds []string, selector, namespace string, ks services.KubectlService) (resource.Objects, error) {
+	listYaml, err := ks.GetWithSelector(ctx, strings.Join(kinds, ","), selector, namespace, "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configs of deployed objects: %w", err)
+	}
+	return resource.DecodeListFromYAML(ctx, []byte(listYaml))
+}
+
+// GetDeployedObjectEvents gets the events of an object deployed to the current context's cluster.
+func GetDeployedObjectEvents(ctx context.Context, kind, name, namespace string, ks services.KubectlService) (resource.Objects, error) {
+	listYaml, err := ks.GetEvents(ctx, kind, name, namespace, "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events of deployed object: %w", err)
+	}
+	return resource.DecodeListFromYAML(ctx, []byte(listYaml))
+}
+
+// APIResource is a resource of the current context's cluster.
+type APIResource struct {
+	// Name is the name of the resource, suffixed with "." and its API group if it is not in the core
+	// group, e.g., "configmaps" or "deployments.apps", which can be used as a kind to get objects.
+	Name string
+	// Kind is the kind of the objects of the resource, e.g., "Deployment".
+	Kind string
+}
+
+// GetAPIResources gets the resources of the current context's cluster whose objects support all of
+// verbs, e.g., "list" and "delete". If namespaced is true, namespaced resources are returned, else
+// cluster-scoped resources.
+func GetAPIResources(ctx context.Context, namespaced bool, verbs []string, ks services.KubectlService) ([]APIResource, error) {
+	out, err := ks.APIResources(ctx, namespaced, verbs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api resources: %w", err)
+	}
+	// The columns are NAME, SHORTNAMES (which may be empty), APIVERSION, NAMESPACED, and KIND.
+	var resources []APIResource
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		name := fields[0]
+		if i := strings.Index(fields[len(fields)-3], "/"); i >= 0 {
+			name += "." + fields[len(fields)-3][:i]
+		}
+		resources = append(resources, APIResource{
+			Name: name,
+			Kind: fields[len(fields)-1],
+		})
+	}
+	return resources, nil
+}
+
+// DeleteDeployedObject deletes an object deployed to the current context's cluster.
+func DeleteDeployedObject(ctx context.Context, kind, name, namespace string, ks services.KubectlService) error {
+	if err := ks.Delete(ctx, kind, name, namespace); err != nil {
+		return fmt.Errorf("failed to delete deployed object: %w", err)
+	}
+	return nil
+}
+
+// DeleteDeployedObjectWithPreconditions deletes an object deployed to the current context's
+// cluster only if it still has uid and resourceVersion. The returned error wraps a conflict,
+// which can be checked with services.IsConflict, if the object has changed.
+func DeleteDeployedObjectWithPreconditions(ctx context.Context, kind, name, namespace, uid, resourceVersion string, ks services.KubectlService) error {
+	if err := ks.DeleteWithPreconditions(ctx, kind, name, namespace, uid, resourceVersion); err != nil {
+		return fmt.Errorf("failed to delete deployed object: %w", err)
+	}
+	return nil
+}
+
+// GetContextNamespace gets the current context's namespace, which objects without a namespace are
+// applied to.
+func GetContextNamespace(ctx context.Context, ks services.KubectlService) (string, error) {
+	namespace, err := ks.ContextNamespace(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current context's namespace: %w", err)
+	}
+	return namespace, nil
+}
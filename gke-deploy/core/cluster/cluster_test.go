@@ -70,6 +70,34 @@ func TestApplyConfigFromStringErrors(t *testing.T) {
 	}
 }
 
+func TestServerSideApplyConfigFromString(t *testing.T) {
+	configString := string(fileContents(t, "testing/deployment.yaml"))
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		ServerSideApplyFromStringResponse: map[string][]error{
+			configString: {nil},
+		},
+	}
+
+	if err := ServerSideApplyConfigFromString(context.Background(), configString, namespace, false, ks); err != nil {
+		t.Errorf("ServerSideApplyConfigFromString(%s, %s, false, ks) = %v; want <nil>", configString, namespace, err)
+	}
+}
+
+func TestServerSideApplyConfigFromStringErrors(t *testing.T) {
+	configString := string(fileContents(t, "testing/deployment.yaml"))
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		ServerSideApplyFromStringResponse: map[string][]error{
+			configString: {fmt.Errorf("failed to apply kubernetes manifests to cluster")},
+		},
+	}
+
+	if err := ServerSideApplyConfigFromString(context.Background(), configString, namespace, false, ks); err == nil {
+		t.Errorf("ServerSideApplyConfigFromString(%s, %s, false, ks) = <nil>; want error", configString, namespace)
+	}
+}
+
 func TestGetDeployedObject(t *testing.T) {
 	ctx := context.Background()
 
@@ -136,6 +164,88 @@ func TestGetDeployedObject(t *testing.T) {
 	}
 }
 
+func TestGetDeployedObjectIfExists(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+
+	tests := []struct {
+		name string
+
+		kind      string
+		objName   string
+		namespace string
+		ks        services.KubectlService
+
+		want runtime.Object
+	}{{
+		name: "Deployed deployment exists",
+
+		kind:      "Deployment",
+		objName:   "test-app",
+		namespace: "default",
+		ks: &testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Deployment": {
+					"test-app": {
+						{
+							Res: string(fileContents(t, testDeploymentFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		want: newObjectFromFile(t, testDeploymentFile),
+	}, {
+		name: "Deployed service does not exist",
+
+		kind:      "Service",
+		objName:   "test-app",
+		namespace: "default",
+		ks: &testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": {
+						{
+							Res: "",
+							Err: testservices.NotFoundError("Service", "test-app"),
+						},
+					},
+				},
+			},
+		},
+
+		want: nil,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := GetDeployedObjectIfExists(ctx, tc.kind, tc.objName, tc.namespace, tc.ks)
+			if err != nil || (tc.want == nil && got != nil) || (tc.want != nil && !reflect.DeepEqual(got, tc.want)) {
+				t.Errorf("GetDeployedObjectIfExists(ctx, %s, %s, %s, ks,) = %v, %v; want %v, <nil>", tc.kind, tc.objName, tc.namespace, got, err, tc.want)
+			}
+		})
+	}
+
+	ks := &testservices.TestKubectl{
+		GetResponse: map[string]map[string][]testservices.GetResponse{
+			"Service": {
+				"test-app": {
+					{
+						Res: "",
+						Err: fmt.Errorf("failed to get service"),
+					},
+				},
+			},
+		},
+	}
+	if got, err := GetDeployedObjectIfExists(ctx, "Service", "test-app", "default", ks); err == nil {
+		t.Errorf("GetDeployedObjectIfExists(ctx, Service, test-app, default, ks) = %v, <nil>; want <nil>, error", got)
+	}
+}
+
 func TestDeployedObjectExists(t *testing.T) {
 	ctx := context.Background()
 
@@ -240,6 +350,178 @@ func TestDeployedObjectExistsErrors(t *testing.T) {
 	}
 }
 
+func TestGetDeployedObjectsWithSelector(t *testing.T) {
+	ctx := context.Background()
+	kinds := []string{"ConfigMap", "Secret"}
+	selector := "app.kubernetes.io/name=test-app"
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+			selector: {
+				namespace: {
+					{
+						Res: string(fileContents(t, "testing/list.yaml")),
+						Err: nil,
+					},
+				},
+			},
+		},
+	}
+
+	got, err := GetDeployedObjectsWithSelector(ctx, kinds, selector, namespace, ks)
+	if err != nil {
+		t.Fatalf("GetDeployedObjectsWithSelector(ctx, %v, %s, %s, ks) = %v, %v; want 2 objects, <nil>", kinds, selector, namespace, got, err)
+	}
+	if len(got) != 2 || got[0].GetName() != "test-config" || got[1].GetName() != "test-secret" {
+		t.Errorf("GetDeployedObjectsWithSelector(ctx, %v, %s, %s, ks) = %v; want [test-config test-secret]", kinds, selector, namespace, got)
+	}
+}
+
+func TestGetDeployedObjectsWithSelectorErrors(t *testing.T) {
+	ctx := context.Background()
+	kinds := []string{"ConfigMap", "Secret"}
+	selector := "app.kubernetes.io/name=test-app"
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+			selector: {
+				namespace: {
+					{
+						Res: "",
+						Err: fmt.Errorf("failed to get objects"),
+					},
+				},
+			},
+		},
+	}
+
+	if got, err := GetDeployedObjectsWithSelector(ctx, kinds, selector, namespace, ks); err == nil {
+		t.Errorf("GetDeployedObjectsWithSelector(ctx, %v, %s, %s, ks) = %v, <nil>; want error", kinds, selector, namespace, got)
+	}
+}
+
+func TestGetDeployedObjectEvents(t *testing.T) {
+	ctx := context.Background()
+	kind := "Pod"
+	name := "test-app-58c8c7fffc-mlnck"
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		GetEventsResponse: map[string]map[string][]testservices.GetResponse{
+			kind: {
+				name: {
+					{
+						Res: string(fileContents(t, "testing/events.yaml")),
+						Err: nil,
+					},
+				},
+			},
+		},
+	}
+
+	got, err := GetDeployedObjectEvents(ctx, kind, name, namespace, ks)
+	if err != nil {
+		t.Fatalf("GetDeployedObjectEvents(ctx, %s, %s, %s, ks) = %v, %v; want 2 events, <nil>", kind, name, namespace, got, err)
+	}
+	if len(got) != 2 || got[0].GetKind() != "Event" || got[1].GetKind() != "Event" {
+		t.Errorf("GetDeployedObjectEvents(ctx, %s, %s, %s, ks) = %v; want 2 events", kind, name, namespace, got)
+	}
+}
+
+func TestGetDeployedObjectEventsErrors(t *testing.T) {
+	ctx := context.Background()
+	kind := "Pod"
+	name := "test-app-58c8c7fffc-mlnck"
+	namespace := "default"
+	ks := &testservices.TestKubectl{
+		GetEventsResponse: map[string]map[string][]testservices.GetResponse{
+			kind: {
+				name: {
+					{
+						Res: "",
+						Err: fmt.Errorf("failed to get events"),
+					},
+				},
+			},
+		},
+	}
+
+	if got, err := GetDeployedObjectEvents(ctx, kind, name, namespace, ks); err == nil {
+		t.Errorf("GetDeployedObjectEvents(ctx, %s, %s, %s, ks) = %v, <nil>; want error", kind, name, namespace, got)
+	}
+}
+
+func TestGetAPIResources(t *testing.T) {
+	ctx := context.Background()
+	ks := &testservices.TestKubectl{
+		APIResourcesResponse: map[bool][]testservices.GetResponse{
+			true: {
+				{
+					Res: "configmaps    cm                   v1         true   ConfigMap\n" +
+						"deployments   deploy               apps/v1    true   Deployment\n" +
+						"leases                             coordination.k8s.io/v1   true   Lease\n\n",
+					Err: nil,
+				},
+			},
+		},
+	}
+
+	want := []APIResource{
+		{Name: "configmaps", Kind: "ConfigMap"},
+		{Name: "deployments.apps", Kind: "Deployment"},
+		{Name: "leases.coordination.k8s.io", Kind: "Lease"},
+	}
+	got, err := GetAPIResources(ctx, true, []string{"list"}, ks)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAPIResources(ctx, true, [list], ks) = %v, %v; want %v, <nil>", got, err, want)
+	}
+}
+
+func TestGetAPIResourcesErrors(t *testing.T) {
+	ctx := context.Background()
+	ks := &testservices.TestKubectl{
+		APIResourcesResponse: map[bool][]testservices.GetResponse{
+			false: {
+				{
+					Res: "",
+					Err: fmt.Errorf("failed to get api resources"),
+				},
+			},
+		},
+	}
+
+	if got, err := GetAPIResources(ctx, false, []string{"list"}, ks); err == nil {
+		t.Errorf("GetAPIResources(ctx, false, [list], ks) = %v, <nil>; want error", got)
+	}
+}
+
+func TestDeleteDeployedObject(t *testing.T) {
+	ks := &testservices.TestKubectl{
+		DeleteResponse: map[string]map[string][]error{
+			"ConfigMap": {
+				"test-config": {nil},
+			},
+		},
+	}
+
+	if err := DeleteDeployedObject(context.Background(), "ConfigMap", "test-config", "default", ks); err != nil {
+		t.Errorf("DeleteDeployedObject(ctx, ConfigMap, test-config, default, ks) = %v; want <nil>", err)
+	}
+}
+
+func TestDeleteDeployedObjectErrors(t *testing.T) {
+	ks := &testservices.TestKubectl{
+		DeleteResponse: map[string]map[string][]error{
+			"ConfigMap": {
+				"test-config": {fmt.Errorf("failed to delete object")},
+			},
+		},
+	}
+
+	if err := DeleteDeployedObject(context.Background(), "ConfigMap", "test-config", "default", ks); err == nil {
+		t.Errorf("DeleteDeployedObject(ctx, ConfigMap, test-config, default, ks) = <nil>; want error")
+	}
+}
+
 func newObjectFromFile(t *testing.T, filename string) runtime.Object {
 	contents := fileContents(t, filename)
 	obj, err := resource.DecodeFromYAML(nil, contents)
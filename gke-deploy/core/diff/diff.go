@@ -0,0 +1,182 @@
+// Package diff contains logic related to computing differences between texts.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	line string
+	// aIdx and bIdx are the 0-based indices of the line before this op in a and b.
+	aIdx int
+	bIdx int
+}
+
+// Unified returns a unified diff of texts a and b, labelled with fromName and toName. An empty
+// string is returned if a and b are equal.
+func Unified(a, b, fromName, toName string) string {
+	if a == b {
+		return ""
+	}
+	ops := lineOps(splitLines(a), splitLines(b))
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %s\n", fromName)
+	fmt.Fprintf(buf, "+++ %s\n", toName)
+
+	for _, h := range hunks(ops) {
+		hunkOps := ops[h[0]:h[1]]
+		aStart, bStart := hunkOps[0].aIdx, hunkOps[0].bIdx
+		aLen, bLen := 0, 0
+		for _, o := range hunkOps {
+			switch o.kind {
+			case opEqual:
+				aLen++
+				bLen++
+			case opDelete:
+				aLen++
+			case opInsert:
+				bLen++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, o := range hunkOps {
+			switch o.kind {
+			case opEqual:
+				fmt.Fprintf(buf, " %s\n", o.line)
+			case opDelete:
+				fmt.Fprintf(buf, "-%s\n", o.line)
+			case opInsert:
+				fmt.Fprintf(buf, "+%s\n", o.line)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// splitLines splits s into lines, ignoring a trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineOps returns the edit operations that transform a into b, using Myers' O((N+M)D) algorithm,
+// where D is the number of changed lines. Only the furthest reaching paths of each edit distance
+// are kept, so memory is O(D^2) rather than O(NM), which is small for the typical diff of a
+// deployed object that only has a few changed lines.
+func lineOps(a, b []string) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	// v[offset+k] is the furthest x reached on diagonal k = x - y.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[k] for k in [-d-1, d+1] before the paths of edit distance d are extended.
+	var trace [][]int
+search:
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Backtrack from the end of a and b to recover the operations in reverse.
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d+1] < prev[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{opEqual, a[x], x, y})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{opInsert, b[y], x, y})
+		} else {
+			x--
+			ops = append(ops, op{opDelete, a[x], x, y})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// hunks groups changed ops, with surrounding context, into [start, end) ranges of ops.
+func hunks(ops []op) [][2]int {
+	var ranges [][2]int
+	for i, o := range ops {
+		if o.kind == opEqual {
+			continue
+		}
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i + contextLines + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if len(ranges) > 0 && start <= ranges[len(ranges)-1][1] {
+			ranges[len(ranges)-1][1] = end
+		} else {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+	return ranges
+}
+
+// hunkRange formats the range of a hunk in a unified diff header. start is 0-based.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
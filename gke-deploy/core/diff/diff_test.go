@@ -0,0 +1,198 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+
+		a string
+		b string
+
+		want string
+	}{{
+		name: "Equal",
+
+		a: "a\nb\nc\n",
+		b: "a\nb\nc\n",
+
+		want: "",
+	}, {
+		name: "Changed line",
+
+		a: "a\nb\nc\n",
+		b: "a\nB\nc\n",
+
+		want: `--- from
++++ to
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+	}, {
+		name: "Added to empty",
+
+		a: "",
+		b: "a\nb\n",
+
+		want: `--- from
++++ to
+@@ -0,0 +1,2 @@
++a
++b
+`,
+	}, {
+		name: "Separate hunks",
+
+		a: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+		b: "1\n2a\n3\n4\n5\n6\n7\n8\n9\n10\n11a\n12\n",
+
+		want: `--- from
++++ to
+@@ -1,5 +1,5 @@
+ 1
+-2
++2a
+ 3
+ 4
+ 5
+@@ -8,5 +8,5 @@
+ 8
+ 9
+ 10
+-11
++11a
+ 12
+`,
+	}, {
+		name: "Removed line",
+
+		a: "a\nb\nc\n",
+		b: "a\nc\n",
+
+		want: `--- from
++++ to
+@@ -1,3 +1,2 @@
+ a
+-b
+ c
+`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Unified(tc.a, tc.b, "from", "to")
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Unified(%q, %q, from, to) produced diff (-want +got):\n%s", tc.a, tc.b, diff)
+			}
+		})
+	}
+}
+
+func TestUnifiedLargeInputs(t *testing.T) {
+	// An O(NM) diff of these inputs would need 10^10 table entries.
+	var a, b strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&a, "%d\n", i)
+		if i == 50000 {
+			fmt.Fprintf(&b, "%da\n", i)
+		} else {
+			fmt.Fprintf(&b, "%d\n", i)
+		}
+	}
+
+	want := `--- from
++++ to
+@@ -49998,7 +49998,7 @@
+ 49997
+ 49998
+ 49999
+-50000
++50000a
+ 50001
+ 50002
+ 50003
+`
+	got := Unified(a.String(), b.String(), "from", "to")
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unified(...) of large inputs produced diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLineOps(t *testing.T) {
+	tests := []struct {
+		name string
+
+		a []string
+		b []string
+	}{{
+		name: "Both empty",
+	}, {
+		name: "Replaced all lines",
+
+		a: []string{"a", "b", "c"},
+		b: []string{"d", "e"},
+	}, {
+		name: "Interleaved changes",
+
+		a: []string{"a", "b", "c", "a", "b", "b", "a"},
+		b: []string{"c", "b", "a", "b", "a", "c"},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotA, gotB []string
+			changes := 0
+			for _, o := range lineOps(tc.a, tc.b) {
+				switch o.kind {
+				case opEqual:
+					gotA = append(gotA, o.line)
+					gotB = append(gotB, o.line)
+				case opDelete:
+					gotA = append(gotA, o.line)
+					changes++
+				case opInsert:
+					gotB = append(gotB, o.line)
+					changes++
+				}
+			}
+			if diff := cmp.Diff(tc.a, gotA); diff != "" {
+				t.Errorf("lineOps(%q, %q) does not reproduce a (-want +got):\n%s", tc.a, tc.b, diff)
+			}
+			if diff := cmp.Diff(tc.b, gotB); diff != "" {
+				t.Errorf("lineOps(%q, %q) does not reproduce b (-want +got):\n%s", tc.a, tc.b, diff)
+			}
+			if want := minEdits(tc.a, tc.b); changes != want {
+				t.Errorf("lineOps(%q, %q) has %d changes; want %d", tc.a, tc.b, changes, want)
+			}
+		})
+	}
+}
+
+// minEdits returns the minimum number of inserted and deleted lines that transform a into b.
+func minEdits(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
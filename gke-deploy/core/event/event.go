@@ -0,0 +1,101 @@
+// Package event contains the events that report the progress of a deployment, so that it can be
+// followed by tools, e.g., a build UI, instead of parsing human-readable output.
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Type is the kind of progress that an event reports.
+type Type string
+
+const (
+	// PhaseStarted events report that a phase of the deployment started, e.g., "apply" or "wait".
+	PhaseStarted Type = "PhaseStarted"
+	// ObjectApplied events report that an object was applied to the cluster.
+	ObjectApplied Type = "ObjectApplied"
+	// ObjectReady events report that an applied object became ready.
+	ObjectReady Type = "ObjectReady"
+	// ObjectFailed events report that an applied object failed and will not become ready without
+	// changes, e.g., because its Pods cannot pull their images.
+	ObjectFailed Type = "ObjectFailed"
+	// Warning events report a problem that does not stop the deployment.
+	Warning Type = "Warning"
+	// Summary events report the outcome of a deployment, with the states of all deployed objects
+	// after waiting for them. A Summary event is always the last event of a deployment, including
+	// deployments that fail before objects are applied, in which case it has no objects, and dry
+	// runs, in which case its objects have no states.
+	Summary Type = "Summary"
+)
+
+const (
+	// StatusSucceeded is the status of Summary events of deployments whose objects are all ready.
+	StatusSucceeded = "Succeeded"
+	// StatusFailed is the status of Summary events of deployments that failed or timed out.
+	StatusFailed = "Failed"
+)
+
+// Event reports the progress of a deployment.
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Cluster and Location are set when deploying to multiple clusters.
+	Cluster  string `json:"cluster,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Phase is set in PhaseStarted events.
+	Phase string `json:"phase,omitempty"`
+	// Object is set in ObjectApplied, ObjectReady, and ObjectFailed events.
+	Object *Object `json:"object,omitempty"`
+	// ReadyAfterSeconds is set in ObjectReady events to how long it took for the object to be ready
+	// after objects were applied.
+	ReadyAfterSeconds float64 `json:"readyAfterSeconds,omitempty"`
+	// Status is set in Summary events.
+	Status string `json:"status,omitempty"`
+	// Objects are set in Summary events, with their states.
+	Objects []*Object `json:"objects,omitempty"`
+	// Message is the reason of ObjectFailed events, the text of Warning events, and the failure of
+	// Summary events.
+	Message string `json:"message,omitempty"`
+}
+
+// Object identifies an object in an event.
+type Object struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// State is "Ready", "NotReady", or "Failed", and is set in Summary events.
+	State string `json:"state,omitempty"`
+}
+
+// Sink receives events. Events may be emitted concurrently, e.g., when deploying to multiple
+// clusters.
+type Sink interface {
+	Emit(e *Event)
+}
+
+// JSONLines is a Sink that writes each event as one line of JSON.
+type JSONLines struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewJSONLines creates a Sink that writes events as lines of JSON to w.
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{w: w}
+}
+
+// Emit writes an event as a line of JSON. Events that cannot be written are dropped, so that
+// reporting progress never fails a deployment.
+func (j *JSONLines) Emit(e *Event) {
+	out, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fmt.Fprintf(j.w, "%s\n", out)
+}
@@ -0,0 +1,82 @@
+package event
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestJSONLines(t *testing.T) {
+	now := time.Date(2020, 2, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+
+		events []*Event
+
+		want string
+	}{{
+		name: "Phase started",
+
+		events: []*Event{{
+			Type:  PhaseStarted,
+			Time:  now,
+			Phase: "apply",
+		}},
+
+		want: `{"type":"PhaseStarted","time":"2020-02-01T10:00:00Z","phase":"apply"}` + "\n",
+	}, {
+		name: "Object events",
+
+		events: []*Event{{
+			Type: ObjectApplied,
+			Time: now,
+			Object: &Object{
+				Kind:      "Deployment",
+				Namespace: "default",
+				Name:      "test-app",
+			},
+		}, {
+			Type:    ObjectReady,
+			Time:    now,
+			Cluster: "cluster-1",
+			Object: &Object{
+				Kind: "Namespace",
+				Name: "foobar",
+			},
+			ReadyAfterSeconds: 1.5,
+		}},
+
+		want: `{"type":"ObjectApplied","time":"2020-02-01T10:00:00Z","object":{"kind":"Deployment","namespace":"default","name":"test-app"}}` + "\n" +
+			`{"type":"ObjectReady","time":"2020-02-01T10:00:00Z","cluster":"cluster-1","object":{"kind":"Namespace","name":"foobar"},"readyAfterSeconds":1.5}` + "\n",
+	}, {
+		name: "Summary",
+
+		events: []*Event{{
+			Type:   Summary,
+			Time:   now,
+			Status: StatusFailed,
+			Objects: []*Object{{
+				Kind:  "Service",
+				Name:  "test-app",
+				State: "NotReady",
+			}},
+			Message: "timed out",
+		}},
+
+		want: `{"type":"Summary","time":"2020-02-01T10:00:00Z","status":"Failed","objects":[{"kind":"Service","name":"test-app","state":"NotReady"}],"message":"timed out"}` + "\n",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			j := NewJSONLines(&buf)
+			for _, e := range tc.events {
+				j.Emit(e)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("Emit(%v) wrote %q; want %q", tc.events, got, tc.want)
+			}
+		})
+	}
+}
@@ -28,3 +28,38 @@ func ResolveDigest(ctx context.Context, ref name.Reference, rs services.RemoteSe
 	}
 	return fmt.Sprintf("%s:%s", digest.Algorithm, digest.Hex), nil
 }
+
+// Mapping maps container images in configuration files to the image that they are set to.
+type Mapping struct {
+	// Name is the name of container images, without a tag or digest, that are set to Ref.
+	Name string
+	// Ref is the image that matching container images are set to.
+	Ref name.Reference
+}
+
+// NewMapping creates a Mapping that sets container images with the same name as ref to ref.
+func NewMapping(ref name.Reference) *Mapping {
+	return &Mapping{
+		Name: Name(ref),
+		Ref:  ref,
+	}
+}
+
+// ParseMapping creates a Mapping that sets container images with name imageName to the image
+// reference ref.
+// e.g., If imageName is "my-app" and ref is "gcr.io/my-project/my-app:1.0.0", containers with image
+// "my-app" or "my-app:latest" are set to "gcr.io/my-project/my-app:1.0.0".
+func ParseMapping(imageName, ref string) (*Mapping, error) {
+	n, err := name.ParseReference(imageName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image name %q: %v", imageName, err)
+	}
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image reference %q: %v", ref, err)
+	}
+	return &Mapping{
+		Name: Name(n),
+		Ref:  r,
+	}, nil
+}
@@ -123,3 +123,78 @@ func newImageWithDigest(t *testing.T, image string) name.Reference {
 	}
 	return ref
 }
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		name string
+
+		imageName string
+		ref       string
+
+		wantName string
+		wantRef  string
+	}{{
+		name: "Image name with registry",
+
+		imageName: "gcr.io/my-project/my-image",
+		ref:       "gcr.io/my-project/my-image:1.0.0",
+
+		wantName: "gcr.io/my-project/my-image",
+		wantRef:  "gcr.io/my-project/my-image:1.0.0",
+	}, {
+		name: "Image name without registry",
+
+		imageName: "my-image",
+		ref:       "gcr.io/my-project/my-image:1.0.0",
+
+		wantName: "index.docker.io/library/my-image",
+		wantRef:  "gcr.io/my-project/my-image:1.0.0",
+	}, {
+		name: "Image name with tag",
+
+		imageName: "gcr.io/my-project/my-image:latest",
+		ref:       "gcr.io/my-project/my-image-2@sha256:929665b8eb2bb286535d29cd73c71808d7e1ad830046333f6cf0ce497996eb79",
+
+		wantName: "gcr.io/my-project/my-image",
+		wantRef:  "gcr.io/my-project/my-image-2@sha256:929665b8eb2bb286535d29cd73c71808d7e1ad830046333f6cf0ce497996eb79",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseMapping(tc.imageName, tc.ref)
+			if err != nil {
+				t.Fatalf("ParseMapping(%s, %s) = _, %v; want <nil>", tc.imageName, tc.ref, err)
+			}
+			if got.Name != tc.wantName || got.Ref.String() != tc.wantRef {
+				t.Errorf("ParseMapping(%s, %s) = {%s, %v}, <nil>; want {%s, %s}, <nil>", tc.imageName, tc.ref, got.Name, got.Ref, tc.wantName, tc.wantRef)
+			}
+		})
+	}
+}
+
+func TestParseMappingErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		imageName string
+		ref       string
+	}{{
+		name: "Invalid image name",
+
+		imageName: "gcr.io/my-project/MY-IMAGE",
+		ref:       "gcr.io/my-project/my-image:1.0.0",
+	}, {
+		name: "Invalid image reference",
+
+		imageName: "gcr.io/my-project/my-image",
+		ref:       "gcr.io/my-project/my-image:1.0.0!",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := ParseMapping(tc.imageName, tc.ref); err == nil {
+				t.Errorf("ParseMapping(%s, %s) = %v, <nil>; want error", tc.imageName, tc.ref, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+// Package lock contains logic related to coordination.k8s.io/v1 Leases that serialize deployments
+// of an application to a namespace.
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	// fieldManagerPrefix prefixes the holder of a lock to get the field manager that the Lease is
+	// applied with. Because each holder has its own field manager, a holder cannot apply a Lease held
+	// by another holder without forcing conflicts.
+	fieldManagerPrefix = "gke-deploy-lock-"
+)
+
+// retryInterval is how often a Lease held by another holder is checked while waiting for it.
+var retryInterval = 2 * time.Second
+
+// Logger reports the progress of acquiring, renewing, and releasing a lock.
+type Logger interface {
+	Printf(format string, a ...interface{})
+	Warnf(format string, a ...interface{})
+}
+
+// Lock is a Lease, named after an application, that is held while the application is deployed to
+// a namespace.
+type Lock struct {
+	Name      string
+	Namespace string
+	Holder    string
+	// Duration is how long the Lease is valid for without being renewed. A Lease that has not been
+	// renewed for longer than its duration is stale, and can be taken over. The Lease is renewed
+	// every third of its duration while it is held.
+	Duration time.Duration
+
+	ks          services.KubectlService
+	log         Logger
+	acquireTime time.Time
+	transitions int32
+
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	cancel context.CancelFunc
+	// lost is why the lock was lost while it was held, if it was.
+	lost error
+}
+
+// New creates a lock of an application in a namespace, held by holder, whose progress is reported
+// to log.
+func New(app, namespace, holder string, duration time.Duration, ks services.KubectlService, log Logger) *Lock {
+	return &Lock{
+		Name:      LeaseName(app),
+		Namespace: namespace,
+		Holder:    holder,
+		Duration:  duration,
+		ks:        ks,
+		log:       log,
+	}
+}
+
+// LeaseName returns the name of the Lease that locks deployments of an application.
+func LeaseName(app string) string {
+	return fmt.Sprintf("gke-deploy.lock.%s", app)
+}
+
+// Acquire takes the lock, waiting up to timeout for another holder to release it. A Lease of
+// another holder that is stale is taken over. Once acquired, the Lease is renewed until Release is
+// called.
+//
+// The returned context is derived from ctx, and is canceled if the lock is lost while it is held,
+// i.e., renewing the Lease fails or another holder takes it over, so that work that must only be
+// done while holding the lock is stopped. Lost returns why the lock was lost.
+func (l *Lock) Acquire(ctx context.Context, timeout time.Duration) (context.Context, error) {
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		lease, err := l.get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		force := false
+		l.transitions = 0
+		if lease != nil {
+			l.transitions = transitions(lease)
+			if holder := holderIdentity(lease); holder != l.Holder {
+				if !Stale(lease, now) {
+					if !now.Before(deadline) {
+						return nil, fmt.Errorf("timed out after %v waiting for lock %q in namespace %q held by %q", timeout, l.Name, l.Namespace, holder)
+					}
+					if !waiting {
+						l.log.Printf("Waiting for lock %q in namespace %q held by %q.\n", l.Name, l.Namespace, holder)
+						waiting = true
+					}
+					if err := sleep(ctx, retryInterval); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				l.log.Warnf("Taking over stale lock %q in namespace %q held by %q, which was last renewed at %s.", l.Name, l.Namespace, holder, renewTime(lease).Format(time.RFC3339))
+				force = true
+				l.transitions++
+			}
+		}
+
+		l.acquireTime = now
+		if err := l.apply(ctx, now, force); err != nil {
+			// Another holder acquired the lock first.
+			if services.IsConflict(err) {
+				if err := sleep(ctx, retryInterval); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			return nil, fmt.Errorf("failed to acquire lock %q in namespace %q: %v", l.Name, l.Namespace, err)
+		}
+		l.log.Printf("Acquired lock %q in namespace %q as %q.\n", l.Name, l.Namespace, l.Holder)
+		lockCtx, cancel := context.WithCancel(ctx)
+		l.startRenewing(cancel)
+		return lockCtx, nil
+	}
+}
+
+// Release stops renewing the lock and deletes its Lease, unless it was taken over by another
+// holder. The Lease is deleted with preconditions on its UID and resource version, so that a Lease
+// that another holder takes over after it is checked is not deleted.
+func (l *Lock) Release(ctx context.Context) error {
+	l.stopRenewing()
+
+	lease, err := l.get(ctx)
+	if err != nil {
+		return err
+	}
+	if lease == nil {
+		return nil
+	}
+	if holder := holderIdentity(lease); holder != l.Holder {
+		return fmt.Errorf("lock %q in namespace %q was taken over by %q", l.Name, l.Namespace, holder)
+	}
+	if err := cluster.DeleteDeployedObjectWithPreconditions(ctx, "Lease", l.Name, l.Namespace, string(lease.UID), lease.ResourceVersion, l.ks); err != nil {
+		if services.IsConflict(err) {
+			return fmt.Errorf("lock %q in namespace %q was taken over while it was released", l.Name, l.Namespace)
+		}
+		return fmt.Errorf("failed to release lock %q in namespace %q: %v", l.Name, l.Namespace, err)
+	}
+	l.log.Printf("Released lock %q in namespace %q.\n", l.Name, l.Namespace)
+	return nil
+}
+
+// Lost returns why the lock was lost while it was held, or nil if it was not lost.
+func (l *Lock) Lost() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// Stale returns true if a Lease has not been renewed for longer than its duration.
+func Stale(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := renewTime(lease).Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// startRenewing renews the Lease every third of its duration until stopRenewing is called. If
+// renewing fails, the lock is lost, and cancel is called to cancel the context returned by
+// Acquire. The Lease is applied without forcing conflicts, so renewing it fails with a conflict if
+// another holder took it over.
+func (l *Lock) startRenewing(cancel context.CancelFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	l.cancel = cancel
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(l.Duration / 3):
+			}
+			err := l.apply(context.Background(), time.Now(), false)
+			if err == nil {
+				continue
+			}
+			lost := fmt.Errorf("failed to renew lock %q in namespace %q: %v", l.Name, l.Namespace, err)
+			if services.IsConflict(err) {
+				lost = fmt.Errorf("lock %q in namespace %q was taken over by another holder", l.Name, l.Namespace)
+			}
+			l.log.Warnf("Lost lock: %v. Canceling deployment.", lost)
+			l.mu.Lock()
+			l.lost = lost
+			l.mu.Unlock()
+			cancel()
+			return
+		}
+	}(l.stop, l.done)
+}
+
+func (l *Lock) stopRenewing() {
+	l.mu.Lock()
+	stop, done, cancel := l.stop, l.done, l.cancel
+	l.stop = nil
+	l.done = nil
+	l.cancel = nil
+	l.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	cancel()
+}
+
+// get returns the Lease of the lock, or nil if it does not exist.
+func (l *Lock) get(ctx context.Context) (*coordinationv1.Lease, error) {
+	obj, err := cluster.GetDeployedObjectIfExists(ctx, "Lease", l.Name, l.Namespace, l.ks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lock %q in namespace %q: %v", l.Name, l.Namespace, err)
+	}
+	if obj == nil {
+		return nil, nil
+	}
+	lease, err := leaseFromObject(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode lock %q in namespace %q: %v", l.Name, l.Namespace, err)
+	}
+	return lease, nil
+}
+
+// apply applies the Lease of the lock, renewed at now, with server-side apply. If force is true,
+// the Lease is taken over from another holder.
+func (l *Lock) apply(ctx context.Context, now time.Time, force bool) error {
+	leaseString, err := l.encode(now)
+	if err != nil {
+		return err
+	}
+	return l.ks.ServerSideApplyFromString(ctx, leaseString, l.Namespace, fieldManagerPrefix+l.Holder, force)
+}
+
+// encode returns the YAML of the Lease of the lock, renewed at now.
+func (l *Lock) encode(now time.Time) (string, error) {
+	duration := int32(l.Duration / time.Second)
+	acquireTime := metav1.NewMicroTime(l.acquireTime)
+	renewTime := metav1.NewMicroTime(now)
+	transitions := l.transitions
+	lease := &coordinationv1.Lease{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.Name,
+			Namespace: l.Namespace,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &l.Holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &acquireTime,
+			RenewTime:            &renewTime,
+			LeaseTransitions:     &transitions,
+		},
+	}
+	asMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(lease)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert lock to unstructured: %v", err)
+	}
+	// Remove the null metadata.creationTimestamp from the output YAML.
+	unstructured.RemoveNestedField(asMap, "metadata", "creationTimestamp")
+	return resource.EncodeToYAMLString(&resource.Object{Unstructured: &unstructured.Unstructured{Object: asMap}})
+}
+
+func leaseFromObject(obj *resource.Object) (*coordinationv1.Lease, error) {
+	lease := &coordinationv1.Lease{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Unstructured.Object, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+func holderIdentity(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
+
+func transitions(lease *coordinationv1.Lease) int32 {
+	if lease.Spec.LeaseTransitions == nil {
+		return 0
+	}
+	return *lease.Spec.LeaseTransitions
+}
+
+// renewTime returns when a Lease was last renewed, or acquired if it was never renewed.
+func renewTime(lease *coordinationv1.Lease) time.Time {
+	if lease.Spec.RenewTime != nil {
+		return lease.Spec.RenewTime.Time
+	}
+	if lease.Spec.AcquireTime != nil {
+		return lease.Spec.AcquireTime.Time
+	}
+	return time.Time{}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,420 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+// leaseKubectl records the Leases that are applied with server-side apply, whose contents are not
+// deterministic.
+type leaseKubectl struct {
+	*testservices.TestKubectl
+
+	applyErrs []error
+	applied   []appliedLease
+}
+
+type appliedLease struct {
+	lease          *coordinationv1.Lease
+	fieldManager   string
+	forceConflicts bool
+}
+
+func (k *leaseKubectl) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	obj, err := resource.DecodeFromYAML(ctx, []byte(configString))
+	if err != nil {
+		return err
+	}
+	lease, err := leaseFromObject(obj)
+	if err != nil {
+		return err
+	}
+	k.applied = append(k.applied, appliedLease{
+		lease:          lease,
+		fieldManager:   fieldManager,
+		forceConflicts: forceConflicts,
+	})
+	if len(k.applyErrs) > 0 {
+		err, k.applyErrs = k.applyErrs[0], k.applyErrs[1:]
+		return err
+	}
+	return nil
+}
+
+// testLogger records the warnings of a lock.
+type testLogger struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (l *testLogger) Printf(format string, a ...interface{}) {}
+
+func (l *testLogger) Warnf(format string, a ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(format, a...))
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	ctx := context.Background()
+	retryInterval = 10 * time.Millisecond
+
+	now := time.Now()
+	errConflict := &services.KubernetesError{
+		Reason:  metav1.StatusReasonConflict,
+		Code:    409,
+		Message: "Apply failed with 1 conflict: conflict with \"gke-deploy-lock-build-2\": .spec.holderIdentity",
+	}
+
+	tests := []struct {
+		name string
+
+		// leases are the Leases that exist each time the lock is checked, which does not exist if
+		// nil.
+		leases    []*coordinationv1.Lease
+		applyErrs []error
+		timeout   time.Duration
+
+		wantApplied     []bool
+		wantTransitions int32
+		wantErr         string
+	}{{
+		name: "Lock does not exist",
+
+		leases: []*coordinationv1.Lease{nil},
+
+		wantApplied: []bool{false},
+	}, {
+		name: "Lock held by the same holder",
+
+		leases: []*coordinationv1.Lease{newLease("build-1", now, 2)},
+
+		wantApplied:     []bool{false},
+		wantTransitions: 2,
+	}, {
+		name: "Wait for lock to be released",
+
+		leases:  []*coordinationv1.Lease{newLease("build-2", now, 0), newLease("build-2", now, 0), nil},
+		timeout: time.Minute,
+
+		wantApplied: []bool{false},
+	}, {
+		name: "Take over stale lock",
+
+		leases: []*coordinationv1.Lease{newLease("build-2", now.Add(-2*time.Minute), 1)},
+
+		wantApplied:     []bool{true},
+		wantTransitions: 2,
+	}, {
+		name: "Lock acquired by another holder first",
+
+		leases:    []*coordinationv1.Lease{nil, newLease("build-2", now, 0), nil},
+		applyErrs: []error{errConflict},
+		timeout:   time.Minute,
+
+		wantApplied: []bool{false, false},
+	}, {
+		name: "Time out waiting for lock",
+
+		leases: []*coordinationv1.Lease{newLease("build-2", now, 0)},
+
+		wantErr: "timed out after 0s waiting for lock \"gke-deploy.lock.test-app\" in namespace \"foobar\" held by \"build-2\"",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var getResponses []testservices.GetResponse
+			for _, lease := range tc.leases {
+				getResponses = append(getResponses, leaseGetResponses(t, lease)...)
+			}
+			if tc.wantErr == "" {
+				// The lock is checked before it is released.
+				acquired := newLease("build-1", now, tc.wantTransitions)
+				getResponses = append(getResponses, leaseGetResponses(t, acquired)...)
+			}
+			ks := &leaseKubectl{
+				TestKubectl: &testservices.TestKubectl{
+					GetResponse: map[string]map[string][]testservices.GetResponse{
+						"Lease": {
+							"gke-deploy.lock.test-app": getResponses,
+						},
+					},
+				},
+				applyErrs: tc.applyErrs,
+			}
+			if tc.wantErr == "" {
+				ks.DeleteWithPreconditionsResponse = map[string]map[string][]testservices.DeleteWithPreconditionsResponse{
+					"Lease": {
+						"gke-deploy.lock.test-app": {{UID: "uid-build-1", ResourceVersion: "1", Err: nil}},
+					},
+				}
+			}
+
+			l := New("test-app", "foobar", "build-1", time.Minute, ks, &testLogger{})
+			_, err := l.Acquire(ctx, tc.timeout)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("Acquire(ctx, %v) = %v; want %q", tc.timeout, err, tc.wantErr)
+				}
+				if len(ks.applied) != 0 {
+					t.Errorf("Acquire(ctx, %v) applied %d Leases; want 0", tc.timeout, len(ks.applied))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Acquire(ctx, %v) = %v; want <nil>", tc.timeout, err)
+			}
+			if err := l.Release(ctx); err != nil {
+				t.Fatalf("Release(ctx) = %v; want <nil>", err)
+			}
+
+			if len(ks.applied) != len(tc.wantApplied) {
+				t.Fatalf("Acquire(ctx, %v) applied %d Leases; want %d", tc.timeout, len(ks.applied), len(tc.wantApplied))
+			}
+			for i, a := range ks.applied {
+				if a.forceConflicts != tc.wantApplied[i] {
+					t.Errorf("Acquire(ctx, %v) applied Lease %d with forceConflicts %v; want %v", tc.timeout, i, a.forceConflicts, tc.wantApplied[i])
+				}
+				if got, want := a.fieldManager, "gke-deploy-lock-build-1"; got != want {
+					t.Errorf("Acquire(ctx, %v) applied Lease %d with field manager %q; want %q", tc.timeout, i, got, want)
+				}
+			}
+			last := ks.applied[len(ks.applied)-1].lease
+			if got := holderIdentity(last); got != "build-1" {
+				t.Errorf("Acquire(ctx, %v) applied Lease held by %q; want %q", tc.timeout, got, "build-1")
+			}
+			if got := transitions(last); got != tc.wantTransitions {
+				t.Errorf("Acquire(ctx, %v) applied Lease with %d transitions; want %d", tc.timeout, got, tc.wantTransitions)
+			}
+			if last.Name != "gke-deploy.lock.test-app" || last.Namespace != "foobar" {
+				t.Errorf("Acquire(ctx, %v) applied Lease %s/%s; want foobar/gke-deploy.lock.test-app", tc.timeout, last.Namespace, last.Name)
+			}
+			if len(ks.GetResponse) != 0 {
+				t.Errorf("Acquire(ctx, %v) did not get all of the expected Leases. got %v; want []", tc.timeout, ks.GetResponse)
+			}
+			if len(ks.DeleteWithPreconditionsResponse) != 0 {
+				t.Errorf("Release(ctx) did not delete the Lease. got %v; want []", ks.DeleteWithPreconditionsResponse)
+			}
+		})
+	}
+}
+
+func TestReleaseTakenOver(t *testing.T) {
+	ctx := context.Background()
+
+	ks := &leaseKubectl{
+		TestKubectl: &testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Lease": {
+					"gke-deploy.lock.test-app": leaseGetResponses(t, newLease("build-2", time.Now(), 1)),
+				},
+			},
+		},
+	}
+	l := New("test-app", "foobar", "build-1", time.Minute, ks, &testLogger{})
+	if err := l.Release(ctx); err == nil || !strings.Contains(err.Error(), "taken over by \"build-2\"") {
+		t.Errorf("Release(ctx) = %v; want error containing %q", err, "taken over by \"build-2\"")
+	}
+}
+
+func TestReleaseTakenOverWhileReleasing(t *testing.T) {
+	ctx := context.Background()
+
+	ks := &leaseKubectl{
+		TestKubectl: &testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Lease": {
+					"gke-deploy.lock.test-app": leaseGetResponses(t, newLease("build-1", time.Now(), 0)),
+				},
+			},
+			// The Lease was taken over after it was checked, so its resource version changed.
+			DeleteWithPreconditionsResponse: map[string]map[string][]testservices.DeleteWithPreconditionsResponse{
+				"Lease": {
+					"gke-deploy.lock.test-app": {{
+						UID:             "uid-build-1",
+						ResourceVersion: "1",
+						Err: &services.KubernetesError{
+							Reason:  metav1.StatusReasonConflict,
+							Code:    409,
+							Message: "Operation cannot be fulfilled on leases.coordination.k8s.io \"gke-deploy.lock.test-app\": the ResourceVersion in the precondition (1) does not match the ResourceVersion in record (2)",
+						},
+					}},
+				},
+			},
+		},
+	}
+	l := New("test-app", "foobar", "build-1", time.Minute, ks, &testLogger{})
+	if err := l.Release(ctx); err == nil || !strings.Contains(err.Error(), "was taken over while it was released") {
+		t.Errorf("Release(ctx) = %v; want error containing %q", err, "was taken over while it was released")
+	}
+	if len(ks.DeleteWithPreconditionsResponse) != 0 {
+		t.Errorf("Release(ctx) did not try to delete the Lease. got %v; want []", ks.DeleteWithPreconditionsResponse)
+	}
+}
+
+func TestLost(t *testing.T) {
+	ctx := context.Background()
+
+	errConflict := &services.KubernetesError{
+		Reason:  metav1.StatusReasonConflict,
+		Code:    409,
+		Message: "Apply failed with 1 conflict: conflict with \"gke-deploy-lock-build-2\": .spec.holderIdentity",
+	}
+
+	tests := []struct {
+		name string
+
+		renewErr error
+
+		wantLost string
+	}{{
+		name: "Taken over by another holder",
+
+		renewErr: errConflict,
+
+		wantLost: "lock \"gke-deploy.lock.test-app\" in namespace \"foobar\" was taken over by another holder",
+	}, {
+		name: "Failed to renew",
+
+		renewErr: fmt.Errorf("connection refused"),
+
+		wantLost: "failed to renew lock \"gke-deploy.lock.test-app\" in namespace \"foobar\": connection refused",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ks := &leaseKubectl{
+				TestKubectl: &testservices.TestKubectl{
+					GetResponse: map[string]map[string][]testservices.GetResponse{
+						"Lease": {
+							"gke-deploy.lock.test-app": leaseGetResponses(t, nil),
+						},
+					},
+				},
+				applyErrs: []error{nil, tc.renewErr},
+			}
+			log := &testLogger{}
+			l := New("test-app", "foobar", "build-1", 30*time.Millisecond, ks, log)
+			lockCtx, err := l.Acquire(ctx, 0)
+			if err != nil {
+				t.Fatalf("Acquire(ctx, 0) = _, %v; want <nil>", err)
+			}
+
+			select {
+			case <-lockCtx.Done():
+			case <-time.After(10 * time.Second):
+				t.Fatalf("Acquire(ctx, 0) returned a context that was not canceled after the lock was lost")
+			}
+			if err := l.Lost(); err == nil || err.Error() != tc.wantLost {
+				t.Errorf("Lost() = %v; want %q", err, tc.wantLost)
+			}
+			log.mu.Lock()
+			defer log.mu.Unlock()
+			if len(log.warnings) != 1 || !strings.Contains(log.warnings[0], tc.wantLost) {
+				t.Errorf("Lock warned %q; want a warning containing %q", log.warnings, tc.wantLost)
+			}
+		})
+	}
+}
+
+func TestStale(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+
+		lease *coordinationv1.Lease
+
+		want bool
+	}{{
+		name: "Renewed",
+
+		lease: newLease("build-1", now.Add(-30*time.Second), 0),
+
+		want: false,
+	}, {
+		name: "Not renewed",
+
+		lease: newLease("build-1", now.Add(-90*time.Second), 0),
+
+		want: true,
+	}, {
+		name: "No duration",
+
+		lease: &coordinationv1.Lease{},
+
+		want: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Stale(tc.lease, now); got != tc.want {
+				t.Errorf("Stale(%v, %v) = %v; want %v", tc.lease, now, got, tc.want)
+			}
+		})
+	}
+}
+
+// newLease returns a one minute Lease held by holder, which was last renewed at renewed.
+func newLease(holder string, renewed time.Time, leaseTransitions int32) *coordinationv1.Lease {
+	duration := int32(60)
+	renewTime := metav1.NewMicroTime(renewed)
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "gke-deploy.lock.test-app",
+			Namespace:       "foobar",
+			UID:             types.UID("uid-" + holder),
+			ResourceVersion: "1",
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &renewTime,
+			RenewTime:            &renewTime,
+			LeaseTransitions:     &leaseTransitions,
+		},
+	}
+}
+
+// leaseGetResponses returns the responses of getting a Lease, which does not exist if lease is nil.
+func leaseGetResponses(t *testing.T, lease *coordinationv1.Lease) []testservices.GetResponse {
+	if lease == nil {
+		return []testservices.GetResponse{{Res: "", Err: testservices.NotFoundError("Lease", "gke-deploy.lock.test-app")}}
+	}
+	l := &Lock{
+		Name:        lease.Name,
+		Namespace:   lease.Namespace,
+		Holder:      holderIdentity(lease),
+		Duration:    time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second,
+		acquireTime: lease.Spec.AcquireTime.Time,
+		transitions: transitions(lease),
+	}
+	s, err := l.encode(lease.Spec.RenewTime.Time)
+	if err != nil {
+		t.Fatalf("failed to encode Lease: %v", err)
+	}
+	// Deployed Leases have a UID and resource version, which the lock does not set.
+	obj, err := resource.DecodeFromYAML(nil, []byte(s))
+	if err != nil {
+		t.Fatalf("failed to decode Lease: %v", err)
+	}
+	obj.SetUID(lease.UID)
+	obj.SetResourceVersion(lease.ResourceVersion)
+	s, err = resource.EncodeToYAMLString(obj)
+	if err != nil {
+		t.Fatalf("failed to encode Lease: %v", err)
+	}
+	return []testservices.GetResponse{{Res: s, Err: nil}}
+}
@@ -0,0 +1,291 @@
+// Package openapi contains logic related to validating Kubernetes objects against OpenAPI schemas.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+const definitionRefPrefix = "#/definitions/"
+
+// Schema is an OpenAPI schema of a Kubernetes object or one of its fields. It has the subset of
+// OpenAPI v2 and v3 fields used by Kubernetes that are needed to validate objects.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"-"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	// GroupVersionKinds are the kinds of objects that a definition is the schema of.
+	GroupVersionKinds     []schema.GroupVersionKind `json:"x-kubernetes-group-version-kind,omitempty"`
+	PreserveUnknownFields bool                      `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool                      `json:"x-kubernetes-int-or-string,omitempty"`
+}
+
+// UnmarshalJSON unmarshals a schema. additionalProperties is either a schema or a boolean, where
+// true allows properties of any schema.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	type plain Schema
+	var fields struct {
+		plain
+		AdditionalProperties json.RawMessage `json:"additionalProperties,omitempty"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*s = Schema(fields.plain)
+	switch strings.TrimSpace(string(fields.AdditionalProperties)) {
+	case "", "false":
+	case "true":
+		s.AdditionalProperties = &Schema{}
+	default:
+		s.AdditionalProperties = &Schema{}
+		if err := json.Unmarshal(fields.AdditionalProperties, s.AdditionalProperties); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// document is an OpenAPI v2 document, such as the one served by the Kubernetes API server at
+// /openapi/v2.
+type document struct {
+	Definitions map[string]*Schema `json:"definitions"`
+}
+
+// Validator validates objects against the OpenAPI schemas of their kinds.
+type Validator struct {
+	definitions map[string]*Schema
+	kinds       map[schema.GroupVersionKind]*Schema
+}
+
+// NewValidator creates a Validator without any schemas.
+func NewValidator() *Validator {
+	return &Validator{
+		definitions: make(map[string]*Schema),
+		kinds:       make(map[schema.GroupVersionKind]*Schema),
+	}
+}
+
+// AddOpenAPISchema adds the definitions of an OpenAPI v2 document, such as the api/openapi-spec/swagger.json
+// file of a Kubernetes release, or the output of `kubectl get --raw /openapi/v2`.
+func (v *Validator) AddOpenAPISchema(data []byte) error {
+	var doc document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse OpenAPI schema: %v", err)
+	}
+	if len(doc.Definitions) == 0 {
+		return fmt.Errorf("OpenAPI schema has no definitions")
+	}
+	for name, s := range doc.Definitions {
+		v.definitions[name] = s
+		for _, gvk := range s.GroupVersionKinds {
+			v.kinds[gvk] = s
+		}
+	}
+	return nil
+}
+
+// AddCustomResourceDefinition adds the openAPIV3Schema of each version of a CustomResourceDefinition,
+// so that its custom resources are validated. Versions without a schema are not validated.
+func (v *Validator) AddCustomResourceDefinition(crd *resource.Object) error {
+	if kind := resource.ObjectKind(crd); kind != "CustomResourceDefinition" {
+		return fmt.Errorf("object with kind %q is not a CustomResourceDefinition", kind)
+	}
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return fmt.Errorf("CustomResourceDefinition %q must set spec.group and spec.names.kind", crd.GetName())
+	}
+
+	// apiextensions.k8s.io/v1beta1 CustomResourceDefinitions can set one schema for all versions.
+	var common map[string]interface{}
+	if s, ok, _ := unstructured.NestedMap(crd.Object, "spec", "validation", "openAPIV3Schema"); ok {
+		common = s
+	}
+	var versions []string
+	if version, ok, _ := unstructured.NestedString(crd.Object, "spec", "version"); ok && version != "" {
+		versions = append(versions, version)
+	}
+	schemas := make(map[string]map[string]interface{})
+	vs, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, item := range vs {
+		version, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		if name == "" {
+			continue
+		}
+		versions = append(versions, name)
+		if s, ok, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema"); ok {
+			schemas[name] = s
+		}
+	}
+
+	for _, version := range versions {
+		s, ok := schemas[version]
+		if !ok {
+			s = common
+		}
+		if s == nil {
+			continue
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return fmt.Errorf("failed to encode schema of version %q of CustomResourceDefinition %q: %v", version, crd.GetName(), err)
+		}
+		root := &Schema{}
+		if err := json.Unmarshal(data, root); err != nil {
+			return fmt.Errorf("failed to parse schema of version %q of CustomResourceDefinition %q: %v", version, crd.GetName(), err)
+		}
+		// Schemas of custom resources do not need to list the fields that every object has.
+		if root.Properties == nil {
+			root.Properties = make(map[string]*Schema)
+		}
+		for _, field := range []string{"apiVersion", "kind", "metadata"} {
+			if _, ok := root.Properties[field]; !ok {
+				root.Properties[field] = &Schema{}
+			}
+		}
+		v.kinds[schema.GroupVersionKind{Group: group, Version: version, Kind: kind}] = root
+	}
+	return nil
+}
+
+// Validate validates an object against the schema of its kind, and returns an error listing every
+// invalid field. Objects of kinds without a schema are not validated.
+func (v *Validator) Validate(obj *resource.Object) error {
+	s, ok := v.kinds[obj.GetObjectKind().GroupVersionKind()]
+	if !ok {
+		return nil
+	}
+	var errs []string
+	v.validate(s, obj.Object, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Strings(errs)
+	return fmt.Errorf("invalid object with kind %q and name %q:\n  %s", resource.ObjectKind(obj), obj.GetName(), strings.Join(errs, "\n  "))
+}
+
+// validate validates a value at path against a schema, and appends an error for each invalid field
+// to errs.
+func (v *Validator) validate(s *Schema, value interface{}, path string, errs *[]string) {
+	if s.Ref != "" {
+		ref, ok := v.definitions[strings.TrimPrefix(s.Ref, definitionRefPrefix)]
+		if !ok {
+			return
+		}
+		s = ref
+	}
+	if value == nil || s.PreserveUnknownFields && len(s.Properties) == 0 {
+		return
+	}
+
+	fail := func(format string, args ...interface{}) {
+		name := path
+		if name == "" {
+			name = "<root>"
+		}
+		*errs = append(*errs, fmt.Sprintf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if s.IntOrString {
+		switch value.(type) {
+		case string, int64, float64:
+		default:
+			fail("expected integer or string, got %s", typeOf(value))
+		}
+		return
+	}
+
+	switch typ := s.Type; {
+	case typ == "object" || typ == "" && (s.Properties != nil || s.AdditionalProperties != nil):
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			fail("expected object, got %s", typeOf(value))
+			return
+		}
+		for _, field := range s.Required {
+			if _, ok := m[field]; !ok {
+				fail("missing required field %q", field)
+			}
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fieldPath := k
+			if path != "" {
+				fieldPath = path + "." + k
+			}
+			if p, ok := s.Properties[k]; ok {
+				v.validate(p, m[k], fieldPath, errs)
+			} else if s.AdditionalProperties != nil {
+				v.validate(s.AdditionalProperties, m[k], fieldPath, errs)
+			} else if len(s.Properties) > 0 && !s.PreserveUnknownFields {
+				*errs = append(*errs, fmt.Sprintf("%s: unknown field", fieldPath))
+			}
+		}
+	case typ == "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("expected array, got %s", typeOf(value))
+			return
+		}
+		if s.Items == nil {
+			return
+		}
+		for i, item := range items {
+			v.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case typ == "integer" || typ == "number":
+		switch value.(type) {
+		case int64, float64:
+		default:
+			fail("expected %s, got %s", typ, typeOf(value))
+		}
+	case typ == "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("expected boolean, got %s", typeOf(value))
+		}
+	case typ == "string":
+		// Like kubectl, numbers and booleans are accepted as strings, e.g., for resource quantities.
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			fail("expected string, got %s", typeOf(value))
+		}
+	}
+}
+
+// typeOf returns the OpenAPI type name of a decoded value.
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
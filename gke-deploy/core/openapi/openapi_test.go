@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+
+		filename string
+
+		wantErrs []string
+	}{{
+		name: "Valid Deployment",
+
+		filename: "testing/deployment.yaml",
+	}, {
+		name: "Invalid Deployment",
+
+		filename: "testing/deployment-invalid.yaml",
+
+		wantErrs: []string{
+			"spec.replicas: expected integer, got string",
+			"spec.template.spec.hostNetwork: expected boolean, got string",
+			"spec.template.spec.contianers: unknown field",
+			`spec.template.spec: missing required field "containers"`,
+		},
+	}, {
+		name: "Valid custom resource",
+
+		filename: "testing/certificate.yaml",
+	}, {
+		name: "Invalid custom resource",
+
+		filename: "testing/certificate-invalid.yaml",
+
+		wantErrs: []string{
+			"spec.dnsName: unknown field",
+			`spec: missing required field "secretName"`,
+			"spec.port: expected integer or string, got object",
+		},
+	}, {
+		name: "Invalid custom resource of v1beta1 CustomResourceDefinition",
+
+		filename: "testing/backup-invalid.yaml",
+
+		wantErrs: []string{
+			"spec.retain: expected integer, got string",
+		},
+	}, {
+		name: "Kind without schema",
+
+		filename: "testing/configmap.yaml",
+	}}
+
+	v := NewValidator()
+	if err := v.AddOpenAPISchema(fileContents(t, "testing/swagger.json")); err != nil {
+		t.Fatalf("AddOpenAPISchema(testing/swagger.json) = %v; want <nil>", err)
+	}
+	for _, f := range []string{"testing/crd.yaml", "testing/crd-v1beta1.yaml"} {
+		if err := v.AddCustomResourceDefinition(newObjectFromFile(t, f)); err != nil {
+			t.Fatalf("AddCustomResourceDefinition(%s) = %v; want <nil>", f, err)
+		}
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.Validate(newObjectFromFile(t, tc.filename))
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Validate(%s) = %v; want <nil>", tc.filename, err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate(%s) = <nil>; want error", tc.filename)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate(%s) = %v; want error containing %q", tc.filename, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAddOpenAPISchemaErrors(t *testing.T) {
+	v := NewValidator()
+	for _, data := range []string{"not json", "{}"} {
+		if err := v.AddOpenAPISchema([]byte(data)); err == nil {
+			t.Errorf("AddOpenAPISchema(%q) = <nil>; want error", data)
+		}
+	}
+}
+
+func TestAddCustomResourceDefinitionErrors(t *testing.T) {
+	v := NewValidator()
+	filename := "testing/deployment.yaml"
+	if err := v.AddCustomResourceDefinition(newObjectFromFile(t, filename)); err == nil {
+		t.Errorf("AddCustomResourceDefinition(%s) = <nil>; want error", filename)
+	}
+}
+
+func newObjectFromFile(t *testing.T, filename string) *resource.Object {
+	obj, err := resource.DecodeFromYAML(context.Background(), fileContents(t, filename))
+	if err != nil {
+		t.Fatalf("failed to decode resource from file %s", filename)
+	}
+	return obj
+}
+
+func fileContents(t *testing.T, filename string) []byte {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file %s", filename)
+	}
+	return contents
+}
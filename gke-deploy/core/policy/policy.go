@@ -0,0 +1,290 @@
+// Package policy contains logic related to checking Kubernetes objects against policy rules.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// ReportFilename is the name of the file that a Report is saved to.
+const ReportFilename = "policy-report.json"
+
+// Severity is how a violation of a rule is handled.
+type Severity string
+
+const (
+	// SeverityError violations block deployment.
+	SeverityError Severity = "error"
+	// SeverityWarning violations are reported, but do not block deployment.
+	SeverityWarning Severity = "warning"
+	// SeverityIgnore turns a rule off.
+	SeverityIgnore Severity = "ignore"
+)
+
+// Names of rules.
+const (
+	RuleResourceRequests = "resource-requests"
+	RuleResourceLimits   = "resource-limits"
+	RuleImageDigest      = "image-digest"
+	RuleNoLatestTag      = "no-latest-tag"
+	RuleNoHostNetwork    = "no-host-network"
+	RuleNoPrivileged     = "no-privileged"
+	RuleLivenessProbe    = "liveness-probe"
+	RuleReadinessProbe   = "readiness-probe"
+)
+
+// rule checks the pod spec of an object, and returns a message for each violation.
+type rule struct {
+	severity Severity
+	check    func(kind string, spec map[string]interface{}) []string
+}
+
+// rules are the rules that objects are checked against, keyed by name, with their default severities.
+var rules = map[string]rule{
+	RuleResourceRequests: {SeverityWarning, checkContainers(allContainerFields, func(c map[string]interface{}) string {
+		if requests, _, _ := unstructured.NestedMap(c, "resources", "requests"); len(requests) == 0 {
+			return "does not set resource requests"
+		}
+		return ""
+	})},
+	RuleResourceLimits: {SeverityWarning, checkContainers(allContainerFields, func(c map[string]interface{}) string {
+		if limits, _, _ := unstructured.NestedMap(c, "resources", "limits"); len(limits) == 0 {
+			return "does not set resource limits"
+		}
+		return ""
+	})},
+	RuleImageDigest: {SeverityWarning, checkContainers(allContainerFields, func(c map[string]interface{}) string {
+		im, _, _ := unstructured.NestedString(c, "image")
+		if ref, err := name.ParseReference(im); err == nil {
+			if _, ok := ref.(name.Digest); ok {
+				return ""
+			}
+		}
+		return fmt.Sprintf("image %q is not pinned to a digest", im)
+	})},
+	RuleNoLatestTag: {SeverityError, checkContainers(allContainerFields, func(c map[string]interface{}) string {
+		im, _, _ := unstructured.NestedString(c, "image")
+		if ref, err := name.ParseReference(im); err == nil {
+			if tag, ok := ref.(name.Tag); ok && tag.TagStr() == "latest" {
+				return fmt.Sprintf("image %q uses the latest tag", im)
+			}
+		}
+		return ""
+	})},
+	RuleNoHostNetwork: {SeverityError, func(_ string, spec map[string]interface{}) []string {
+		if hostNetwork, _, _ := unstructured.NestedBool(spec, "hostNetwork"); hostNetwork {
+			return []string{"uses the host's network"}
+		}
+		return nil
+	}},
+	RuleNoPrivileged: {SeverityError, checkContainers(allContainerFields, func(c map[string]interface{}) string {
+		if privileged, _, _ := unstructured.NestedBool(c, "securityContext", "privileged"); privileged {
+			return "is privileged"
+		}
+		return ""
+	})},
+	RuleLivenessProbe: {SeverityWarning, checkServingContainers(func(c map[string]interface{}) string {
+		if _, ok := c["livenessProbe"]; !ok {
+			return "does not set a liveness probe"
+		}
+		return ""
+	})},
+	RuleReadinessProbe: {SeverityWarning, checkServingContainers(func(c map[string]interface{}) string {
+		if _, ok := c["readinessProbe"]; !ok {
+			return "does not set a readiness probe"
+		}
+		return ""
+	})},
+}
+
+// allContainerFields are the fields of a pod spec that list containers.
+var allContainerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// runToCompletionKinds are the kinds of objects whose Pods run to completion, so they are not probed.
+var runToCompletionKinds = map[string]bool{
+	"CronJob": true,
+	"Job":     true,
+}
+
+// checkContainers returns a rule check that calls check for each container listed in fields of a pod
+// spec. check returns a message if the container violates the rule, or an empty string otherwise.
+func checkContainers(fields []string, check func(c map[string]interface{}) string) func(string, map[string]interface{}) []string {
+	return func(_ string, spec map[string]interface{}) []string {
+		var messages []string
+		for _, field := range fields {
+			containers, _, _ := unstructured.NestedSlice(spec, field)
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if m := check(container); m != "" {
+					containerName, _, _ := unstructured.NestedString(container, "name")
+					messages = append(messages, fmt.Sprintf("container %q %s", containerName, m))
+				}
+			}
+		}
+		return messages
+	}
+}
+
+// checkServingContainers is like checkContainers, but only checks the long-running containers of
+// objects whose Pods do not run to completion.
+func checkServingContainers(check func(c map[string]interface{}) string) func(string, map[string]interface{}) []string {
+	checkFn := checkContainers([]string{"containers"}, check)
+	return func(kind string, spec map[string]interface{}) []string {
+		if runToCompletionKinds[kind] {
+			return nil
+		}
+		return checkFn(kind, spec)
+	}
+}
+
+// Policy is the severity of each rule, keyed by rule name.
+type Policy map[string]Severity
+
+// RuleConfig is an entry of a policy file.
+type RuleConfig struct {
+	Name     string   `json:"name"`
+	Severity Severity `json:"severity"`
+}
+
+// File is the contents of a policy file.
+type File struct {
+	Rules []RuleConfig `json:"rules"`
+}
+
+// DefaultPolicy returns a Policy with the default severity of each rule.
+func DefaultPolicy() Policy {
+	p := make(Policy)
+	for n, r := range rules {
+		p[n] = r.severity
+	}
+	return p
+}
+
+// ParsePolicy returns a Policy with the severities of rules listed in a YAML policy file, e.g.,
+//
+//	rules:
+//	- name: image-digest
+//	  severity: error
+//	- name: liveness-probe
+//	  severity: ignore
+//
+// Rules that are not listed keep their default severity.
+func ParsePolicy(data []byte) (Policy, error) {
+	var f File
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %v", err)
+	}
+	p := DefaultPolicy()
+	for _, rc := range f.Rules {
+		if _, ok := rules[rc.Name]; !ok {
+			return nil, fmt.Errorf("unknown rule %q, must be one of %s", rc.Name, strings.Join(RuleNames(), ", "))
+		}
+		switch rc.Severity {
+		case SeverityError, SeverityWarning, SeverityIgnore:
+		default:
+			return nil, fmt.Errorf("severity %q of rule %q must be one of %q, %q, or %q", rc.Severity, rc.Name, SeverityError, SeverityWarning, SeverityIgnore)
+		}
+		p[rc.Name] = rc.Severity
+	}
+	return p, nil
+}
+
+// RuleNames returns the sorted names of all rules.
+func RuleNames() []string {
+	names := make([]string, 0, len(rules))
+	for n := range rules {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Violation is a violation of a rule by an object.
+type Violation struct {
+	Rule      string   `json:"rule"`
+	Severity  Severity `json:"severity"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Message   string   `json:"message"`
+}
+
+// String returns a one-line description of a violation, e.g.,
+// `error: Deployment "my-app": container "my-app" is privileged (no-privileged)`.
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s %q: %s (%s)", v.Severity, v.Kind, v.Name, v.Message, v.Rule)
+}
+
+// Report lists the violations of a policy by objects.
+type Report struct {
+	Violations []Violation `json:"violations"`
+	Errors     int         `json:"errors"`
+	Warnings   int         `json:"warnings"`
+}
+
+// JSON returns a report encoded as indented JSON.
+func (r *Report) JSON() ([]byte, error) {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy report: %v", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// Check checks the pod specs of objects against the rules of a policy, and returns a report of
+// violations. Pod templates are found with paths, and objects without a pod template are not
+// checked.
+func Check(objs resource.Objects, paths resource.PodTemplatePaths, p Policy) (*Report, error) {
+	report := &Report{
+		Violations: []Violation{},
+	}
+	names := RuleNames()
+	for _, obj := range objs {
+		path, ok := paths.Path(obj)
+		if !ok {
+			continue
+		}
+		specFields := append(append([]string{}, path...), "spec")
+		spec, found, err := unstructured.NestedMap(obj.Object, specFields...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s field: %v", strings.Join(specFields, "."), err)
+		}
+		if !found {
+			continue
+		}
+		kind := resource.ObjectKind(obj)
+		for _, n := range names {
+			severity := p[n]
+			if severity == "" || severity == SeverityIgnore {
+				continue
+			}
+			for _, m := range rules[n].check(kind, spec) {
+				report.Violations = append(report.Violations, Violation{
+					Rule:      n,
+					Severity:  severity,
+					Kind:      kind,
+					Name:      obj.GetName(),
+					Namespace: obj.GetNamespace(),
+					Message:   m,
+				})
+				if severity == SeverityError {
+					report.Errors++
+				} else {
+					report.Warnings++
+				}
+			}
+		}
+	}
+	return report, nil
+}
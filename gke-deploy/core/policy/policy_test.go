@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+const (
+	testCompliantDeploymentFile    = "testing/deployment-compliant.yaml"
+	testNoncompliantDeploymentFile = "testing/deployment-noncompliant.yaml"
+	testJobFile                    = "testing/job.yaml"
+	testServiceFile                = "testing/service.yaml"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+
+		objs   resource.Objects
+		policy Policy
+
+		want *Report
+	}{{
+		name: "Compliant objects",
+
+		objs: resource.Objects{
+			newObjectFromFile(t, testCompliantDeploymentFile),
+			newObjectFromFile(t, testJobFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+		policy: DefaultPolicy(),
+
+		want: &Report{
+			Violations: []Violation{},
+		},
+	}, {
+		name: "Noncompliant object",
+
+		objs: resource.Objects{
+			newObjectFromFile(t, testNoncompliantDeploymentFile),
+		},
+		policy: DefaultPolicy(),
+
+		want: &Report{
+			Violations: []Violation{{
+				Rule:      RuleImageDigest,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "init" image "busybox" is not pinned to a digest`,
+			}, {
+				Rule:      RuleImageDigest,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" image "gcr.io/my-project/test-app:1.0.0" is not pinned to a digest`,
+			}, {
+				Rule:      RuleLivenessProbe,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" does not set a liveness probe`,
+			}, {
+				Rule:      RuleNoHostNetwork,
+				Severity:  SeverityError,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   "uses the host's network",
+			}, {
+				Rule:      RuleNoLatestTag,
+				Severity:  SeverityError,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "init" image "busybox" uses the latest tag`,
+			}, {
+				Rule:      RuleNoPrivileged,
+				Severity:  SeverityError,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" is privileged`,
+			}, {
+				Rule:      RuleReadinessProbe,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" does not set a readiness probe`,
+			}, {
+				Rule:      RuleResourceLimits,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" does not set resource limits`,
+			}, {
+				Rule:      RuleResourceRequests,
+				Severity:  SeverityWarning,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" does not set resource requests`,
+			}},
+			Errors:   3,
+			Warnings: 6,
+		},
+	}, {
+		name: "Rules with custom severity",
+
+		objs: resource.Objects{
+			newObjectFromFile(t, testNoncompliantDeploymentFile),
+		},
+		policy: Policy{
+			RuleImageDigest:   SeverityError,
+			RuleNoHostNetwork: SeverityIgnore,
+		},
+
+		want: &Report{
+			Violations: []Violation{{
+				Rule:      RuleImageDigest,
+				Severity:  SeverityError,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "init" image "busybox" is not pinned to a digest`,
+			}, {
+				Rule:      RuleImageDigest,
+				Severity:  SeverityError,
+				Kind:      "Deployment",
+				Name:      "test-app",
+				Namespace: "default",
+				Message:   `container "test-app" image "gcr.io/my-project/test-app:1.0.0" is not pinned to a digest`,
+			}},
+			Errors: 2,
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Check(tc.objs, nil, tc.policy)
+			if err != nil {
+				t.Fatalf("Check(%v, %v) = _, %v; want _, <nil>", tc.objs, tc.policy, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Check(%v, %v) produced diff (-want +got):\n%s", tc.objs, tc.policy, diff)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	want := DefaultPolicy()
+	want[RuleImageDigest] = SeverityError
+	want[RuleNoHostNetwork] = SeverityWarning
+	want[RuleLivenessProbe] = SeverityIgnore
+	want[RuleReadinessProbe] = SeverityIgnore
+
+	got, err := ParsePolicy(fileContents(t, "testing/policy.yaml"))
+	if err != nil {
+		t.Fatalf("ParsePolicy(testing/policy.yaml) = _, %v; want _, <nil>", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParsePolicy(testing/policy.yaml) produced diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		filename string
+	}{{
+		name: "Unknown rule",
+
+		filename: "testing/policy-unknown-rule.yaml",
+	}, {
+		name: "Invalid severity",
+
+		filename: "testing/policy-invalid-severity.yaml",
+	}, {
+		name: "Unknown field",
+
+		filename: "testing/policy-unknown-field.yaml",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := ParsePolicy(fileContents(t, tc.filename)); got != nil || err == nil {
+				t.Errorf("ParsePolicy(%s) = %v, %v; want <nil>, error", tc.filename, got, err)
+			}
+		})
+	}
+}
+
+func newObjectFromFile(t *testing.T, filename string) *resource.Object {
+	obj, err := resource.DecodeFromYAML(context.Background(), fileContents(t, filename))
+	if err != nil {
+		t.Fatalf("failed to decode resource from file %s", filename)
+	}
+	return obj
+}
+
+func fileContents(t *testing.T, filename string) []byte {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file %s", filename)
+	}
+	return contents
+}
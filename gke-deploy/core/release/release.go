@@ -0,0 +1,206 @@
+// Package release contains logic related to records of deployed applications, which are stored as
+// Secrets in the cluster they were deployed to.
+package release
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+const (
+	// NameLabelKey is the label of release Secrets whose value is the name of the released
+	// application. It is different from app.kubernetes.io/name so that release Secrets are never
+	// pruned as objects of the application.
+	NameLabelKey = "gke-deploy.cloud.google.com/release"
+	// RevisionLabelKey is the label of release Secrets whose value is the revision of the release.
+	RevisionLabelKey = "gke-deploy.cloud.google.com/revision"
+
+	// SecretType is the type of release Secrets.
+	SecretType = "gke-deploy.cloud.google.com/release.v1"
+
+	// dataKey is the key of release Secrets' data that holds the encoded release.
+	dataKey = "release"
+)
+
+// Release is a record of an application deployed to a namespace.
+type Release struct {
+	Name        string    `json:"name"`
+	Namespace   string    `json:"namespace"`
+	Revision    int       `json:"revision"`
+	Version     string    `json:"version,omitempty"`
+	Images      []string  `json:"images,omitempty"`
+	BuildID     string    `json:"buildID,omitempty"`
+	Description string    `json:"description,omitempty"`
+	DeployedAt  time.Time `json:"deployedAt"`
+	// Manifests are the gzip-compressed, "---"-delimited YAML of the deployed objects.
+	Manifests []byte `json:"manifests"`
+}
+
+// New creates a release of objs, whose manifests are compressed. Objects must be in the namespaces
+// they were deployed to, so that they are redeployed to the same namespaces. The images of the
+// release are those of the pod templates of objs, which are found with paths.
+func New(name, namespace string, revision int, objs resource.Objects, paths resource.PodTemplatePaths) (*Release, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	images := make(map[string]bool)
+	for i, obj := range objs {
+		if i > 0 {
+			if _, err := zw.Write([]byte("---\n")); err != nil {
+				return nil, fmt.Errorf("failed to compress manifests: %v", err)
+			}
+		}
+		s, err := resource.EncodeToYAMLString(obj)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write([]byte(s)); err != nil {
+			return nil, fmt.Errorf("failed to compress manifests: %v", err)
+		}
+		if err := resource.UpdateContainerImages(context.Background(), resource.Objects{obj}, paths, func(_ *resource.Object, _, image string) (string, error) {
+			images[image] = true
+			return image, nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get images of objects: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress manifests: %v", err)
+	}
+
+	r := &Release{
+		Name:       name,
+		Namespace:  namespace,
+		Revision:   revision,
+		DeployedAt: time.Now().UTC().Truncate(time.Second),
+		Manifests:  buf.Bytes(),
+	}
+	for image := range images {
+		r.Images = append(r.Images, image)
+	}
+	sort.Strings(r.Images)
+	return r, nil
+}
+
+// Objects decompresses and decodes the manifests of a release.
+func (r *Release) Objects(ctx context.Context) (resource.Objects, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(r.Manifests))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifests of revision %d: %v", r.Revision, err)
+	}
+	defer zr.Close()
+	manifests, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress manifests of revision %d: %v", r.Revision, err)
+	}
+	return resource.ParseConfigsFromYAML(ctx, string(manifests), fmt.Sprintf("revision %d", r.Revision), nil)
+}
+
+// SecretName returns the name of the Secret that stores a revision of an application's release.
+func SecretName(name string, revision int) string {
+	return fmt.Sprintf("gke-deploy.release.%s.v%d", name, revision)
+}
+
+// Selector returns the label selector of the Secrets that store the releases of an application.
+func Selector(name string) string {
+	return fmt.Sprintf("%s=%s", NameLabelKey, name)
+}
+
+// ToSecret encodes a release as a Secret.
+func (r *Release) ToSecret() (*resource.Object, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode release: %v", err)
+	}
+	obj := &resource.Object{Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"type":       SecretType,
+		"data": map[string]interface{}{
+			dataKey: base64.StdEncoding.EncodeToString(data),
+		},
+	}}}
+	obj.SetName(SecretName(r.Name, r.Revision))
+	obj.SetNamespace(r.Namespace)
+	obj.SetLabels(map[string]string{
+		NameLabelKey:     r.Name,
+		RevisionLabelKey: strconv.Itoa(r.Revision),
+	})
+	return obj, nil
+}
+
+// FromSecret decodes a release from a Secret.
+func FromSecret(obj *resource.Object) (*Release, error) {
+	if typ, _, _ := unstructured.NestedString(obj.Object, "type"); typ != SecretType {
+		return nil, fmt.Errorf("Secret %q has type %q, not %q", obj.GetName(), typ, SecretType)
+	}
+	encoded, ok, err := unstructured.NestedString(obj.Object, "data", dataKey)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("Secret %q does not have a %q data field", obj.GetName(), dataKey)
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode data of Secret %q: %v", obj.GetName(), err)
+	}
+	r := &Release{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to decode release in Secret %q: %v", obj.GetName(), err)
+	}
+	return r, nil
+}
+
+// List returns the releases of an application in a namespace of the current context's cluster,
+// sorted by revision.
+func List(ctx context.Context, name, namespace string, ks services.KubectlService) ([]*Release, error) {
+	secrets, err := cluster.GetDeployedObjectsWithSelector(ctx, []string{"Secret"}, Selector(name), namespace, ks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get releases of %q in namespace %q: %v", name, namespace, err)
+	}
+	var releases []*Release
+	for _, s := range secrets {
+		r, err := FromSecret(s)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].Revision < releases[j].Revision
+	})
+	return releases, nil
+}
+
+// Find returns the release with a revision from releases sorted by revision. If revision is 0, the
+// release before the latest one is returned.
+func Find(releases []*Release, revision int) (*Release, error) {
+	if revision == 0 {
+		if len(releases) < 2 {
+			return nil, fmt.Errorf("no release before the latest one")
+		}
+		return releases[len(releases)-2], nil
+	}
+	for _, r := range releases {
+		if r.Revision == revision {
+			return r, nil
+		}
+	}
+	var revisions []string
+	for _, r := range releases {
+		revisions = append(revisions, strconv.Itoa(r.Revision))
+	}
+	return nil, fmt.Errorf("revision %d not found, available revisions: [%s]", revision, strings.Join(revisions, ", "))
+}
@@ -0,0 +1,230 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+const (
+	testDeploymentFile = "testing/deployment.yaml"
+	testServiceFile    = "testing/service.yaml"
+)
+
+func TestReleaseSecret(t *testing.T) {
+	ctx := context.Background()
+
+	objs := resource.Objects{
+		newObjectFromFile(t, testDeploymentFile),
+		newObjectFromFile(t, testServiceFile),
+	}
+	r, err := New("test-app", "foobar", 3, objs, nil)
+	if err != nil {
+		t.Fatalf("New(test-app, foobar, 3, %v) = _, %v; want _, <nil>", objs, err)
+	}
+	r.Version = "1.0.0"
+	r.BuildID = "build-1"
+
+	wantImages := []string{
+		"gcr.io/my-project/sidecar@sha256:2c7c73c049dafddcc82f61bd50c70a8061c301bb63065fca6cff1f1ef10b9afc",
+		"gcr.io/my-project/test-app@sha256:1c7c73c049dafddcc82f61bd50c70a8061c301bb63065fca6cff1f1ef10b9afc",
+	}
+	if diff := cmp.Diff(wantImages, r.Images); diff != "" {
+		t.Errorf("New(test-app, foobar, 3, %v) produced images with diff (-want +got):\n%s", objs, diff)
+	}
+
+	secret, err := r.ToSecret()
+	if err != nil {
+		t.Fatalf("ToSecret() = _, %v; want _, <nil>", err)
+	}
+	if got, want := secret.GetName(), "gke-deploy.release.test-app.v3"; got != want {
+		t.Errorf("ToSecret() has name %q; want %q", got, want)
+	}
+	if got, want := secret.GetNamespace(), "foobar"; got != want {
+		t.Errorf("ToSecret() has namespace %q; want %q", got, want)
+	}
+	wantLabels := map[string]string{
+		NameLabelKey:     "test-app",
+		RevisionLabelKey: "3",
+	}
+	if diff := cmp.Diff(wantLabels, secret.GetLabels()); diff != "" {
+		t.Errorf("ToSecret() produced labels with diff (-want +got):\n%s", diff)
+	}
+
+	got, err := FromSecret(secret)
+	if err != nil {
+		t.Fatalf("FromSecret(%v) = _, %v; want _, <nil>", secret, err)
+	}
+	if diff := cmp.Diff(r, got); diff != "" {
+		t.Errorf("FromSecret(ToSecret()) produced diff (-want +got):\n%s", diff)
+	}
+
+	gotObjs, err := got.Objects(ctx)
+	if err != nil {
+		t.Fatalf("Objects(ctx) = _, %v; want _, <nil>", err)
+	}
+	if len(gotObjs) != len(objs) {
+		t.Fatalf("Objects(ctx) = %v; want %v", gotObjs, objs)
+	}
+	for i := range objs {
+		if diff := cmp.Diff(objs[i].Object, gotObjs[i].Object); diff != "" {
+			t.Errorf("Objects(ctx) produced object %d with diff (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestFromSecretErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		filename string
+	}{{
+		name: "Not a release",
+
+		filename: testServiceFile,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			obj := newObjectFromFile(t, tc.filename)
+			if got, err := FromSecret(obj); got != nil || err == nil {
+				t.Errorf("FromSecret(%v) = %v, %v; want <nil>, error", obj, got, err)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+
+	var secrets []*resource.Object
+	for _, revision := range []int{2, 1} {
+		r, err := New("test-app", "foobar", revision, resource.Objects{newObjectFromFile(t, testServiceFile)}, nil)
+		if err != nil {
+			t.Fatalf("failed to create release: %v", err)
+		}
+		s, err := r.ToSecret()
+		if err != nil {
+			t.Fatalf("failed to encode release: %v", err)
+		}
+		secrets = append(secrets, s)
+	}
+
+	ks := &testservices.TestKubectl{
+		GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+			Selector("test-app"): {
+				"foobar": {
+					{
+						Res: listYAML(t, secrets...),
+						Err: nil,
+					},
+				},
+			},
+		},
+	}
+	got, err := List(ctx, "test-app", "foobar", ks)
+	if err != nil {
+		t.Fatalf("List(ctx, test-app, foobar, ks) = _, %v; want _, <nil>", err)
+	}
+	if len(got) != 2 || got[0].Revision != 1 || got[1].Revision != 2 {
+		t.Errorf("List(ctx, test-app, foobar, ks) = %v; want releases with revisions [1 2]", got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	releases := []*Release{{Revision: 1}, {Revision: 2}, {Revision: 4}}
+
+	tests := []struct {
+		name string
+
+		releases []*Release
+		revision int
+
+		want    int
+		wantErr bool
+	}{{
+		name: "Revision",
+
+		releases: releases,
+		revision: 2,
+
+		want: 2,
+	}, {
+		name: "Previous revision",
+
+		releases: releases,
+
+		want: 2,
+	}, {
+		name: "Missing revision",
+
+		releases: releases,
+		revision: 3,
+
+		wantErr: true,
+	}, {
+		name: "No previous revision",
+
+		releases: releases[:1],
+
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Find(tc.releases, tc.revision)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Find(%v, %d) = %v, <nil>; want <nil>, error", tc.releases, tc.revision, got)
+				}
+				return
+			}
+			if err != nil || got.Revision != tc.want {
+				t.Errorf("Find(%v, %d) = %v, %v; want revision %d, <nil>", tc.releases, tc.revision, got, err, tc.want)
+			}
+		})
+	}
+}
+
+// listYAML encodes objects as a YAML list, like the output of `kubectl get -o yaml`.
+func listYAML(t *testing.T, objs ...*resource.Object) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: List\nitems:\n")
+	for _, obj := range objs {
+		s, err := resource.EncodeToYAMLString(obj)
+		if err != nil {
+			t.Fatalf("failed to encode object: %v", err)
+		}
+		for i, line := range strings.Split(strings.TrimSpace(s), "\n") {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			fmt.Fprintf(&b, "%s%s\n", prefix, line)
+		}
+	}
+	return b.String()
+}
+
+func newObjectFromFile(t *testing.T, filename string) *resource.Object {
+	obj, err := resource.DecodeFromYAML(context.Background(), fileContents(t, filename))
+	if err != nil {
+		t.Fatalf("failed to decode resource from file %s", filename)
+	}
+	return obj
+}
+
+func fileContents(t *testing.T, filename string) []byte {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read file %s", filename)
+	}
+	return contents
+}
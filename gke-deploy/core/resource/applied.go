@@ -0,0 +1,206 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PreviouslyAppliedConfig returns the configuration of a deployed object that was applied to it
+// before config is applied, so that re-applying it restores the deployed object without taking
+// ownership of fields that are set by other managers, e.g., replicas set by a
+// HorizontalPodAutoscaler.
+//
+// If serverSide is true, the result only has the fields of deployed that are owned by
+// fieldManager via server-side apply. Otherwise, the result is the deployed object's
+// kubectl.kubernetes.io/last-applied-configuration annotation. If deployed was not previously
+// applied, the result only has the fields of deployed that are set in config, i.e., the fields that
+// applying config takes ownership of.
+func PreviouslyAppliedConfig(deployed, config *Object, fieldManager string, serverSide bool) (*Object, error) {
+	var previous map[string]interface{}
+	if serverSide {
+		fields, err := managedFieldSet(deployed, fieldManager)
+		if err != nil {
+			return nil, err
+		}
+		if fields != nil {
+			p, ok := projectOntoFieldSet(RemoveServerPopulatedFields(deployed).Object, fields).(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("failed to convert object to map")
+			}
+			previous = p
+		}
+	} else if lastApplied, ok := deployed.GetAnnotations()[lastAppliedConfigAnnotationKey]; ok {
+		p, err := DecodeFromYAML(nil, []byte(lastApplied))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s annotation: %v", lastAppliedConfigAnnotationKey, err)
+		}
+		previous = p.Object
+	}
+	if previous == nil {
+		p, ok := projectOnto(RemoveServerPopulatedFields(deployed).Object, []interface{}{config.Object}).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to convert object to map")
+		}
+		previous = p
+	}
+
+	obj := &Object{
+		&unstructured.Unstructured{
+			Object: previous,
+		},
+	}
+	// The identifying fields of an object are not part of its managed fields.
+	obj.SetAPIVersion(deployed.GetAPIVersion())
+	obj.SetKind(deployed.GetKind())
+	obj.SetName(deployed.GetName())
+	if ns := deployed.GetNamespace(); ns != "" {
+		obj.SetNamespace(ns)
+	}
+	return obj, nil
+}
+
+// managedFieldSet returns the set of fields of obj that are owned by fieldManager via server-side
+// apply, merged across its metadata.managedFields entries. It returns nil if fieldManager does not
+// own any fields of obj.
+func managedFieldSet(obj *Object, fieldManager string) (map[string]interface{}, error) {
+	entries, _, err := unstructured.NestedSlice(obj.Object, "metadata", "managedFields")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get managed fields: %v", err)
+	}
+	var fields map[string]interface{}
+	for _, e := range entries {
+		entry, ok := e.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("failed to get managed fields: entry is not a map")
+		}
+		if entry["manager"] != fieldManager || entry["operation"] != "Apply" {
+			continue
+		}
+		set, ok := entry["fieldsV1"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields = mergeFieldSets(fields, set)
+	}
+	return fields, nil
+}
+
+// mergeFieldSets returns the union of two sets of fields in the fieldsV1 format.
+func mergeFieldSets(a, b map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		bm, _ := v.(map[string]interface{})
+		if am, ok := out[k].(map[string]interface{}); ok {
+			out[k] = mergeFieldSets(am, bm)
+		} else {
+			out[k] = mergeFieldSets(nil, bm)
+		}
+	}
+	return out
+}
+
+// projectOntoFieldSet returns v with only the fields in fields, a set of fields in the fieldsV1
+// format. Map keys are prefixed with "f:", and list items are identified by their keys ("k:"),
+// their values ("v:"), or their indexes ("i:").
+func projectOntoFieldSet(v interface{}, fields map[string]interface{}) interface{} {
+	if !hasChildFields(fields) {
+		// The whole value is owned.
+		return v
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, sub := range fields {
+			if !strings.HasPrefix(k, "f:") {
+				continue
+			}
+			name := strings.TrimPrefix(k, "f:")
+			child, ok := val[name]
+			if !ok {
+				continue
+			}
+			subFields, _ := sub.(map[string]interface{})
+			out[name] = projectOntoFieldSet(child, subFields)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(val))
+		for i, item := range val {
+			for k, sub := range fields {
+				if !listItemMatches(i, item, k) {
+					continue
+				}
+				subFields, _ := sub.(map[string]interface{})
+				out = append(out, projectOntoFieldSet(item, subFields))
+				break
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// hasChildFields returns true if fields has any fields other than the value itself (".").
+func hasChildFields(fields map[string]interface{}) bool {
+	for k := range fields {
+		if k != "." {
+			return true
+		}
+	}
+	return false
+}
+
+// listItemMatches returns true if the list item at index i is identified by key, a key of a set of
+// fields in the fieldsV1 format.
+func listItemMatches(i int, item interface{}, key string) bool {
+	switch {
+	case strings.HasPrefix(key, "i:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(key, "i:"))
+		return err == nil && n == i
+	case strings.HasPrefix(key, "v:"):
+		var want interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "v:")), &want); err != nil {
+			return false
+		}
+		return jsonEqual(item, want)
+	case strings.HasPrefix(key, "k:"):
+		var want map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(key, "k:")), &want); err != nil {
+			return false
+		}
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range want {
+			if !jsonEqual(m[k], v) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// jsonEqual returns true if a and b have the same JSON encoding. This ignores differences between
+// numeric types, e.g., int64 values of decoded objects and float64 values of decoded JSON.
+func jsonEqual(a, b interface{}) bool {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(aj) == string(bj)
+}
@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPreviouslyAppliedConfig(t *testing.T) {
+	tests := []struct {
+		name string
+
+		deployed   *Object
+		config     *Object
+		serverSide bool
+
+		want *Object
+	}{{
+		name: "Fields owned by field manager",
+
+		deployed:   newObjectFromFile(t, "testing/deployment-managed-fields.yaml"),
+		config:     newObjectFromFile(t, "testing/deployment-managed-fields-config.yaml"),
+		serverSide: true,
+
+		want: newObjectFromFile(t, "testing/deployment-managed-fields-applied.yaml"),
+	}, {
+		name: "Field manager does not own any fields",
+
+		deployed:   newObjectFromFile(t, "testing/deployment-managed-fields.yaml"),
+		config:     newObjectFromFile(t, "testing/deployment-managed-fields-config.yaml"),
+		serverSide: false,
+
+		want: newObjectFromFile(t, "testing/deployment-managed-fields-configured.yaml"),
+	}, {
+		name: "Last applied configuration",
+
+		deployed:   newObjectFromFile(t, "testing/deployment-ready.yaml"),
+		config:     newObjectFromFile(t, "testing/deployment.yaml"),
+		serverSide: false,
+
+		want: newObjectFromFile(t, "testing/deployment-ready-last-applied.yaml"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := PreviouslyAppliedConfig(tc.deployed, tc.config, "gke-deploy", tc.serverSide); !reflect.DeepEqual(got, tc.want) || err != nil {
+				t.Errorf("PreviouslyAppliedConfig(%v, %v, gke-deploy, %t) = %v, %v; want %v, <nil>", tc.deployed, tc.config, tc.serverSide, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPreviouslyAppliedConfigErrors(t *testing.T) {
+	deployed := newObjectFromFile(t, "testing/deployment.yaml")
+	deployed.SetAnnotations(map[string]string{
+		lastAppliedConfigAnnotationKey: "{not json",
+	})
+	config := newObjectFromFile(t, "testing/deployment.yaml")
+
+	if got, err := PreviouslyAppliedConfig(deployed, config, "gke-deploy", false); err == nil {
+		t.Errorf("PreviouslyAppliedConfig(%v, %v, gke-deploy, false) = %v, <nil>; want error", deployed, config, got)
+	}
+}
@@ -0,0 +1,98 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RemoveUnconfiguredFields returns a copy of a deployed object that only has the fields that are
+// set in config or in the deployed object's kubectl.kubernetes.io/last-applied-configuration
+// annotation. Fields populated by the API server are removed as well. This drops fields that were
+// defaulted or set by other controllers, so that the result can be compared with config.
+func RemoveUnconfiguredFields(deployed, config *Object) (*Object, error) {
+	templates := []interface{}{config.Object}
+	if lastApplied, ok := deployed.GetAnnotations()[lastAppliedConfigAnnotationKey]; ok {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(lastApplied), &m); err != nil {
+			return nil, fmt.Errorf("failed to parse %s annotation: %v", lastAppliedConfigAnnotationKey, err)
+		}
+		templates = append(templates, m)
+	}
+	projected, ok := projectOnto(RemoveServerPopulatedFields(deployed).Object, templates).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to convert object to map")
+	}
+	return &Object{
+		&unstructured.Unstructured{
+			Object: projected,
+		},
+	}, nil
+}
+
+// projectOnto returns v with only the map keys that exist at the same path in any of templates.
+// List items are matched by index, and items without a matching template item are kept as is.
+func projectOnto(v interface{}, templates []interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		var tmplMaps []map[string]interface{}
+		for _, t := range templates {
+			if m, ok := t.(map[string]interface{}); ok {
+				tmplMaps = append(tmplMaps, m)
+			}
+		}
+		if len(tmplMaps) == 0 {
+			return v
+		}
+		out := make(map[string]interface{})
+		for k, child := range val {
+			var childTemplates []interface{}
+			for _, m := range tmplMaps {
+				if c, ok := m[k]; ok {
+					childTemplates = append(childTemplates, c)
+				}
+			}
+			if len(childTemplates) == 0 {
+				continue
+			}
+			projected := projectOnto(child, childTemplates)
+			if m, ok := projected.(map[string]interface{}); ok && len(m) == 0 {
+				// Drop maps whose fields are all unconfigured, e.g., annotations that are only set by
+				// the API server.
+				if orig, ok := child.(map[string]interface{}); ok && len(orig) > 0 {
+					continue
+				}
+			}
+			out[k] = projected
+		}
+		return out
+	case []interface{}:
+		var tmplLists [][]interface{}
+		for _, t := range templates {
+			if l, ok := t.([]interface{}); ok {
+				tmplLists = append(tmplLists, l)
+			}
+		}
+		if len(tmplLists) == 0 {
+			return v
+		}
+		out := make([]interface{}, 0, len(val))
+		for i, child := range val {
+			var childTemplates []interface{}
+			for _, l := range tmplLists {
+				if i < len(l) {
+					childTemplates = append(childTemplates, l[i])
+				}
+			}
+			if len(childTemplates) == 0 {
+				out = append(out, child)
+				continue
+			}
+			out = append(out, projectOnto(child, childTemplates))
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,51 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRemoveUnconfiguredFields(t *testing.T) {
+	tests := []struct {
+		name string
+
+		deployed *Object
+		config   *Object
+
+		want *Object
+	}{{
+		name: "Keep fields in config and last applied configuration",
+
+		deployed: newObjectFromFile(t, "testing/deployment-ready.yaml"),
+		config:   newObjectFromFile(t, "testing/deployment.yaml"),
+
+		want: newObjectFromFile(t, "testing/deployment-ready-configured-fields.yaml"),
+	}, {
+		name: "Same object",
+
+		deployed: newObjectFromFile(t, "testing/deployment.yaml"),
+		config:   newObjectFromFile(t, "testing/deployment.yaml"),
+
+		want: newObjectFromFile(t, "testing/deployment.yaml"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := RemoveUnconfiguredFields(tc.deployed, tc.config); !reflect.DeepEqual(got, tc.want) || err != nil {
+				t.Errorf("RemoveUnconfiguredFields(%v, %v) = %v, %v; want %v, <nil>", tc.deployed, tc.config, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRemoveUnconfiguredFieldsErrors(t *testing.T) {
+	deployed := newObjectFromFile(t, "testing/deployment.yaml")
+	deployed.SetAnnotations(map[string]string{
+		lastAppliedConfigAnnotationKey: "{not json",
+	})
+	config := newObjectFromFile(t, "testing/deployment.yaml")
+
+	if got, err := RemoveUnconfiguredFields(deployed, config); err == nil {
+		t.Errorf("RemoveUnconfiguredFields(%v, %v) = %v, <nil>; want error", deployed, config, got)
+	}
+}
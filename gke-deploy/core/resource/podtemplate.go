@@ -0,0 +1,94 @@
+package resource
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// workloadPodTemplatePaths are the paths of pod templates in objects of Kubernetes workload kinds,
+// keyed by kind. These are matched by kind alone because their groups have changed across
+// Kubernetes versions (e.g., from extensions to apps). An empty path means that the object is
+// itself a pod.
+var workloadPodTemplatePaths = map[string][]string{
+	"CronJob":               {"spec", "jobTemplate", "spec", "template"},
+	"DaemonSet":             {"spec", "template"},
+	"Deployment":            {"spec", "template"},
+	"Job":                   {"spec", "template"},
+	"Pod":                   {},
+	"ReplicaSet":            {"spec", "template"},
+	"ReplicationController": {"spec", "template"},
+	"StatefulSet":           {"spec", "template"},
+}
+
+// PodTemplatePaths are the paths of pod templates in custom resources, keyed by GroupKind, so that
+// their container images, labels, and annotations are updated like those of Kubernetes workloads.
+// A nil PodTemplatePaths only has the paths of well-known custom resources.
+type PodTemplatePaths map[schema.GroupKind][]string
+
+// defaultPodTemplatePaths are the paths of pod templates in well-known custom resources. Paths in a
+// PodTemplatePaths take precedence over these.
+var defaultPodTemplatePaths = PodTemplatePaths{
+	{Group: "apps.openshift.io", Kind: "DeploymentConfig"}: {"spec", "template"},
+	{Group: "argoproj.io", Kind: "Rollout"}:                {"spec", "template"},
+	{Group: "serving.knative.dev", Kind: "Configuration"}:  {"spec", "template"},
+	{Group: "serving.knative.dev", Kind: "Service"}:        {"spec", "template"},
+}
+
+// PodTemplatePathConfig is an entry of a pod template paths file.
+type PodTemplatePathConfig struct {
+	Group string `json:"group"`
+	Kind  string `json:"kind"`
+	// Path is the dot-delimited path of the pod template, e.g., "spec.template".
+	Path string `json:"path"`
+}
+
+// ParsePodTemplatePaths parses the pod template paths listed in a YAML file, e.g.,
+//
+//   - group: example.com
+//     kind: MyApp
+//     path: spec.workload.template
+func ParsePodTemplatePaths(data []byte) (PodTemplatePaths, error) {
+	var configs []PodTemplatePathConfig
+	if err := yaml.UnmarshalStrict(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse pod template paths: %v", err)
+	}
+	paths := make(PodTemplatePaths, len(configs))
+	for _, c := range configs {
+		if c.Kind == "" || c.Path == "" {
+			return nil, fmt.Errorf("kind and path of pod template path with group %q cannot be empty", c.Group)
+		}
+		path := strings.Split(c.Path, ".")
+		for _, f := range path {
+			if f == "" {
+				return nil, fmt.Errorf("pod template path %q of kind %q is invalid", c.Path, c.Kind)
+			}
+		}
+		paths[schema.GroupKind{Group: c.Group, Kind: c.Kind}] = path
+	}
+	return paths, nil
+}
+
+// Path returns the path of the pod template in an object, and whether the object has a pod
+// template. An empty path means that the object is itself a pod.
+func (p PodTemplatePaths) Path(obj *Object) ([]string, bool) {
+	gk := obj.GetObjectKind().GroupVersionKind().GroupKind()
+	if path, ok := p[gk]; ok {
+		return path, true
+	}
+	if path, ok := defaultPodTemplatePaths[gk]; ok {
+		return path, true
+	}
+	path, ok := workloadPodTemplatePaths[gk.Kind]
+	return path, ok
+}
+
+// podTemplateField returns the nested fields of a field in an object's pod template, e.g.,
+// spec.template.metadata.labels for a Deployment's "metadata", "labels" fields.
+func podTemplateField(path []string, fields ...string) []string {
+	nested := make([]string, 0, len(path)+len(fields))
+	nested = append(nested, path...)
+	return append(nested, fields...)
+}
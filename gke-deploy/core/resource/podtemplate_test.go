@@ -0,0 +1,156 @@
+package resource
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPodTemplatePath(t *testing.T) {
+	paths, err := ParsePodTemplatePaths(fileContents(t, "testing/pod-template-paths.yaml"))
+	if err != nil {
+		t.Fatalf("ParsePodTemplatePaths(...) = _, %v; want _, <nil>", err)
+	}
+
+	tests := []struct {
+		name string
+
+		obj *Object
+
+		want   []string
+		wantOk bool
+	}{{
+		name: "Deployment",
+
+		obj: newObjectFromFile(t, "testing/deployment.yaml"),
+
+		want:   []string{"spec", "template"},
+		wantOk: true,
+	}, {
+		name: "CronJob",
+
+		obj: newObjectFromFile(t, "testing/cronjob.yaml"),
+
+		want:   []string{"spec", "jobTemplate", "spec", "template"},
+		wantOk: true,
+	}, {
+		name: "Pod",
+
+		obj: newObjectFromFile(t, "testing/pod.yaml"),
+
+		want:   []string{},
+		wantOk: true,
+	}, {
+		name: "Knative Service",
+
+		obj: newObjectFromFile(t, "testing/knative-service.yaml"),
+
+		want:   []string{"spec", "template"},
+		wantOk: true,
+	}, {
+		name: "Custom resource with pod template path",
+
+		obj: newObjectFromFile(t, "testing/myapp.yaml"),
+
+		want:   []string{"spec", "workload", "template"},
+		wantOk: true,
+	}, {
+		name: "Kubernetes Service",
+
+		obj: newObjectFromFile(t, "testing/service.yaml"),
+
+		want:   nil,
+		wantOk: false,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := paths.Path(tc.obj)
+			if ok != tc.wantOk {
+				t.Fatalf("Path(%v) = _, %t; want _, %t", tc.obj, ok, tc.wantOk)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Path(%v) produced diff (-want +got):\n%s", tc.obj, diff)
+			}
+		})
+	}
+}
+
+func TestPodTemplatePathWithoutPaths(t *testing.T) {
+	if _, err := ParsePodTemplatePaths(fileContents(t, "testing/pod-template-paths.yaml")); err != nil {
+		t.Fatalf("ParsePodTemplatePaths(...) = _, %v; want _, <nil>", err)
+	}
+
+	var paths PodTemplatePaths
+	// Parsed pod template paths are not shared with other PodTemplatePaths.
+	if got, ok := paths.Path(newObjectFromFile(t, "testing/myapp.yaml")); ok {
+		t.Errorf("Path(myapp) = %v, true; want _, false", got)
+	}
+	// Pod template paths of well-known custom resources are always found.
+	got, ok := paths.Path(newObjectFromFile(t, "testing/knative-service.yaml"))
+	if !ok {
+		t.Fatalf("Path(knative-service) = _, false; want _, true")
+	}
+	if diff := cmp.Diff([]string{"spec", "template"}, got); diff != "" {
+		t.Errorf("Path(knative-service) produced diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestPodTemplateOfCustomResource(t *testing.T) {
+	ctx := context.Background()
+
+	paths, err := ParsePodTemplatePaths(fileContents(t, "testing/pod-template-paths.yaml"))
+	if err != nil {
+		t.Fatalf("ParsePodTemplatePaths(...) = _, %v; want _, <nil>", err)
+	}
+	obj := newObjectFromFile(t, "testing/myapp.yaml")
+
+	if _, err := UpdateMatchingContainerImage(ctx, Objects{obj}, paths, "gcr.io/cbd-test/test-app", "REPLACED"); err != nil {
+		t.Fatalf("UpdateMatchingContainerImage(ctx, ...) = _, %v; want _, <nil>", err)
+	}
+	if err := AddLabel(ctx, obj, paths, "foo", "bar", false, nil); err != nil {
+		t.Fatalf("AddLabel(ctx, ...) = %v; want <nil>", err)
+	}
+
+	cons, _, _ := unstructured.NestedSlice(obj.Object, "spec", "workload", "template", "spec", "containers")
+	if got := cons[0].(map[string]interface{})["image"]; got != "REPLACED" {
+		t.Errorf("UpdateMatchingContainerImage(ctx, ...) set image to %v; want REPLACED", got)
+	}
+	if got, _, _ := unstructured.NestedString(obj.Object, "spec", "workload", "template", "metadata", "labels", "foo"); got != "bar" {
+		t.Errorf("AddLabel(ctx, ...) set pod template label to %q; want \"bar\"", got)
+	}
+}
+
+func TestParsePodTemplatePathsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+
+		data string
+	}{{
+		name: "Invalid YAML",
+
+		data: "group: example.com",
+	}, {
+		name: "Unknown field",
+
+		data: "- kind: MyApp\n  paths: spec.template",
+	}, {
+		name: "Missing kind",
+
+		data: "- group: example.com\n  path: spec.template",
+	}, {
+		name: "Empty path segment",
+
+		data: "- group: example.com\n  kind: MyApp\n  path: spec..template",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParsePodTemplatePaths([]byte(tc.data)); err == nil {
+				t.Errorf("ParsePodTemplatePaths(%q) = _, <nil>; want _, error", tc.data)
+			}
+		})
+	}
+}
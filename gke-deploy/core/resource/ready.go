@@ -2,20 +2,188 @@ package resource
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
+// ReadyState is the readiness state of a deployed object.
+type ReadyState int
+
+const (
+	// NotReady means a deployed object is not ready yet, but may become ready.
+	NotReady ReadyState = iota
+	// Ready means a deployed object is ready.
+	Ready
+	// Failed means a deployed object is in a state that it will not recover from without changes,
+	// e.g., a Pod whose container cannot pull its image.
+	Failed
+)
+
+// String returns the name of a readiness state.
+func (s ReadyState) String() string {
+	switch s {
+	case NotReady:
+		return "NotReady"
+	case Ready:
+		return "Ready"
+	case Failed:
+		return "Failed"
+	default:
+		return fmt.Sprintf("ReadyState(%d)", int(s))
+	}
+}
+
+const (
+	// ReadyConditionAnnotation is the annotation that names the status condition to wait for before
+	// an object is considered ready, as "<type>=<status>" or "<type>", e.g., "Synced=True". The
+	// status defaults to "True". It overrides the readiness check of the object's kind.
+	ReadyConditionAnnotation = "gke-deploy.cloud.google.com/ready-condition"
+
+	// hpaConditionsAnnotation is the annotation that has the status conditions of
+	// HorizontalPodAutoscalers in the autoscaling/v1 API.
+	hpaConditionsAnnotation = "autoscaling.alpha.kubernetes.io/conditions"
+)
+
+var (
+	// failedContainerWaitingReasons are the reasons for a container to be waiting that it will not
+	// recover from without changes.
+	failedContainerWaitingReasons = map[string]bool{
+		"CrashLoopBackOff":           true,
+		"CreateContainerConfigError": true,
+		"ErrImageNeverPull":          true,
+		"ImagePullBackOff":           true,
+		"InvalidImageName":           true,
+	}
+)
+
+// CheckReady returns the readiness state of a deployed object. If the object has failed, it also
+// returns the reason. Please check the comments of each kind's implementation of IsReady for a
+// description of what is considered to be ready, and the comments of each kind's failure function
+// for a description of what is considered to be failed.
+func CheckReady(ctx context.Context, obj *Object) (ReadyState, string, error) {
+	var reason string
+	var err error
+	switch ObjectKind(obj) {
+	case "Deployment":
+		reason, err = deploymentFailure(ctx, obj)
+	case "Job":
+		reason, err = jobFailure(ctx, obj)
+	case "Pod":
+		reason, err = podFailure(ctx, obj)
+	default:
+		reason, err = conditionsFailure(ctx, obj)
+	}
+	if err != nil {
+		return NotReady, "", err
+	}
+	if reason != "" {
+		return Failed, reason, nil
+	}
+
+	ok, err := IsReady(ctx, obj)
+	if err != nil {
+		return NotReady, "", err
+	}
+	if ok {
+		return Ready, "", nil
+	}
+	return NotReady, "", nil
+}
+
+// ContainerStates returns a description of the state of each container and init container of a
+// deployed object with kind "Pod", e.g., `container "app" is waiting: CrashLoopBackOff: back-off
+// 5m0s restarting failed container`.
+func ContainerStates(ctx context.Context, obj *Object) ([]string, error) {
+	var states []string
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _, err := unstructured.NestedSlice(obj.Object, "status", field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get status.%s field: %v", field, err)
+		}
+		container := "container"
+		if field == "initContainerStatuses" {
+			container = "init container"
+		}
+		for _, s := range statuses {
+			sMap, ok := s.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("failed to convert %s to map", field)
+			}
+			name, _, err := unstructured.NestedString(sMap, "name")
+			if err != nil {
+				return nil, fmt.Errorf("failed to get name field: %v", err)
+			}
+			restarts, _, err := unstructured.NestedInt64(sMap, "restartCount")
+			if err != nil {
+				return nil, fmt.Errorf("failed to get restartCount field: %v", err)
+			}
+			state, err := containerState(sMap)
+			if err != nil {
+				return nil, err
+			}
+			states = append(states, fmt.Sprintf("%s %q %s (restarts: %d)", container, name, state, restarts))
+		}
+	}
+	return states, nil
+}
+
+// containerState returns a description of the state of a container from its status, e.g.,
+// "is waiting: CrashLoopBackOff: back-off 5m0s restarting failed container".
+func containerState(status map[string]interface{}) (string, error) {
+	for _, state := range []string{"waiting", "terminated", "running"} {
+		s, ok, err := unstructured.NestedMap(status, "state", state)
+		if err != nil {
+			return "", fmt.Errorf("failed to get state.%s field: %v", state, err)
+		}
+		if !ok {
+			continue
+		}
+		desc := []string{"is " + state}
+		if reason, _, _ := unstructured.NestedString(s, "reason"); reason != "" {
+			desc = append(desc, reason)
+		}
+		if exitCode, ok, _ := unstructured.NestedInt64(s, "exitCode"); ok {
+			desc = append(desc, fmt.Sprintf("exit code %d", exitCode))
+		}
+		if message, _, _ := unstructured.NestedString(s, "message"); message != "" {
+			desc = append(desc, strings.TrimSpace(message))
+		}
+		return strings.Join(desc, ": "), nil
+	}
+	return "is in an unknown state", nil
+}
+
 // IsReady returns true if a deployed object is ready. Please check the comments of each kind's
 // implementation for a description of what is considered to be ready for that kind of object.
+// Objects of other kinds, e.g., custom resources, are checked with the standard status condition
+// conventions. If the object has the ReadyConditionAnnotation, it is ready when it has that
+// condition instead.
 func IsReady(ctx context.Context, obj *Object) (bool, error) {
+	if condition, ok := obj.GetAnnotations()[ReadyConditionAnnotation]; ok {
+		return annotatedConditionIsReady(ctx, obj, condition)
+	}
+
 	kind := ObjectKind(obj)
 	switch kind {
+	case "Application":
+		return applicationIsReady(ctx, obj)
+	case "CronJob":
+		return cronJobIsReady(ctx, obj)
+	case "CustomResourceDefinition":
+		return customResourceDefinitionIsReady(ctx, obj)
 	case "DaemonSet":
 		return daemonSetIsReady(ctx, obj)
 	case "Deployment":
 		return deploymentIsReady(ctx, obj)
+	case "HorizontalPodAutoscaler":
+		return horizontalPodAutoscalerIsReady(ctx, obj)
+	case "Ingress":
+		return ingressIsReady(ctx, obj)
+	case "Job":
+		return jobIsReady(ctx, obj)
 	case "PersistentVolumeClaim":
 		return persistentVolumeClaimIsReady(ctx, obj)
 	case "Pod":
@@ -31,8 +199,168 @@ func IsReady(ctx context.Context, obj *Object) (bool, error) {
 	case "StatefulSet":
 		return statefulSetIsReady(ctx, obj)
 	default:
+		return conditionsAreReady(ctx, obj)
+	}
+}
+
+// annotatedConditionIsReady returns true if a deployed object has the status condition named by
+// the value of its ReadyConditionAnnotation.
+// This returns true if the following bullets are true:
+// * status.observedGeneration == metadata.generation, if status.observedGeneration is set
+// * status.conditions contains an item that matches:
+//   * type == <type> AND status == <status>
+func annotatedConditionIsReady(ctx context.Context, obj *Object, condition string) (bool, error) {
+	conditionType, status := condition, "True"
+	if i := strings.Index(condition, "="); i >= 0 {
+		conditionType, status = condition[:i], condition[i+1:]
+	}
+	conditionType, status = strings.TrimSpace(conditionType), strings.TrimSpace(status)
+	if conditionType == "" || status == "" {
+		return false, fmt.Errorf("%s annotation %q must have the form <type>=<status> or <type>", ReadyConditionAnnotation, condition)
+	}
+
+	observed, err := generationObserved(obj)
+	if err != nil || !observed {
+		return false, err
+	}
+
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	return hasCondition(conditions, conditionType, status)
+}
+
+// applicationIsReady returns true if a deployed object with kind "Application" is ready.
+// This returns true if any of the following bullets are true:
+// * status is empty, i.e., no Application controller is running in the cluster to report status
+// * status.observedGeneration == metadata.generation AND status.conditions contains an item that
+//   matches:
+//   * type == "Ready" AND status == "True"
+func applicationIsReady(ctx context.Context, obj *Object) (bool, error) {
+	status, ok, err := unstructured.NestedMap(obj.Object, "status")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status field: %v", err)
+	}
+	if !ok || len(status) == 0 {
 		return true, nil
 	}
+
+	generation, ok, err := unstructured.NestedInt64(obj.Object, "metadata", "generation")
+	if err != nil {
+		return false, fmt.Errorf("failed to get metadata.generation field: %v", err)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	observedGeneration, ok, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.observedGeneration field: %v", err)
+	}
+	if !ok || observedGeneration != generation {
+		return false, nil
+	}
+
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	return hasCondition(conditions, "Ready", "True")
+}
+
+// conditionsAreReady returns true if a deployed object with a kind that has no specific readiness
+// check is ready, following the standard status condition conventions used by most custom
+// resources.
+// This returns true if the following bullets are true:
+// * status.observedGeneration == metadata.generation, if status.observedGeneration is set
+// * status.conditions does not contain an item that matches any:
+//   * type == "Ready" AND status != "True"
+//   * type == "Reconciling" AND status == "True"
+//   * type == "Stalled" AND status == "True"
+func conditionsAreReady(ctx context.Context, obj *Object) (bool, error) {
+	observed, err := generationObserved(obj)
+	if err != nil || !observed {
+		return false, err
+	}
+
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("failed to convert conditions to map")
+		}
+		cType, _, err := unstructured.NestedString(cMap, "type")
+		if err != nil {
+			return false, fmt.Errorf("failed to get type field: %v", err)
+		}
+		status, _, err := unstructured.NestedString(cMap, "status")
+		if err != nil {
+			return false, fmt.Errorf("failed to get status field: %v", err)
+		}
+		switch cType {
+		case "Ready":
+			if status != "True" {
+				return false, nil
+			}
+		case "Reconciling", "Stalled":
+			if status == "True" {
+				return false, nil
+			}
+		default:
+			// Skip
+		}
+	}
+	return true, nil
+}
+
+// conditionsFailure returns the reason that a deployed object with a kind that has no specific
+// failure check has failed, or an empty string if it has not failed.
+// This returns a reason if the following bullets are true:
+// * Any item in status.conditions matches:
+//   * type == "Stalled" AND status == "True"
+func conditionsFailure(ctx context.Context, obj *Object) (string, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return "", fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("failed to convert conditions to map")
+		}
+		cType, _, _ := unstructured.NestedString(cMap, "type")
+		status, _, _ := unstructured.NestedString(cMap, "status")
+		if cType == "Stalled" && status == "True" {
+			reason, _, _ := unstructured.NestedString(cMap, "reason")
+			message, _, _ := unstructured.NestedString(cMap, "message")
+			return strings.TrimSpace(fmt.Sprintf("Stalled: %s: %s", reason, message)), nil
+		}
+	}
+	return "", nil
+}
+
+// cronJobIsReady returns true if a deployed object with kind "CronJob" is ready.
+// This always returns true because a CronJob has no rollout to wait for. The Jobs that it creates
+// run on its schedule, which may be long after it is deployed.
+func cronJobIsReady(ctx context.Context, obj *Object) (bool, error) {
+	return true, nil
+}
+
+// customResourceDefinitionIsReady returns true if a deployed object with kind
+// "CustomResourceDefinition" is ready, i.e., custom resources of its kind can be created.
+// This returns true if the following bullets are true:
+// * status.conditions contains an item that matches:
+//   * type == "Established" AND status == "True"
+func customResourceDefinitionIsReady(ctx context.Context, obj *Object) (bool, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	return hasCondition(conditions, "Established", "True")
 }
 
 // daemonSetIsReady returns true if a deployed object with kind "DaemonSet" is ready.
@@ -204,6 +532,156 @@ func deploymentIsReady(ctx context.Context, obj *Object) (bool, error) {
 	return true, nil
 }
 
+// deploymentFailure returns the reason that a deployed object with kind "Deployment" has failed, or
+// an empty string if it has not failed.
+// This returns a reason if the following bullets are true:
+// * Any item in status.conditions matches:
+//   * type == "Progressing" AND status == "False" AND reason == "ProgressDeadlineExceeded"
+func deploymentFailure(ctx context.Context, obj *Object) (string, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return "", fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("failed to convert conditions to map")
+		}
+		cType, _, err := unstructured.NestedString(cMap, "type")
+		if err != nil {
+			return "", fmt.Errorf("failed to get type field: %v", err)
+		}
+		status, _, err := unstructured.NestedString(cMap, "status")
+		if err != nil {
+			return "", fmt.Errorf("failed to get status field: %v", err)
+		}
+		reason, _, err := unstructured.NestedString(cMap, "reason")
+		if err != nil {
+			return "", fmt.Errorf("failed to get reason field: %v", err)
+		}
+		if cType == "Progressing" && status == "False" && reason == "ProgressDeadlineExceeded" {
+			message, _, _ := unstructured.NestedString(cMap, "message")
+			return strings.TrimSpace(fmt.Sprintf("%s: %s", reason, message)), nil
+		}
+	}
+	return "", nil
+}
+
+// horizontalPodAutoscalerIsReady returns true if a deployed object with kind
+// "HorizontalPodAutoscaler" is ready.
+// This returns true if the following bullets are true:
+// * status.conditions, or the conditions in the "autoscaling.alpha.kubernetes.io/conditions"
+//   annotation for autoscaling/v1 objects, contains an item that matches:
+//   * type == "AbleToScale" AND status == "True"
+func horizontalPodAutoscalerIsReady(ctx context.Context, obj *Object) (bool, error) {
+	conditions, ok, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	if !ok {
+		annotation, ok := obj.GetAnnotations()[hpaConditionsAnnotation]
+		if !ok {
+			return false, nil
+		}
+		if err := json.Unmarshal([]byte(annotation), &conditions); err != nil {
+			return false, fmt.Errorf("failed to parse %s annotation: %v", hpaConditionsAnnotation, err)
+		}
+	}
+	return hasCondition(conditions, "AbleToScale", "True")
+}
+
+// ingressIsReady returns true if a deployed object with kind "Ingress" is ready.
+// This returns true if the following bullets are true:
+// * status.loadBalancer.ingress is not empty
+// * All objects in status.loadBalancer.ingress have an "ip" or "hostname" that is not empty
+func ingressIsReady(ctx context.Context, obj *Object) (bool, error) {
+	ingress, ok, err := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.loadBalancer.ingress field: %v", err)
+	}
+	if !ok || len(ingress) == 0 {
+		return false, nil
+	}
+	for _, i := range ingress {
+		iMap, ok := i.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("failed to convert ingress to map")
+		}
+		ip, _, err := unstructured.NestedString(iMap, "ip")
+		if err != nil {
+			return false, fmt.Errorf("failed to get ip field: %v", err)
+		}
+		hostname, _, err := unstructured.NestedString(iMap, "hostname")
+		if err != nil {
+			return false, fmt.Errorf("failed to get hostname field: %v", err)
+		}
+		if ip == "" && hostname == "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// jobIsReady returns true if a deployed object with kind "Job" is ready.
+// This returns true if any of the following bullets are true:
+// * status.conditions contains an item that matches:
+//   * type == "Complete" AND status == "True"
+// * status.succeeded >= spec.completions, where spec.completions defaults to 1
+func jobIsReady(ctx context.Context, obj *Object) (bool, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	complete, err := hasCondition(conditions, "Complete", "True")
+	if err != nil || complete {
+		return complete, err
+	}
+
+	completions, ok, err := unstructured.NestedInt64(obj.Object, "spec", "completions")
+	if err != nil {
+		return false, fmt.Errorf("failed to get spec.completions field: %v", err)
+	}
+	if !ok {
+		completions = 1
+	}
+
+	succeeded, ok, err := unstructured.NestedInt64(obj.Object, "status", "succeeded")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.succeeded field: %v", err)
+	}
+	if !ok || succeeded < completions {
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// jobFailure returns the reason that a deployed object with kind "Job" has failed, or an empty
+// string if it has not failed.
+// This returns a reason if the following bullets are true:
+// * Any item in status.conditions matches:
+//   * type == "Failed" AND status == "True"
+func jobFailure(ctx context.Context, obj *Object) (string, error) {
+	conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return "", fmt.Errorf("failed to get status.conditions field: %v", err)
+	}
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("failed to convert conditions to map")
+		}
+		cType, _, _ := unstructured.NestedString(cMap, "type")
+		status, _, _ := unstructured.NestedString(cMap, "status")
+		if cType == "Failed" && status == "True" {
+			reason, _, _ := unstructured.NestedString(cMap, "reason")
+			message, _, _ := unstructured.NestedString(cMap, "message")
+			return strings.TrimSpace(fmt.Sprintf("%s: %s", reason, message)), nil
+		}
+	}
+	return "", nil
+}
+
 // persistentVolumeClaimIsReady returns true if a deployed object with kind "PersistentVolumeClaim" is ready.
 // This returns true if the following bullets are true:
 // * status.phase == "Bound"
@@ -276,6 +754,49 @@ func podIsReady(ctx context.Context, obj *Object) (bool, error) {
 	return false, nil
 }
 
+// podFailure returns the reason that a deployed object with kind "Pod" has failed, or an empty
+// string if it has not failed.
+// This returns a reason if any of the following bullets are true:
+// * status.phase == "Failed"
+// * Any item in status.initContainerStatuses or status.containerStatuses matches any:
+//   * state.waiting.reason is one of "CrashLoopBackOff", "CreateContainerConfigError",
+//     "ErrImageNeverPull", "ImagePullBackOff", or "InvalidImageName"
+func podFailure(ctx context.Context, obj *Object) (string, error) {
+	phase, _, err := unstructured.NestedString(obj.Object, "status", "phase")
+	if err != nil {
+		return "", fmt.Errorf("failed to get status.phase field: %v", err)
+	}
+	if phase == "Failed" {
+		reason, _, _ := unstructured.NestedString(obj.Object, "status", "reason")
+		if reason == "" {
+			reason = "pod failed"
+		}
+		return fmt.Sprintf("phase is Failed: %s", reason), nil
+	}
+
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		statuses, _, err := unstructured.NestedSlice(obj.Object, "status", field)
+		if err != nil {
+			return "", fmt.Errorf("failed to get status.%s field: %v", field, err)
+		}
+		for _, s := range statuses {
+			sMap, ok := s.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("failed to convert %s to map", field)
+			}
+			reason, _, err := unstructured.NestedString(sMap, "state", "waiting", "reason")
+			if err != nil {
+				return "", fmt.Errorf("failed to get state.waiting.reason field: %v", err)
+			}
+			if failedContainerWaitingReasons[reason] {
+				name, _, _ := unstructured.NestedString(sMap, "name")
+				return fmt.Sprintf("container %q is waiting: %s", name, reason), nil
+			}
+		}
+	}
+	return "", nil
+}
+
 // podDisruptionBudget returns true if a deployed object with kind "PodDisruptionBudget" is ready.
 // This returns true if the following bullets are true:
 // * status.observedGeneration == metadata.generation
@@ -586,3 +1107,42 @@ func statefulSetIsReady(ctx context.Context, obj *Object) (bool, error) {
 
 	return true, nil
 }
+
+// generationObserved returns true if status.observedGeneration of a deployed object is not set or
+// is equal to metadata.generation, i.e., the object's controller has seen its latest changes.
+func generationObserved(obj *Object) (bool, error) {
+	observedGeneration, ok, err := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if err != nil {
+		return false, fmt.Errorf("failed to get status.observedGeneration field: %v", err)
+	}
+	if !ok {
+		return true, nil
+	}
+	generation, _, err := unstructured.NestedInt64(obj.Object, "metadata", "generation")
+	if err != nil {
+		return false, fmt.Errorf("failed to get metadata.generation field: %v", err)
+	}
+	return observedGeneration == generation, nil
+}
+
+// hasCondition returns true if conditions contains an item with the given type and status.
+func hasCondition(conditions []interface{}, conditionType, status string) (bool, error) {
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("failed to convert conditions to map")
+		}
+		cType, _, err := unstructured.NestedString(cMap, "type")
+		if err != nil {
+			return false, fmt.Errorf("failed to get type field: %v", err)
+		}
+		cStatus, _, err := unstructured.NestedString(cMap, "status")
+		if err != nil {
+			return false, fmt.Errorf("failed to get status field: %v", err)
+		}
+		if cType == conditionType && cStatus == status {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -3,6 +3,8 @@ package resource
 import (
 	"context"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestIsReady(t *testing.T) {
@@ -60,7 +62,34 @@ func TestIsReady(t *testing.T) {
 	testStatefulsetUnready3File := "testing/statefulset-unready-3.yaml"
 	testStatefulsetUnready4File := "testing/statefulset-unready-4.yaml"
 	testStatefulsetUnready5File := "testing/statefulset-unready-5.yaml"
+	testApplicationFile := "testing/application.yaml"
+	testApplicationReadyFile := "testing/application-ready.yaml"
+	testApplicationUnreadyFile := "testing/application-unready.yaml"
+	testApplicationUnready2File := "testing/application-unready-2.yaml"
+	testCronJobFile := "testing/cronjob.yaml"
 	testHpaFile := "testing/hpa.yaml"
+	testHpaReadyFile := "testing/hpa-ready.yaml"
+	testHpaReady2File := "testing/hpa-ready-2.yaml"
+	testHpaUnreadyFile := "testing/hpa-unready.yaml"
+	testIngressReadyFile := "testing/ingress-ready.yaml"
+	testIngressReady2File := "testing/ingress-ready-2.yaml"
+	testIngressUnreadyFile := "testing/ingress-unready.yaml"
+	testJobFile := "testing/job.yaml"
+	testJobReadyFile := "testing/job-ready.yaml"
+	testJobReady2File := "testing/job-ready-2.yaml"
+	testJobUnreadyFile := "testing/job-unready.yaml"
+	testJobFailedFile := "testing/job-failed.yaml"
+	testNamespaceFile := "testing/namespace.yaml"
+	testCrdReadyFile := "testing/crd-ready.yaml"
+	testCrdUnreadyFile := "testing/crd-unready.yaml"
+	testCertificateReadyFile := "testing/certificate-ready.yaml"
+	testCertificateUnreadyFile := "testing/certificate-unready.yaml"
+	testCertificateUnready2File := "testing/certificate-unready-2.yaml"
+	testCertificateUnready3File := "testing/certificate-unready-3.yaml"
+	testCertificateFailedFile := "testing/certificate-failed.yaml"
+	testStorageBucketReadyFile := "testing/storagebucket-ready.yaml"
+	testStorageBucketReady2File := "testing/storagebucket-ready-2.yaml"
+	testStorageBucketUnreadyFile := "testing/storagebucket-unready.yaml"
 
 	tests := []struct {
 		name string
@@ -381,10 +410,172 @@ func TestIsReady(t *testing.T) {
 
 		want: false,
 	}, {
-		name: "Default kind is always ready",
+		name: "Application without status is ready",
+
+		obj: newObjectFromFile(t, testApplicationFile),
+
+		want: true,
+	}, {
+		name: "Application is ready",
+
+		obj: newObjectFromFile(t, testApplicationReadyFile),
+
+		want: true,
+	}, {
+		name: "Application is unready because Ready condition is not True",
+
+		obj: newObjectFromFile(t, testApplicationUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Application is unready because status.observedGeneration != metadata.generation",
+
+		obj: newObjectFromFile(t, testApplicationUnready2File),
+
+		want: false,
+	}, {
+		name: "CronJob is ready",
+
+		obj: newObjectFromFile(t, testCronJobFile),
+
+		want: true,
+	}, {
+		name: "HorizontalPodAutoscaler is ready",
+
+		obj: newObjectFromFile(t, testHpaReadyFile),
+
+		want: true,
+	}, {
+		name: "HorizontalPodAutoscaler is ready with conditions annotation",
+
+		obj: newObjectFromFile(t, testHpaReady2File),
+
+		want: true,
+	}, {
+		name: "HorizontalPodAutoscaler is unready because AbleToScale condition is not True",
+
+		obj: newObjectFromFile(t, testHpaUnreadyFile),
+
+		want: false,
+	}, {
+		name: "HorizontalPodAutoscaler is unready without status",
 
 		obj: newObjectFromFile(t, testHpaFile),
 
+		want: false,
+	}, {
+		name: "Ingress is ready with IP",
+
+		obj: newObjectFromFile(t, testIngressReadyFile),
+
+		want: true,
+	}, {
+		name: "Ingress is ready with hostname",
+
+		obj: newObjectFromFile(t, testIngressReady2File),
+
+		want: true,
+	}, {
+		name: "Ingress is unready because status.loadBalancer.ingress is empty",
+
+		obj: newObjectFromFile(t, testIngressUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Job is ready with Complete condition",
+
+		obj: newObjectFromFile(t, testJobReadyFile),
+
+		want: true,
+	}, {
+		name: "Job is ready because status.succeeded >= spec.completions",
+
+		obj: newObjectFromFile(t, testJobReady2File),
+
+		want: true,
+	}, {
+		name: "Job is unready because it is active",
+
+		obj: newObjectFromFile(t, testJobUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Job is unready without status",
+
+		obj: newObjectFromFile(t, testJobFile),
+
+		want: false,
+	}, {
+		name: "Job is unready because it failed",
+
+		obj: newObjectFromFile(t, testJobFailedFile),
+
+		want: false,
+	}, {
+		name: "CustomResourceDefinition is ready",
+
+		obj: newObjectFromFile(t, testCrdReadyFile),
+
+		want: true,
+	}, {
+		name: "CustomResourceDefinition is unready because Established condition is not True",
+
+		obj: newObjectFromFile(t, testCrdUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Custom resource is ready",
+
+		obj: newObjectFromFile(t, testCertificateReadyFile),
+
+		want: true,
+	}, {
+		name: "Custom resource is unready because Ready condition is not True",
+
+		obj: newObjectFromFile(t, testCertificateUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Custom resource is unready because status.observedGeneration != metadata.generation",
+
+		obj: newObjectFromFile(t, testCertificateUnready2File),
+
+		want: false,
+	}, {
+		name: "Custom resource is unready because Reconciling condition is True",
+
+		obj: newObjectFromFile(t, testCertificateUnready3File),
+
+		want: false,
+	}, {
+		name: "Custom resource is unready because Stalled condition is True",
+
+		obj: newObjectFromFile(t, testCertificateFailedFile),
+
+		want: false,
+	}, {
+		name: "Annotated condition is ready",
+
+		obj: newObjectFromFile(t, testStorageBucketReadyFile),
+
+		want: true,
+	}, {
+		name: "Annotated condition without status is ready",
+
+		obj: newObjectFromFile(t, testStorageBucketReady2File),
+
+		want: true,
+	}, {
+		name: "Annotated condition is unready even if Ready condition is True",
+
+		obj: newObjectFromFile(t, testStorageBucketUnreadyFile),
+
+		want: false,
+	}, {
+		name: "Default kind is always ready",
+
+		obj: newObjectFromFile(t, testNamespaceFile),
+
 		want: true,
 	}}
 
@@ -396,3 +587,177 @@ func TestIsReady(t *testing.T) {
 		})
 	}
 }
+
+func TestIsReadyErrors(t *testing.T) {
+	ctx := context.Background()
+
+	obj := newObjectFromFile(t, "testing/storagebucket-invalid-annotation.yaml")
+	if got, err := IsReady(ctx, obj); err == nil {
+		t.Errorf("IsReady(ctx, %v) = %t, <nil>; want error", obj, got)
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testDeploymentUnreadyFile := "testing/deployment-unready.yaml"
+	testDeploymentFailedFile := "testing/deployment-failed.yaml"
+	testPodReadyFile := "testing/pod-ready.yaml"
+	testPodUnreadyFile := "testing/pod-unready.yaml"
+	testPodFailedFile := "testing/pod-failed.yaml"
+	testPodFailed2File := "testing/pod-failed-2.yaml"
+	testPodFailed3File := "testing/pod-failed-3.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+	testJobReadyFile := "testing/job-ready.yaml"
+	testJobFailedFile := "testing/job-failed.yaml"
+
+	tests := []struct {
+		name string
+
+		obj *Object
+
+		wantState  ReadyState
+		wantReason string
+	}{{
+		name: "Ready deployment",
+
+		obj: newObjectFromFile(t, testDeploymentReadyFile),
+
+		wantState: Ready,
+	}, {
+		name: "Unready deployment",
+
+		obj: newObjectFromFile(t, testDeploymentUnreadyFile),
+
+		wantState: NotReady,
+	}, {
+		name: "Deployment exceeded progress deadline",
+
+		obj: newObjectFromFile(t, testDeploymentFailedFile),
+
+		wantState:  Failed,
+		wantReason: `ProgressDeadlineExceeded: ReplicaSet "test-app-d7d58977d" has timed out progressing.`,
+	}, {
+		name: "Ready pod",
+
+		obj: newObjectFromFile(t, testPodReadyFile),
+
+		wantState: Ready,
+	}, {
+		name: "Unschedulable pod is not failed",
+
+		obj: newObjectFromFile(t, testPodUnreadyFile),
+
+		wantState: NotReady,
+	}, {
+		name: "Pod in CrashLoopBackOff",
+
+		obj: newObjectFromFile(t, testPodFailedFile),
+
+		wantState:  Failed,
+		wantReason: `container "test-app" is waiting: CrashLoopBackOff`,
+	}, {
+		name: "Pod with init container in ImagePullBackOff",
+
+		obj: newObjectFromFile(t, testPodFailed2File),
+
+		wantState:  Failed,
+		wantReason: `container "init" is waiting: ImagePullBackOff`,
+	}, {
+		name: "Pod in failed phase",
+
+		obj: newObjectFromFile(t, testPodFailed3File),
+
+		wantState:  Failed,
+		wantReason: "phase is Failed: Evicted",
+	}, {
+		name: "Completed job",
+
+		obj: newObjectFromFile(t, testJobReadyFile),
+
+		wantState: Ready,
+	}, {
+		name: "Job reached backoff limit",
+
+		obj: newObjectFromFile(t, testJobFailedFile),
+
+		wantState:  Failed,
+		wantReason: "BackoffLimitExceeded: Job has reached the specified backoff limit",
+	}, {
+		name: "Stalled custom resource",
+
+		obj: newObjectFromFile(t, "testing/certificate-failed.yaml"),
+
+		wantState:  Failed,
+		wantReason: `Stalled: IssuerNotFound: ClusterIssuer "letsencrypt" not found`,
+	}, {
+		name: "Unready service",
+
+		obj: newObjectFromFile(t, testServiceUnreadyFile),
+
+		wantState: NotReady,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			state, reason, err := CheckReady(ctx, tc.obj)
+			if state != tc.wantState || reason != tc.wantReason || err != nil {
+				t.Errorf("CheckReady(ctx, %v) = %v, %q, %v; want %v, %q, <nil>", tc.obj, state, reason, err, tc.wantState, tc.wantReason)
+			}
+		})
+	}
+}
+
+func TestContainerStates(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		obj *Object
+
+		want []string
+	}{{
+		name: "Running container",
+
+		obj: newObjectFromFile(t, "testing/pod-ready.yaml"),
+
+		want: []string{
+			`container "test-app" is running (restarts: 0)`,
+		},
+	}, {
+		name: "Crashing container",
+
+		obj: newObjectFromFile(t, "testing/pod-failed.yaml"),
+
+		want: []string{
+			`container "test-app" is waiting: CrashLoopBackOff: back-off 1m20s restarting failed container=test-app pod=test-app-deployment-58c8c7fffc-mlnck_default(c8e37074-8baf-11e9-8840-42010a8e00dc) (restarts: 4)`,
+		},
+	}, {
+		name: "Init container",
+
+		obj: newObjectFromFile(t, "testing/pod-failed-2.yaml"),
+
+		want: []string{
+			`init container "init" is waiting: ImagePullBackOff: Back-off pulling image "gcr.io/cbd-test/init:bad" (restarts: 0)`,
+			`container "test-app" is waiting: PodInitializing (restarts: 0)`,
+		},
+	}, {
+		name: "No container statuses",
+
+		obj: newObjectFromFile(t, "testing/pod-unready.yaml"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ContainerStates(ctx, tc.obj)
+			if err != nil {
+				t.Fatalf("ContainerStates(ctx, %v) = _, %v; want <nil>", tc.obj, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("ContainerStates(ctx, %v) produced diff (-want +got):\n%s", tc.obj, diff)
+			}
+		})
+	}
+}
@@ -27,6 +27,20 @@ import (
 // AggregatedFilename is the filename for the file created by SaveAsConfigs.
 const AggregatedFilename = "aggregated-resources.yaml"
 
+const lastAppliedConfigAnnotationKey = "kubectl.kubernetes.io/last-applied-configuration"
+
+// serverPopulatedMetadataFields are fields under metadata that are set by the API server.
+var serverPopulatedMetadataFields = []string{
+	"creationTimestamp",
+	"deletionGracePeriodSeconds",
+	"deletionTimestamp",
+	"generation",
+	"managedFields",
+	"resourceVersion",
+	"selfLink",
+	"uid",
+}
+
 type resourceDecoder struct{}
 
 func (resourceDecoder) Decode(data []byte, defaults *schema.GroupVersionKind, into runtime.Object) (runtime.Object, *schema.GroupVersionKind, error) {
@@ -42,6 +56,11 @@ var (
 	encoder = json.NewSerializerWithOptions(json.DefaultMetaFactory, nil, nil, json.SerializerOptions{Yaml: true})
 )
 
+// Validator validates objects parsed from configuration files.
+type Validator interface {
+	Validate(obj *Object) error
+}
+
 // Objects maps resource file base names to corresponding resource objects (mutable).
 type Objects []*Object
 
@@ -74,16 +93,47 @@ func DecodeFromYAML(ctx context.Context, yaml []byte) (*Object, error) {
 	}, nil
 }
 
+// DecodeListFromYAML decodes objects from a YAML string as bytes that represents a list of objects
+// (i.e., an object with kind "List").
+func DecodeListFromYAML(ctx context.Context, yaml []byte) (Objects, error) {
+	if strings.TrimSpace(string(yaml)) == "" {
+		return Objects{}, nil
+	}
+	obj, err := runtime.Decode(decoder, yaml)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode yaml into list")
+	}
+	list, ok := obj.(*unstructured.UnstructuredList)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert object to UnstructuredList")
+	}
+	objs := make(Objects, 0, len(list.Items))
+	for i := range list.Items {
+		objs = append(objs, &Object{
+			&list.Items[i],
+		})
+	}
+	return objs, nil
+}
+
+// kustomizationFileNames are the names of files that make a directory a kustomization.
+var kustomizationFileNames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
 // ParseConfigs parses resource objects from a file or directory of files into a map that maps
-// unique file base names to the parsed objects.
-func ParseConfigs(ctx context.Context, configs string, oss services.OSService, recursive bool) (Objects, error) {
+// unique file base names to the parsed objects. If configs is a kustomization file, or a directory
+// with a kustomization file, the kustomization is built with kzs, or with a new services.Kustomize
+// if kzs is nil, and the objects it outputs are parsed instead. If vars is not nil, ${VAR}
+// placeholders are expanded before objects are parsed, and the names of the substituted variables
+// are recorded in each object's SubstitutedVariablesAnnotation. If validator is not nil, each
+// object is validated after it is parsed.
+func ParseConfigs(ctx context.Context, configs string, oss services.OSService, kzs services.KustomizeService, vars *Variables, validator Validator, recursive bool) (Objects, error) {
 	objs := Objects{}
 
 	if configs == "-" {
 		if recursive {
 			return nil, fmt.Errorf("cannot recur with stdin")
 		}
-		objs, err := parseResourcesFromFile(ctx, configs, objs, oss)
+		objs, err := parseResourcesFromFile(ctx, configs, objs, oss, vars, validator)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse config from stdin: %v", err)
 		}
@@ -99,6 +149,27 @@ func ParseConfigs(ctx context.Context, configs string, oss services.OSService, r
 		return nil, fmt.Errorf("cannot recur through a file")
 	}
 
+	kustomization, err := kustomizationDir(ctx, configs, fi, oss)
+	if err != nil {
+		return nil, err
+	}
+	if kustomization != "" {
+		if kzs == nil {
+			if kzs, err = services.NewKustomize(ctx); err != nil {
+				return nil, err
+			}
+		}
+		out, err := kzs.Build(ctx, kustomization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build kustomization %q: %v", kustomization, err)
+		}
+		objs, err = parseResources(ctx, out, fmt.Sprintf("kustomization %q", kustomization), objs, vars, validator)
+		if err != nil {
+			return nil, err
+		}
+		return objs, nil
+	}
+
 	hasResources := false
 
 	// Since walk is recursive, we need to declare it before creating the function that refers to it.
@@ -121,7 +192,7 @@ func ParseConfigs(ctx context.Context, configs string, oss services.OSService, r
 		} else {
 			if hasYamlOrYmlSuffix(path) {
 				hasResources = true
-				objs, err = parseResourcesFromFile(ctx, path, objs, oss)
+				objs, err = parseResourcesFromFile(ctx, path, objs, oss, vars, validator)
 				if err != nil {
 					return fmt.Errorf("failed to parse config %q: %v", path, err)
 				}
@@ -144,6 +215,13 @@ func ParseConfigs(ctx context.Context, configs string, oss services.OSService, r
 	return objs, nil
 }
 
+// ParseConfigsFromYAML parses resource objects from a string of YAML documents, such as the output
+// of a templating engine. source describes where the string came from, e.g., `chart "my-chart"`. If
+// validator is not nil, each object is validated after it is parsed.
+func ParseConfigsFromYAML(ctx context.Context, in, source string, validator Validator) (Objects, error) {
+	return parseResources(ctx, in, source, Objects{}, nil, validator)
+}
+
 // SaveAsConfigs saves resource objects as config files to a target output directory.
 // If any lines in a resource object's string representation contain a key in
 // lineComments, the corresponding value will be added as a comment at the end of
@@ -222,67 +300,98 @@ func addCommentsToLines(s string, lineComments map[string]string) (string, error
 	return strings.Join(lines, "\n"), nil
 }
 
-// UpdateMatchingContainerImage updates all objects that have container images matching the provided image
-// name with the provided replacement string.
-func UpdateMatchingContainerImage(ctx context.Context, objs Objects, imageName, replace string) error {
-	matched := false
-	for _, obj := range objs {
-		var nestedFields []string
-
-		switch kind := ObjectKind(obj); kind {
-		case "CronJob":
-			nestedFields = []string{"spec", "jobTemplate", "spec", "template", "spec", "containers"}
-		case "Pod":
-			nestedFields = []string{"spec", "containers"}
-		case "DaemonSet", "Deployment", "Job", "ReplicaSet", "ReplicationController", "StatefulSet":
-			nestedFields = []string{"spec", "template", "spec", "containers"}
-		default:
-			continue
-		}
+// ContainerMatch is a container of an object whose image matched an image name.
+type ContainerMatch struct {
+	Kind      string
+	Name      string
+	Container string
+}
+
+// String returns a description of the matched container, e.g., `Deployment "my-app", container "my-app"`.
+func (m ContainerMatch) String() string {
+	return fmt.Sprintf("%s %q, container %q", m.Kind, m.Name, m.Container)
+}
 
-		cons, ok, err := unstructured.NestedFieldNoCopy(obj.Object, nestedFields...)
+// UpdateMatchingContainerImage updates all objects that have container images matching the provided image
+// name with the provided replacement string. It returns the containers that were updated, which are
+// none if no container has the image name. Pod specs are found with paths.
+func UpdateMatchingContainerImage(ctx context.Context, objs Objects, paths PodTemplatePaths, imageName, replace string) ([]ContainerMatch, error) {
+	var matches []ContainerMatch
+	err := UpdateContainerImages(ctx, objs, paths, func(obj *Object, container, im string) (string, error) {
+		ref, err := name.ParseReference(im)
 		if err != nil {
-			return fmt.Errorf("failed to get nested containers field: %v", err)
+			return "", fmt.Errorf("failed to parse reference from image %q: %v", im, err)
 		}
-		if !ok {
-			continue
+		if image.Name(ref) != imageName {
+			return im, nil
 		}
-		consList, ok := cons.([]interface{})
+		matches = append(matches, ContainerMatch{
+			Kind:      ObjectKind(obj),
+			Name:      obj.GetName(),
+			Container: container,
+		})
+		return replace, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// podSpecContainerFields are the fields of a pod spec that list containers.
+var podSpecContainerFields = []string{"initContainers", "containers", "ephemeralContainers"}
+
+// UpdateContainerImages calls update with the image of every container, init container, and
+// ephemeral container in the pod specs of objects, and sets the container's image to the returned
+// value. Pod specs are found with paths.
+func UpdateContainerImages(ctx context.Context, objs Objects, paths PodTemplatePaths, update func(obj *Object, container, image string) (string, error)) error {
+	for _, obj := range objs {
+		path, ok := paths.Path(obj)
 		if !ok {
-			return fmt.Errorf("failed to convert containers to list")
+			continue
 		}
 
-		for _, con := range consList {
-			conMap, ok := con.(map[string]interface{})
-			if !ok {
-				return fmt.Errorf("failed to convert container to map")
-			}
-			im, ok, err := unstructured.NestedString(conMap, "image")
+		for _, field := range podSpecContainerFields {
+			nestedFields := podTemplateField(path, "spec", field)
+			cons, ok, err := unstructured.NestedFieldNoCopy(obj.Object, nestedFields...)
 			if err != nil {
-				return fmt.Errorf("failed to get image field: %v", err)
+				return fmt.Errorf("failed to get nested %s field: %v", field, err)
 			}
 			if !ok {
 				continue
 			}
-
-			ref, err := name.ParseReference(im)
-			if err != nil {
-				return fmt.Errorf("failed to parse reference from image %q: %v", im, err)
+			consList, ok := cons.([]interface{})
+			if !ok {
+				return fmt.Errorf("failed to convert %s to list", field)
 			}
-			if image.Name(ref) == imageName {
-				fmt.Printf("Updating container of resource: %v\n", obj)
+
+			for _, con := range consList {
+				conMap, ok := con.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("failed to convert container to map")
+				}
+				im, ok, err := unstructured.NestedString(conMap, "image")
+				if err != nil {
+					return fmt.Errorf("failed to get image field: %v", err)
+				}
+				if !ok {
+					continue
+				}
+				conName, _, _ := unstructured.NestedString(conMap, "name")
+
+				replace, err := update(obj, conName, im)
+				if err != nil {
+					return err
+				}
+				if replace == im {
+					continue
+				}
 				if err := unstructured.SetNestedField(conMap, replace, "image"); err != nil {
 					return fmt.Errorf("failed to set image field: %v", err)
 				}
-				matched = true
 			}
 		}
 	}
-
-	if !matched {
-		fmt.Fprintf(os.Stderr, "\nWARNING: Did not find any resources with a container that has image name %q\n\n", imageName)
-	}
-
 	return nil
 }
 
@@ -411,11 +520,13 @@ func DeploySummary(ctx context.Context, objs Objects) (string, error) {
 		}
 
 		var ready string
-		ok, err := IsReady(ctx, obj)
+		state, _, err := CheckReady(ctx, obj)
 		if err != nil {
 			ready = "Unknown"
-		} else if ok {
+		} else if state == Ready {
 			ready = "Yes"
+		} else if state == Failed {
+			ready = "Failed"
 		} else {
 			ready = "No"
 		}
@@ -431,6 +542,46 @@ func DeploySummary(ctx context.Context, objs Objects) (string, error) {
 	return buf.String(), nil
 }
 
+// applyPhases are the kinds of objects in each phase of applying objects, in the order that the
+// phases are applied. Objects are applied after the objects they commonly depend on, e.g.,
+// ServiceAccounts before the workloads that run as them. Objects with kinds that are not in any
+// phase, e.g., custom resources, are applied last.
+var applyPhases = [][]string{
+	{"CustomResourceDefinition"},
+	{"Namespace"},
+	{"ServiceAccount", "ClusterRole", "Role", "ClusterRoleBinding", "RoleBinding", "PodSecurityPolicy"},
+	{"ConfigMap", "Secret", "LimitRange", "ResourceQuota"},
+	{"StorageClass", "PersistentVolume", "PersistentVolumeClaim"},
+	{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job", "CronJob", "Pod"},
+	{"Service", "Ingress"},
+}
+
+// applyPhase returns the index of the phase in applyPhases that an object is applied in.
+func applyPhase(obj *Object) int {
+	kind := ObjectKind(obj)
+	for i, kinds := range applyPhases {
+		for _, k := range kinds {
+			if k == kind {
+				return i
+			}
+		}
+	}
+	return len(applyPhases)
+}
+
+// SortObjectsByApplyPhase returns a copy of objs sorted into the phases that they should be applied
+// in: CustomResourceDefinitions; Namespaces; RBAC objects and ServiceAccounts; ConfigMaps and
+// Secrets; storage; workloads; Services and Ingresses; then all other objects, including custom
+// resources. Objects in the same phase keep their order.
+func SortObjectsByApplyPhase(objs Objects) Objects {
+	sorted := make(Objects, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return applyPhase(sorted[i]) < applyPhase(sorted[j])
+	})
+	return sorted
+}
+
 // sortObjectsByKindAndName sorts a list of objects by kind, then name, alphabetically.
 func sortObjectsByKindAndName(objs []*Object) []*Object {
 	sort.SliceStable(objs, func(i, j int) bool {
@@ -545,7 +696,29 @@ func serviceExternalName(obj *Object) (string, error) {
 	return externalName, nil
 }
 
-func parseResourcesFromFile(ctx context.Context, filename string, objs Objects, oss services.OSService) (Objects, error) {
+// kustomizationDir returns the directory of the kustomization at configs, i.e., configs if it is a
+// directory with a kustomization file or the parent directory of configs if it is a kustomization
+// file. It returns an empty string if configs is not a kustomization.
+func kustomizationDir(ctx context.Context, configs string, fi os.FileInfo, oss services.OSService) (string, error) {
+	if !fi.IsDir() {
+		for _, name := range kustomizationFileNames {
+			if filepath.Base(configs) == name {
+				return filepath.Dir(configs), nil
+			}
+		}
+		return "", nil
+	}
+	for _, name := range kustomizationFileNames {
+		if _, err := oss.Stat(ctx, filepath.Join(configs, name)); err == nil {
+			return configs, nil
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to get file info for %q: %v", filepath.Join(configs, name), err)
+		}
+	}
+	return "", nil
+}
+
+func parseResourcesFromFile(ctx context.Context, filename string, objs Objects, oss services.OSService, vars *Variables, validator Validator) (Objects, error) {
 	readStdin := filename == "-"
 	var printFilename string
 	if readStdin {
@@ -558,11 +731,15 @@ func parseResourcesFromFile(ctx context.Context, filename string, objs Objects,
 	if err != nil {
 		return nil, fmt.Errorf("failed to read %s: %v", printFilename, err)
 	}
-	if readStdin {
-		filename = "k8s.yaml" // Files parsed from stdin will have the prefix "k8s".
-	}
+	return parseResources(ctx, string(in), printFilename, objs, vars, validator)
+}
 
-	split := strings.Split(string(in), "\n---")
+// parseResources parses resource objects from a string of YAML documents and appends them to objs.
+// printFilename describes where the string came from in errors. If vars is not nil, ${VAR}
+// placeholders in the string values of each parsed object are expanded. If validator is not nil,
+// each parsed object is validated.
+func parseResources(ctx context.Context, in, printFilename string, objs Objects, vars *Variables, validator Validator) (Objects, error) {
+	split := strings.Split(in, "\n---")
 
 	for i, r := range split {
 		lines := strings.Split(r, "\n")
@@ -582,6 +759,23 @@ func parseResourcesFromFile(ctx context.Context, filename string, objs Objects,
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode resource from item %d in %s: %v", i+1, printFilename, err)
 		}
+		var substituted []string
+		if vars != nil {
+			substituted, err = vars.ExpandObject(obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to expand variables in item %d in %s: %v", i+1, printFilename, err)
+			}
+		}
+		if validator != nil {
+			if err := validator.Validate(obj); err != nil {
+				return nil, fmt.Errorf("failed to validate item %d in %s: %v", i+1, printFilename, err)
+			}
+		}
+		if len(substituted) > 0 {
+			if err := addToNestedMap(obj, SubstitutedVariablesAnnotation, strings.Join(substituted, ","), true, nil, "metadata", "annotations"); err != nil {
+				return nil, fmt.Errorf("failed to record substituted variables of item %d in %s: %v", i+1, printFilename, err)
+			}
+		}
 
 		objs = append(objs, obj)
 	}
@@ -605,26 +799,24 @@ func (obj *Object) String() string {
 	return fmt.Sprintf("{kind: %s, name: %s}", kind, name)
 }
 
-// AddLabel updates an object to add a label with the key and value provided.
-func AddLabel(ctx context.Context, obj *Object, key, value string, override bool) error {
+// AddLabel updates an object to add a label with the key and value provided. The label is also added
+// to the object's pod template, if it has one. Pod templates are found with paths. If override is
+// false, labels that are already set to other values are kept, and warnf, if not nil, is called
+// with a warning about each of them.
+func AddLabel(ctx context.Context, obj *Object, paths PodTemplatePaths, key, value string, override bool, warnf func(format string, a ...interface{})) error {
 	if key == "" || value == "" {
 		return fmt.Errorf("key and value cannot be empty")
 	}
 
-	if err := addToNestedMap(obj, key, value, override, "metadata", "labels"); err != nil {
+	if err := addToNestedMap(obj, key, value, override, warnf, "metadata", "labels"); err != nil {
 		return err
 	}
 
-	var nestedFields []string
-	switch kind := ObjectKind(obj); kind {
-	case "CronJob":
-		nestedFields = []string{"spec", "jobTemplate", "spec", "template", "metadata", "labels"}
-	case "DaemonSet", "Deployment", "Job", "ReplicaSet", "ReplicationController", "StatefulSet":
-		nestedFields = []string{"spec", "template", "metadata", "labels"}
-	default:
+	path, ok := paths.Path(obj)
+	if !ok || len(path) == 0 {
 		return nil
 	}
-	if err := addToNestedMap(obj, key, value, override, nestedFields...); err != nil {
+	if err := addToNestedMap(obj, key, value, override, warnf, podTemplateField(path, "metadata", "labels")...); err != nil {
 		return err
 	}
 
@@ -632,33 +824,29 @@ func AddLabel(ctx context.Context, obj *Object, key, value string, override bool
 }
 
 // AddAnnotation updates an object to add an annotation with the key and value
-// provided.
-func AddAnnotation(obj *Object, key, value string) error {
+// provided. The annotation is also added to the object's pod template, if it has one. Pod templates
+// are found with paths.
+func AddAnnotation(obj *Object, paths PodTemplatePaths, key, value string) error {
 	if key == "" || value == "" {
 		return fmt.Errorf("key and value cannot be empty")
 	}
 
-	if err := addToNestedMap(obj, key, value, true, "metadata", "annotations"); err != nil {
+	if err := addToNestedMap(obj, key, value, true, nil, "metadata", "annotations"); err != nil {
 		return err
 	}
 
-	var nestedFields []string
-	switch kind := ObjectKind(obj); kind {
-	case "CronJob":
-		nestedFields = []string{"spec", "jobTemplate", "spec", "template", "metadata", "annotations"}
-	case "DaemonSet", "Deployment", "Job", "ReplicaSet", "ReplicationController", "StatefulSet":
-		nestedFields = []string{"spec", "template", "metadata", "annotations"}
-	default:
+	path, ok := paths.Path(obj)
+	if !ok || len(path) == 0 {
 		return nil
 	}
-	if err := addToNestedMap(obj, key, value, true, nestedFields...); err != nil {
+	if err := addToNestedMap(obj, key, value, true, nil, podTemplateField(path, "metadata", "annotations")...); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func addToNestedMap(obj *Object, key, value string, override bool, nestedFields ...string) error {
+func addToNestedMap(obj *Object, key, value string, override bool, warnf func(format string, a ...interface{}), nestedFields ...string) error {
 	mapField, ok, err := unstructured.NestedMap(obj.Object, nestedFields...)
 	if err != nil {
 		return fmt.Errorf("failed to get map field: %v", err)
@@ -669,8 +857,8 @@ func addToNestedMap(obj *Object, key, value string, override bool, nestedFields
 	}
 
 	if existing, ok := mapField[key]; ok && !override {
-		if existing != value {
-			fmt.Fprintf(os.Stderr, "\nWARNING: Key %q is already set as %q for object %v in %v field. Not overriding.\n", key, existing, obj, strings.Join(nestedFields, "."))
+		if existing != value && warnf != nil {
+			warnf("Key %q is already set as %q for object %v in %v field. Not overriding.", key, existing, obj, strings.Join(nestedFields, "."))
 		}
 	} else {
 		mapField[key] = value
@@ -682,6 +870,29 @@ func addToNestedMap(obj *Object, key, value string, override bool, nestedFields
 	return nil
 }
 
+// RemoveServerPopulatedFields returns a copy of an object without the fields that are populated by
+// the API server (e.g., status, metadata.resourceVersion, metadata.uid) and without the
+// kubectl.kubernetes.io/last-applied-configuration annotation.
+func RemoveServerPopulatedFields(obj *Object) *Object {
+	cp := &Object{
+		obj.DeepCopy(),
+	}
+	unstructured.RemoveNestedField(cp.Object, "status")
+	for _, field := range serverPopulatedMetadataFields {
+		unstructured.RemoveNestedField(cp.Object, "metadata", field)
+	}
+	annotations := cp.GetAnnotations()
+	if _, ok := annotations[lastAppliedConfigAnnotationKey]; ok {
+		delete(annotations, lastAppliedConfigAnnotationKey)
+		if len(annotations) == 0 {
+			unstructured.RemoveNestedField(cp.Object, "metadata", "annotations")
+		} else {
+			cp.SetAnnotations(annotations)
+		}
+	}
+	return cp
+}
+
 // TODO(joonlim): These should be member functions of Object.
 
 // ObjectKind returns the kind of an object.
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -147,6 +148,59 @@ func TestParseYaml(t *testing.T) {
 	}
 }
 
+func TestDecodeListFromYAML(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+
+	tests := []struct {
+		name string
+
+		yaml []byte
+
+		want Objects
+	}{{
+		name: "Decode list",
+
+		yaml: fileContents(t, "testing/list.yaml"),
+
+		want: Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+	}, {
+		name: "Decode empty list",
+
+		yaml: fileContents(t, "testing/list-empty.yaml"),
+
+		want: Objects{},
+	}, {
+		name: "Decode empty string",
+
+		yaml: []byte(""),
+
+		want: Objects{},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := DecodeListFromYAML(ctx, tc.yaml); !reflect.DeepEqual(got, tc.want) || err != nil {
+				t.Errorf("DecodeListFromYAML(ctx, %s) = %v, %v; want %v, <nil>", tc.yaml, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeListFromYAMLErrors(t *testing.T) {
+	ctx := context.Background()
+
+	yaml := fileContents(t, "testing/deployment.yaml")
+	if got, err := DecodeListFromYAML(ctx, yaml); err == nil {
+		t.Errorf("DecodeListFromYAML(ctx, %s) = %v, <nil>; want error", yaml, got)
+	}
+}
+
 func TestSaveAsConfigs(t *testing.T) {
 	ctx := context.Background()
 
@@ -602,13 +656,148 @@ func TestParseConfigs(t *testing.T) {
 
 			configs := tc.configs
 
-			if got, err := ParseConfigs(ctx, configs, oss, tc.recur); !reflect.DeepEqual(got, tc.want) || err != nil {
-				t.Errorf("ParseConfigs(ctx, %s, oss, %v) = %v, %v; want %v, <nil>", configs, tc.recur, got, err, tc.want)
+			if got, err := ParseConfigs(ctx, configs, oss, nil, nil, nil, tc.recur); !reflect.DeepEqual(got, tc.want) || err != nil {
+				t.Errorf("ParseConfigs(ctx, %s, oss, nil, %v) = %v, %v; want %v, <nil>", configs, tc.recur, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseConfigsKustomization(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	kustomizationDir := "testing/configs/kustomization"
+
+	built := string(fileContents(t, testDeploymentFile)) + "\n---\n" + string(fileContents(t, testServiceFile))
+
+	tests := []struct {
+		name    string
+		configs string
+		kzs     services.KustomizeService
+		want    Objects
+		wantErr bool
+	}{{
+		name:    "Configs is a directory with a kustomization file",
+		configs: kustomizationDir,
+		kzs: &testservices.TestKustomize{
+			BuildResponse: map[string]testservices.BuildResponse{
+				kustomizationDir: {Res: built},
+			},
+		},
+		want: Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+	}, {
+		name:    "Configs is a kustomization file",
+		configs: "testing/configs/kustomization/kustomization.yaml",
+		kzs: &testservices.TestKustomize{
+			BuildResponse: map[string]testservices.BuildResponse{
+				kustomizationDir: {Res: built},
+			},
+		},
+		want: Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+	}, {
+		name:    "Failed to build kustomization",
+		configs: kustomizationDir,
+		kzs: &testservices.TestKustomize{
+			BuildResponse: map[string]testservices.BuildResponse{
+				kustomizationDir: {Err: fmt.Errorf("failed to build kustomization")},
+			},
+		},
+		wantErr: true,
+	}, {
+		name:    "Kustomization is built in-process without a kustomize service",
+		configs: kustomizationDir,
+		kzs:     nil,
+		want: Objects{
+			newObjectFromFile(t, testServiceFile),
+			newObjectFromFile(t, testDeploymentFile),
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oss, err := services.NewOS(ctx)
+			if err != nil {
+				t.Fatalf("Failed to create OS: %v", err)
+			}
+
+			got, err := ParseConfigs(ctx, tc.configs, oss, tc.kzs, nil, nil, false)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("ParseConfigs(ctx, %s, oss, kzs, false) = _, %v; want error %t", tc.configs, err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ParseConfigs(ctx, %s, oss, kzs, false) = %v, <nil>; want %v, <nil>", tc.configs, got, tc.want)
 			}
 		})
 	}
 }
 
+func TestParseConfigsWithVariables(t *testing.T) {
+	ctx := context.Background()
+
+	oss, err := services.NewOS(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create OS: %v", err)
+	}
+	configs := "testing/configs/vars"
+	vars := &Variables{
+		Values: map[string]string{
+			"ENVIRONMENT": "staging",
+			"SHORT_SHA":   "abc1234",
+		},
+		Strict: true,
+	}
+
+	want := Objects{newObjectFromFile(t, "testing/deployment-vars-expanded.yaml")}
+	if got, err := ParseConfigs(ctx, configs, oss, nil, vars, nil, false); !reflect.DeepEqual(got, want) || err != nil {
+		t.Errorf("ParseConfigs(ctx, %s, oss, nil, vars, nil, false) = %v, %v; want %v, <nil>", configs, got, err, want)
+	}
+
+	delete(vars.Values, "SHORT_SHA")
+	if got, err := ParseConfigs(ctx, configs, oss, nil, vars, nil, false); got != nil || err == nil {
+		t.Errorf("ParseConfigs(ctx, %s, oss, nil, vars, nil, false) = %v, <nil>; want <nil>, error", configs, got)
+	}
+}
+
+// kindValidator is a Validator that fails to validate objects of a kind.
+type kindValidator string
+
+func (v kindValidator) Validate(obj *Object) error {
+	if ObjectKind(obj) == string(v) {
+		return fmt.Errorf("invalid %s", v)
+	}
+	return nil
+}
+
+func TestParseConfigsWithValidator(t *testing.T) {
+	ctx := context.Background()
+
+	oss, err := services.NewOS(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create OS: %v", err)
+	}
+	configs := "testing/configs/multi-resource.yaml"
+
+	if _, err := ParseConfigs(ctx, configs, oss, nil, nil, kindValidator("ConfigMap"), false); err != nil {
+		t.Errorf("ParseConfigs(ctx, %s, oss, nil, nil, validator, false) = _, %v; want _, <nil>", configs, err)
+	}
+
+	got, err := ParseConfigs(ctx, configs, oss, nil, nil, kindValidator("Service"), false)
+	if got != nil || err == nil {
+		t.Fatalf("ParseConfigs(ctx, %s, oss, nil, nil, validator, false) = %v, <nil>; want <nil>, error", configs, got)
+	}
+	if want := fmt.Sprintf("item 2 in file %q", configs); !strings.Contains(err.Error(), want) {
+		t.Errorf("ParseConfigs(ctx, %s, oss, nil, nil, validator, false) = _, %v; want error containing %q", configs, err, want)
+	}
+}
+
 func TestParseConfigsFromStdIn(t *testing.T) {
 	ctx := context.Background()
 
@@ -650,8 +839,8 @@ func TestParseConfigsFromStdIn(t *testing.T) {
 			defer func() { os.Stdin = oldStdin }()
 			os.Stdin = f
 
-			if got, err := ParseConfigs(ctx, "-", oss, false); !reflect.DeepEqual(got, tc.want) || err != nil {
-				t.Errorf("ParseConfigs(ctx, %s, oss, false) = %v, %v; want %v, <nil>", "-", got, err, tc.want)
+			if got, err := ParseConfigs(ctx, "-", oss, nil, nil, nil, false); !reflect.DeepEqual(got, tc.want) || err != nil {
+				t.Errorf("ParseConfigs(ctx, %s, oss, nil, false) = %v, %v; want %v, <nil>", "-", got, err, tc.want)
 			}
 		})
 	}
@@ -700,8 +889,8 @@ func TestParseConfigsErrors(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			oss, _ := services.NewOS(ctx)
-			if got, err := ParseConfigs(ctx, tc.configs, oss, tc.recur); got != nil || err == nil {
-				t.Errorf("ParseConfigs(ctx, %s, oss, %v) = %v, <nil>; want <nil>, error", tc.configs, tc.recur, got)
+			if got, err := ParseConfigs(ctx, tc.configs, oss, nil, nil, nil, tc.recur); got != nil || err == nil {
+				t.Errorf("ParseConfigs(ctx, %s, oss, nil, %v) = %v, <nil>; want <nil>, error", tc.configs, tc.recur, got)
 			}
 		})
 	}
@@ -739,8 +928,8 @@ func TestParseConfigsFromStdInErrors(t *testing.T) {
 			defer func() { os.Stdin = oldStdin }()
 			os.Stdin = f
 
-			if got, err := ParseConfigs(ctx, "-", oss, tc.recur); got != nil || err == nil {
-				t.Errorf("ParseConfigs(ctx, %s, oss, %v) = %v, <nil>; want <nil>, error", tc.configs, tc.recur, got)
+			if got, err := ParseConfigs(ctx, "-", oss, nil, nil, nil, tc.recur); got != nil || err == nil {
+				t.Errorf("ParseConfigs(ctx, %s, oss, nil, %v) = %v, <nil>; want <nil>, error", tc.configs, tc.recur, got)
 			}
 		})
 	}
@@ -779,6 +968,7 @@ func TestUpdateMatchingContainerImage(t *testing.T) {
 
 		beforeUpdate Objects
 		want         Objects
+		wantMatches  []ContainerMatch
 	}{{
 		name: "Empty objects",
 
@@ -820,6 +1010,17 @@ func TestUpdateMatchingContainerImage(t *testing.T) {
 			newObjectFromFile(t, testReplicationcontrollerUpdatedFile),
 			newObjectFromFile(t, testStatefulsetUpdatedFile),
 		},
+		wantMatches: []ContainerMatch{
+			{Kind: "CronJob", Name: "test-cron-job", Container: "test-app"},
+			{Kind: "DaemonSet", Name: "test-daemon-set", Container: "test-app"},
+			{Kind: "Deployment", Name: "test-app", Container: "test-app"},
+			{Kind: "Job", Name: "test-job", Container: "test-app"},
+			{Kind: "Pod", Name: "test-pod", Container: "test-app-1"},
+			{Kind: "Pod", Name: "test-pod", Container: "test-app-2"},
+			{Kind: "ReplicaSet", Name: "test-replica-set", Container: "test-app"},
+			{Kind: "ReplicationController", Name: "test-replication-controller", Container: "test-app"},
+			{Kind: "StatefulSet", Name: "test-stateful-set", Container: "test-app"},
+		},
 	}, {
 		name: "Nothing to update",
 
@@ -846,17 +1047,108 @@ func TestUpdateMatchingContainerImage(t *testing.T) {
 		want: Objects{
 			newObjectFromFile(t, testDeploymentUpdated3File),
 		},
+		wantMatches: []ContainerMatch{
+			{Kind: "Deployment", Name: "test-app", Container: "test-app"},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			matches, err := UpdateMatchingContainerImage(ctx, tc.objs, nil, imageName, replace)
+			if !reflect.DeepEqual(tc.objs, tc.want) || err != nil {
+				t.Errorf("UpdateMatchingContainerImage(ctx, %v, %s, %s) = _, %v, %v; want _, <nil>, %v", tc.beforeUpdate, imageName, replace, err, tc.objs, tc.want)
+			}
+			if diff := cmp.Diff(tc.wantMatches, matches); diff != "" {
+				t.Errorf("UpdateMatchingContainerImage(ctx, %v, %s, %s) produced diff in matches (-want +got):\n%s", tc.beforeUpdate, imageName, replace, diff)
+			}
+		})
+	}
+}
+
+func TestUpdateContainerImages(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentInitContainersFile := "testing/deployment-init-containers.yaml"
+	testDeploymentInitContainersUpdatedFile := "testing/deployment-init-containers-updated.yaml"
+	testPodEphemeralContainersFile := "testing/pod-ephemeral-containers.yaml"
+	testServiceFile := "testing/service.yaml"
+
+	replace := "REPLACED"
+
+	tests := []struct {
+		name string
+
+		objs Objects
+
+		want        Objects
+		wantVisited []string
+	}{{
+		name: "Update init containers",
+
+		objs: Objects{
+			newObjectFromFile(t, testDeploymentInitContainersFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+
+		want: Objects{
+			newObjectFromFile(t, testDeploymentInitContainersUpdatedFile),
+			newObjectFromFile(t, testServiceFile),
+		},
+		wantVisited: []string{
+			"Deployment/test-app/init=busybox:1.31",
+			"Deployment/test-app/test-app=gcr.io/cbd-test/test-app:latest",
+			"Deployment/test-app/logger=fluentd:v1.9",
+		},
+	}, {
+		name: "Visit ephemeral containers",
+
+		objs: Objects{
+			newObjectFromFile(t, testPodEphemeralContainersFile),
+		},
+
+		wantVisited: []string{
+			"Pod/test-pod/test-app=gcr.io/cbd-test/test-app:1",
+			"Pod/test-pod/debugger=busybox:1.31",
+		},
 	}}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := UpdateMatchingContainerImage(ctx, tc.objs, imageName, replace); !reflect.DeepEqual(tc.objs, tc.want) || err != nil {
-				t.Errorf("UpdateMatchingContainerImage(ctx, %v, %s, %s) = %v, %v; want <nil>, %v", tc.beforeUpdate, imageName, replace, err, tc.objs, tc.want)
+			var visited []string
+			update := func(obj *Object, container, image string) (string, error) {
+				visited = append(visited, fmt.Sprintf("%s/%s/%s=%s", ObjectKind(obj), obj.GetName(), container, image))
+				if tc.want == nil {
+					return image, nil
+				}
+				return replace, nil
+			}
+			if err := UpdateContainerImages(ctx, tc.objs, nil, update); err != nil {
+				t.Fatalf("UpdateContainerImages(ctx, %v, update) = %v; want <nil>", tc.objs, err)
+			}
+			if diff := cmp.Diff(tc.wantVisited, visited); diff != "" {
+				t.Errorf("UpdateContainerImages(ctx, %v, update) produced diff in visited containers (-want +got):\n%s", tc.objs, diff)
+			}
+			if tc.want != nil && !reflect.DeepEqual(tc.objs, tc.want) {
+				t.Errorf("UpdateContainerImages(ctx, ...) updated objects to %v; want %v", tc.objs, tc.want)
 			}
 		})
 	}
 }
 
+func TestUpdateContainerImagesErrors(t *testing.T) {
+	ctx := context.Background()
+
+	objs := Objects{
+		newObjectFromFile(t, "testing/deployment-init-containers.yaml"),
+	}
+	update := func(obj *Object, container, image string) (string, error) {
+		return "", fmt.Errorf("failed to update image %q", image)
+	}
+	if err := UpdateContainerImages(ctx, objs, nil, update); err == nil {
+		t.Errorf("UpdateContainerImages(ctx, %v, update) = <nil>; want error", objs)
+	}
+}
+
 func TestAddLabel(t *testing.T) {
 	ctx := context.Background()
 
@@ -990,7 +1282,7 @@ func TestAddLabel(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := AddLabel(ctx, tc.obj, tc.key, tc.value, tc.override); !reflect.DeepEqual(tc.obj, tc.want) || err != nil {
+			if err := AddLabel(ctx, tc.obj, nil, tc.key, tc.value, tc.override, nil); !reflect.DeepEqual(tc.obj, tc.want) || err != nil {
 				t.Errorf("AddLabel(ctx, %v, %s, %s, %t) = %v, %v; want <nil>, %v", tc.beforeUpdate, tc.key, tc.value, tc.override, err, tc.obj, tc.want)
 			}
 		})
@@ -1024,7 +1316,7 @@ func TestAddLabelErrors(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := AddLabel(ctx, tc.obj, tc.key, tc.value, false); err == nil {
+			if err := AddLabel(ctx, tc.obj, nil, tc.key, tc.value, false, nil); err == nil {
 				t.Errorf("AddLabel(ctx, %v, %s, %s, false) = <nil>; want error", tc.obj, tc.key, tc.value)
 			}
 		})
@@ -1123,7 +1415,7 @@ func TestAddAnnotation(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := AddAnnotation(tc.obj, tc.key, tc.value); !reflect.DeepEqual(tc.obj, tc.want) || err != nil {
+			if err := AddAnnotation(tc.obj, nil, tc.key, tc.value); !reflect.DeepEqual(tc.obj, tc.want) || err != nil {
 				t.Errorf("AddAnnotation(%v, %s, %s) = %v, %v; want <nil>, %v", tc.beforeUpdate, tc.key, tc.value, err, tc.obj, tc.want)
 			}
 		})
@@ -1155,7 +1447,7 @@ func TestAddAnnotationErrors(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			if err := AddAnnotation(tc.obj, tc.key, tc.value); err == nil {
+			if err := AddAnnotation(tc.obj, nil, tc.key, tc.value); err == nil {
 				t.Errorf("AddAnnotation(%v, %s, %s) = <nil>; want error", tc.obj, tc.key, tc.value)
 			}
 		})
@@ -1449,6 +1741,9 @@ func TestDeploySummary(t *testing.T) {
 	testLoadBalancerServiceUnreadyFile := "testing/service-unready.yaml"
 	testExternalNameServiceReadyFile := "testing/service-ready-4.yaml"
 	testStatefulsetUnreadyFile := "testing/statefulset-unready.yaml"
+	testHpaReadyFile := "testing/hpa-ready.yaml"
+	testIngressUnreadyFile := "testing/ingress-unready.yaml"
+	testJobFailedFile := "testing/job-failed.yaml"
 
 	tests := []struct {
 		name string
@@ -1503,6 +1798,20 @@ test-local-deploy-all    ReplicationController    test-app-replicationcontroller
 foobar                   Service                  test-app                          No       
 foobar                   Service                  test-app-service-externalname     Yes      test-app.example.com
 default                  StatefulSet              test-app-statefulset              No       
+`,
+	}, {
+		name: "Job, Ingress, and HorizontalPodAutoscaler",
+
+		objs: Objects{
+			newObjectFromFile(t, testHpaReadyFile),
+			newObjectFromFile(t, testIngressUnreadyFile),
+			newObjectFromFile(t, testJobFailedFile),
+		},
+
+		want: `NAMESPACE    KIND                       NAME                READY     
+default      HorizontalPodAutoscaler    test-app-hpa        Yes       
+default      Ingress                    test-app-ingress    No        
+default      Job                        test-job            Failed    
 `,
 	}}
 
@@ -1570,6 +1879,48 @@ func TestSortObjectsByKindAndName(t *testing.T) {
 	}
 }
 
+func TestSortObjectsByApplyPhase(t *testing.T) {
+	testApplicationFile := "testing/application.yaml"
+	testCertificateFile := "testing/certificate-ready.yaml"
+	testConfigMapFile := "testing/configmap.yaml"
+	testCrdFile := "testing/crd.yaml"
+	testDeploymentFile := "testing/deployment.yaml"
+	testHpaFile := "testing/hpa.yaml"
+	testJobFile := "testing/job.yaml"
+	testNamespaceFile := "testing/namespace.yaml"
+	testServiceFile := "testing/service.yaml"
+	testServiceAccountFile := "testing/serviceaccount.yaml"
+
+	objs := Objects{
+		newObjectFromFile(t, testServiceFile),
+		newObjectFromFile(t, testCertificateFile),
+		newObjectFromFile(t, testDeploymentFile),
+		newObjectFromFile(t, testConfigMapFile),
+		newObjectFromFile(t, testHpaFile),
+		newObjectFromFile(t, testCrdFile),
+		newObjectFromFile(t, testServiceAccountFile),
+		newObjectFromFile(t, testApplicationFile),
+		newObjectFromFile(t, testNamespaceFile),
+		newObjectFromFile(t, testJobFile),
+	}
+	want := Objects{
+		newObjectFromFile(t, testCrdFile),
+		newObjectFromFile(t, testNamespaceFile),
+		newObjectFromFile(t, testServiceAccountFile),
+		newObjectFromFile(t, testConfigMapFile),
+		newObjectFromFile(t, testDeploymentFile),
+		newObjectFromFile(t, testJobFile),
+		newObjectFromFile(t, testServiceFile),
+		newObjectFromFile(t, testCertificateFile),
+		newObjectFromFile(t, testHpaFile),
+		newObjectFromFile(t, testApplicationFile),
+	}
+
+	if got := SortObjectsByApplyPhase(objs); !reflect.DeepEqual(got, want) {
+		t.Errorf("SortObjectsByApplyPhase(%v) = %v; want %v", objs, got, want)
+	}
+}
+
 func TestAddCommentsToLines(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1624,6 +1975,46 @@ func TestAddCommentsToLines(t *testing.T) {
 	}
 }
 
+func TestRemoveServerPopulatedFields(t *testing.T) {
+	tests := []struct {
+		name string
+
+		obj *Object
+
+		want *Object
+	}{{
+		name: "Deployment with other annotations",
+
+		obj: newObjectFromFile(t, "testing/deployment-ready.yaml"),
+
+		want: newObjectFromFile(t, "testing/deployment-ready-without-server-fields.yaml"),
+	}, {
+		name: "Service with only last-applied-configuration annotation",
+
+		obj: newObjectFromFile(t, "testing/service-ready.yaml"),
+
+		want: newObjectFromFile(t, "testing/service-ready-without-server-fields.yaml"),
+	}, {
+		name: "No server populated fields",
+
+		obj: newObjectFromFile(t, "testing/service.yaml"),
+
+		want: newObjectFromFile(t, "testing/service.yaml"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			original := tc.obj.DeepCopy()
+			if got := RemoveServerPopulatedFields(tc.obj); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("RemoveServerPopulatedFields(%v) = %v; want %v", tc.obj, got, tc.want)
+			}
+			if !reflect.DeepEqual(tc.obj.Unstructured, original) {
+				t.Errorf("RemoveServerPopulatedFields(%v) modified its input", tc.obj)
+			}
+		})
+	}
+}
+
 func newObjectFromFile(t *testing.T, filename string) *Object {
 	contents := fileContents(t, filename)
 	obj, err := DecodeFromYAML(nil, contents)
@@ -0,0 +1,116 @@
+package resource
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SubstitutedVariablesAnnotation is the annotation that records the names of the variables that were
+// substituted in an object's configuration.
+const SubstitutedVariablesAnnotation = "gke-deploy.cloud.google.com/substituted-variables"
+
+// variablePattern matches ${VAR} placeholders, and $${VAR} escaped placeholders.
+var variablePattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Variables are the values of ${VAR} placeholders in configuration files.
+type Variables struct {
+	Values map[string]string
+	// Strict makes placeholders of undefined variables an error, instead of a warning.
+	Strict bool
+	// Warnf is called with the warning about placeholders of undefined variables. If nil, the
+	// warning is not reported.
+	Warnf func(format string, a ...interface{})
+}
+
+// Expand replaces ${VAR} placeholders in s with the values of their variables, and returns the sorted
+// names of the variables that were substituted. Escaped placeholders, i.e., $${VAR}, are replaced
+// with ${VAR}. Placeholders of undefined variables are left as is, unless v.Strict is set, in which
+// case an error is returned.
+func (v *Variables) Expand(s string) (string, []string, error) {
+	substituted := make(map[string]bool)
+	undefined := make(map[string]bool)
+	expanded := v.expand(s, substituted, undefined)
+	if err := v.checkUndefined(undefined); err != nil {
+		return "", nil, err
+	}
+	return expanded, sortedKeys(substituted), nil
+}
+
+// ExpandObject replaces ${VAR} placeholders in the string values of obj like Expand, and returns the
+// sorted names of the variables that were substituted. Values are substituted into decoded strings
+// rather than into the YAML of obj, so they cannot change the structure of obj, e.g., a value with
+// a newline or ": " stays part of the string it is substituted into. Map keys are not expanded.
+func (v *Variables) ExpandObject(obj *Object) ([]string, error) {
+	substituted := make(map[string]bool)
+	undefined := make(map[string]bool)
+	obj.Object = v.expandValue(obj.Object, substituted, undefined).(map[string]interface{})
+	if err := v.checkUndefined(undefined); err != nil {
+		return nil, err
+	}
+	return sortedKeys(substituted), nil
+}
+
+// expandValue expands the placeholders in every string in value, which is a decoded YAML value.
+func (v *Variables) expandValue(value interface{}, substituted, undefined map[string]bool) interface{} {
+	switch val := value.(type) {
+	case string:
+		return v.expand(val, substituted, undefined)
+	case map[string]interface{}:
+		for k, field := range val {
+			val[k] = v.expandValue(field, substituted, undefined)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = v.expandValue(item, substituted, undefined)
+		}
+		return val
+	default:
+		return value
+	}
+}
+
+// expand expands the placeholders in s, and adds the names of substituted and undefined variables to
+// substituted and undefined.
+func (v *Variables) expand(s string, substituted, undefined map[string]bool) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(placeholder string) string {
+		if strings.HasPrefix(placeholder, "$$") {
+			return placeholder[1:]
+		}
+		name := variablePattern.FindStringSubmatch(placeholder)[1]
+		value, ok := v.Values[name]
+		if !ok {
+			undefined[name] = true
+			return placeholder
+		}
+		substituted[name] = true
+		return value
+	})
+}
+
+// checkUndefined returns an error if any variables are undefined and v.Strict is set, or else warns
+// about them.
+func (v *Variables) checkUndefined(undefined map[string]bool) error {
+	if len(undefined) == 0 {
+		return nil
+	}
+	names := sortedKeys(undefined)
+	if v.Strict {
+		return fmt.Errorf("undefined variable(s): %s", strings.Join(names, ", "))
+	}
+	if v.Warnf != nil {
+		v.Warnf("Placeholders of undefined variable(s) are left as is: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,153 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name string
+
+		in     string
+		values map[string]string
+		strict bool
+
+		want        string
+		wantNames   []string
+		wantWarning string
+	}{{
+		name: "No placeholders",
+
+		in: "image: gcr.io/my-project/my-app:1.0.0",
+
+		want: "image: gcr.io/my-project/my-app:1.0.0",
+	}, {
+		name: "Placeholders",
+
+		in: "image: gcr.io/${PROJECT_ID}/my-app:${SHORT_SHA}\nproject: ${PROJECT_ID}",
+		values: map[string]string{
+			"PROJECT_ID": "my-project",
+			"SHORT_SHA":  "abc1234",
+		},
+
+		want:      "image: gcr.io/my-project/my-app:abc1234\nproject: my-project",
+		wantNames: []string{"PROJECT_ID", "SHORT_SHA"},
+	}, {
+		name: "Escaped placeholder",
+
+		in: "value: $${SHORT_SHA}-${SHORT_SHA}",
+		values: map[string]string{
+			"SHORT_SHA": "abc1234",
+		},
+
+		want:      "value: ${SHORT_SHA}-abc1234",
+		wantNames: []string{"SHORT_SHA"},
+	}, {
+		name: "Undefined variable is left as is",
+
+		in: "value: ${UNDEFINED}",
+
+		want:        "value: ${UNDEFINED}",
+		wantWarning: "Placeholders of undefined variable(s) are left as is: UNDEFINED",
+	}, {
+		name: "Shell variables are left as is",
+
+		in: "command: echo $HOME ${1}",
+		values: map[string]string{
+			"HOME": "/root",
+		},
+		strict: true,
+
+		want: "command: echo $HOME ${1}",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var warning string
+			v := &Variables{
+				Values: tc.values,
+				Strict: tc.strict,
+				Warnf: func(format string, a ...interface{}) {
+					warning = fmt.Sprintf(format, a...)
+				},
+			}
+			got, names, err := v.Expand(tc.in)
+			if err != nil {
+				t.Fatalf("Expand(%q) = _, _, %v; want _, _, <nil>", tc.in, err)
+			}
+			if got != tc.want {
+				t.Errorf("Expand(%q) = %q, _, <nil>; want %q, _, <nil>", tc.in, got, tc.want)
+			}
+			if len(names) != 0 || len(tc.wantNames) != 0 {
+				if !reflect.DeepEqual(names, tc.wantNames) {
+					t.Errorf("Expand(%q) = _, %v, <nil>; want _, %v, <nil>", tc.in, names, tc.wantNames)
+				}
+			}
+			if warning != tc.wantWarning {
+				t.Errorf("Expand(%q) warned %q; want %q", tc.in, warning, tc.wantWarning)
+			}
+		})
+	}
+}
+
+func TestExpandStrictErrors(t *testing.T) {
+	v := &Variables{
+		Values: map[string]string{"SHORT_SHA": "abc1234"},
+		Strict: true,
+	}
+	in := "image: gcr.io/${PROJECT_ID}/my-app:${SHORT_SHA}"
+	if got, names, err := v.Expand(in); err == nil {
+		t.Errorf("Expand(%q) = %q, %v, <nil>; want error", in, got, names)
+	}
+}
+
+func TestExpandObject(t *testing.T) {
+	ctx := context.Background()
+
+	obj, err := DecodeFromYAML(ctx, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: ${NAME}\ndata:\n  count: \"1\"\n  environment: ${ENVIRONMENT}\n  list: $${NAME}\n"))
+	if err != nil {
+		t.Fatalf("failed to decode object: %v", err)
+	}
+	v := &Variables{
+		Values: map[string]string{
+			"NAME": "test-app",
+			// A value that would add a field if it were substituted into YAML.
+			"ENVIRONMENT": "staging\n  injected: true",
+		},
+		Strict: true,
+	}
+
+	names, err := v.ExpandObject(obj)
+	if err != nil {
+		t.Fatalf("ExpandObject(%v) = _, %v; want _, <nil>", obj, err)
+	}
+	if want := []string{"ENVIRONMENT", "NAME"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("ExpandObject(%v) = %v, <nil>; want %v, <nil>", obj, names, want)
+	}
+	want := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": "test-app",
+		},
+		"data": map[string]interface{}{
+			"count":       "1",
+			"environment": "staging\n  injected: true",
+			"list":        "${NAME}",
+		},
+	}
+	if diff := cmp.Diff(want, obj.Object); diff != "" {
+		t.Errorf("ExpandObject(...) produced diff (-want +got):\n%s", diff)
+	}
+
+	delete(v.Values, "NAME")
+	if _, err := v.ExpandObject(&Object{&unstructured.Unstructured{Object: map[string]interface{}{"name": "${NAME}"}}}); err == nil {
+		t.Errorf("ExpandObject(...) with undefined variable = _, <nil>; want _, error")
+	}
+}
@@ -0,0 +1,48 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+// Chart is a Helm chart that configuration files are rendered from.
+type Chart struct {
+	// Path is the path to a local chart directory or packaged chart (.tgz).
+	Path string
+	// ValuesFiles are paths to YAML files with values for the chart.
+	ValuesFiles []string
+	// SetValues are values for the chart, in the form key=value.
+	SetValues []string
+}
+
+// renderChart renders d.Chart with the application name as the release name and parses the rendered
+// configuration files. The chart is rendered with d.Clients.Helm, or with a new services.Helm if it
+// is not set.
+func (d *Deployer) renderChart(ctx context.Context, releaseName, namespace string) (resource.Objects, error) {
+	hs := d.Clients.Helm
+	if hs == nil {
+		var err error
+		if hs, err = services.NewHelm(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if releaseName == "" {
+		return nil, fmt.Errorf("release name of chart %q cannot be empty", d.Chart.Path)
+	}
+	d.printf("Rendering chart %q with release name %q\n", d.Chart.Path, releaseName)
+	out, err := hs.Template(ctx, releaseName, d.Chart.Path, namespace, d.Chart.ValuesFiles, d.Chart.SetValues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart %q: %v", d.Chart.Path, err)
+	}
+	objs, err := resource.ParseConfigsFromYAML(ctx, out, fmt.Sprintf("chart %q", d.Chart.Path), d.Validator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration files rendered from chart %q: %v", d.Chart.Path, err)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no objects found")
+	}
+	return objs, nil
+}
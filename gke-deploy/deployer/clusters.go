@@ -0,0 +1,194 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+// ClusterTarget is a GKE cluster to deploy to.
+type ClusterTarget struct {
+	Name     string `json:"cluster"`
+	Location string `json:"location"`
+	// Project is the project of the cluster. If it is empty, the project passed to ApplyToClusters
+	// is used.
+	Project string `json:"project,omitempty"`
+}
+
+// String returns a string representation of a cluster target.
+func (t ClusterTarget) String() string {
+	return fmt.Sprintf("cluster %q in %q", t.Name, t.Location)
+}
+
+// NewClusterClientsFunc creates clients whose cluster credentials are stored in a kubeconfig file,
+// so that each cluster is accessed with isolated credentials.
+type NewClusterClientsFunc func(ctx context.Context, kubeconfig string) (*services.Clients, error)
+
+// clusterResult is the result of deploying to a cluster.
+type clusterResult struct {
+	target  ClusterTarget
+	project string
+	// objs are the last seen states of the deployed objects.
+	objs    resource.Objects
+	err     error
+	skipped bool
+}
+
+// status returns the status of deploying to a cluster, for the summary of all clusters.
+func (r *clusterResult) status() string {
+	switch {
+	case r.skipped:
+		return "Skipped"
+	case r.err != nil:
+		return "Failed"
+	default:
+		return "Succeeded"
+	}
+}
+
+// ApplyToClusters applies the configuration files in config to each target cluster, with the
+// credentials of each cluster stored in a separate kubeconfig file. Clusters are deployed to
+// concurrently, unless sequential is true, in which case clusters are deployed to one at a time and
+// the remaining clusters are skipped once more than maxUnavailable clusters failed. A summary of each
+// cluster's deployed objects is printed at the end.
+func (d *Deployer) ApplyToClusters(ctx context.Context, targets []ClusterTarget, clusterProject, config, namespace string, waitTimeout time.Duration, recursive, sequential bool, maxUnavailable int) error {
+	if d.NewClusterClients == nil {
+		return fmt.Errorf("clients of each cluster cannot be created")
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no clusters to deploy to")
+	}
+	if d.ServerDryRun {
+		d.printf("Applying deployment to %d clusters in server dry run mode.\n", len(targets))
+	} else {
+		d.printf("Applying deployment to %d clusters.\n", len(targets))
+	}
+
+	objs, err := d.parseConfigs(ctx, config, recursive)
+	if err != nil {
+		d.emitFailure(err)
+		return err
+	}
+	d.printf("Configuration files to be used: %v\n", objs)
+
+	tmpDir, err := d.Clients.OS.TempDir(ctx, "", k8sConfigStagingDir)
+	if err != nil {
+		return fmt.Errorf("failed to create tmp directory: %v", err)
+	}
+	defer d.Clients.OS.RemoveAll(ctx, tmpDir)
+
+	results := make([]*clusterResult, len(targets))
+	deploy := func(i int) {
+		t := targets[i]
+		r := &clusterResult{target: t}
+		results[i] = r
+		project := t.Project
+		if project == "" {
+			project = clusterProject
+		}
+
+		d.printf("\nDeploying to %s.\n", t)
+		cd := *d
+		cd.target = t
+		clients, err := d.NewClusterClients(ctx, filepath.Join(tmpDir, fmt.Sprintf("kubeconfig-%d", i)))
+		if err != nil {
+			r.err = fmt.Errorf("failed to initialize clients: %v", err)
+			cd.emitFailure(r.err)
+			return
+		}
+		cd.Clients = clients
+
+		endAuthorize := cd.startPhase("authorize", t)
+		r.project, r.err = cd.authorizeClusterAccess(ctx, t.Name, t.Location, project)
+		if r.err != nil {
+			cd.emitFailure(r.err)
+			return
+		}
+		endAuthorize()
+		clusterObjs := make(resource.Objects, 0, len(objs))
+		for _, obj := range objs {
+			clusterObjs = append(clusterObjs, &resource.Object{Unstructured: obj.DeepCopy()})
+		}
+		target := t
+		target.Project = r.project
+		r.objs, r.err = cd.applyObjects(ctx, target, clusterObjs, namespace, waitTimeout)
+	}
+
+	if sequential {
+		failed := 0
+		for i, t := range targets {
+			if failed > maxUnavailable {
+				results[i] = &clusterResult{target: t, skipped: true}
+				continue
+			}
+			deploy(i)
+			if results[i].err != nil {
+				failed++
+			}
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i := range targets {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				deploy(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	if err := d.printClustersSummary(ctx, results); err != nil {
+		return err
+	}
+
+	var failures []string
+	for _, r := range results {
+		if r.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", r.target, r.err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deploy to %d of %d clusters:\n%s", len(failures), len(targets), strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// printClustersSummary prints the status of deploying to each cluster, followed by the summary of
+// each cluster's deployed objects.
+func (d *Deployer) printClustersSummary(ctx context.Context, results []*clusterResult) error {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "CLUSTER\tLOCATION\tPROJECT\tSTATUS\n")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.target.Name, r.target.Location, r.project, r.status())
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush writer: %v", err)
+	}
+
+	d.printf("################################################################################\n")
+	d.printf("> Deployed Clusters\n\n")
+	d.printf("%s\n", buf.String())
+	for _, r := range results {
+		if len(r.objs) == 0 {
+			continue
+		}
+		summary, err := resource.DeploySummary(ctx, r.objs)
+		if err != nil {
+			return fmt.Errorf("failed to get summary of objects deployed to %s: %v", r.target, err)
+		}
+		d.printf("> Deployed Objects in %s\n\n", r.target)
+		d.printf("%s\n", summary)
+	}
+	d.printf("################################################################################\n")
+	return nil
+}
@@ -0,0 +1,208 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestApplyToClusters(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+
+	targets := []ClusterTarget{{
+		Name:     "cluster-1",
+		Location: "us-east1",
+		Project:  "project-1",
+	}, {
+		Name:     "cluster-2",
+		Location: "europe-west1",
+	}, {
+		Name:     "cluster-3",
+		Location: "asia-east1",
+	}}
+	errGetCredentials := fmt.Errorf("failed to get credentials")
+
+	newKubectl := func() *testservices.TestKubectl {
+		return &testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testDeploymentFile)): {nil},
+				string(fileContents(t, testServiceFile)):    {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Deployment": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testDeploymentReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		sequential     bool
+		maxUnavailable int
+		// failing are the indexes of targets whose credentials cannot be fetched.
+		failing map[int]bool
+
+		wantDeployed []int
+		wantErr      string
+	}{{
+		name: "Deploy concurrently",
+
+		wantDeployed: []int{0, 1, 2},
+	}, {
+		name: "Deploy concurrently with failing cluster",
+
+		failing: map[int]bool{0: true},
+
+		wantDeployed: []int{1, 2},
+		wantErr:      "failed to deploy to 1 of 3 clusters",
+	}, {
+		name: "Deploy sequentially",
+
+		sequential: true,
+
+		wantDeployed: []int{0, 1, 2},
+	}, {
+		name: "Skip remaining clusters after failing cluster",
+
+		sequential: true,
+		failing:    map[int]bool{1: true},
+
+		wantDeployed: []int{0},
+		wantErr:      "failed to deploy to 1 of 3 clusters",
+	}, {
+		name: "Skip remaining clusters after more than max unavailable clusters",
+
+		sequential:     true,
+		maxUnavailable: 1,
+		failing:        map[int]bool{0: true, 1: true},
+
+		wantDeployed: []int{},
+		wantErr:      "failed to deploy to 2 of 3 clusters",
+	}, {
+		name: "Continue after max unavailable clusters",
+
+		sequential:     true,
+		maxUnavailable: 1,
+		failing:        map[int]bool{0: true},
+
+		wantDeployed: []int{1, 2},
+		wantErr:      "failed to deploy to 1 of 3 clusters",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			kubectls := make(map[int]*testservices.TestKubectl)
+			kubeconfigs := make(map[string]bool)
+
+			d := Deployer{
+				Clients: &services.Clients{
+					OS: &services.OS{},
+				},
+				UseGcloud: true,
+				NewClusterClients: func(ctx context.Context, kubeconfig string) (*services.Clients, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					var i int
+					if _, err := fmt.Sscanf(filepath.Base(kubeconfig), "kubeconfig-%d", &i); err != nil {
+						return nil, fmt.Errorf("unexpected kubeconfig %q", kubeconfig)
+					}
+					kubeconfigs[kubeconfig] = true
+					gcloud := &testservices.TestGcloud{
+						ConfigGetValueResp: "my-project",
+					}
+					if tc.failing[i] {
+						gcloud.ContainerClustersGetCredentialsErr = errGetCredentials
+					}
+					kubectls[i] = newKubectl()
+					return &services.Clients{
+						Kubectl: kubectls[i],
+						Gcloud:  gcloud,
+						OS:      &services.OS{},
+					}, nil
+				},
+			}
+
+			err := d.ApplyToClusters(ctx, targets, "my-project", "testing/configs/deployment-and-service", "default", 10*time.Second, false, tc.sequential, tc.maxUnavailable)
+			if tc.wantErr == "" && err != nil {
+				t.Fatalf("ApplyToClusters(ctx, %v, ...) = %v; want <nil>", targets, err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("ApplyToClusters(ctx, %v, ...) = %v; want error containing %q", targets, err, tc.wantErr)
+			}
+
+			deployed := 0
+			for i, k := range kubectls {
+				if len(k.ApplyFromStringResponse) == 0 {
+					deployed++
+					continue
+				}
+				if !tc.failing[i] {
+					t.Errorf("ApplyToClusters(ctx, %v, ...) did not apply all of the expected configs to %s. got %v; want []", targets, targets[i], k.ApplyFromStringResponse)
+				}
+			}
+			for _, i := range tc.wantDeployed {
+				if k, ok := kubectls[i]; !ok || len(k.ApplyFromStringResponse) != 0 {
+					t.Errorf("ApplyToClusters(ctx, %v, ...) did not deploy to %s", targets, targets[i])
+				}
+			}
+			if deployed != len(tc.wantDeployed) {
+				t.Errorf("ApplyToClusters(ctx, %v, ...) deployed to %d clusters; want %d", targets, deployed, len(tc.wantDeployed))
+			}
+			if len(kubeconfigs) != len(kubectls) {
+				t.Errorf("ApplyToClusters(ctx, %v, ...) used %d kubeconfigs for %d clusters; want one kubeconfig per cluster", targets, len(kubeconfigs), len(kubectls))
+			}
+		})
+	}
+}
+
+func TestApplyToClustersErrors(t *testing.T) {
+	ctx := context.Background()
+
+	d := Deployer{
+		Clients: &services.Clients{
+			OS: &services.OS{},
+		},
+	}
+	targets := []ClusterTarget{{Name: "cluster-1", Location: "us-east1"}}
+	if err := d.ApplyToClusters(ctx, targets, "", "testing/configs/deployment-and-service", "default", 10*time.Second, false, false, 0); err == nil {
+		t.Errorf("ApplyToClusters(ctx, %v, ...) without NewClusterClients = <nil>; want error", targets)
+	}
+
+	d.NewClusterClients = func(ctx context.Context, kubeconfig string) (*services.Clients, error) {
+		return nil, fmt.Errorf("failed to create clients")
+	}
+	if err := d.ApplyToClusters(ctx, nil, "", "testing/configs/deployment-and-service", "default", 10*time.Second, false, false, 0); err == nil {
+		t.Errorf("ApplyToClusters(ctx, [], ...) = <nil>; want error")
+	}
+	if err := d.ApplyToClusters(ctx, targets, "", "testing/configs/deployment-and-service", "default", 10*time.Second, false, false, 0); err == nil {
+		t.Errorf("ApplyToClusters(ctx, %v, ...) with failing NewClusterClients = <nil>; want error", targets)
+	}
+}
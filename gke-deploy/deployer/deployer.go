@@ -4,20 +4,23 @@ package deployer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"path/filepath"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/crd"
-	"github.com/google/go-containerregistry/pkg/name"
 	applicationsv1beta1 "github.com/kubernetes-sigs/application/pkg/apis/app/v1beta1"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/event"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/gcp"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/gcs"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/image"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/policy"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
@@ -32,18 +35,67 @@ const (
 	k8sConfigStagingDir = "gke_deploy_temp_"
 	expendedFileName    = "expanded-resources.yaml"
 	suggestedFileName   = "suggested-resources.yaml"
+
+	// readinessCheckInterval is how often deployed objects are checked for readiness when some
+	// objects must be fetched individually.
+	readinessCheckInterval = 5 * time.Second
+	// listedReadinessCheckInterval is how often deployed objects are checked for readiness when all
+	// objects are fetched with list requests, which are cheap enough to make more often.
+	listedReadinessCheckInterval = 1 * time.Second
 )
 
 // Deployer handles the deployment of an image to a cluster.
 type Deployer struct {
-	Clients      *services.Clients
-	UseGcloud    bool
-	ServerDryRun bool
+	Clients               *services.Clients
+	UseGcloud             bool
+	ServerDryRun          bool
+	Prune                 bool
+	PruneClusterScoped    bool
+	RollbackOnFailure     bool
+	ServerSideApply       bool
+	ForceConflicts        bool
+	CheckOwnership        bool
+	Lock                  bool
+	LockTimeout           time.Duration
+	LockDuration          time.Duration
+	PinAllImages          bool
+	PinImagesPolicy       string
+	Chart                 *Chart
+	Variables             *resource.Variables
+	Validator             resource.Validator
+	PodTemplatePaths      resource.PodTemplatePaths
+	NewClusterClients     NewClusterClientsFunc
+	Results               *Results
+	RecordRelease         bool
+	ReleaseHistoryMax     int
+	BuildID               string
+	Events                event.Sink
+	CheckPolicy           bool
+	Policy                policy.Policy
+	AllowPolicyViolations bool
+	// Out is where human-readable progress is written. If nil, it is written to stdout.
+	Out io.Writer
+
+	// releaseDescription is the description of the release recorded after applying objects.
+	releaseDescription string
+	// target is the cluster that events are emitted for, which is set on the copy of the deployer
+	// that deploys to one of multiple clusters.
+	target ClusterTarget
+	// contextNamespace is the namespace of the current context of the target cluster, which objects
+	// without a namespace are applied to. It is set by authorizeClusterAccess.
+	contextNamespace string
 }
 
 // Prepare handles preparing deployment.
-func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appVersion, config, suggestedOutput, expandedOutput, namespace string, labels, annotations map[string]string, exposePort int, recursive, createApplicationCR bool, applicationLinks []applicationsv1beta1.Link) error {
-	fmt.Printf("Preparing deployment.\n")
+func (d *Deployer) Prepare(ctx context.Context, images []*image.Mapping, appName, appVersion, config, suggestedOutput, expandedOutput, namespace string, labels, annotations map[string]string, exposePort int, recursive, createApplicationCR bool, applicationLinks []applicationsv1beta1.Link) (err error) {
+	d.printf("Preparing deployment.\n")
+	defer d.startPhase("prepare", ClusterTarget{})()
+	// The deployment ends here if it cannot be prepared.
+	defer func() {
+		if err != nil {
+			d.emitFailure(err)
+		}
+	}()
 
 	var objs resource.Objects
 	ss := &gcs.GCS{
@@ -64,7 +116,7 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 			config = tmpDir
 		}
 
-		parsed, err := resource.ParseConfigs(ctx, config, d.Clients.OS, recursive)
+		parsed, err := resource.ParseConfigs(ctx, config, d.Clients.OS, d.kustomize(), d.variables(), d.Validator, recursive)
 		if err != nil {
 			return fmt.Errorf("failed to parse configuration files %q: %v", config, err)
 		}
@@ -72,20 +124,30 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 			return fmt.Errorf("no objects found")
 		}
 		objs = parsed
-		fmt.Printf("Configuration files to be used: %v\n", objs)
+		d.printf("Configuration files to be used: %v\n", objs)
+	} else if d.Chart != nil {
+		rendered, err := d.renderChart(ctx, appName, namespace)
+		if err != nil {
+			return err
+		}
+		objs = rendered
+		d.printf("Configuration files to be used: %v\n", objs)
 	} else {
 		objs = resource.Objects{}
-		fmt.Println("Starting with no configuration files")
+		d.printf("Starting with no configuration files\n")
 	}
 
-	if im != nil {
-		// e.g., Resolve "gcr.io/my-project/my-app:1.0.0" to name suffix "my-app".
-		imageNameSplit := strings.Split(image.Name(im), "/")
-		imageNameSuffix := imageNameSplit[len(imageNameSplit)-1]
-		imageName := image.Name(im)
+	if len(images) > 0 {
+		if config == "" && d.Chart == nil {
+			if len(images) > 1 {
+				return fmt.Errorf("suggested configuration files can only be created for one image, got %d", len(images))
+			}
+			imageName := image.Name(images[0].Ref)
+			// e.g., Resolve "gcr.io/my-project/my-app:1.0.0" to name suffix "my-app".
+			imageNameSplit := strings.Split(imageName, "/")
+			imageNameSuffix := imageNameSplit[len(imageNameSplit)-1]
 
-		if config == "" {
-			fmt.Printf("Creating suggested Deployment configuration file %q\n", imageNameSuffix)
+			d.printf("Creating suggested Deployment configuration file %q\n", imageNameSuffix)
 			dObj, err := resource.CreateDeploymentObject(ctx, imageNameSuffix, imageNameSuffix, imageName)
 			if err != nil {
 				return fmt.Errorf("failed to create Deployment object: %v", err)
@@ -94,7 +156,7 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 			objs = append(objs, dObj)
 
 			hpaName := fmt.Sprintf("%s-hpa", imageNameSuffix)
-			fmt.Printf("Creating suggested HorizontalPodAutoscaler configuration file %q\n", hpaName)
+			d.printf("Creating suggested HorizontalPodAutoscaler configuration file %q\n", hpaName)
 			hpaObj, err := resource.CreateHorizontalPodAutoscalerObject(ctx, hpaName, imageNameSuffix)
 			if err != nil {
 				return fmt.Errorf("failed to create HorizontalPodAutoscaler object: %v", err)
@@ -103,8 +165,14 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 		}
 
 		// Remove tag/digest from image references.
-		if err := resource.UpdateMatchingContainerImage(ctx, objs, imageName, imageName); err != nil {
-			return fmt.Errorf("failed to update container of objects: %v", err)
+		for _, m := range images {
+			matches, err := resource.UpdateMatchingContainerImage(ctx, objs, d.PodTemplatePaths, m.Name, image.Name(m.Ref))
+			if err != nil {
+				return fmt.Errorf("failed to update container of objects: %v", err)
+			}
+			if len(matches) == 0 {
+				d.warnf("Did not find any resources with a container that has image name %q", m.Name)
+			}
 		}
 	}
 
@@ -116,14 +184,14 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 				return fmt.Errorf("failed to check if Service %q exists: %v", service, err)
 			}
 			if !ok {
-				fmt.Printf("Creating suggested Service configuration file %q\n", service)
+				d.printf("Creating suggested Service configuration file %q\n", service)
 				svcObj, err := resource.CreateServiceObject(ctx, service, appNameLabelKey, appName, exposePort)
 				if err != nil {
 					return fmt.Errorf("failed to create Service object: %v", err)
 				}
 				objs = append(objs, svcObj)
 			} else {
-				fmt.Fprintf(os.Stderr, "\nWARNING: Service %q already exists in provided configuration files. Not generating new Service.\n\n", service)
+				d.warnf("Service %q already exists in provided configuration files. Not generating new Service.", service)
 			}
 		}
 
@@ -133,14 +201,14 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 				return fmt.Errorf("failed to check if Application %q exists: %v", appName, err)
 			}
 			if !ok {
-				fmt.Printf("Creating suggested Application configuration file %q\n", appName)
+				d.printf("Creating suggested Application configuration file %q\n", appName)
 				appObj, err := resource.CreateApplicationObject(appName, appNameLabelKey, appName, appName, appVersion, objs)
 				if err != nil {
 					return fmt.Errorf("failed to create Application object: %v", err)
 				}
 				objs = append(objs, appObj)
 			} else {
-				fmt.Fprintf(os.Stderr, "\nWARNING: Application %q already exists in provided configuration files. Not generating new Application.\n\n", appName)
+				d.warnf("Application %q already exists in provided configuration files. Not generating new Application.", appName)
 			}
 		}
 	}
@@ -151,7 +219,7 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 			return fmt.Errorf("failed to check if Namespace %q exists: %v", namespace, err)
 		}
 		if !ok {
-			fmt.Printf("Creating suggested Namespace configuration file %q\n", namespace)
+			d.printf("Creating suggested Namespace configuration file %q\n", namespace)
 			nsObj, err := resource.CreateNamespaceObject(ctx, namespace)
 			if err != nil {
 				return fmt.Errorf("failed to create Namespace object: %v", err)
@@ -163,7 +231,7 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 	for _, obj := range objs {
 		if resource.ObjectKind(obj) != "Namespace" {
 			if appName != "" {
-				if err := resource.AddLabel(ctx, obj, appNameLabelKey, appName, false); err != nil {
+				if err := resource.AddLabel(ctx, obj, d.PodTemplatePaths, appNameLabelKey, appName, false, d.warnf); err != nil {
 					return fmt.Errorf("failed to add %s=%s label to object %v: %v", appNameLabelKey, appName, obj, err)
 				}
 			}
@@ -173,11 +241,12 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 	var toGcs bool
 	var gcsPath string
 	if len(objs) > 0 {
-		fmt.Printf("Saving suggested configuration files to %q\n", suggestedOutput)
+		d.printf("Saving suggested configuration files to %q\n", suggestedOutput)
 		var lineComments map[string]string
-		if im != nil {
-			lineComments = map[string]string{
-				fmt.Sprintf("image: %s", image.Name(im)): "Will be set to actual image before deployment",
+		if len(images) > 0 {
+			lineComments = make(map[string]string, len(images))
+			for _, m := range images {
+				lineComments[fmt.Sprintf("image: %s", image.Name(m.Ref))] = "Will be set to actual image before deployment"
 			}
 		}
 
@@ -205,21 +274,38 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 		}
 	}
 
-	fmt.Printf("\nExpanding configuration files.\n")
+	d.printf("\nExpanding configuration files.\n")
 
-	if im != nil {
-		imageName := image.Name(im)
-		imageDigest, err := image.ResolveDigest(ctx, im, d.Clients.Remote)
+	var imageMatches []imageMatch
+	for _, m := range images {
+		imageName := image.Name(m.Ref)
+		imageDigest, err := image.ResolveDigest(ctx, m.Ref, d.Clients.Remote)
 		if err != nil {
-			return fmt.Errorf("failed to get image digest: %v", err)
+			return fmt.Errorf("failed to get digest of image %q: %v", m.Ref, err)
 		}
-		imageWithDigest := fmt.Sprintf("%s@%s", image.Name(im), imageDigest)
-		fmt.Printf("Got digest for image: %s --> %s\n", im, imageWithDigest)
+		imageWithDigest := fmt.Sprintf("%s@%s", imageName, imageDigest)
+		d.printf("Got digest for image: %s --> %s\n", m.Ref, imageWithDigest)
 
-		fmt.Printf("Updating containers in configuration files that have image name %q to use image with digest %q\n", imageName, imageWithDigest)
-		if err := resource.UpdateMatchingContainerImage(ctx, objs, imageName, imageWithDigest); err != nil {
+		d.printf("Updating containers in configuration files that have image name %q to use image with digest %q\n", imageName, imageWithDigest)
+		matches, err := resource.UpdateMatchingContainerImage(ctx, objs, d.PodTemplatePaths, imageName, imageWithDigest)
+		if err != nil {
 			return fmt.Errorf("failed to update container of objects: %v", err)
 		}
+		if len(matches) == 0 {
+			d.warnf("Did not find any resources with a container that has image name %q", imageName)
+		}
+		imageMatches = append(imageMatches, imageMatch{
+			image:   imageWithDigest,
+			matches: matches,
+		})
+	}
+	if len(imageMatches) > 0 {
+		d.printImageMatches(imageMatches)
+	}
+	if d.PinAllImages {
+		if err := d.pinAllImages(ctx, objs); err != nil {
+			return fmt.Errorf("failed to pin images to digests: %v", err)
+		}
 	}
 
 	if namespace != "" {
@@ -235,13 +321,13 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 	for _, obj := range objs {
 		if resource.ObjectKind(obj) != "Namespace" {
 			if appVersion != "" {
-				if err := resource.AddLabel(ctx, obj, appVersionLabelKey, appVersion, false); err != nil {
+				if err := resource.AddLabel(ctx, obj, d.PodTemplatePaths, appVersionLabelKey, appVersion, false, d.warnf); err != nil {
 					return fmt.Errorf("failed to add %s=%s label to object %v: %v", appVersionLabelKey, appVersion, obj, err)
 				}
 			}
 		}
 
-		if err := resource.AddLabel(ctx, obj, managedByLabelKey, managedByLabelValue, true); err != nil {
+		if err := resource.AddLabel(ctx, obj, d.PodTemplatePaths, managedByLabelKey, managedByLabelValue, true, nil); err != nil {
 			return fmt.Errorf("failed to add %s=%s label to object %v: %v", managedByLabelKey, managedByLabelValue, obj, err)
 		}
 
@@ -256,13 +342,13 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 				return fmt.Errorf("%s label cannot be explicitly set", managedByLabelKey)
 			}
 
-			if err := resource.AddLabel(ctx, obj, k, v, true); err != nil {
+			if err := resource.AddLabel(ctx, obj, d.PodTemplatePaths, k, v, true, nil); err != nil {
 				return fmt.Errorf("failed to add %s=%s custom label to object %v: %v", k, v, obj, err)
 			}
 		}
 
 		for k, v := range annotations {
-			if err := resource.AddAnnotation(obj, k, v); err != nil {
+			if err := resource.AddAnnotation(obj, d.PodTemplatePaths, k, v); err != nil {
 				return fmt.Errorf("failed to add %s=%s custom annotation to object %v: %v", k, v, obj, err)
 			}
 		}
@@ -274,14 +360,25 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 		}
 	}
 
-	fmt.Printf("Saving expanded configuration files to %q\n", expandedOutput)
+	var report *policy.Report
+	if d.CheckPolicy {
+		r, err := d.checkPolicy(objs)
+		if err != nil {
+			return err
+		}
+		report = r
+	}
+
+	d.printf("Saving expanded configuration files to %q\n", expandedOutput)
 
+	var gcsDir string
 	if strings.HasPrefix(expandedOutput, "gs://") {
 		tmpDir, err := d.Clients.OS.TempDir(ctx, "", k8sConfigStagingDir)
 		if err != nil {
 			return fmt.Errorf("failed to create tmp directory: %v", err)
 		}
 		defer d.Clients.OS.RemoveAll(ctx, tmpDir)
+		gcsDir = expandedOutput
 		gcsPath = strings.Join([]string{expandedOutput, expendedFileName}, "/")
 		expandedOutput = tmpDir
 		toGcs = true
@@ -299,7 +396,22 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 		}
 	}
 
-	fmt.Printf("Finished preparing deployment.\n\n")
+	if report != nil {
+		reportFile := filepath.Join(expandedOutput, policy.ReportFilename)
+		if err := d.savePolicyReport(ctx, report, reportFile); err != nil {
+			return err
+		}
+		if toGcs {
+			if err := ss.Upload(ctx, reportFile, strings.Join([]string{gcsDir, policy.ReportFilename}, "/")); err != nil {
+				return fmt.Errorf("failed to upload policy report to GCS %q: %v", gcsDir, err)
+			}
+		}
+		if err := d.policyViolationsError(report); err != nil {
+			return err
+		}
+	}
+
+	d.printf("Finished preparing deployment.\n\n")
 
 	return nil
 }
@@ -307,68 +419,52 @@ func (d *Deployer) Prepare(ctx context.Context, im name.Reference, appName, appV
 // Apply handles applying the deployment.
 func (d *Deployer) Apply(ctx context.Context, clusterName, clusterLocation, clusterProject, config, namespace string, waitTimeout time.Duration, recursive bool) error {
 	if d.ServerDryRun {
-		fmt.Printf("Applying deployment in server dry run mode.\n")
+		d.printf("Applying deployment in server dry run mode.\n")
 	} else {
-		fmt.Printf("Applying deployment.\n")
+		d.printf("Applying deployment.\n")
 	}
 
-	if (clusterName != "" && clusterLocation == "") || (clusterName == "" && clusterLocation != "") {
-		return fmt.Errorf("clusterName and clusterLocation either must both be provided, or neither should be provided")
+	target := ClusterTarget{
+		Name:     clusterName,
+		Location: clusterLocation,
 	}
-	if clusterProject == "" && d.UseGcloud {
-		currentProject, err := gcp.GetProject(ctx, d.Clients.Gcloud)
-		if err != nil {
-			return fmt.Errorf("failed to get GCP project: %v", err)
-		}
-		clusterProject = currentProject
+	endAuthorize := d.startPhase("authorize", target)
+	clusterProject, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject)
+	if err != nil {
+		d.emitFailure(err)
+		return err
 	}
+	endAuthorize()
+	target.Project = clusterProject
 
-	if clusterName != "" && clusterLocation != "" && d.UseGcloud {
-		fmt.Printf("Getting access to cluster %q in %q.\n", clusterName, clusterLocation)
-		if err := cluster.AuthorizeAccess(ctx, clusterName, clusterLocation, clusterProject, d.Clients.Gcloud); err != nil {
-			account, err2 := gcp.GetAccount(ctx, d.Clients.Gcloud)
-			if err2 != nil {
-				fmt.Printf("Failed to get GCP account. Swallowing error: %v\n", err)
-			}
-			if err2 == nil {
-				// TODO(joonlim): Find a better way to figure out if accountType is "user", "serviceAccount", or "group".
-				accountType := "user"
-				if strings.Contains(account, "gserviceaccount.com") {
-					accountType = "serviceAccount"
-				}
-
-				fmt.Printf("> You may need to grant permission to access to the cluster:\n\n")
-				fmt.Printf("   gcloud projects add-iam-policy-binding %s --member=%s:%s --role=roles/container.developer\n\n", clusterProject, accountType, account)
-			}
-			return fmt.Errorf("failed to get access to cluster: %v", err)
-		}
+	objs, err := d.parseConfigs(ctx, config, recursive)
+	if err != nil {
+		d.emitFailure(err)
+		return err
 	}
+	d.printf("Configuration files to be used: %v\n", objs)
 
-	if strings.HasPrefix(config, "gs://") {
+	_, err = d.applyObjects(ctx, target, objs, namespace, waitTimeout)
+	return err
+}
 
-		tmpDir, err := d.Clients.OS.TempDir(ctx, "", k8sConfigStagingDir)
+// applyObjects applies objs to the cluster of d.Clients, whose project is set in target, and waits
+// for them to be ready. It returns the last seen states of the deployed objects, which are nil if the
+// objects were not waited for.
+func (d *Deployer) applyObjects(ctx context.Context, target ClusterTarget, objs resource.Objects, namespace string, waitTimeout time.Duration) (_ resource.Objects, err error) {
+	// A Summary event is always the last event of a deployment, including deployments that fail
+	// before their objects are waited for, and server-side dry runs. It has the last seen states of
+	// the objects that were waited for.
+	var summaryObjs resource.Objects
+	defer func(ctx context.Context) {
+		failure := ""
 		if err != nil {
-			return fmt.Errorf("failed to create tmp directory: %v", err)
-		}
-		defer d.Clients.OS.RemoveAll(ctx, tmpDir)
-		ss := &gcs.GCS{
-			GcsService: d.Clients.GCS,
+			failure = err.Error()
 		}
-		err = ss.Download(ctx, config, tmpDir, recursive)
-		if err != nil {
-			return fmt.Errorf("failed to download configuration files from GCS %q: %v", config, err)
+		if summaryErr := d.emitSummary(ctx, summaryObjs, namespace, failure); summaryErr != nil && err == nil {
+			err = summaryErr
 		}
-		config = tmpDir
-	}
-
-	objs, err := resource.ParseConfigs(ctx, config, d.Clients.OS, recursive)
-	if err != nil {
-		return fmt.Errorf("failed to parse configuration files: %v", err)
-	}
-	if len(objs) == 0 {
-		return fmt.Errorf("no objects found")
-	}
-	fmt.Printf("Configuration files to be used: %v\n", objs)
+	}(ctx)
 
 	exists := make(map[string]bool)
 	var dups []string
@@ -381,181 +477,745 @@ func (d *Deployer) Apply(ctx context.Context, clusterName, clusterLocation, clus
 		exists[key] = true
 	}
 	if len(dups) > 0 {
-		fmt.Fprintf(os.Stderr, "\nWARNING: Deploying multiple objects share the same kind and name. Duplicate objects will be overridden:\n")
-		for _, obj := range dups {
-			fmt.Fprintf(os.Stderr, "%v\n", obj)
-		}
-		fmt.Fprintln(os.Stderr)
+		d.warnf("Deploying multiple objects share the same kind and name. Duplicate objects will be overridden:\n%s", strings.Join(dups, "\n"))
 	}
 
-	fmt.Printf("Applying configuration files to cluster.\n")
+	// Keep all objects, including namespaces, to be able to tell which deployed objects to prune.
+	appliedObjs := objs
+
+	// Apply objects after the objects they commonly depend on, e.g., custom resources after their
+	// CustomResourceDefinitions. This order is the only one that objects are applied in.
+	objs = resource.SortObjectsByApplyPhase(objs)
 
-	// Apply all namespace objects first, if they exist
-	filteredObjs := make(resource.Objects, 0, len(objs))
+	// Namespaces are not waited for, so they are removed from the objects to be waited for, and do
+	// not show up in the deployment summary.
+	waitObjs := make(resource.Objects, 0, len(objs))
 	for _, obj := range objs {
-		if resource.ObjectKind(obj) == "Namespace" {
-			nsName, err := resource.ObjectName(obj)
-			if err != nil {
-				return fmt.Errorf("failed to get name of object: %v", err)
-			}
-			exists, err := cluster.DeployedObjectExists(ctx, "Namespace", nsName, "", d.Clients.Kubectl)
-			if err != nil {
-				return fmt.Errorf("failed to check if deployed object with kind \"Namespace\" and name %q exists: %v", nsName, err)
-			}
-			if !exists {
-				fmt.Fprintf(os.Stderr, "\nWARNING: It is recommended that namespaces be created by an administrator. Creating namespace %q because it does not exist.\n\n", nsName)
-				objString, err := resource.EncodeToYAMLString(obj)
-				if err != nil {
-					return fmt.Errorf("failed to encode obj to string")
-				}
-				if err := cluster.ApplyConfigFromString(ctx, objString, "", d.Clients.Kubectl); err != nil {
-					return fmt.Errorf("failed to apply Namespace configuration file with name %q to cluster: %v", nsName, err)
+		if resource.ObjectKind(obj) != "Namespace" {
+			waitObjs = append(waitObjs, obj)
+		}
+	}
+
+	// Hold the lock of the application while checking, applying, and waiting for objects. If the
+	// lock is lost, the rest of the deployment is canceled.
+	ensuredNamespaces := false
+	if d.Lock && !d.ServerDryRun {
+		// The lock's Lease is in the application's namespace, which may be one of the namespaces
+		// being deployed that do not exist yet, so they are ensured first.
+		if err := d.ensureNamespaces(ctx, objs); err != nil {
+			return nil, err
+		}
+		ensuredNamespaces = true
+
+		endLock := d.startPhase("lock", target)
+		l, lockCtx, err := d.acquireLock(ctx, objs, namespace)
+		endLock()
+		if err != nil {
+			return nil, err
+		}
+		if l != nil {
+			releaseCtx := ctx
+			ctx = lockCtx
+			defer func() {
+				if lost := l.Lost(); lost != nil && err != nil {
+					err = fmt.Errorf("deployment was canceled because it lost its lock: %v: %v", lost, err)
 				}
+				d.releaseLock(releaseCtx, l)
+			}()
+		}
+	}
+
+	// The deployed states of objects are fetched once, and shared by the ownership check and the
+	// snapshots that are rolled back to.
+	takeSnapshots := d.RollbackOnFailure && !d.ServerDryRun
+	var live liveObjects
+	if d.CheckOwnership || takeSnapshots {
+		var err error
+		live, err = d.getLiveObjects(ctx, waitObjs, namespace)
+		if err != nil {
+			if takeSnapshots {
+				return nil, fmt.Errorf("failed to save state of deployed objects: %v", err)
 			}
-		} else {
-			// Delete namespace from list of objects to be deployed because it has already been deployed we do not want it to show up in the deployment summary.
-			filteredObjs = append(filteredObjs, obj)
+			return nil, fmt.Errorf("failed to check ownership of deployed objects: %v", err)
 		}
 	}
 
-	objs = filteredObjs
+	if d.CheckOwnership {
+		if err := d.checkOwnership(waitObjs, namespace, live); err != nil {
+			return nil, err
+		}
+	}
+
+	d.printf("Applying configuration files to cluster.\n")
+	endApply := d.startPhase("apply", target)
+	defer endApply()
+
+	var snapshots []*snapshot
+	if takeSnapshots {
+		d.printf("Saving state of deployed objects to roll back to in case of failure.\n")
+		var err error
+		snapshots, err = d.takeSnapshots(waitObjs, namespace, live)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save state of deployed objects: %v", err)
+		}
+	}
 
-	// Apply each config file individually vs applying the directory to avoid applying namespaces.
-	// Namespace objects are removed from objs at this point.
+	// Apply each config file individually vs applying the directory to avoid applying namespaces
+	// that already exist.
 	ensuredInstallApplicationCRD := false // Only need to do this once, in the case where the user provides more than one Application CR
+	var conflicts []string
+	var appliedCRDs resource.Objects
 	for _, obj := range objs {
 		objName, err := resource.ObjectName(obj)
 		if err != nil {
-			return fmt.Errorf("failed to get name of object: %v", err)
+			return nil, fmt.Errorf("failed to get name of object: %v", err)
+		}
+
+		// CustomResourceDefinitions are applied first. Wait for them to be established before
+		// applying objects that may be custom resources of their kinds.
+		if len(appliedCRDs) > 0 && resource.ObjectKind(obj) != "CustomResourceDefinition" {
+			if err := d.waitForCRDs(ctx, appliedCRDs, waitTimeout); err != nil {
+				return nil, err
+			}
+			appliedCRDs = nil
+		}
+
+		if resource.ObjectKind(obj) == "Namespace" {
+			if ensuredNamespaces {
+				continue
+			}
+			if err := d.ensureNamespace(ctx, obj, objName); err != nil {
+				return nil, err
+			}
+			continue
 		}
 
 		if !ensuredInstallApplicationCRD && resource.ObjectKind(obj) == "Application" {
 			if err := crd.EnsureInstallApplicationCRD(ctx, d.Clients.Kubectl); err != nil {
-				return fmt.Errorf("failed to ensure installation of Application CRD on target cluster: %v", err)
+				return nil, fmt.Errorf("failed to ensure installation of Application CRD on target cluster: %v", err)
 			}
 			ensuredInstallApplicationCRD = true
 		}
 
 		objString, err := resource.EncodeToYAMLString(obj)
 		if err != nil {
-			return fmt.Errorf("failed to encode obj to string")
+			return nil, fmt.Errorf("failed to encode obj to string")
 		}
 		// If namespace == "", uses the namespace defined in each config.
-		if err := cluster.ApplyConfigFromString(ctx, objString, namespace, d.Clients.Kubectl); err != nil {
-			return fmt.Errorf("failed to apply %s configuration file with name %q to cluster: %v", resource.ObjectKind(obj), objName, err)
+		if err := d.applyConfig(ctx, objString, namespace); err != nil {
+			// Report field ownership conflicts of all objects before failing.
+			if fieldConflicts := services.FieldManagerConflicts(err); len(fieldConflicts) > 0 {
+				var lines []string
+				for _, c := range fieldConflicts {
+					lines = append(lines, fmt.Sprintf("  %s: %s", c.Field, c.Message))
+				}
+				d.warnf("Failed to apply %s configuration file with name %q because fields are managed by other field managers:\n%s", resource.ObjectKind(obj), objName, strings.Join(lines, "\n"))
+				conflicts = append(conflicts, fmt.Sprintf("%s %q", resource.ObjectKind(obj), objName))
+				continue
+			}
+			switch {
+			case services.IsForbidden(err):
+				d.warnf("Permission to apply %s configuration file with name %q was denied. The account running gke-deploy may need the roles/container.developer role.", resource.ObjectKind(obj), objName)
+			case services.IsConflict(err):
+				d.warnf("%s object with name %q was modified by someone else while it was being applied. Deploying again may succeed.", resource.ObjectKind(obj), objName)
+			}
+			return nil, fmt.Errorf("failed to apply %s configuration file with name %q to cluster: %v", resource.ObjectKind(obj), objName, err)
+		}
+		if err := d.emitObject(event.ObjectApplied, obj, namespace, "", 0); err != nil {
+			return nil, err
+		}
+		if resource.ObjectKind(obj) == "CustomResourceDefinition" && !d.ServerDryRun {
+			appliedCRDs = append(appliedCRDs, obj)
 		}
 	}
-
-	deployedObjs := map[string]map[string]resource.Object{}
-	summaryObjs := make(resource.Objects, 0, len(objs))
-	timedOut := false
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("failed to apply configuration files of %s to cluster because of conflicts with other field managers. Set --force-conflicts to take ownership of the conflicting fields", strings.Join(conflicts, ", "))
+	}
+	endApply()
 
 	if d.ServerDryRun {
-		fmt.Printf("Server-side dry run deployment succeeded.\n\n")
+		if d.Prune {
+			if err := d.pruneObjects(ctx, target, appliedObjs, namespace, false); err != nil {
+				return nil, err
+			}
+		}
+		d.printf("Server-side dry run deployment succeeded.\n\n")
+		summaryObjs = waitObjs
+		if err := d.Results.addObjects(ctx, target, waitObjs, d.PodTemplatePaths, d.namespaceOf(namespace), nil, false); err != nil {
+			return nil, fmt.Errorf("failed to record deployment results: %v", err)
+		}
+		return nil, nil
+	}
+
+	endWait := d.startPhase("wait", target)
+	defer endWait()
+	result, err := d.waitForObjects(ctx, waitObjs, namespace, waitTimeout)
+	if err != nil {
+		return nil, err
+	}
+	endWait()
+	summaryObjs = result.objs
+	if err := d.Results.addObjects(ctx, target, result.objs, d.PodTemplatePaths, d.namespaceOf(namespace), result.readyAfter, true); err != nil {
+		return nil, fmt.Errorf("failed to record deployment results: %v", err)
+	}
+
+	d.printf("Finished applying deployment.\n\n")
+
+	if err := d.printSummary(ctx, result.objs); err != nil {
+		return nil, err
+	}
+
+	if target.Project != "" {
+		links, err := d.gkeLinks(target.Project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GKE links: %v", err)
+		}
+
+		d.printf("> GKE\n\n")
+		d.printf("%s\n", links)
+	}
+
+	if result.timedOut || result.failure != "" {
+		err := fmt.Errorf("timed out after %v while waiting for deployed objects to be ready", waitTimeout)
+		if result.failure != "" {
+			err = errors.New(result.failure)
+		}
+		if d.RollbackOnFailure {
+			endRollback := d.startPhase("rollback", target)
+			rbErr := d.rollback(ctx, snapshots, waitTimeout)
+			endRollback()
+			if rbErr != nil {
+				return result.objs, fmt.Errorf("%v, and failed to roll back deployment: %v", err, rbErr)
+			}
+			return result.objs, fmt.Errorf("%v, rolled back deployment to previously deployed objects", err)
+		}
+		return result.objs, err
+	}
+
+	// Objects are only pruned once the applied objects are ready, so that they are not lost if the
+	// deployment fails and is rolled back.
+	if d.Prune {
+		// Namespaces are not waited for, and have no namespace either way.
+		live := append(resource.Objects{}, result.objs...)
+		for _, obj := range appliedObjs {
+			if resource.ObjectKind(obj) == "Namespace" {
+				live = append(live, obj)
+			}
+		}
+		if err := d.pruneObjects(ctx, target, live, namespace, true); err != nil {
+			return result.objs, err
+		}
+	}
+
+	if d.RecordRelease {
+		if err := d.recordRelease(ctx, appliedObjs, namespace); err != nil {
+			d.warnf("Failed to record release of deployment: %v", err)
+		}
+	}
+
+	return result.objs, nil
+}
+
+// ensureNamespaces ensures that the Namespaces in objs exist.
+func (d *Deployer) ensureNamespaces(ctx context.Context, objs resource.Objects) error {
+	for _, obj := range objs {
+		if resource.ObjectKind(obj) != "Namespace" {
+			continue
+		}
+		nsName, err := resource.ObjectName(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get name of object: %v", err)
+		}
+		if err := d.ensureNamespace(ctx, obj, nsName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureNamespace applies Namespace obj with name nsName if it does not exist in the cluster yet.
+// Existing namespaces are left as they are, because they are commonly managed by an administrator.
+func (d *Deployer) ensureNamespace(ctx context.Context, obj *resource.Object, nsName string) error {
+	deployedObj, err := cluster.GetDeployedObjectIfExists(ctx, "Namespace", nsName, "", d.Clients.Kubectl)
+	if err != nil {
+		return fmt.Errorf("failed to check if deployed object with kind \"Namespace\" and name %q exists: %v", nsName, err)
+	}
+	if deployedObj != nil {
 		return nil
 	}
+	d.warnf("It is recommended that namespaces be created by an administrator. Creating namespace %q because it does not exist.", nsName)
+	objString, err := resource.EncodeToYAMLString(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode obj to string")
+	}
+	if err := d.applyConfig(ctx, objString, ""); err != nil {
+		return fmt.Errorf("failed to apply Namespace configuration file with name %q to cluster: %v", nsName, err)
+	}
+	return d.emitObject(event.ObjectApplied, obj, "", "", 0)
+}
 
-	fmt.Printf("\nWaiting for deployed objects to be ready with timeout of %v\n", waitTimeout)
+// pruneObjects prunes deployed objects that are no longer in the configuration files, in its own
+// phase. See prune for objs, namespace, and live.
+func (d *Deployer) pruneObjects(ctx context.Context, target ClusterTarget, objs resource.Objects, namespace string, live bool) error {
+	d.printf("\nPruning deployed objects that are no longer in configuration files.\n")
+	endPrune := d.startPhase("prune", target)
+	defer endPrune()
+	if err := d.prune(ctx, objs, namespace, live); err != nil {
+		return fmt.Errorf("failed to prune deployed objects: %v", err)
+	}
+	return nil
+}
+
+// waitForObjects waits for objs to be ready in the cluster until waitTimeout elapses. Objects that
+// are part of an application deployed by gke-deploy are fetched with one list request per
+// application and namespace, so they are checked every second; if any other objects are not ready,
+// objects are checked every 5 seconds instead. Waiting stops early if any object fails, e.g.,
+// because its Pods cannot pull their images, in which case the failure is reported. If namespace is
+// not empty, it overrides the namespace of each object.
+func (d *Deployer) waitForObjects(ctx context.Context, objs resource.Objects, namespace string, waitTimeout time.Duration) (*waitResult, error) {
+	deployedObjs := map[string]map[string]resource.Object{}
+	result := &waitResult{
+		objs:       make(resource.Objects, 0, len(objs)),
+		readyAfter: make(map[string]time.Duration),
+	}
+
+	d.printf("\nWaiting for deployed objects to be ready with timeout of %v\n", waitTimeout)
 	start := time.Now()
 	end := start.Add(waitTimeout)
 	periodicMsgInterval := 30 * time.Second
 	nextPeriodicMsg := time.Now().Add(periodicMsgInterval)
-	ticker := time.NewTicker(5 * time.Second)
+	// lastPodsCheck is when the Pods of each object were last checked for failures.
+	lastPodsCheck := map[string]time.Time{}
 	for len(objs) > 0 {
 
 		filteredObjs := make(resource.Objects, 0, len(objs))
 
+		fetched, err := d.getDeployedObjects(ctx, objs, namespace)
+		if err != nil {
+			return nil, err
+		}
+
 		for _, obj := range objs {
 			kind := resource.ObjectKind(obj)
 			name, err := resource.ObjectName(obj)
 			if err != nil {
-				return fmt.Errorf("failed to get name of object: %v", err)
-			}
-			objNamespace := ""
-			if namespace == "" {
-				ns, err := resource.ObjectNamespace(obj)
-				if err != nil {
-					return fmt.Errorf("failed to get namespace of object: %v", err)
-				}
-				objNamespace = ns
-			} else {
-				objNamespace = namespace
+				return nil, fmt.Errorf("failed to get name of object: %v", err)
 			}
-			deployedObj, err := cluster.GetDeployedObject(ctx, kind, name, objNamespace, d.Clients.Kubectl)
+			objNamespace, err := d.effectiveNamespace(obj, namespace)
 			if err != nil {
-				return fmt.Errorf("failed to get configuration of deployed object with kind %q and name %q: %v", kind, name, err)
+				return nil, err
 			}
+			deployedObj := fetched.objects[readinessKey(kind, name, objNamespace)]
 			if deployedObjs[kind] == nil {
 				deployedObjs[kind] = map[string]resource.Object{}
 			}
 			deployedObjs[kind][name] = *deployedObj
-			ok, err := resource.IsReady(ctx, deployedObj)
+			state, reason, err := resource.CheckReady(ctx, deployedObj)
 			if err != nil {
-				return fmt.Errorf("failed to check if deployed object with kind %q and name %q is ready: %v", kind, name, err)
+				return nil, fmt.Errorf("failed to check if deployed object with kind %q and name %q is ready: %v", kind, name, err)
+			}
+			var failedPods resource.Objects
+			if state == resource.Failed && kind == "Pod" {
+				failedPods = resource.Objects{deployedObj}
+			}
+			key := readinessKey(kind, name, objNamespace)
+			if state == resource.NotReady && podOwnerKinds[kind] && time.Since(lastPodsCheck[key]) >= failedPodsCheckInterval {
+				lastPodsCheck[key] = time.Now()
+				failedPods, err = d.failedPods(ctx, deployedObj)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check if pods of deployed object with kind %q and name %q have failed: %v", kind, name, err)
+				}
+				if len(failedPods) > 0 {
+					_, podReason, _ := resource.CheckReady(ctx, failedPods[0])
+					state = resource.Failed
+					reason = fmt.Sprintf("pod %q failed: %s", failedPods[0].GetName(), podReason)
+				}
 			}
-			if ok {
+
+			switch state {
+			case resource.Ready:
 				dur := time.Now().Sub(start).Round(time.Second / 10) // Round to nearest 0.1 seconds
-				fmt.Printf("Deployed object with kind %q and name %q is ready after %v\n", kind, name, dur)
-			} else {
+				result.readyAfter[readinessKey(kind, name, objNamespace)] = dur
+				d.printf("Deployed object with kind %q and name %q is ready after %v\n", kind, name, dur)
+				if err := d.emitObject(event.ObjectReady, obj, namespace, "", dur); err != nil {
+					return nil, err
+				}
+			case resource.Failed:
+				if err := d.printFailure(ctx, kind, name, reason, failedPods); err != nil {
+					return nil, err
+				}
+				if err := d.emitObject(event.ObjectFailed, obj, namespace, reason, 0); err != nil {
+					return nil, err
+				}
+				if result.failure == "" {
+					result.failure = fmt.Sprintf("deployed object with kind %q and name %q failed: %s", kind, name, reason)
+				}
+			default:
 				filteredObjs = append(filteredObjs, obj)
 			}
 		}
 
 		objs = filteredObjs
 
+		if result.failure != "" {
+			// Stop waiting because the failed object will not become ready without changes.
+			break
+		}
+
 		if len(objs) == 0 {
-			// Break out here to avoid waiting for ticker.
+			// Break out here to avoid waiting for the next check.
 			break
 		}
 		if time.Now().After(end) {
-			timedOut = true
+			result.timedOut = true
 			break
 		}
 		if time.Now().After(nextPeriodicMsg) {
-			fmt.Printf("Still waiting on %d object(s) to be ready: %v\n", len(objs), objs)
+			d.printf("Still waiting on %d object(s) to be ready: %v\n", len(objs), objs)
 			nextPeriodicMsg = nextPeriodicMsg.Add(periodicMsgInterval)
 		}
+		interval := readinessCheckInterval
+		if fetched.allListed {
+			interval = listedReadinessCheckInterval
+		}
 		select {
-		case <-ticker.C:
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
 	}
 
-	fmt.Printf("Finished applying deployment.\n\n")
-
 	for _, nameMap := range deployedObjs {
-		for k, _ := range nameMap {
+		for k := range nameMap {
 			o := nameMap[k]
-			summaryObjs = append(summaryObjs, &o)
+			result.objs = append(result.objs, &o)
 		}
 	}
-	summary, err := resource.DeploySummary(ctx, summaryObjs)
+	return result, nil
+}
+
+// waitResult is the result of waiting for deployed objects to be ready.
+type waitResult struct {
+	// objs are the last seen states of the deployed objects.
+	objs resource.Objects
+	// timedOut is true if waiting timed out before all objects were ready.
+	timedOut bool
+	// failure describes the first object that failed, if any.
+	failure string
+	// readyAfter maps the readiness keys of objects that became ready to how long it took.
+	readyAfter map[string]time.Duration
+}
+
+// waitForCRDs waits for CustomResourceDefinitions to be established, so that custom resources of
+// their kinds can be applied.
+func (d *Deployer) waitForCRDs(ctx context.Context, crds resource.Objects, waitTimeout time.Duration) error {
+	d.printf("\nWaiting for CustomResourceDefinitions to be established before applying dependent objects.\n")
+	result, err := d.waitForObjects(ctx, crds, "", waitTimeout)
 	if err != nil {
-		return fmt.Errorf("failed to get summary of deployed objects: %v", err)
+		return err
+	}
+	if result.failure != "" {
+		return errors.New(result.failure)
+	}
+	if result.timedOut {
+		return fmt.Errorf("timed out after %v while waiting for CustomResourceDefinitions to be established", waitTimeout)
+	}
+	return nil
+}
+
+// fetchedObjects are the deployed states of objects being waited on.
+type fetchedObjects struct {
+	// objects are the deployed objects, keyed by readinessKey.
+	objects map[string]*resource.Object
+	// allListed is true if all objects were fetched with list requests.
+	allListed bool
+}
+
+// getDeployedObjects gets the deployed state of each of objs. Objects that have the
+// app.kubernetes.io/managed-by and app.kubernetes.io/name labels set by gke-deploy are fetched
+// with a single label selector list request per application and namespace. Other objects, and
+// objects missing from the list responses, are fetched individually.
+func (d *Deployer) getDeployedObjects(ctx context.Context, objs resource.Objects, namespace string) (*fetchedObjects, error) {
+	type listRequest struct {
+		selector  string
+		namespace string
+		kinds     []string
+		count     int
+	}
+	var requests []*listRequest
+	requestsByKey := make(map[string]*listRequest)
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		appName := labels[appNameLabelKey]
+		if appName == "" || labels[managedByLabelKey] != managedByLabelValue {
+			continue
+		}
+		ns, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		selector := fmt.Sprintf("%s=%s,%s=%s", managedByLabelKey, managedByLabelValue, appNameLabelKey, appName)
+		key := selector + "/" + ns
+		r, ok := requestsByKey[key]
+		if !ok {
+			r = &listRequest{selector: selector, namespace: ns}
+			requestsByKey[key] = r
+			requests = append(requests, r)
+		}
+		r.kinds = appendIfMissing(r.kinds, resource.ObjectKind(obj))
+		r.count++
+	}
+
+	fetched := &fetchedObjects{
+		objects:   make(map[string]*resource.Object),
+		allListed: true,
+	}
+	for _, r := range requests {
+		if r.count < 2 {
+			// Listing is no cheaper than getting a single object.
+			continue
+		}
+		listed, err := cluster.GetDeployedObjectsWithSelector(ctx, r.kinds, r.selector, r.namespace, d.Clients.Kubectl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deployed objects with selector %q: %v", r.selector, err)
+		}
+		for _, obj := range listed {
+			name, err := resource.ObjectName(obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get name of object: %v", err)
+			}
+			fetched.objects[readinessKey(resource.ObjectKind(obj), name, r.namespace)] = obj
+		}
 	}
 
-	fmt.Printf("################################################################################\n")
-	fmt.Printf("> Deployed Objects\n\n")
-	fmt.Printf("%s\n", summary)
+	for _, obj := range objs {
+		kind := resource.ObjectKind(obj)
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get name of object: %v", err)
+		}
+		ns, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		key := readinessKey(kind, name, ns)
+		if _, ok := fetched.objects[key]; ok {
+			continue
+		}
+		fetched.allListed = false
+		deployedObj, err := cluster.GetDeployedObject(ctx, kind, name, ns, d.Clients.Kubectl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration of deployed object with kind %q and name %q: %v", kind, name, err)
+		}
+		fetched.objects[key] = deployedObj
+	}
+	return fetched, nil
+}
 
-	fmt.Printf("################################################################################\n")
+// liveObjects are the deployed states of objects before they are applied, keyed by readinessKey. A
+// nil object means that the object is not deployed.
+type liveObjects map[string]*resource.Object
 
-	if clusterProject != "" {
-		links, err := d.gkeLinks(clusterProject)
+// getLiveObjects gets the deployed state of each of objs with a single request per object, in the
+// namespace returned by effectiveNamespace.
+func (d *Deployer) getLiveObjects(ctx context.Context, objs resource.Objects, namespace string) (liveObjects, error) {
+	live := make(liveObjects, len(objs))
+	for _, obj := range objs {
+		kind := resource.ObjectKind(obj)
+		name, err := resource.ObjectName(obj)
 		if err != nil {
-			return fmt.Errorf("failed to get GKE links: %v", err)
+			return nil, fmt.Errorf("failed to get name of object: %v", err)
 		}
+		objNamespace, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		key := readinessKey(kind, name, objNamespace)
+		if _, ok := live[key]; ok {
+			continue
+		}
+		deployedObj, err := cluster.GetDeployedObjectIfExists(ctx, kind, name, objNamespace, d.Clients.Kubectl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configuration of deployed object with kind %q and name %q: %v", kind, name, err)
+		}
+		live[key] = deployedObj
+	}
+	return live, nil
+}
+
+// get returns the deployed state of the object with kind and name in namespace, which must be one
+// of the objects that live was fetched for (see effectiveNamespace), or nil if it is not deployed.
+func (live liveObjects) get(kind, name, namespace string) *resource.Object {
+	return live[readinessKey(kind, name, namespace)]
+}
+
+// effectiveNamespace returns the namespace that obj is applied to and that its deployed state is
+// fetched from, which is empty for cluster-scoped objects. If namespace is not empty, it overrides
+// the object's namespace. Objects without a namespace are applied to the current context's
+// namespace.
+func (d *Deployer) effectiveNamespace(obj *resource.Object, namespace string) (string, error) {
+	if clusterScopedKinds[resource.ObjectKind(obj)] {
+		return "", nil
+	}
+	if namespace != "" {
+		return namespace, nil
+	}
+	ns, err := resource.ObjectNamespace(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace of object: %v", err)
+	}
+	if ns == "" {
+		return d.contextNamespace, nil
+	}
+	return ns, nil
+}
 
-		fmt.Printf("> GKE\n\n")
-		fmt.Printf("%s\n", links)
+// namespaceOf returns a function that returns the effectiveNamespace of an object.
+func (d *Deployer) namespaceOf(namespace string) func(*resource.Object) (string, error) {
+	return func(obj *resource.Object) (string, error) {
+		return d.effectiveNamespace(obj, namespace)
 	}
+}
+
+// readinessKey returns a key that identifies a deployed object by its kind, name, and the
+// namespace used to get it.
+func readinessKey(kind, name, namespace string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, kind, name)
+}
 
-	if timedOut {
-		return fmt.Errorf("timed out after %v while waiting for deployed objects to be ready", waitTimeout)
+// printSummary prints a table that summarizes the deploy statuses of deployed objects.
+func (d *Deployer) printSummary(ctx context.Context, objs resource.Objects) error {
+	summary, err := resource.DeploySummary(ctx, objs)
+	if err != nil {
+		return fmt.Errorf("failed to get summary of deployed objects: %v", err)
 	}
 
+	d.printf("################################################################################\n")
+	d.printf("> Deployed Objects\n\n")
+	d.printf("%s\n", summary)
+
+	d.printf("################################################################################\n")
 	return nil
 }
 
+// applyConfig applies a configuration to the cluster. If d.ServerSideApply is true, server-side
+// apply is used.
+func (d *Deployer) applyConfig(ctx context.Context, configString, namespace string) error {
+	if d.ServerSideApply {
+		return cluster.ServerSideApplyConfigFromString(ctx, configString, namespace, d.ForceConflicts, d.Clients.Kubectl)
+	}
+	return cluster.ApplyConfigFromString(ctx, configString, namespace, d.Clients.Kubectl)
+}
+
+// authorizeClusterAccess gets access to the target cluster, if clusterName and clusterLocation are
+// provided, and gets the current context's namespace. It returns the project of the cluster, which
+// is the current set GCP project if clusterProject is empty and gcloud is used.
+func (d *Deployer) authorizeClusterAccess(ctx context.Context, clusterName, clusterLocation, clusterProject string) (string, error) {
+	if (clusterName != "" && clusterLocation == "") || (clusterName == "" && clusterLocation != "") {
+		return "", fmt.Errorf("clusterName and clusterLocation either must both be provided, or neither should be provided")
+	}
+	if clusterProject == "" && d.UseGcloud {
+		currentProject, err := gcp.GetProject(ctx, d.Clients.Gcloud)
+		if err != nil {
+			return "", fmt.Errorf("failed to get GCP project: %v", err)
+		}
+		clusterProject = currentProject
+	}
+
+	if clusterName != "" && clusterLocation != "" && d.UseGcloud {
+		d.printf("Getting access to cluster %q in %q.\n", clusterName, clusterLocation)
+		if err := cluster.AuthorizeAccess(ctx, clusterName, clusterLocation, clusterProject, d.Clients.Gcloud); err != nil {
+			account, err2 := gcp.GetAccount(ctx, d.Clients.Gcloud)
+			if err2 != nil {
+				d.printf("Failed to get GCP account. Swallowing error: %v\n", err)
+			}
+			if err2 == nil {
+				// TODO(joonlim): Find a better way to figure out if accountType is "user", "serviceAccount", or "group".
+				accountType := "user"
+				if strings.Contains(account, "gserviceaccount.com") {
+					accountType = "serviceAccount"
+				}
+
+				d.printf("> You may need to grant permission to access to the cluster:\n\n")
+				d.printf("   gcloud projects add-iam-policy-binding %s --member=%s:%s --role=roles/container.developer\n\n", clusterProject, accountType, account)
+			}
+			return "", fmt.Errorf("failed to get access to cluster: %v", err)
+		}
+	}
+
+	contextNamespace, err := cluster.GetContextNamespace(ctx, d.Clients.Kubectl)
+	if err != nil {
+		return "", err
+	}
+	d.contextNamespace = contextNamespace
+
+	return clusterProject, nil
+}
+
+// parseConfigs parses objects from a file or directory of configuration files. If config is a GCS
+// path, the files are downloaded first.
+func (d *Deployer) parseConfigs(ctx context.Context, config string, recursive bool) (resource.Objects, error) {
+	if strings.HasPrefix(config, "gs://") {
+
+		tmpDir, err := d.Clients.OS.TempDir(ctx, "", k8sConfigStagingDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tmp directory: %v", err)
+		}
+		defer d.Clients.OS.RemoveAll(ctx, tmpDir)
+		ss := &gcs.GCS{
+			GcsService: d.Clients.GCS,
+		}
+		err = ss.Download(ctx, config, tmpDir, recursive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download configuration files from GCS %q: %v", config, err)
+		}
+		config = tmpDir
+	}
+
+	objs, err := resource.ParseConfigs(ctx, config, d.Clients.OS, d.kustomize(), nil, nil, recursive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration files: %v", err)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no objects found")
+	}
+	return objs, nil
+}
+
+// kustomize returns the service that builds kustomizations, which reports the kustomizations that
+// it builds to d.Out, or nil if d.Clients.Kustomize is not set.
+func (d *Deployer) kustomize() services.KustomizeService {
+	if d.Clients.Kustomize == nil {
+		return nil
+	}
+	return &printingKustomize{
+		KustomizeService: d.Clients.Kustomize,
+		d:                d,
+	}
+}
+
+// variables returns a copy of d.Variables whose warnings are reported with d.warnf, or nil if
+// d.Variables is nil.
+func (d *Deployer) variables() *resource.Variables {
+	if d.Variables == nil {
+		return nil
+	}
+	v := *d.Variables
+	v.Warnf = d.warnf
+	return &v
+}
+
+// printingKustomize prints each kustomization before it is built.
+type printingKustomize struct {
+	services.KustomizeService
+	d *Deployer
+}
+
+func (k *printingKustomize) Build(ctx context.Context, dir string) (string, error) {
+	k.d.printf("Building kustomization %q\n", dir)
+	return k.KustomizeService.Build(ctx, dir)
+}
+
 func (d *Deployer) gkeLinks(clusterProject string) (string, error) {
 	padding := 4
 	buf := new(bytes.Buffer)
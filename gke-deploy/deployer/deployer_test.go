@@ -2,6 +2,7 @@ package deployer
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -15,7 +16,11 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	applicationsv1beta1 "github.com/kubernetes-sigs/application/pkg/apis/app/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/image"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/policy"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
 )
@@ -35,7 +40,7 @@ var testOutputDir string
 func TestPrepare(t *testing.T) {
 	ctx := context.Background()
 
-	image := newImageWithTag(t, "my-image:1.0.0")
+	images := []*image.Mapping{image.NewMapping(newImageWithTag(t, "my-image:1.0.0"))}
 	appName := "my-app"
 	appVersion := "b2e43cb"
 	namespace := "default"
@@ -45,7 +50,7 @@ func TestPrepare(t *testing.T) {
 	tests := []struct {
 		name string
 
-		image               name.Reference
+		images              []*image.Mapping
 		appName             string
 		appVersion          string
 		config              string
@@ -61,7 +66,7 @@ func TestPrepare(t *testing.T) {
 	}{{
 		name: "Config is directory",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/directory",
@@ -71,10 +76,23 @@ func TestPrepare(t *testing.T) {
 		annotations:       annotations,
 		namespace:         namespace,
 		exposePort:        0,
+	}, {
+		name: "Config is a kustomization",
+
+		images:            images,
+		appName:           appName,
+		appVersion:        appVersion,
+		config:            "testing/configs/kustomization",
+		expectedSuggested: "testing/expected-suggested/directory.yaml",
+		expectedExpanded:  "testing/expected-expanded/directory.yaml",
+		labels:            labels,
+		annotations:       annotations,
+		namespace:         namespace,
+		exposePort:        0,
 	}, {
 		name: "Config is a recursive directory",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/nested-directory",
@@ -88,7 +106,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Config is file",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/multi-resource.yaml",
@@ -101,7 +119,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Add custom labels",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/deployment.yaml",
@@ -118,7 +136,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Add custom annotations",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/deployment.yaml",
@@ -135,7 +153,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "AppName and AppVersion not set",
 
-		image:             image,
+		images:            images,
 		appName:           "",
 		appVersion:        "",
 		config:            "testing/configs/deployment.yaml",
@@ -148,7 +166,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Namespace is not default",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/deployment.yaml",
@@ -161,7 +179,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Wait for service object to be ready",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/service.yaml",
@@ -174,7 +192,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "No config arg",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "",
@@ -187,7 +205,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Expose application",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/deployment.yaml",
@@ -200,7 +218,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Namespace is empty",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/deployment.yaml",
@@ -213,7 +231,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Create Application CR",
 
-		image:               image,
+		images:              images,
 		appName:             appName,
 		appVersion:          "",
 		config:              "testing/configs/deployment-and-service",
@@ -227,7 +245,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Create Application CR with version",
 
-		image:               image,
+		images:              images,
 		appName:             appName,
 		appVersion:          appVersion,
 		config:              "testing/configs/deployment-and-service",
@@ -241,7 +259,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Create Application CR with links",
 
-		image:               image,
+		images:              images,
 		appName:             appName,
 		appVersion:          "",
 		config:              "testing/configs/deployment-and-service",
@@ -265,7 +283,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Application CR already exists",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/directory-with-application",
@@ -278,7 +296,7 @@ func TestPrepare(t *testing.T) {
 	}, {
 		name: "Add links to existing Application CR",
 
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            "testing/configs/directory-with-application",
@@ -300,7 +318,7 @@ func TestPrepare(t *testing.T) {
 		},
 	}, {
 		name:              "Single config file in GCS",
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            singleGcsFile,
@@ -312,7 +330,7 @@ func TestPrepare(t *testing.T) {
 		exposePort:        0,
 	}, {
 		name:              "Config files in a GCS directory",
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            gcsDirectory,
@@ -324,7 +342,7 @@ func TestPrepare(t *testing.T) {
 		exposePort:        0,
 	}, {
 		name:              "Config files in a nested GCS directory",
-		image:             image,
+		images:            images,
 		appName:           appName,
 		appVersion:        appVersion,
 		config:            gcsNestedDir,
@@ -352,7 +370,19 @@ func TestPrepare(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to create os: %v", err)
 	}
-	d := Deployer{Clients: &services.Clients{OS: oss, Remote: &remote, GCS: gcs}}
+	kzs := testservices.TestKustomize{
+		BuildResponse: map[string]testservices.BuildResponse{
+			"testing/configs/kustomization": {
+				Res: strings.Join([]string{
+					string(fileContents(t, "testing/configs/kustomization/deployment-2.yaml")),
+					string(fileContents(t, "testing/configs/kustomization/multi-resource.yaml")),
+					string(fileContents(t, "testing/configs/kustomization/service.yaml")),
+				}, "\n---\n"),
+				Err: nil,
+			},
+		},
+	}
+	d := Deployer{Clients: &services.Clients{OS: oss, Remote: &remote, GCS: gcs, Kustomize: &kzs}}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -375,8 +405,8 @@ func TestPrepare(t *testing.T) {
 			}
 			defer os.RemoveAll(expandedDir)
 
-			if err := d.Prepare(ctx, tc.image, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.exposePort, tc.recursive, tc.createApplicationCR, tc.applicationLinks); err != nil {
-				t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = %v; want <nil>", tc.image, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.recursive, tc.createApplicationCR, tc.applicationLinks, err)
+			if err := d.Prepare(ctx, tc.images, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.exposePort, tc.recursive, tc.createApplicationCR, tc.applicationLinks); err != nil {
+				t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = %v; want <nil>", tc.images, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.recursive, tc.createApplicationCR, tc.applicationLinks, err)
 			}
 
 			err = compareFiles(tc.expectedExpanded, expandedDir)
@@ -401,8 +431,8 @@ func TestPrepare(t *testing.T) {
 		}
 		defer os.RemoveAll(testOutputDir)
 
-		if err := d.Prepare(ctx, image, appName, appVersion, config, gcsOutputBucket, gcsOutputBucket, namespace, labels, annotations, 0, false, false, nil); err != nil {
-			t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = %v; want <nil>", image, appName, appVersion, config, gcsOutputBucket, gcsOutputBucket, namespace, labels, annotations, false, false, nil, err)
+		if err := d.Prepare(ctx, images, appName, appVersion, config, gcsOutputBucket, gcsOutputBucket, namespace, labels, annotations, 0, false, false, nil); err != nil {
+			t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = %v; want <nil>", images, appName, appVersion, config, gcsOutputBucket, gcsOutputBucket, namespace, labels, annotations, false, false, nil, err)
 		}
 
 		suggestedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_suggested")
@@ -441,10 +471,340 @@ func TestPrepare(t *testing.T) {
 
 }
 
+func TestPrepareMultipleImages(t *testing.T) {
+	ctx := context.Background()
+
+	images := []*image.Mapping{
+		newImageMapping(t, "api", "gcr.io/cbd-test/api:1.0.0"),
+		image.NewMapping(newImageWithTag(t, "gcr.io/cbd-test/worker:1.0.0")),
+		image.NewMapping(newImageWithTag(t, "gcr.io/cbd-test/sidecar:1.0.0")),
+	}
+	config := "testing/configs/multiple-images.yaml"
+	expectedSuggested := "testing/expected-suggested/multiple-images.yaml"
+	expectedExpanded := "testing/expected-expanded/multiple-images.yaml"
+
+	remote := testservices.TestRemote{
+		ImageResp: &testservices.TestImage{
+			Hash: v1.Hash{
+				Algorithm: "sha256",
+				Hex:       "929665b8eb2bb286535d29cd73c71808d7e1ad830046333f6cf0ce497996eb79",
+			},
+			Err: nil,
+		},
+		ImageErr: nil,
+	}
+	oss, err := services.NewOS(ctx)
+	if err != nil {
+		t.Fatalf("Failed to create os: %v", err)
+	}
+	d := Deployer{Clients: &services.Clients{OS: oss, Remote: &remote}}
+
+	suggestedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_suggested")
+	if err != nil {
+		t.Fatalf("Failed to create tmp directory: %v", err)
+	}
+	defer os.RemoveAll(suggestedDir)
+
+	expandedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_expected")
+	if err != nil {
+		t.Fatalf("Failed to create tmp directory: %v", err)
+	}
+	defer os.RemoveAll(expandedDir)
+
+	if err := d.Prepare(ctx, images, "my-app", "", config, suggestedDir, expandedDir, "", nil, nil, 0, false, false, nil); err != nil {
+		t.Fatalf("Prepare(ctx, %v, ...) = %v; want <nil>", images, err)
+	}
+
+	if err := compareFiles(expectedExpanded, expandedDir); err != nil {
+		t.Fatalf("Failure with expanded file generation: %v", err)
+	}
+	if err := compareFiles(expectedSuggested, suggestedDir); err != nil {
+		t.Fatalf("Failure with suggested file generation: %v", err)
+	}
+}
+
+func TestPreparePinAllImages(t *testing.T) {
+	ctx := context.Background()
+
+	config := "testing/configs/init-containers.yaml"
+
+	tests := []struct {
+		name string
+
+		policy string
+		remote services.RemoteService
+
+		expectedExpanded string
+		wantErr          bool
+	}{{
+		name: "Pin all images",
+
+		policy: PinImagesPolicyFail,
+		remote: &testservices.TestRemote{
+			ImageResp: &testservices.TestImage{
+				Hash: v1.Hash{
+					Algorithm: "sha256",
+					Hex:       "a8f6c4e3b5b58c0d3b5b5e1e8c9b0f1a2d3c4b5a69788796a5b4c3d2e1f0a9b8",
+				},
+				Err: nil,
+			},
+			ImageErr: nil,
+		},
+
+		expectedExpanded: "testing/expected-expanded/pin-all-images.yaml",
+	}, {
+		name: "Warn if digest cannot be resolved",
+
+		policy: PinImagesPolicyWarn,
+		remote: &testservices.TestRemote{
+			ImageResp: nil,
+			ImageErr:  fmt.Errorf("failed to get remote image"),
+		},
+
+		expectedExpanded: "testing/expected-expanded/pin-all-images-unresolved.yaml",
+	}, {
+		name: "Skip if digest cannot be resolved",
+
+		policy: PinImagesPolicySkip,
+		remote: &testservices.TestRemote{
+			ImageResp: nil,
+			ImageErr:  fmt.Errorf("failed to get remote image"),
+		},
+
+		expectedExpanded: "testing/expected-expanded/pin-all-images-unresolved.yaml",
+	}, {
+		name: "Fail if digest cannot be resolved",
+
+		policy: PinImagesPolicyFail,
+		remote: &testservices.TestRemote{
+			ImageResp: nil,
+			ImageErr:  fmt.Errorf("failed to get remote image"),
+		},
+
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oss, err := services.NewOS(ctx)
+			if err != nil {
+				t.Fatalf("Failed to create os: %v", err)
+			}
+			d := Deployer{
+				Clients:         &services.Clients{OS: oss, Remote: tc.remote},
+				PinAllImages:    true,
+				PinImagesPolicy: tc.policy,
+			}
+
+			suggestedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_suggested")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(suggestedDir)
+
+			expandedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_expected")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(expandedDir)
+
+			err = d.Prepare(ctx, nil, "my-app", "", config, suggestedDir, expandedDir, "", nil, nil, 0, false, false, nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Prepare(ctx, ...) = %v; want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if err := compareFiles(tc.expectedExpanded, expandedDir); err != nil {
+				t.Fatalf("Failure with expanded file generation: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrepareCheckPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	config := "testing/configs/init-containers.yaml"
+
+	tests := []struct {
+		name string
+
+		policy                policy.Policy
+		allowPolicyViolations bool
+
+		wantErrors int
+		wantErr    bool
+	}{{
+		name: "Violations with error severity",
+
+		wantErrors: 1,
+		wantErr:    true,
+	}, {
+		name: "Violations with error severity are allowed",
+
+		allowPolicyViolations: true,
+
+		wantErrors: 1,
+	}, {
+		name: "Rule with error severity is ignored",
+
+		policy: policy.Policy{
+			policy.RuleNoLatestTag: policy.SeverityIgnore,
+			policy.RuleImageDigest: policy.SeverityWarning,
+		},
+
+		wantErrors: 0,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oss, err := services.NewOS(ctx)
+			if err != nil {
+				t.Fatalf("Failed to create os: %v", err)
+			}
+			d := Deployer{
+				Clients:               &services.Clients{OS: oss},
+				CheckPolicy:           true,
+				Policy:                tc.policy,
+				AllowPolicyViolations: tc.allowPolicyViolations,
+			}
+
+			suggestedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_suggested")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(suggestedDir)
+
+			expandedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_expected")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(expandedDir)
+
+			err = d.Prepare(ctx, nil, "", "", config, suggestedDir, expandedDir, "", nil, nil, 0, false, false, nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Prepare(ctx, ...) = %v; want error %t", err, tc.wantErr)
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join(expandedDir, policy.ReportFilename))
+			if err != nil {
+				t.Fatalf("Failed to read policy report: %v", err)
+			}
+			var report policy.Report
+			if err := json.Unmarshal(contents, &report); err != nil {
+				t.Fatalf("Failed to parse policy report: %v", err)
+			}
+			if report.Errors != tc.wantErrors {
+				t.Errorf("Policy report has %d violation(s) with error severity; want %d", report.Errors, tc.wantErrors)
+			}
+		})
+	}
+}
+
+func TestPrepareChart(t *testing.T) {
+	ctx := context.Background()
+
+	images := []*image.Mapping{image.NewMapping(newImageWithTag(t, "my-image:1.0.0"))}
+	chart := "testing/chart/test-app"
+
+	tests := []struct {
+		name string
+
+		helm services.HelmService
+
+		expectedExpanded string
+		wantErr          bool
+	}{{
+		name: "Render chart",
+
+		helm: &testservices.TestHelm{
+			TemplateResponse: map[string]testservices.TemplateResponse{
+				chart: {
+					Res: string(fileContents(t, "testing/chart/rendered.yaml")),
+					Err: nil,
+				},
+			},
+		},
+
+		expectedExpanded: "testing/expected-expanded/chart.yaml",
+	}, {
+		name: "Failed to render chart",
+
+		helm: &testservices.TestHelm{
+			TemplateResponse: map[string]testservices.TemplateResponse{
+				chart: {
+					Res: "",
+					Err: fmt.Errorf("failed to render chart"),
+				},
+			},
+		},
+
+		wantErr: true,
+	}, {
+		name: "No helm service",
+
+		helm:    nil,
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			oss, err := services.NewOS(ctx)
+			if err != nil {
+				t.Fatalf("Failed to create os: %v", err)
+			}
+			remote := testservices.TestRemote{
+				ImageResp: &testservices.TestImage{
+					Hash: v1.Hash{
+						Algorithm: "sha256",
+						Hex:       "foobar",
+					},
+					Err: nil,
+				},
+				ImageErr: nil,
+			}
+			d := Deployer{
+				Clients: &services.Clients{OS: oss, Remote: &remote, Helm: tc.helm},
+				Chart: &Chart{
+					Path:        chart,
+					ValuesFiles: []string{"testing/chart/values.yaml"},
+					SetValues:   []string{"replicas=1"},
+				},
+			}
+
+			suggestedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_suggested")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(suggestedDir)
+
+			expandedDir, err := ioutil.TempDir("/tmp", "gke-deploy_deploy_test_expected")
+			if err != nil {
+				t.Fatalf("Failed to create tmp directory: %v", err)
+			}
+			defer os.RemoveAll(expandedDir)
+
+			err = d.Prepare(ctx, images, "my-app", "", "", suggestedDir, expandedDir, "", nil, nil, 0, false, false, nil)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Prepare(ctx, ...) = %v; want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+
+			if err := compareFiles(tc.expectedExpanded, expandedDir); err != nil {
+				t.Fatalf("Failure with expanded file generation: %v", err)
+			}
+		})
+	}
+}
+
 func TestPrepareErrors(t *testing.T) {
 	ctx := context.Background()
 
-	image := newImageWithTag(t, "my-image:1.0.0")
+	images := []*image.Mapping{image.NewMapping(newImageWithTag(t, "my-image:1.0.0"))}
 	appName := "my-app"
 	appVersion := "b2e43cb"
 	namespace := "default"
@@ -454,7 +814,7 @@ func TestPrepareErrors(t *testing.T) {
 	tests := []struct {
 		name string
 
-		image               name.Reference
+		images              []*image.Mapping
 		appName             string
 		appVersion          string
 		config              string
@@ -472,7 +832,7 @@ func TestPrepareErrors(t *testing.T) {
 	}{{
 		name: "Failed to parse resources",
 
-		image:       image,
+		images:      images,
 		appName:     appName,
 		appVersion:  appVersion,
 		config:      "testing/configs/empty-directory",
@@ -483,7 +843,7 @@ func TestPrepareErrors(t *testing.T) {
 	}, {
 		name: "Failed to get image digest",
 
-		image:       image,
+		images:      images,
 		appName:     appName,
 		appVersion:  appVersion,
 		config:      "testing/configs/deployment.yaml",
@@ -497,10 +857,24 @@ func TestPrepareErrors(t *testing.T) {
 		},
 
 		want: "failed to get remote image",
+	}, {
+		name: "Multiple images without config",
+
+		images: []*image.Mapping{
+			image.NewMapping(newImageWithTag(t, "my-image:1.0.0")),
+			image.NewMapping(newImageWithTag(t, "my-image-2:1.0.0")),
+		},
+		appName:     appName,
+		appVersion:  appVersion,
+		labels:      labels,
+		annotations: annotations,
+		namespace:   namespace,
+
+		want: "suggested configuration files can only be created for one image, got 2",
 	}, {
 		name: "Failed to save configs",
 
-		image:        image,
+		images:       images,
 		appName:      appName,
 		appVersion:   appVersion,
 		config:       "testing/configs/deployment.yaml",
@@ -512,7 +886,7 @@ func TestPrepareErrors(t *testing.T) {
 	}, {
 		name: "Cannot set app.kubernetes.io/name label via custom labels",
 
-		image:      image,
+		images:     images,
 		appName:    appName,
 		appVersion: appVersion,
 		config:     "testing/configs/deployment.yaml",
@@ -525,7 +899,7 @@ func TestPrepareErrors(t *testing.T) {
 	}, {
 		name: "Cannot set app.kubernetes.io/version label via custom labels",
 
-		image:      image,
+		images:     images,
 		appName:    appName,
 		appVersion: appVersion,
 		config:     "testing/configs/deployment.yaml",
@@ -538,7 +912,7 @@ func TestPrepareErrors(t *testing.T) {
 	}, {
 		name: "Cannot set app.kubernetes.io/managed-by label via custom labels",
 
-		image:      image,
+		images:     images,
 		appName:    appName,
 		appVersion: appVersion,
 		config:     "testing/configs/deployment.yaml",
@@ -550,7 +924,7 @@ func TestPrepareErrors(t *testing.T) {
 		want:        "app.kubernetes.io/managed-by label cannot be explicitly set",
 	}, {
 		name:        "GCS path is a directory but recursive flag is false",
-		image:       image,
+		images:      images,
 		appName:     appName,
 		appVersion:  appVersion,
 		config:      dirWithoutWildcard,
@@ -608,8 +982,8 @@ func TestPrepareErrors(t *testing.T) {
 			d := Deployer{Clients: &services.Clients{OS: oss, Remote: remote, GCS: gcs}}
 
 			var prepareErr error
-			if prepareErr = d.Prepare(ctx, tc.image, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, 0, tc.recursive, tc.createApplicationCR, tc.applicationLinks); prepareErr == nil {
-				t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = <nil>; want error", tc.image, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.recursive, tc.createApplicationCR, tc.applicationLinks)
+			if prepareErr = d.Prepare(ctx, tc.images, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, 0, tc.recursive, tc.createApplicationCR, tc.applicationLinks); prepareErr == nil {
+				t.Fatalf("Prepare(ctx, %v, %s, %s, %s, %s, %s, %s, %s, %v, %v, %t, %v) = <nil>; want error", tc.images, tc.appName, tc.appVersion, tc.config, suggestedDir, expandedDir, tc.namespace, tc.labels, tc.annotations, tc.recursive, tc.createApplicationCR, tc.applicationLinks)
 			}
 
 			if tc.want == "" {
@@ -695,9 +1069,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testServiceReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testServiceReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -727,9 +1098,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testDeploymentReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testDeploymentReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -738,9 +1106,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testServiceReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testServiceReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -983,7 +1348,7 @@ func TestApply(t *testing.T) {
 					"foobar": []testservices.GetResponse{
 						{
 							Res: "",
-							Err: nil,
+							Err: testservices.NotFoundError("Namespace", "foobar"),
 						},
 					},
 				},
@@ -1030,9 +1395,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testServiceReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testServiceReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -1063,9 +1425,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testDeploymentReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testDeploymentReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -1074,9 +1433,6 @@ func TestApply(t *testing.T) {
 						{
 							Res: string(fileContents(t, testServiceReadyFile)),
 							Err: nil,
-						}, {
-							Res: string(fileContents(t, testServiceReadyFile)),
-							Err: nil,
 						},
 					},
 				},
@@ -1249,7 +1605,7 @@ func TestApplyErrors(t *testing.T) {
 					"foobar": []testservices.GetResponse{
 						{
 							Res: "",
-							Err: nil,
+							Err: testservices.NotFoundError("Namespace", "foobar"),
 						},
 					},
 				},
@@ -1376,6 +1732,428 @@ func TestApplyErrors(t *testing.T) {
 	}
 }
 
+func TestApplyServerSideApply(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: &testservices.TestKubectl{
+				ServerSideApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {nil},
+					string(fileContents(t, testServiceFile)):    {nil},
+				},
+				GetResponse: map[string]map[string][]testservices.GetResponse{
+					"Deployment": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testDeploymentReadyFile)),
+								Err: nil,
+							},
+						},
+					},
+					"Service": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testServiceReadyFile)),
+								Err: nil,
+							},
+						},
+					},
+				},
+			},
+			OS: &services.OS{},
+		},
+		ServerSideApply: true,
+	}
+
+	if err := d.Apply(ctx, "", "", "", "testing/configs/deployment-and-service", "default", 10*time.Second, false); err != nil {
+		t.Fatalf("Apply(ctx, ...) with server-side apply = %v; want <nil>", err)
+	}
+}
+
+func TestApplyServerSideApplyConflicts(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+
+	conflictErr := &services.KubernetesError{
+		Reason:  metav1.StatusReasonConflict,
+		Code:    409,
+		Message: "Apply failed with 1 conflict",
+		Causes: []metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kubectl-client-side-apply" using apps/v1`,
+			Field:   ".spec.replicas",
+		}},
+	}
+
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: &testservices.TestKubectl{
+				ServerSideApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {conflictErr},
+					string(fileContents(t, testServiceFile)):    {conflictErr},
+				},
+			},
+			OS: &services.OS{},
+		},
+		ServerSideApply: true,
+		Results:         NewResults(),
+	}
+
+	err := d.Apply(ctx, "", "", "", "testing/configs/deployment-and-service", "default", 10*time.Second, false)
+	want := `failed to apply configuration files of Deployment "test-app", Service "test-app" to cluster because of conflicts with other field managers. Set --force-conflicts to take ownership of the conflicting fields`
+	if err == nil || err.Error() != want {
+		t.Errorf("Apply(ctx, ...) with server-side apply = %v; want %s", err, want)
+	}
+	// The apply phase still ends when it fails.
+	for _, p := range d.Results.Phases {
+		if !p.done {
+			t.Errorf("Apply(ctx, ...) with server-side apply did not end phase %q", p.Name)
+		}
+	}
+}
+
+func TestApplyListsApplicationObjects(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/ready/configs/deployment.yaml"
+	testServiceFile := "testing/ready/configs/service.yaml"
+	testDeployedFile := "testing/ready/deployed.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+
+	kubectl := &testservices.TestKubectl{
+		ApplyFromStringResponse: map[string][]error{
+			string(fileContents(t, testDeploymentFile)): {nil},
+			string(fileContents(t, testServiceFile)):    {nil},
+		},
+		// Both objects are checked with a single list request, and the Service, which is not ready,
+		// is then checked on its own.
+		GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+			"app.kubernetes.io/managed-by=gcp-cloud-build-deploy,app.kubernetes.io/name=test-app": {
+				"foobar": {
+					{
+						Res: string(fileContents(t, testDeployedFile)),
+						Err: nil,
+					},
+				},
+			},
+		},
+		GetResponse: map[string]map[string][]testservices.GetResponse{
+			"Service": {
+				"test-app": []testservices.GetResponse{
+					{
+						Res: string(fileContents(t, testServiceReadyFile)),
+						Err: nil,
+					},
+				},
+			},
+		},
+	}
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: kubectl,
+			OS:      &services.OS{},
+		},
+	}
+
+	if err := d.Apply(ctx, "", "", "", "testing/ready/configs", "", 10*time.Second, false); err != nil {
+		t.Fatalf("Apply(ctx, ...) = %v; want <nil>", err)
+	}
+	if len(kubectl.GetWithSelectorResponse) != 0 {
+		t.Errorf("Apply(ctx, ...) did not list all of the expected objects. got %v; want []", kubectl.GetWithSelectorResponse)
+	}
+	if len(kubectl.GetResponse) != 0 {
+		t.Errorf("Apply(ctx, ...) did not get all of the expected objects. got %v; want []", kubectl.GetResponse)
+	}
+}
+
+func TestApplyFailedPods(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testDeploymentUnreadyFile := "testing/failure/deployment-unready.yaml"
+	testReplicaSetsFile := "testing/failure/replicasets.yaml"
+	testPodsFile := "testing/failure/pods-with-old-revision.yaml"
+	testEventsFile := "testing/failure/events.yaml"
+
+	tests := []struct {
+		name string
+
+		eventsErr error
+	}{{
+		name: "Report failed pod with events",
+	}, {
+		name: "Report failed pod without events",
+
+		eventsErr: fmt.Errorf("failed to get events"),
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubectl := &testservices.TestKubectl{
+				ApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {nil},
+				},
+				GetResponse: map[string]map[string][]testservices.GetResponse{
+					"Deployment": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testDeploymentUnreadyFile)),
+								Err: nil,
+							},
+						},
+					},
+				},
+				GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+					"app=test-app": {
+						"foobar": {
+							{
+								Res: string(fileContents(t, testReplicaSetsFile)),
+								Err: nil,
+							},
+						},
+					},
+					// A failed Pod of the old ReplicaSet is ignored.
+					"app=test-app,pod-template-hash=58c8c7fffc": {
+						"foobar": {
+							{
+								Res: string(fileContents(t, testPodsFile)),
+								Err: nil,
+							},
+						},
+					},
+				},
+				GetEventsResponse: map[string]map[string][]testservices.GetResponse{
+					"Pod": {
+						"test-app-deployment-58c8c7fffc-pzxjb": {
+							{
+								Res: string(fileContents(t, testEventsFile)),
+								Err: tc.eventsErr,
+							},
+						},
+					},
+				},
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			start := time.Now()
+			err := d.Apply(ctx, "", "", "", testDeploymentFile, "", time.Minute, false)
+			want := `deployed object with kind "Deployment" and name "test-app" failed: pod "test-app-deployment-58c8c7fffc-pzxjb" failed: container "test-app" is waiting: CrashLoopBackOff`
+			if err == nil || err.Error() != want {
+				t.Errorf("Apply(ctx, ...) = %v; want %s", err, want)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Apply(ctx, ...) took %v; want it to fail without waiting for the timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestApplyCustomResourceDefinitions(t *testing.T) {
+	ctx := context.Background()
+
+	testCrdFile := "testing/crd/configs/crd.yaml"
+	testCertificateFile := "testing/crd/configs/certificate.yaml"
+	testCrdReadyFile := "testing/crd/crd-ready.yaml"
+	testCrdUnreadyFile := "testing/crd/crd-unready.yaml"
+	testCertificateReadyFile := "testing/crd/certificate-ready.yaml"
+	testNamespaceFile := "testing/namespace.yaml"
+
+	tests := []struct {
+		name string
+
+		config      string
+		waitTimeout time.Duration
+		kubectl     testservices.TestKubectl
+
+		wantErr bool
+	}{{
+		name: "Custom resource is applied after CustomResourceDefinition is established",
+
+		config:      "testing/crd/configs",
+		waitTimeout: 10 * time.Second,
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testCrdFile)):         {nil},
+				string(fileContents(t, testCertificateFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"CustomResourceDefinition": {
+					"certificates.cert-manager.io": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCrdReadyFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testCrdReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+				"Certificate": {
+					"test-app-cert": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCertificateReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Namespace is created after CustomResourceDefinition is established",
+
+		config:      "testing/crd/configs-with-namespace",
+		waitTimeout: 10 * time.Second,
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testCrdFile)):         {nil},
+				string(fileContents(t, testNamespaceFile)):   {nil},
+				string(fileContents(t, testCertificateFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"CustomResourceDefinition": {
+					"certificates.cert-manager.io": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCrdReadyFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testCrdReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+				"Namespace": {
+					"foobar": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: testservices.NotFoundError("Namespace", "foobar"),
+						},
+					},
+				},
+				"Certificate": {
+					"test-app-cert": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCertificateReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Custom resource is not applied if CustomResourceDefinition is not established",
+
+		config: "testing/crd/configs",
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testCrdFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"CustomResourceDefinition": {
+					"certificates.cert-manager.io": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCrdUnreadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		wantErr: true,
+	}, {
+		name: "Namespace is not created if CustomResourceDefinition is not established",
+
+		config: "testing/crd/configs-with-namespace",
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testCrdFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"CustomResourceDefinition": {
+					"certificates.cert-manager.io": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testCrdUnreadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			err := d.Apply(ctx, "", "", "", tc.config, "", tc.waitTimeout, false)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("Apply(ctx, ...) = %v; want error %t", err, tc.wantErr)
+			}
+			if len(tc.kubectl.ApplyFromStringResponse) != 0 {
+				t.Errorf("Apply(ctx, ...) did not apply all of the expected configs. got %v; want []", tc.kubectl.ApplyFromStringResponse)
+			}
+			if len(tc.kubectl.GetResponse) != 0 {
+				t.Errorf("Apply(ctx, ...) did not get all of the expected configs. got %v; want []", tc.kubectl.GetResponse)
+			}
+		})
+	}
+}
+
+func TestWaitForObjectsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testServiceFile := "testing/service.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+
+	kubectl := testservices.TestKubectl{
+		GetResponse: map[string]map[string][]testservices.GetResponse{
+			"Service": {
+				"test-app": []testservices.GetResponse{
+					{
+						Res: string(fileContents(t, testServiceUnreadyFile)),
+						Err: nil,
+					},
+				},
+			},
+		},
+	}
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: &kubectl,
+			OS:      &services.OS{},
+		},
+	}
+	objs, err := resource.ParseConfigsFromYAML(ctx, string(fileContents(t, testServiceFile)), testServiceFile, nil)
+	if err != nil {
+		t.Fatalf("failed to parse configs: %v", err)
+	}
+
+	if _, err := d.waitForObjects(ctx, objs, "", time.Minute); err != context.Canceled {
+		t.Errorf("waitForObjects(ctx, ...) = %v; want %v", err, context.Canceled)
+	}
+}
+
 func fileContents(t *testing.T, filename string) []byte {
 	contents, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -1384,6 +2162,14 @@ func fileContents(t *testing.T, filename string) []byte {
 	return contents
 }
 
+func newImageMapping(t *testing.T, imageName, ref string) *image.Mapping {
+	m, err := image.ParseMapping(imageName, ref)
+	if err != nil {
+		t.Fatalf("failed to create image mapping: %v", err)
+	}
+	return m
+}
+
 func newImageWithTag(t *testing.T, image string) name.Reference {
 	ref, err := name.NewTag(image)
 	if err != nil {
@@ -0,0 +1,89 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/diff"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// Diff prints a unified diff between the deployed state of each object in config and the object
+// itself. Fields populated by the server and fields not set in the configuration files are ignored.
+// It returns true if any object differs from its deployed state or is not deployed.
+func (d *Deployer) Diff(ctx context.Context, clusterName, clusterLocation, clusterProject, config, namespace string, recursive bool) (bool, error) {
+	d.printf("Comparing configuration files with deployed objects.\n")
+
+	if _, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject); err != nil {
+		return false, err
+	}
+
+	objs, err := d.parseConfigs(ctx, config, recursive)
+	if err != nil {
+		return false, err
+	}
+	d.printf("Configuration files to be used: %v\n\n", objs)
+
+	live, err := d.getLiveObjects(ctx, objs, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	changed := 0
+	for _, obj := range objs {
+		kind := resource.ObjectKind(obj)
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return false, fmt.Errorf("failed to get name of object: %v", err)
+		}
+
+		desired := &resource.Object{Unstructured: obj.DeepCopy()}
+		objNamespace, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return false, err
+		}
+		if objNamespace != "" {
+			desired.SetNamespace(objNamespace)
+		}
+
+		desiredString, err := resource.EncodeToYAMLString(desired)
+		if err != nil {
+			return false, fmt.Errorf("failed to encode obj to string")
+		}
+
+		deployedString := ""
+		deployedObj := live.get(kind, name, objNamespace)
+		if deployedObj != nil {
+			deployedObj, err = resource.RemoveUnconfiguredFields(deployedObj, desired)
+			if err != nil {
+				return false, fmt.Errorf("failed to compare deployed object with kind %q and name %q: %v", kind, name, err)
+			}
+			deployedString, err = resource.EncodeToYAMLString(deployedObj)
+			if err != nil {
+				return false, fmt.Errorf("failed to encode obj to string")
+			}
+		}
+
+		path := diffPath(kind, objNamespace, name)
+		if out := diff.Unified(deployedString, desiredString, "live/"+path, "config/"+path); out != "" {
+			changed++
+			d.printf("%s\n", out)
+		}
+	}
+
+	if changed == 0 {
+		d.printf("No differences found between configuration files and deployed objects.\n")
+		return false, nil
+	}
+	d.printf("%d of %d objects differ from deployed objects.\n", changed, len(objs))
+	return true, nil
+}
+
+// diffPath returns the path used to label an object in a diff. Cluster-scoped objects do not have
+// a namespace segment.
+func diffPath(kind, namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
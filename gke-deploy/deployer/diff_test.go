@@ -0,0 +1,158 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+
+	testServiceReadyFile := "testing/service-ready.yaml"
+
+	tests := []struct {
+		name string
+
+		config    string
+		namespace string
+		kubectl   testservices.TestKubectl
+
+		want bool
+	}{{
+		name: "No differences",
+
+		config: "testing/diff/service.yaml",
+		kubectl: testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		want: false,
+	}, {
+		name: "Changed object",
+
+		config: "testing/diff/service-changed.yaml",
+		kubectl: testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		want: true,
+	}, {
+		name: "Object not deployed",
+
+		config:    "testing/configs/service.yaml",
+		namespace: "foobar",
+		kubectl: testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: testservices.NotFoundError("Service", "test-app"),
+						},
+					},
+				},
+			},
+		},
+
+		want: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			got, err := d.Diff(ctx, "", "", "", tc.config, tc.namespace, false)
+			if err != nil {
+				t.Fatalf("Diff(ctx, %s, %s) = _, %v; want <nil>", tc.config, tc.namespace, err)
+			}
+			if got != tc.want {
+				t.Errorf("Diff(ctx, %s, %s) = %t; want %t", tc.config, tc.namespace, got, tc.want)
+			}
+
+			// Verify that all expected gets were executed
+			if len(tc.kubectl.GetResponse) != 0 {
+				t.Errorf("Diff(ctx, %s, %s) did not get all of the expected configs. got %v; want []", tc.config, tc.namespace, tc.kubectl.GetResponse)
+			}
+		})
+	}
+}
+
+func TestDiffErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		clusterName     string
+		clusterLocation string
+		config          string
+		kubectl         testservices.TestKubectl
+	}{{
+		name: "Cluster name without location",
+
+		clusterName: "test-cluster",
+		config:      "testing/diff/service.yaml",
+	}, {
+		name: "No objects found",
+
+		config: "testing/configs/empty-directory",
+	}, {
+		name: "Failed to get deployed object",
+
+		config: "testing/diff/service.yaml",
+		kubectl: testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: fmt.Errorf("failed to get config"),
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			if _, err := d.Diff(ctx, tc.clusterName, tc.clusterLocation, "", tc.config, "", false); err == nil {
+				t.Errorf("Diff(ctx, %s, %s, %s) = _, <nil>; want error", tc.clusterName, tc.clusterLocation, tc.config)
+			}
+		})
+	}
+}
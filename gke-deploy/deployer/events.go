@@ -0,0 +1,149 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/event"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// emit sends an event to d.Events, if set. Events of a copy of the deployer that deploys to one of
+// multiple clusters are emitted with that cluster.
+func (d *Deployer) emit(e *event.Event) {
+	if d.Events == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Cluster = d.target.Name
+	e.Location = d.target.Location
+	d.Events.Emit(e)
+}
+
+// startPhase records the start of a phase of deploying to target in d.Results and emits a
+// PhaseStarted event. It returns a function that records the end of the phase.
+func (d *Deployer) startPhase(name string, target ClusterTarget) func() {
+	d.emit(&event.Event{
+		Type:  event.PhaseStarted,
+		Phase: name,
+	})
+	return d.Results.startPhase(name, target)
+}
+
+// printf writes human-readable progress to d.Out, or stdout if it is not set.
+func (d *Deployer) printf(format string, a ...interface{}) {
+	out := d.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, a...)
+}
+
+// warnf prints a warning to stderr and emits a Warning event with the same text.
+func (d *Deployer) warnf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	fmt.Fprintf(os.Stderr, "\nWARNING: %s\n\n", msg)
+	d.emit(&event.Event{
+		Type:    event.Warning,
+		Message: msg,
+	})
+}
+
+// emitObject emits an event of an object. If namespace is not empty, it overrides the namespace of
+// the object.
+func (d *Deployer) emitObject(typ event.Type, obj *resource.Object, namespace, message string, readyAfter time.Duration) error {
+	if d.Events == nil {
+		return nil
+	}
+	eo, err := d.eventObject(obj, namespace)
+	if err != nil {
+		return err
+	}
+	d.emit(&event.Event{
+		Type:              typ,
+		Object:            eo,
+		ReadyAfterSeconds: roundSeconds(readyAfter),
+		Message:           message,
+	})
+	return nil
+}
+
+// emitFailure emits the Summary event of a deployment that failed before its objects were applied,
+// e.g., because access to the cluster could not be authorized.
+func (d *Deployer) emitFailure(err error) {
+	d.emit(&event.Event{
+		Type:    event.Summary,
+		Status:  event.StatusFailed,
+		Objects: []*event.Object{},
+		Message: err.Error(),
+	})
+}
+
+// emitSummary emits a Summary event with the states of deployed objects. The deployment failed if
+// failure is not empty. Objects of server-side dry runs are not deployed, so they have no state.
+func (d *Deployer) emitSummary(ctx context.Context, objs resource.Objects, namespace, failure string) error {
+	if d.Events == nil {
+		return nil
+	}
+	e := &event.Event{
+		Type:    event.Summary,
+		Status:  event.StatusSucceeded,
+		Objects: []*event.Object{},
+		Message: failure,
+	}
+	if failure != "" {
+		e.Status = event.StatusFailed
+	}
+	for _, obj := range objs {
+		eo, err := d.eventObject(obj, namespace)
+		if err != nil {
+			return err
+		}
+		if d.ServerDryRun {
+			e.Objects = append(e.Objects, eo)
+			continue
+		}
+		state, _, err := resource.CheckReady(ctx, obj)
+		if err != nil {
+			return fmt.Errorf("failed to check if deployed object with kind %q and name %q is ready: %v", eo.Kind, eo.Name, err)
+		}
+		eo.State = state.String()
+		e.Objects = append(e.Objects, eo)
+	}
+	sort.SliceStable(e.Objects, func(i, j int) bool {
+		a, b := e.Objects[i], e.Objects[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	d.emit(e)
+	return nil
+}
+
+// eventObject identifies an object in events. If namespace is not empty, it overrides the
+// namespace of namespaced objects.
+func (d *Deployer) eventObject(obj *resource.Object, namespace string) (*event.Object, error) {
+	kind := resource.ObjectKind(obj)
+	name, err := resource.ObjectName(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get name of object: %v", err)
+	}
+	ns, err := d.effectiveNamespace(obj, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return &event.Object{
+		Kind:      kind,
+		Name:      name,
+		Namespace: ns,
+	}, nil
+}
@@ -0,0 +1,256 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/event"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+// testSink records emitted events.
+type testSink struct {
+	events []*event.Event
+}
+
+func (s *testSink) Emit(e *event.Event) {
+	s.events = append(s.events, e)
+}
+
+func TestApplyEvents(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+
+	tests := []struct {
+		name string
+
+		serviceFile  string
+		applyErr     error
+		serverDryRun bool
+
+		want    []*event.Event
+		wantErr bool
+	}{{
+		name: "Objects become ready",
+
+		serviceFile: testServiceReadyFile,
+
+		want: []*event.Event{{
+			Type:  event.PhaseStarted,
+			Phase: "authorize",
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "apply",
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Service", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "wait",
+		}, {
+			Type:   event.ObjectReady,
+			Object: &event.Object{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.ObjectReady,
+			Object: &event.Object{Kind: "Service", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.Summary,
+			Status: event.StatusSucceeded,
+			Objects: []*event.Object{
+				{Kind: "Deployment", Namespace: "foobar", Name: "test-app", State: "Ready"},
+				{Kind: "Service", Namespace: "foobar", Name: "test-app", State: "Ready"},
+			},
+		}},
+	}, {
+		name: "Object does not become ready",
+
+		serviceFile: testServiceUnreadyFile,
+
+		want: []*event.Event{{
+			Type:  event.PhaseStarted,
+			Phase: "authorize",
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "apply",
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Service", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "wait",
+		}, {
+			Type:   event.ObjectReady,
+			Object: &event.Object{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.Summary,
+			Status: event.StatusFailed,
+			Objects: []*event.Object{
+				{Kind: "Deployment", Namespace: "foobar", Name: "test-app", State: "Ready"},
+				{Kind: "Service", Namespace: "foobar", Name: "test-app", State: "NotReady"},
+			},
+			Message: "timed out after 0s while waiting for deployed objects to be ready",
+		}},
+		wantErr: true,
+	}, {
+		name: "Failed to apply",
+
+		serviceFile: testServiceReadyFile,
+		applyErr:    fmt.Errorf("failed to apply"),
+
+		want: []*event.Event{{
+			Type:  event.PhaseStarted,
+			Phase: "authorize",
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "apply",
+		}, {
+			Type:    event.Summary,
+			Status:  event.StatusFailed,
+			Objects: []*event.Object{},
+			Message: `failed to apply Deployment configuration file with name "test-app" to cluster: failed to apply config from string: failed to apply`,
+		}},
+		wantErr: true,
+	}, {
+		name: "Server dry run",
+
+		serviceFile:  testServiceReadyFile,
+		serverDryRun: true,
+
+		want: []*event.Event{{
+			Type:  event.PhaseStarted,
+			Phase: "authorize",
+		}, {
+			Type:  event.PhaseStarted,
+			Phase: "apply",
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.ObjectApplied,
+			Object: &event.Object{Kind: "Service", Namespace: "foobar", Name: "test-app"},
+		}, {
+			Type:   event.Summary,
+			Status: event.StatusSucceeded,
+			Objects: []*event.Object{
+				{Kind: "Deployment", Namespace: "foobar", Name: "test-app"},
+				{Kind: "Service", Namespace: "foobar", Name: "test-app"},
+			},
+		}},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sink := &testSink{}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &testservices.TestKubectl{
+						ApplyFromStringResponse: map[string][]error{
+							string(fileContents(t, testDeploymentFile)): {tc.applyErr},
+							string(fileContents(t, testServiceFile)):    {nil},
+						},
+						GetResponse: map[string]map[string][]testservices.GetResponse{
+							"Deployment": {
+								"test-app": []testservices.GetResponse{
+									{
+										Res: string(fileContents(t, testDeploymentReadyFile)),
+										Err: nil,
+									},
+								},
+							},
+							"Service": {
+								"test-app": []testservices.GetResponse{
+									{
+										Res: string(fileContents(t, tc.serviceFile)),
+										Err: nil,
+									},
+								},
+							},
+						},
+					},
+					OS: &services.OS{},
+				},
+				Events:       sink,
+				ServerDryRun: tc.serverDryRun,
+			}
+
+			// Objects that are not ready on the first check time out immediately.
+			err := d.Apply(ctx, "", "", "", "testing/configs/deployment-and-service", "foobar", 0, false)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Apply(ctx, ...) = %v; want error %v", err, tc.wantErr)
+			}
+
+			for _, e := range sink.events {
+				if e.Time.IsZero() {
+					t.Errorf("Apply(ctx, ...) emitted event %+v without a time", e)
+				}
+				// Times depend on how long the test takes.
+				e.Time = time.Time{}
+				e.ReadyAfterSeconds = 0
+			}
+			if diff := cmp.Diff(tc.want, sink.events); diff != "" {
+				t.Errorf("Apply(ctx, ...) emitted events with diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWarnfEvent(t *testing.T) {
+	sink := &testSink{}
+	d := Deployer{
+		Events: sink,
+		target: ClusterTarget{Name: "cluster-1", Location: "us-east1"},
+	}
+	d.warnf("Failed to get digest of image %q", "gcr.io/my-project/my-app")
+
+	want := []*event.Event{{
+		Type:     event.Warning,
+		Cluster:  "cluster-1",
+		Location: "us-east1",
+		Message:  `Failed to get digest of image "gcr.io/my-project/my-app"`,
+	}}
+	for _, e := range sink.events {
+		e.Time = time.Time{}
+	}
+	if diff := cmp.Diff(want, sink.events); diff != "" {
+		t.Errorf("warnf(...) emitted events with diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestVariablesWarnfEvent(t *testing.T) {
+	sink := &testSink{}
+	d := Deployer{
+		Events:    sink,
+		Variables: &resource.Variables{},
+	}
+	if _, _, err := d.variables().Expand("value: ${UNDEFINED}"); err != nil {
+		t.Fatalf("Expand(...) = _, _, %v; want _, _, <nil>", err)
+	}
+
+	want := []*event.Event{{
+		Type:    event.Warning,
+		Message: "Placeholders of undefined variable(s) are left as is: UNDEFINED",
+	}}
+	for _, e := range sink.events {
+		e.Time = time.Time{}
+	}
+	if diff := cmp.Diff(want, sink.events); diff != "" {
+		t.Errorf("Expand(...) emitted events with diff (-want +got):\n%s", diff)
+	}
+}
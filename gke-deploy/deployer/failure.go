@@ -0,0 +1,257 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// maxFailureEvents is the number of most recent events that are reported for each failed Pod.
+const maxFailureEvents = 5
+
+// podOwnerKinds are the kinds of objects whose Pods are checked for failures while they are not
+// ready.
+var podOwnerKinds = map[string]bool{
+	"DaemonSet":             true,
+	"Deployment":            true,
+	"Job":                   true,
+	"ReplicaSet":            true,
+	"ReplicationController": true,
+	"StatefulSet":           true,
+}
+
+const (
+	// failedPodsCheckInterval is how often the Pods of each deployed object that is not ready are
+	// checked for failures. Pods are listed for every check, so this is less often than readiness
+	// checks.
+	failedPodsCheckInterval = 10 * time.Second
+
+	// revisionAnnotation is the annotation with the revision of Deployments and their ReplicaSets.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+	// podTemplateHashLabel is the label with the hash of the Pod template of a Deployment's
+	// ReplicaSet, which is set on the ReplicaSet and its Pods.
+	podTemplateHashLabel = "pod-template-hash"
+	// controllerRevisionHashLabel is the label with the revision of a StatefulSet's Pods.
+	controllerRevisionHashLabel = "controller-revision-hash"
+)
+
+// failedPods returns the Pods of the current revision of a deployed object with one of
+// podOwnerKinds that have failed. Pods of earlier revisions, e.g., of a Deployment's old ReplicaSets
+// that are being scaled down, are ignored.
+func (d *Deployer) failedPods(ctx context.Context, obj *resource.Object) (resource.Objects, error) {
+	selector, err := podSelector(obj)
+	if err != nil {
+		return nil, err
+	}
+	if selector == "" {
+		return nil, nil
+	}
+	owner := obj
+	switch resource.ObjectKind(obj) {
+	case "Deployment":
+		// The Pods of a Deployment are owned by the ReplicaSet of its current revision.
+		owner, err = d.currentReplicaSet(ctx, obj, selector)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil {
+			return nil, nil
+		}
+		if hash := owner.GetLabels()[podTemplateHashLabel]; hash != "" {
+			selector = fmt.Sprintf("%s,%s=%s", selector, podTemplateHashLabel, hash)
+		}
+	case "StatefulSet":
+		if revision, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision"); revision != "" {
+			selector = fmt.Sprintf("%s,%s=%s", selector, controllerRevisionHashLabel, revision)
+		}
+	}
+
+	pods, err := cluster.GetDeployedObjectsWithSelector(ctx, []string{"Pod"}, selector, obj.GetNamespace(), d.Clients.Kubectl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pods with selector %q: %v", selector, err)
+	}
+	var failed resource.Objects
+	for _, pod := range pods {
+		if !controlledBy(pod, owner) {
+			continue
+		}
+		state, _, err := resource.CheckReady(ctx, pod)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if pod %q has failed: %v", pod.GetName(), err)
+		}
+		if state == resource.Failed {
+			failed = append(failed, pod)
+		}
+	}
+	return failed, nil
+}
+
+// currentReplicaSet returns the ReplicaSet of the current revision of a deployed Deployment, whose
+// Pods are selected by selector. It returns nil if the Deployment controller has not created it
+// yet.
+func (d *Deployer) currentReplicaSet(ctx context.Context, deployment *resource.Object, selector string) (*resource.Object, error) {
+	observedGeneration, _, _ := unstructured.NestedInt64(deployment.Object, "status", "observedGeneration")
+	revision := deployment.GetAnnotations()[revisionAnnotation]
+	if observedGeneration < deployment.GetGeneration() || revision == "" {
+		return nil, nil
+	}
+	replicaSets, err := cluster.GetDeployedObjectsWithSelector(ctx, []string{"ReplicaSet"}, selector, deployment.GetNamespace(), d.Clients.Kubectl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replicasets with selector %q: %v", selector, err)
+	}
+	for _, rs := range replicaSets {
+		if controlledBy(rs, deployment) && rs.GetAnnotations()[revisionAnnotation] == revision {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+// controlledBy returns true if obj is controlled by owner. If owner has no UID, e.g., it was not
+// fetched from the cluster, every object is considered to be controlled by it.
+func controlledBy(obj, owner *resource.Object) bool {
+	if owner.GetUID() == "" {
+		return true
+	}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Controller != nil && *ref.Controller && ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// podSelector returns a label selector for the Pods of a deployed object, built from
+// spec.selector.matchLabels and spec.selector.matchExpressions, or spec.selector for
+// ReplicationControllers. It returns an empty string if the object does not select Pods by labels.
+func podSelector(obj *resource.Object) (string, error) {
+	if resource.ObjectKind(obj) == "ReplicationController" {
+		labels, _, err := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+		if err != nil {
+			return "", fmt.Errorf("failed to get spec.selector field: %v", err)
+		}
+		return strings.Join(labelRequirements(labels), ","), nil
+	}
+
+	labels, _, err := unstructured.NestedStringMap(obj.Object, "spec", "selector", "matchLabels")
+	if err != nil {
+		return "", fmt.Errorf("failed to get spec.selector.matchLabels field: %v", err)
+	}
+	requirements := labelRequirements(labels)
+	expressions, _, err := unstructured.NestedSlice(obj.Object, "spec", "selector", "matchExpressions")
+	if err != nil {
+		return "", fmt.Errorf("failed to get spec.selector.matchExpressions field: %v", err)
+	}
+	for _, e := range expressions {
+		expression, ok := e.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("failed to get spec.selector.matchExpressions field: expression is not a map")
+		}
+		r, err := expressionRequirement(expression)
+		if err != nil {
+			return "", err
+		}
+		requirements = append(requirements, r)
+	}
+	return strings.Join(requirements, ","), nil
+}
+
+// labelRequirements returns the sorted requirements of a label selector that match labels.
+func labelRequirements(labels map[string]string) []string {
+	requirements := make([]string, 0, len(labels))
+	for k, v := range labels {
+		requirements = append(requirements, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(requirements)
+	return requirements
+}
+
+// expressionRequirement returns the requirement of a label selector for a match expression, e.g.,
+// "tier in (frontend,backend)".
+func expressionRequirement(expression map[string]interface{}) (string, error) {
+	key, _, _ := unstructured.NestedString(expression, "key")
+	operator, _, _ := unstructured.NestedString(expression, "operator")
+	values, _, err := unstructured.NestedStringSlice(expression, "values")
+	if err != nil {
+		return "", fmt.Errorf("failed to get values of match expression with key %q: %v", key, err)
+	}
+	switch operator {
+	case "In":
+		return fmt.Sprintf("%s in (%s)", key, strings.Join(values, ",")), nil
+	case "NotIn":
+		return fmt.Sprintf("%s notin (%s)", key, strings.Join(values, ",")), nil
+	case "Exists":
+		return key, nil
+	case "DoesNotExist":
+		return "!" + key, nil
+	}
+	return "", fmt.Errorf("unknown operator %q of match expression with key %q", operator, key)
+}
+
+// printFailure prints why a deployed object failed, along with the container states and most
+// recent events of its failed Pods. Events that cannot be retrieved are skipped with a warning.
+func (d *Deployer) printFailure(ctx context.Context, kind, name, reason string, pods resource.Objects) error {
+	d.printf("\nDeployed object with kind %q and name %q failed: %s\n", kind, name, reason)
+	for _, pod := range pods {
+		d.printf("\nPod %q:\n", pod.GetName())
+		states, err := resource.ContainerStates(ctx, pod)
+		if err != nil {
+			return fmt.Errorf("failed to get container states of pod %q: %v", pod.GetName(), err)
+		}
+		for _, s := range states {
+			d.printf("  %s\n", s)
+		}
+
+		events, err := cluster.GetDeployedObjectEvents(ctx, "Pod", pod.GetName(), pod.GetNamespace(), d.Clients.Kubectl)
+		if err != nil {
+			d.warnf("Failed to get events of pod %q: %v", pod.GetName(), err)
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+		sortEventsByTime(events)
+		if len(events) > maxFailureEvents {
+			events = events[len(events)-maxFailureEvents:]
+		}
+		d.printf("  Recent events:\n")
+		for _, e := range events {
+			d.printf("    %s\n", eventDescription(e))
+		}
+	}
+	return nil
+}
+
+// sortEventsByTime sorts events from oldest to newest.
+func sortEventsByTime(events resource.Objects) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(events[i]) < eventTime(events[j])
+	})
+}
+
+// eventTime returns the RFC 3339 time that an event last occurred.
+func eventTime(e *resource.Object) string {
+	for _, field := range []string{"lastTimestamp", "eventTime"} {
+		if t, _, _ := unstructured.NestedString(e.Object, field); t != "" {
+			return t
+		}
+	}
+	t, _, _ := unstructured.NestedString(e.Object, "metadata", "creationTimestamp")
+	return t
+}
+
+// eventDescription returns a one-line description of an event, e.g.,
+// `2019-06-10T18:45:01Z Warning Failed: Failed to pull image "gcr.io/my-project/my-app:bad"`.
+func eventDescription(e *resource.Object) string {
+	eventType, _, _ := unstructured.NestedString(e.Object, "type")
+	reason, _, _ := unstructured.NestedString(e.Object, "reason")
+	message, _, _ := unstructured.NestedString(e.Object, "message")
+	return fmt.Sprintf("%s %s %s: %s", eventTime(e), eventType, reason, strings.TrimSpace(message))
+}
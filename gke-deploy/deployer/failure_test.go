@@ -0,0 +1,63 @@
+package deployer
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+func TestPodSelector(t *testing.T) {
+	tests := []struct {
+		name string
+
+		obj string
+
+		want string
+	}{{
+		name: "Match labels",
+
+		obj: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\nspec:\n  selector:\n    matchLabels:\n      tier: web\n      app: test-app\n",
+
+		want: "app=test-app,tier=web",
+	}, {
+		name: "Match labels and expressions",
+
+		obj: "apiVersion: apps/v1\nkind: StatefulSet\nmetadata:\n  name: test-app\nspec:\n  selector:\n    matchLabels:\n      app: test-app\n    matchExpressions:\n    - key: tier\n      operator: In\n      values: [web, api]\n    - key: env\n      operator: NotIn\n      values: [dev]\n    - key: canary\n      operator: DoesNotExist\n    - key: track\n      operator: Exists\n",
+
+		want: "app=test-app,tier in (web,api),env notin (dev),!canary,track",
+	}, {
+		name: "ReplicationController",
+
+		obj: "apiVersion: v1\nkind: ReplicationController\nmetadata:\n  name: test-app\nspec:\n  selector:\n    app: test-app\n",
+
+		want: "app=test-app",
+	}, {
+		name: "No selector",
+
+		obj: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: test-app\nspec: {}\n",
+
+		want: "",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			obj, err := resource.DecodeFromYAML(nil, []byte(tc.obj))
+			if err != nil {
+				t.Fatalf("failed to decode object: %v", err)
+			}
+			if got, err := podSelector(obj); got != tc.want || err != nil {
+				t.Errorf("podSelector(%v) = %q, %v; want %q, <nil>", obj, got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPodSelectorErrors(t *testing.T) {
+	obj, err := resource.DecodeFromYAML(nil, []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\nspec:\n  selector:\n    matchExpressions:\n    - key: tier\n      operator: Foo\n"))
+	if err != nil {
+		t.Fatalf("failed to decode object: %v", err)
+	}
+	if got, err := podSelector(obj); err == nil {
+		t.Errorf("podSelector(%v) = %q, <nil>; want error", obj, got)
+	}
+}
@@ -0,0 +1,82 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/image"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// Policies for images whose digests cannot be resolved when pinning all images.
+const (
+	// PinImagesPolicyFail fails the deployment.
+	PinImagesPolicyFail = "fail"
+	// PinImagesPolicyWarn prints a warning and leaves the image unpinned.
+	PinImagesPolicyWarn = "warn"
+	// PinImagesPolicySkip leaves the image unpinned.
+	PinImagesPolicySkip = "skip"
+)
+
+// imageMatch is an image with digest and the containers that were set to it.
+type imageMatch struct {
+	image   string
+	matches []resource.ContainerMatch
+}
+
+// printImageMatches prints which objects and containers were set to each image.
+func (d *Deployer) printImageMatches(imageMatches []imageMatch) {
+	d.printf("\nImages set in configuration files:\n")
+	for _, im := range imageMatches {
+		d.printf("\n%s\n", im.image)
+		if len(im.matches) == 0 {
+			d.printf("  No matching containers\n")
+			continue
+		}
+		for _, m := range im.matches {
+			d.printf("  %s\n", m)
+		}
+	}
+	d.printf("\n")
+}
+
+// pinAllImages sets the image of every container, init container, and ephemeral container of objs
+// that is not already pinned to a digest to its digest. Images whose digests cannot be resolved are
+// handled according to d.PinImagesPolicy.
+func (d *Deployer) pinAllImages(ctx context.Context, objs resource.Objects) error {
+	d.printf("Pinning all container images to digests\n")
+	pinned := make(map[string]string)
+	return resource.UpdateContainerImages(ctx, objs, d.PodTemplatePaths, func(obj *resource.Object, container, im string) (string, error) {
+		if p, ok := pinned[im]; ok {
+			return p, nil
+		}
+		ref, err := name.ParseReference(im)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse reference from image %q of container %q in %v: %v", im, container, obj, err)
+		}
+		if _, ok := ref.(name.Digest); ok {
+			pinned[im] = im
+			return im, nil
+		}
+
+		digest, err := image.ResolveDigest(ctx, ref, d.Clients.Remote)
+		if err != nil {
+			switch d.PinImagesPolicy {
+			case PinImagesPolicyWarn:
+				d.warnf("Failed to get digest of image %q. Image will not be pinned: %v", im, err)
+			case PinImagesPolicySkip:
+				d.printf("Skipping image %q because its digest could not be resolved\n", im)
+			default:
+				return "", fmt.Errorf("failed to get digest of image %q: %v", im, err)
+			}
+			pinned[im] = im
+			return im, nil
+		}
+		imageWithDigest := fmt.Sprintf("%s@%s", image.Name(ref), digest)
+		d.printf("Got digest for image: %s --> %s\n", im, imageWithDigest)
+		pinned[im] = imageWithDigest
+		return imageWithDigest, nil
+	})
+}
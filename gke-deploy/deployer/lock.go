@@ -0,0 +1,98 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/lock"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+const (
+	// DefaultLockTimeout is the default time to wait for another deployment of an application to
+	// release its lock.
+	DefaultLockTimeout = 10 * time.Minute
+	// DefaultLockDuration is the default time after which a lock that has not been renewed is stale
+	// and can be taken over.
+	DefaultLockDuration = 1 * time.Minute
+)
+
+// acquireLock takes the lock of the application of objs in its namespace, so that it is not
+// deployed concurrently. The lock's holder is d.BuildID, or the host name and process ID if it is
+// not set. It returns nil and ctx if objs do not belong to exactly one application. Otherwise, the
+// returned context is canceled if the lock is lost before it is released.
+func (d *Deployer) acquireLock(ctx context.Context, objs resource.Objects, namespace string) (*lock.Lock, context.Context, error) {
+	appNames := objectAppNames(objs)
+	if len(appNames) != 1 {
+		d.printf("Not locking deployment because objects must have the same %s label. This label can be set with the --app|-a flag in the prepare phase.\n", appNameLabelKey)
+		return nil, ctx, nil
+	}
+	lockNamespace, err := d.applicationNamespace(objs, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	duration := d.LockDuration
+	if duration <= 0 {
+		duration = DefaultLockDuration
+	}
+	l := lock.New(appNames[0], lockNamespace, d.lockHolder(), duration, d.Clients.Kubectl, lockLogger{d})
+	lockCtx, err := l.Acquire(ctx, d.LockTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, lockCtx, nil
+}
+
+// releaseLock releases a lock taken by acquireLock. Failing to release the lock is not an error
+// because it becomes stale.
+func (d *Deployer) releaseLock(ctx context.Context, l *lock.Lock) {
+	if l == nil {
+		return
+	}
+	if err := l.Release(ctx); err != nil {
+		d.warnf("Failed to release lock: %v. It can be taken over after %v.", err, l.Duration)
+	}
+}
+
+// lockLogger reports the progress of a lock like the rest of the deployment, with warnings that
+// are also emitted as events.
+type lockLogger struct {
+	d *Deployer
+}
+
+func (l lockLogger) Printf(format string, a ...interface{}) {
+	l.d.printf(format, a...)
+}
+
+func (l lockLogger) Warnf(format string, a ...interface{}) {
+	l.d.warnf(format, a...)
+}
+
+func (d *Deployer) lockHolder() string {
+	if d.BuildID != "" {
+		return d.BuildID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// applicationNamespace returns the namespace that an application's releases and locks are stored
+// in, which is namespace, if set, or else the namespace of the first namespaced object, or the
+// current context's namespace.
+func (d *Deployer) applicationNamespace(objs resource.Objects, namespace string) (string, error) {
+	if namespace != "" {
+		return namespace, nil
+	}
+	for _, obj := range objs {
+		if !clusterScopedKinds[resource.ObjectKind(obj)] {
+			return d.effectiveNamespace(obj, "")
+		}
+	}
+	return d.contextNamespace, nil
+}
@@ -0,0 +1,168 @@
+package deployer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+// lockKubectl records the namespaces and field managers of configs applied with server-side apply,
+// i.e., Leases, whose contents are not deterministic.
+type lockKubectl struct {
+	*testservices.TestKubectl
+
+	// missingNamespaces do not exist until their Namespaces are applied.
+	missingNamespaces map[string]bool
+
+	leaseNamespaces []string
+	fieldManagers   []string
+}
+
+func (k *lockKubectl) ApplyFromString(ctx context.Context, configString, namespace string) error {
+	if err := k.TestKubectl.ApplyFromString(ctx, configString, namespace); err != nil {
+		return err
+	}
+	obj, err := resource.DecodeFromYAML(ctx, []byte(configString))
+	if err != nil {
+		return err
+	}
+	if resource.ObjectKind(obj) == "Namespace" {
+		delete(k.missingNamespaces, obj.GetName())
+	}
+	return nil
+}
+
+func (k *lockKubectl) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	if k.missingNamespaces[namespace] {
+		return testservices.NotFoundError("Namespace", namespace)
+	}
+	k.leaseNamespaces = append(k.leaseNamespaces, namespace)
+	k.fieldManagers = append(k.fieldManagers, fieldManager)
+	return nil
+}
+
+func TestApplyLock(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+	testDeploymentUnlabeledFile := "testing/prune/deployment-unlabeled.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testNewNamespaceConfigs := "testing/lock/new-namespace"
+
+	tests := []struct {
+		name string
+
+		config       string
+		namespace    string
+		serverDryRun bool
+		// newNamespace is a namespace in config that does not exist yet.
+		newNamespace string
+
+		wantLeaseNamespaces []string
+	}{{
+		name: "Lock application",
+
+		config: testDeploymentFile,
+
+		wantLeaseNamespaces: []string{"default"},
+	}, {
+		name: "Lock application in namespace",
+
+		config:    testDeploymentFile,
+		namespace: "foobar",
+
+		wantLeaseNamespaces: []string{"foobar"},
+	}, {
+		name: "Lock application in new namespace",
+
+		config:       testNewNamespaceConfigs,
+		newNamespace: "foobar",
+
+		wantLeaseNamespaces: []string{"foobar"},
+	}, {
+		name: "No app name",
+
+		config: testDeploymentUnlabeledFile,
+	}, {
+		name: "Server dry run",
+
+		config:       testDeploymentFile,
+		serverDryRun: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ks := &lockKubectl{
+				TestKubectl: &testservices.TestKubectl{
+					ApplyFromStringResponse: map[string][]error{},
+					GetResponse:             map[string]map[string][]testservices.GetResponse{},
+				},
+				missingNamespaces: map[string]bool{},
+			}
+			if tc.newNamespace != "" {
+				ks.ApplyFromStringResponse[string(fileContents(t, filepath.Join(tc.config, "namespace.yaml")))] = []error{nil}
+				ks.ApplyFromStringResponse[string(fileContents(t, filepath.Join(tc.config, "deployment.yaml")))] = []error{nil}
+				ks.GetResponse["Namespace"] = map[string][]testservices.GetResponse{
+					tc.newNamespace: {
+						{Res: "", Err: testservices.NotFoundError("Namespace", tc.newNamespace)},
+					},
+				}
+				ks.missingNamespaces[tc.newNamespace] = true
+			} else {
+				ks.ApplyFromStringResponse[string(fileContents(t, tc.config))] = []error{nil}
+			}
+			if !tc.serverDryRun {
+				ks.GetResponse["Deployment"] = map[string][]testservices.GetResponse{
+					"test-app": {
+						{
+							Res: string(fileContents(t, testDeploymentReadyFile)),
+							Err: nil,
+						},
+					},
+				}
+			}
+			if len(tc.wantLeaseNamespaces) > 0 {
+				// The Lease does not exist when it is acquired, and was deleted when it is released.
+				ks.GetResponse["Lease"] = map[string][]testservices.GetResponse{
+					"gke-deploy.lock.test-app": {
+						{Res: "", Err: testservices.NotFoundError("Lease", "gke-deploy.lock.test-app")},
+						{Res: "", Err: testservices.NotFoundError("Lease", "gke-deploy.lock.test-app")},
+					},
+				}
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: ks,
+					OS:      &services.OS{},
+				},
+				ServerDryRun: tc.serverDryRun,
+				Lock:         true,
+				LockDuration: time.Hour,
+				BuildID:      "build-1",
+			}
+
+			if err := d.Apply(ctx, "", "", "", tc.config, tc.namespace, 10*time.Second, false); err != nil {
+				t.Fatalf("Apply(ctx, ..., %s, %s, ...) = %v; want <nil>", tc.config, tc.namespace, err)
+			}
+			if len(ks.leaseNamespaces) != len(tc.wantLeaseNamespaces) {
+				t.Fatalf("Apply(ctx, ..., %s, %s, ...) acquired Leases in namespaces %v; want %v", tc.config, tc.namespace, ks.leaseNamespaces, tc.wantLeaseNamespaces)
+			}
+			for i, ns := range ks.leaseNamespaces {
+				if ns != tc.wantLeaseNamespaces[i] {
+					t.Errorf("Apply(ctx, ..., %s, %s, ...) acquired Lease in namespace %q; want %q", tc.config, tc.namespace, ns, tc.wantLeaseNamespaces[i])
+				}
+				if got, want := ks.fieldManagers[i], "gke-deploy-lock-build-1"; got != want {
+					t.Errorf("Apply(ctx, ..., %s, %s, ...) acquired Lease with field manager %q; want %q", tc.config, tc.namespace, got, want)
+				}
+			}
+			if len(ks.GetResponse) != 0 {
+				t.Errorf("Apply(ctx, ..., %s, %s, ...) did not get all of the expected objects. got %v; want []", tc.config, tc.namespace, ks.GetResponse)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package deployer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// ownershipConflict is a deployed object that belongs to another manager or application than the
+// object that would be applied over it.
+type ownershipConflict struct {
+	kind      string
+	name      string
+	namespace string
+	reason    string
+}
+
+func (c ownershipConflict) String() string {
+	if c.namespace == "" {
+		return fmt.Sprintf("%s %q: %s", c.kind, c.name, c.reason)
+	}
+	return fmt.Sprintf("%s %q in namespace %q: %s", c.kind, c.name, c.namespace, c.reason)
+}
+
+// checkOwnership returns an error listing the deployed objects that objs would be applied over, if
+// they have an app.kubernetes.io/managed-by label of another manager, e.g., Helm or Config Sync, or
+// an app.kubernetes.io/name label of another application. Objects that do not exist, or that do not
+// have these labels, can be adopted. Namespaces are skipped because they are only created if they
+// do not exist. If namespace is not empty, it overrides the namespace of each object. The deployed
+// states of objs are taken from live.
+func (d *Deployer) checkOwnership(objs resource.Objects, namespace string, live liveObjects) error {
+	var conflicts []ownershipConflict
+	for _, obj := range objs {
+		kind := resource.ObjectKind(obj)
+		if kind == "Namespace" {
+			continue
+		}
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get name of object: %v", err)
+		}
+		objNamespace, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return err
+		}
+
+		deployedObj := live.get(kind, name, objNamespace)
+		if deployedObj == nil {
+			continue
+		}
+
+		deployedLabels := deployedObj.GetLabels()
+		if managedBy := deployedLabels[managedByLabelKey]; managedBy != "" && managedBy != managedByLabelValue {
+			conflicts = append(conflicts, ownershipConflict{
+				kind:      kind,
+				name:      name,
+				namespace: objNamespace,
+				reason:    fmt.Sprintf("managed by %q", managedBy),
+			})
+			continue
+		}
+		deployedApp := deployedLabels[appNameLabelKey]
+		if app := obj.GetLabels()[appNameLabelKey]; deployedApp != "" && deployedApp != app {
+			conflicts = append(conflicts, ownershipConflict{
+				kind:      kind,
+				name:      name,
+				namespace: objNamespace,
+				reason:    fmt.Sprintf("belongs to application %q", deployedApp),
+			})
+		}
+	}
+
+	if len(conflicts) > 0 {
+		var lines []string
+		for _, c := range conflicts {
+			lines = append(lines, fmt.Sprintf("  %v", c))
+		}
+		d.warnf("The following deployed objects belong to another manager or application and would be overwritten:\n%s", strings.Join(lines, "\n"))
+		return fmt.Errorf("refusing to adopt %d deployed objects that belong to another manager or application. Set --adopt to apply over them anyway", len(conflicts))
+	}
+	return nil
+}
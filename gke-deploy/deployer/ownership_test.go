@@ -0,0 +1,117 @@
+package deployer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestApplyCheckOwnership(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testDeployedFile := "testing/ownership/deployed.yaml"
+	testDeployedUnlabeledFile := "testing/ownership/deployed-unlabeled.yaml"
+	testDeployedHelmFile := "testing/ownership/deployed-helm.yaml"
+	testDeployedOtherAppFile := "testing/ownership/deployed-other-app.yaml"
+
+	tests := []struct {
+		name string
+
+		checkOwnership bool
+		// deployed is the configuration of the deployed object, which does not exist if empty.
+		deployed string
+
+		wantErr string
+	}{{
+		name: "Object does not exist",
+
+		checkOwnership: true,
+	}, {
+		name: "Object managed by gke-deploy",
+
+		checkOwnership: true,
+		deployed:       testDeployedFile,
+	}, {
+		name: "Object without labels",
+
+		checkOwnership: true,
+		deployed:       testDeployedUnlabeledFile,
+	}, {
+		name: "Object managed by another manager",
+
+		checkOwnership: true,
+		deployed:       testDeployedHelmFile,
+
+		wantErr: "refusing to adopt 1 deployed objects",
+	}, {
+		name: "Object of another application",
+
+		checkOwnership: true,
+		deployed:       testDeployedOtherAppFile,
+
+		wantErr: "refusing to adopt 1 deployed objects",
+	}, {
+		name: "Adopt object managed by another manager",
+
+		deployed: testDeployedHelmFile,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var getResponses []testservices.GetResponse
+			if tc.checkOwnership {
+				if tc.deployed == "" {
+					getResponses = append(getResponses, testservices.GetResponse{Res: "", Err: testservices.NotFoundError("Deployment", "test-app")})
+				} else {
+					getResponses = append(getResponses, testservices.GetResponse{Res: string(fileContents(t, tc.deployed)), Err: nil})
+				}
+			}
+			if tc.wantErr == "" {
+				getResponses = append(getResponses, testservices.GetResponse{Res: string(fileContents(t, testDeploymentReadyFile)), Err: nil})
+			}
+			ks := &testservices.TestKubectl{
+				ApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {nil},
+				},
+				GetResponse: map[string]map[string][]testservices.GetResponse{
+					"Deployment": {
+						"test-app": getResponses,
+					},
+				},
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: ks,
+					OS:      &services.OS{},
+				},
+				CheckOwnership: tc.checkOwnership,
+			}
+
+			err := d.Apply(ctx, "", "", "", testDeploymentFile, "", 10*time.Second, false)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Apply(ctx, ..., %s, ...) = %v; want <nil>", testDeploymentFile, err)
+				}
+				if len(ks.ApplyFromStringResponse) != 0 {
+					t.Errorf("Apply(ctx, ..., %s, ...) did not apply all of the expected configs. got %v; want []", testDeploymentFile, ks.ApplyFromStringResponse)
+				}
+			} else {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("Apply(ctx, ..., %s, ...) = %v; want error containing %q", testDeploymentFile, err, tc.wantErr)
+				}
+				if len(ks.ApplyFromStringResponse) == 0 {
+					t.Errorf("Apply(ctx, ..., %s, ...) applied configs over objects owned by others", testDeploymentFile)
+				}
+			}
+			if len(ks.GetResponse) != 0 {
+				t.Errorf("Apply(ctx, ..., %s, ...) did not get all of the expected objects. got %v; want []", testDeploymentFile, ks.GetResponse)
+			}
+		})
+	}
+}
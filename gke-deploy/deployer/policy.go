@@ -0,0 +1,80 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/policy"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// Lint checks the objects in config against d.Policy, or the default policy if it is not set, and
+// prints the violations. If reportOutput is set, the report is saved to that file.
+func (d *Deployer) Lint(ctx context.Context, config, reportOutput string, recursive bool) (*policy.Report, error) {
+	objs, err := d.parseConfigs(ctx, config, recursive)
+	if err != nil {
+		return nil, err
+	}
+	d.printf("Configuration files to be used: %v\n\n", objs)
+
+	report, err := d.checkPolicy(objs)
+	if err != nil {
+		return nil, err
+	}
+	if reportOutput != "" {
+		if err := d.savePolicyReport(ctx, report, reportOutput); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// checkPolicy checks objects against d.Policy, or the default policy if it is not set, and prints the
+// violations.
+func (d *Deployer) checkPolicy(objs resource.Objects) (*policy.Report, error) {
+	p := d.Policy
+	if p == nil {
+		p = policy.DefaultPolicy()
+	}
+
+	d.printf("Checking objects against policy.\n")
+	report, err := policy.Check(objs, d.PodTemplatePaths, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check objects against policy: %v", err)
+	}
+	for _, v := range report.Violations {
+		d.printf("  %s\n", v)
+	}
+	d.printf("Found %d policy violation(s) with error severity and %d with warning severity.\n\n", report.Errors, report.Warnings)
+	return report, nil
+}
+
+// savePolicyReport saves a report as JSON to filename.
+func (d *Deployer) savePolicyReport(ctx context.Context, report *policy.Report, filename string) error {
+	out, err := report.JSON()
+	if err != nil {
+		return err
+	}
+	if err := d.Clients.OS.MkdirAll(ctx, filepath.Dir(filename), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory of policy report %q: %v", filename, err)
+	}
+	if err := d.Clients.OS.WriteFile(ctx, filename, out, 0644); err != nil {
+		return fmt.Errorf("failed to save policy report to %q: %v", filename, err)
+	}
+	return nil
+}
+
+// policyViolationsError returns an error if a report has violations with error severity, unless
+// d.AllowPolicyViolations is set, in which case a warning is printed instead.
+func (d *Deployer) policyViolationsError(report *policy.Report) error {
+	if report.Errors == 0 {
+		return nil
+	}
+	if d.AllowPolicyViolations {
+		d.warnf("Ignoring %d policy violation(s) with error severity because policy violations are allowed", report.Errors)
+		return nil
+	}
+	return fmt.Errorf("found %d policy violation(s) with error severity", report.Errors)
+}
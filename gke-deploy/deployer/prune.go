@@ -0,0 +1,327 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+var (
+	// pruneVerbs are the verbs that the resources of objects to prune must support.
+	pruneVerbs = []string{"list", "delete"}
+
+	// clusterScopedKinds are the built-in kinds whose objects are not namespaced.
+	clusterScopedKinds = map[string]bool{
+		"APIService":                     true,
+		"ClusterRole":                    true,
+		"ClusterRoleBinding":             true,
+		"CustomResourceDefinition":       true,
+		"MutatingWebhookConfiguration":   true,
+		"Namespace":                      true,
+		"PersistentVolume":               true,
+		"PodSecurityPolicy":              true,
+		"PriorityClass":                  true,
+		"StorageClass":                   true,
+		"ValidatingWebhookConfiguration": true,
+	}
+
+	// prunableKinds are the kinds of objects that are pruned even if no objects of the kind are
+	// applied, like the default allowlist of `kubectl apply --prune`. Objects of other kinds,
+	// including custom resources, are only pruned if objects of the same kind are applied.
+	prunableKinds = map[string]bool{
+		"ClusterRole":             true,
+		"ClusterRoleBinding":      true,
+		"ConfigMap":               true,
+		"CronJob":                 true,
+		"DaemonSet":               true,
+		"Deployment":              true,
+		"HorizontalPodAutoscaler": true,
+		"Ingress":                 true,
+		"Job":                     true,
+		"Namespace":               true,
+		"NetworkPolicy":           true,
+		"PersistentVolume":        true,
+		"PersistentVolumeClaim":   true,
+		"Pod":                     true,
+		"PodDisruptionBudget":     true,
+		"ReplicaSet":              true,
+		"ReplicationController":   true,
+		"Role":                    true,
+		"RoleBinding":             true,
+		"Secret":                  true,
+		"Service":                 true,
+		"ServiceAccount":          true,
+		"StatefulSet":             true,
+	}
+
+	// controllerManagedKinds are the kinds of objects that controllers create with labels copied
+	// from other objects and without owner references, e.g., the Endpoints of a Service. They are
+	// never pruned, nor are they objects of an application in `wait` and `status`.
+	controllerManagedKinds = map[string]bool{
+		"EndpointSlice": true,
+		"Endpoints":     true,
+		"Event":         true,
+	}
+)
+
+// prune deletes objects from the cluster that are managed by gke-deploy and have the same
+// app.kubernetes.io/name label as any of objs, but are not in objs. Only objects of the kinds of
+// objs, including custom resources, and of prunableKinds are checked, and objects of
+// controllerManagedKinds are never pruned. Objects that have owner references (e.g., Pods created
+// by a ReplicaSet) are never pruned either, and cluster-scoped objects are only pruned if
+// d.PruneClusterScoped is true. In server dry run mode, the objects that would be
+// pruned are printed but not deleted.
+//
+// If live is true, objs are the deployed objects that were applied, whose namespaces are the ones
+// they were applied to, and namespace is ignored. Else, objs are the applied configs, and namespace
+// overrides the namespace of each object if it is not empty. Objects are only looked for in the
+// namespaces of objs, so objects of the application in a namespace that it is no longer deployed
+// to are not pruned.
+func (d *Deployer) prune(ctx context.Context, objs resource.Objects, namespace string, live bool) error {
+	appNames := objectAppNames(objs)
+	if len(appNames) == 0 {
+		return fmt.Errorf("no objects have the %s label, which is required to find objects to prune. This label can be set with the --app|-a flag in the prepare phase", appNameLabelKey)
+	}
+
+	applied, err := newAppliedObjects(objs, namespace, d.contextNamespace, live)
+	if err != nil {
+		return err
+	}
+	resources, err := cluster.GetAPIResources(ctx, true, pruneVerbs, d.Clients.Kubectl)
+	if err != nil {
+		return fmt.Errorf("failed to get kinds of objects to prune: %v", err)
+	}
+	namespacedResources := applied.prunableResources(resources)
+	var clusterScopedResources []string
+	if d.PruneClusterScoped {
+		resources, err := cluster.GetAPIResources(ctx, false, pruneVerbs, d.Clients.Kubectl)
+		if err != nil {
+			return fmt.Errorf("failed to get kinds of cluster-scoped objects to prune: %v", err)
+		}
+		clusterScopedResources = applied.prunableResources(resources)
+	}
+
+	var toPrune resource.Objects
+	pruning := make(map[string]bool)
+	for _, appName := range appNames {
+		selector := fmt.Sprintf("%s=%s,%s=%s", managedByLabelKey, managedByLabelValue, appNameLabelKey, appName)
+
+		var live resource.Objects
+		for _, ns := range sortedKeys(applied.searched) {
+			found, err := cluster.GetDeployedObjectsWithSelector(ctx, namespacedResources, selector, ns, d.Clients.Kubectl)
+			if err != nil {
+				return fmt.Errorf("failed to get deployed objects with selector %q in namespace %q: %v", selector, ns, err)
+			}
+			live = append(live, found...)
+		}
+		if d.PruneClusterScoped && len(clusterScopedResources) > 0 {
+			found, err := cluster.GetDeployedObjectsWithSelector(ctx, clusterScopedResources, selector, "", d.Clients.Kubectl)
+			if err != nil {
+				return fmt.Errorf("failed to get cluster-scoped deployed objects with selector %q: %v", selector, err)
+			}
+			live = append(live, found...)
+		}
+
+		for _, obj := range live {
+			if len(obj.GetOwnerReferences()) > 0 || !applied.prunable(resource.ObjectKind(obj)) {
+				continue
+			}
+			key, err := pruneKey(obj)
+			if err != nil {
+				return err
+			}
+			if applied.contains(obj) || pruning[key] {
+				continue
+			}
+			pruning[key] = true
+			toPrune = append(toPrune, obj)
+		}
+	}
+
+	if len(toPrune) == 0 {
+		d.printf("No objects to prune.\n")
+		return nil
+	}
+
+	if d.ServerDryRun {
+		d.printf("Objects that would be pruned:\n")
+		for _, obj := range toPrune {
+			d.printf("  %s\n", pruneDescription(obj))
+		}
+		return nil
+	}
+
+	for _, obj := range toPrune {
+		kind := resource.ObjectKind(obj)
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get name of object: %v", err)
+		}
+		ns, err := resource.ObjectNamespace(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get namespace of object: %v", err)
+		}
+		d.printf("Pruning %s\n", pruneDescription(obj))
+		if err := cluster.DeleteDeployedObject(ctx, kind, name, ns, d.Clients.Kubectl); err != nil {
+			return fmt.Errorf("failed to prune deployed object with kind %q and name %q: %v", kind, name, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedObjects identifies the objects that were applied, to tell which deployed objects must not
+// be pruned.
+type appliedObjects struct {
+	// namespaces maps the kind and name of each applied object to the namespaces it was applied to. An
+	// empty namespace is no namespace, for cluster-scoped objects, or the current context's namespace
+	// if it is not known.
+	namespaces map[string][]string
+	// searched are the namespaces to look for objects to prune in. An empty namespace is the
+	// current context's namespace.
+	searched map[string]bool
+	// kinds are the kinds of the applied objects.
+	kinds map[string]bool
+}
+
+// newAppliedObjects returns the applied objects of objs. If live is false, objs are configs, whose
+// namespace is overridden by namespace if it is not empty, and configs without a namespace are
+// applied to contextNamespace.
+func newAppliedObjects(objs resource.Objects, namespace, contextNamespace string, live bool) (*appliedObjects, error) {
+	a := &appliedObjects{
+		namespaces: make(map[string][]string),
+		searched:   make(map[string]bool),
+		kinds:      make(map[string]bool),
+	}
+	for _, obj := range objs {
+		key, err := kindName(obj)
+		if err != nil {
+			return nil, err
+		}
+		ns, err := resource.ObjectNamespace(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace of object: %v", err)
+		}
+		if !live && namespace != "" {
+			ns = namespace
+		}
+		// Deployed objects without a namespace are cluster-scoped. Configs without a namespace are
+		// applied to the current context's namespace, unless they are known to be cluster-scoped.
+		if !live && ns == "" && !clusterScopedKinds[resource.ObjectKind(obj)] {
+			ns = contextNamespace
+		}
+		a.namespaces[key] = append(a.namespaces[key], ns)
+		a.kinds[resource.ObjectKind(obj)] = true
+		if ns != "" || (!live && !clusterScopedKinds[resource.ObjectKind(obj)]) {
+			a.searched[ns] = true
+		}
+	}
+	return a, nil
+}
+
+// prunable returns true if objects of kind can be pruned, because objects of the kind are applied
+// or it is one of prunableKinds, and it is not one of controllerManagedKinds.
+func (a *appliedObjects) prunable(kind string) bool {
+	return (a.kinds[kind] || prunableKinds[kind]) && !controllerManagedKinds[kind]
+}
+
+// prunableResources returns the names of the resources whose objects can be pruned.
+func (a *appliedObjects) prunableResources(resources []cluster.APIResource) []string {
+	var names []string
+	for _, r := range resources {
+		if a.prunable(r.Kind) {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
+
+// contains returns true if a deployed object is one of the applied objects. Deployed objects
+// without a namespace are cluster-scoped, so they match applied objects of the same kind and name
+// regardless of the namespace they were applied with.
+func (a *appliedObjects) contains(obj *resource.Object) bool {
+	key, err := kindName(obj)
+	if err != nil {
+		return false
+	}
+	namespaces, ok := a.namespaces[key]
+	if !ok {
+		return false
+	}
+	liveNamespace := obj.GetNamespace()
+	if liveNamespace == "" {
+		return true
+	}
+	for _, ns := range namespaces {
+		if ns == "" || ns == liveNamespace {
+			return true
+		}
+	}
+	return false
+}
+
+// objectAppNames returns the sorted, unique values of the app.kubernetes.io/name label of objs.
+func objectAppNames(objs resource.Objects) []string {
+	names := make(map[string]bool)
+	for _, obj := range objs {
+		if name, ok := obj.GetLabels()[appNameLabelKey]; ok && name != "" {
+			names[name] = true
+		}
+	}
+	return sortedKeys(names)
+}
+
+// kindName returns a key that identifies an object by its kind and name. The API group is not part
+// of the key because the same objects can be served by multiple groups, e.g., Deployments applied
+// as extensions/v1beta1 are listed as apps/v1.
+func kindName(obj *resource.Object) (string, error) {
+	name, err := resource.ObjectName(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to get name of object: %v", err)
+	}
+	return fmt.Sprintf("%s/%s", resource.ObjectKind(obj), name), nil
+}
+
+// pruneKey returns a key that uniquely identifies a deployed object in a cluster by its kind,
+// namespace, and name.
+func pruneKey(obj *resource.Object) (string, error) {
+	key, err := kindName(obj)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s", obj.GetNamespace(), key), nil
+}
+
+func pruneDescription(obj *resource.Object) string {
+	kind := resource.ObjectKind(obj)
+	name, err := resource.ObjectName(obj)
+	if err != nil {
+		name = "UNKNOWN"
+	}
+	ns, err := resource.ObjectNamespace(obj)
+	if err != nil || ns == "" {
+		return fmt.Sprintf("object with kind %q and name %q", kind, name)
+	}
+	return fmt.Sprintf("object with kind %q and name %q in namespace %q", kind, name, ns)
+}
+
+func appendIfMissing(list []string, s string) []string {
+	for _, item := range list {
+		if item == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
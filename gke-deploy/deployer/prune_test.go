@@ -0,0 +1,511 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+const pruneSelector = "app.kubernetes.io/managed-by=gcp-cloud-build-deploy,app.kubernetes.io/name=test-app"
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+	testDeploymentNoNamespaceFile := "testing/prune/deployment-no-namespace.yaml"
+	testNamespaceFile := "testing/prune/namespace.yaml"
+	testDeployedFile := "testing/prune/deployed.yaml"
+	testDeployedEmptyFile := "testing/prune/deployed-empty.yaml"
+	testDeployedClusterScopedFile := "testing/prune/deployed-cluster-scoped.yaml"
+	testClusterIssuerFile := "testing/prune/cluster-issuer.yaml"
+	testDeployedClusterIssuerFile := "testing/prune/deployed-cluster-issuer.yaml"
+	testDeployedEndpointsFile := "testing/prune/deployed-endpoints.yaml"
+
+	tests := []struct {
+		name string
+
+		objs               resource.Objects
+		namespace          string
+		contextNamespace   string
+		live               bool
+		serverDryRun       bool
+		pruneClusterScoped bool
+		kubectl            testservices.TestKubectl
+	}{{
+		name: "Prune object no longer in configs",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"ConfigMap": {
+					"old-config": {nil},
+				},
+			},
+		},
+	}, {
+		name: "Controller-managed objects and objects of kinds that are not applied are not pruned",
+
+		// The Endpoints of the Service have the Service's labels, and no Certificates are applied.
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedEndpointsFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"Service": {
+					"old-service": {nil},
+				},
+			},
+		},
+	}, {
+		name: "Namespace overrides object namespace",
+
+		objs:      resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		namespace: "foobar",
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"foobar": {
+						{
+							Res: string(fileContents(t, testDeployedEmptyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Objects without a namespace are in the current context's namespace",
+
+		objs:             resource.Objects{newObjectFromFile(t, testDeploymentNoNamespaceFile)},
+		contextNamespace: "foobar",
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"foobar": {
+						{
+							Res: string(fileContents(t, testDeployedEmptyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Server dry run does not delete",
+
+		objs:         resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		serverDryRun: true,
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Nothing to prune",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedEmptyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}, {
+		name: "Prune cluster-scoped objects",
+
+		objs: resource.Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testNamespaceFile),
+		},
+		pruneClusterScoped: true,
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(true),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedEmptyFile)),
+							Err: nil,
+						},
+					},
+					"": {
+						{
+							Res: string(fileContents(t, testDeployedClusterScopedFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"ClusterRole": {
+					"old-role": {nil},
+				},
+			},
+		},
+	}, {
+		name: "Cluster-scoped custom object applied with namespace",
+
+		objs: resource.Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testClusterIssuerFile),
+		},
+		namespace:          "foobar",
+		pruneClusterScoped: true,
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(true),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"foobar": {
+						{
+							Res: string(fileContents(t, testDeployedEmptyFile)),
+							Err: nil,
+						},
+					},
+					"": {
+						{
+							Res: string(fileContents(t, testDeployedClusterIssuerFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"ClusterRole": {
+					"old-role": {nil},
+				},
+			},
+		},
+	}, {
+		name: "Deployed objects are in the namespaces they were applied to",
+
+		// The live cluster-scoped object has no namespace, so no namespace is searched for it.
+		objs: resource.Objects{
+			newObjectFromFile(t, testDeploymentFile),
+			newObjectFromFile(t, testClusterIssuerFile),
+		},
+		namespace:          "foobar",
+		live:               true,
+		pruneClusterScoped: true,
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(true),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedFile)),
+							Err: nil,
+						},
+					},
+					"": {
+						{
+							Res: string(fileContents(t, testDeployedClusterIssuerFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"ConfigMap": {
+					"old-config": {nil},
+				},
+				"ClusterRole": {
+					"old-role": {nil},
+				},
+			},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+				},
+				ServerDryRun:       tc.serverDryRun,
+				Prune:              true,
+				PruneClusterScoped: tc.pruneClusterScoped,
+				contextNamespace:   tc.contextNamespace,
+			}
+
+			if err := d.prune(ctx, tc.objs, tc.namespace, tc.live); err != nil {
+				t.Fatalf("prune(ctx, %v, %s, %t) = %v; want <nil>", tc.objs, tc.namespace, tc.live, err)
+			}
+
+			// Verify that all expected lists were executed
+			if len(tc.kubectl.GetWithSelectorResponse) != 0 {
+				t.Fatalf("prune(ctx, %v, %s) did not list all of the expected objects. got %v; want []", tc.objs, tc.namespace, tc.kubectl.GetWithSelectorResponse)
+			}
+
+			if len(tc.kubectl.APIResourcesResponse) != 0 {
+				t.Fatalf("prune(ctx, %v, %s) did not get all of the expected api resources. got %v; want []", tc.objs, tc.namespace, tc.kubectl.APIResourcesResponse)
+			}
+
+			// Verify that all expected deletes were executed
+			if len(tc.kubectl.DeleteResponse) != 0 {
+				t.Fatalf("prune(ctx, %v, %s) did not delete all of the expected objects. got %v; want []", tc.objs, tc.namespace, tc.kubectl.DeleteResponse)
+			}
+		})
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+	testDeployedFile := "testing/prune/deployed-foobar.yaml"
+
+	tests := []struct {
+		name string
+
+		serviceFile string
+
+		wantPrune bool
+		wantErr   bool
+	}{{
+		name: "Prune after objects are ready",
+
+		serviceFile: testServiceReadyFile,
+
+		wantPrune: true,
+	}, {
+		name: "Do not prune if objects are not ready",
+
+		serviceFile: testServiceUnreadyFile,
+
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubectl := &testservices.TestKubectl{
+				ApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {nil},
+					string(fileContents(t, testServiceFile)):    {nil},
+				},
+				GetResponse: map[string]map[string][]testservices.GetResponse{
+					"Deployment": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testDeploymentReadyFile)),
+								Err: nil,
+							},
+						},
+					},
+					"Service": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, tc.serviceFile)),
+								Err: nil,
+							},
+						},
+					},
+				},
+			}
+			if tc.wantPrune {
+				// The deployed objects are in namespace "foobar".
+				kubectl.APIResourcesResponse = apiResourcesResponse(false)
+				kubectl.GetWithSelectorResponse = map[string]map[string][]testservices.GetResponse{
+					pruneSelector: {
+						"foobar": {
+							{
+								Res: string(fileContents(t, testDeployedFile)),
+								Err: nil,
+							},
+						},
+					},
+				}
+				kubectl.DeleteResponse = map[string]map[string][]error{
+					"ConfigMap": {
+						"old-config": {nil},
+					},
+				}
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: kubectl,
+					OS:      &services.OS{},
+				},
+				Prune: true,
+			}
+
+			// Objects that are not ready on the first check time out immediately.
+			err := d.Apply(ctx, "", "", "", "testing/configs/deployment-and-service", "foobar", 0, false)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Fatalf("Apply(ctx, ...) = %v; want error %v", err, tc.wantErr)
+			}
+			if len(kubectl.GetWithSelectorResponse) != 0 {
+				t.Errorf("Apply(ctx, ...) did not list all of the expected objects. got %v; want []", kubectl.GetWithSelectorResponse)
+			}
+			if len(kubectl.DeleteResponse) != 0 {
+				t.Errorf("Apply(ctx, ...) did not delete all of the expected objects. got %v; want []", kubectl.DeleteResponse)
+			}
+		})
+	}
+}
+
+func TestPruneErrors(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+	testDeploymentUnlabeledFile := "testing/prune/deployment-unlabeled.yaml"
+	testDeployedFile := "testing/prune/deployed.yaml"
+
+	tests := []struct {
+		name string
+
+		objs    resource.Objects
+		kubectl testservices.TestKubectl
+
+		want string
+	}{{
+		name: "Objects do not have app name label",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentUnlabeledFile)},
+
+		want: "no objects have the app.kubernetes.io/name label",
+	}, {
+		name: "Failed to get deployed objects",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: "",
+							Err: fmt.Errorf("failed to get objects"),
+						},
+					},
+				},
+			},
+		},
+
+		want: "failed to get deployed objects with selector",
+	}, {
+		name: "Failed to delete object",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		kubectl: testservices.TestKubectl{
+			APIResourcesResponse: apiResourcesResponse(false),
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				pruneSelector: {
+					"default": {
+						{
+							Res: string(fileContents(t, testDeployedFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"ConfigMap": {
+					"old-config": {fmt.Errorf("failed to delete object")},
+				},
+			},
+		},
+
+		want: "failed to prune deployed object with kind \"ConfigMap\" and name \"old-config\"",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+				},
+				Prune: true,
+			}
+
+			err := d.prune(ctx, tc.objs, "", false)
+			if err == nil {
+				t.Fatalf("prune(ctx, %v, \"\", false) = <nil>; want error", tc.objs)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Unexpected error: got \"%v\", want substring %s", err, tc.want)
+			}
+		})
+	}
+}
+
+// apiResourcesResponse returns the responses of getting the namespaced resources of a cluster, and
+// its cluster-scoped resources if clusterScoped is true.
+func apiResourcesResponse(clusterScoped bool) map[bool][]testservices.GetResponse {
+	resp := map[bool][]testservices.GetResponse{
+		true: {
+			{
+				Res: "configmaps    cm       v1                        true   ConfigMap\n" +
+					"endpoints     ep       v1                        true   Endpoints\n" +
+					"deployments   deploy   apps/v1                   true   Deployment\n" +
+					"replicasets   rs       apps/v1                   true   ReplicaSet\n" +
+					"certificates  cert     cert-manager.io/v1alpha2  true   Certificate\n",
+				Err: nil,
+			},
+		},
+	}
+	if clusterScoped {
+		resp[false] = []testservices.GetResponse{
+			{
+				Res: "namespaces      ns   v1                          false   Namespace\n" +
+					"clusterroles         rbac.authorization.k8s.io/v1  false   ClusterRole\n" +
+					"clusterissuers       cert-manager.io/v1alpha2      false   ClusterIssuer\n",
+				Err: nil,
+			},
+		}
+	}
+	return resp
+}
+
+func newObjectFromFile(t *testing.T, filename string) *resource.Object {
+	obj, err := resource.DecodeFromYAML(context.Background(), fileContents(t, filename))
+	if err != nil {
+		t.Fatalf("failed to decode object from file %s: %v", filename, err)
+	}
+	return obj
+}
@@ -0,0 +1,192 @@
+package deployer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/release"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+)
+
+// DefaultReleaseHistoryMax is the default number of releases of an application that are kept in
+// the cluster.
+const DefaultReleaseHistoryMax = 10
+
+// History prints the releases of an application in a namespace, from oldest to newest.
+func (d *Deployer) History(ctx context.Context, clusterName, clusterLocation, clusterProject, appName, namespace string) error {
+	if _, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject); err != nil {
+		return err
+	}
+	if namespace == "" {
+		namespace = d.contextNamespace
+	}
+
+	releases, err := release.List(ctx, appName, namespace, d.Clients.Kubectl)
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		return fmt.Errorf("no releases of %q found in namespace %q", appName, namespace)
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 4, ' ', 0)
+	fmt.Fprintf(w, "REVISION\tDEPLOYED\tVERSION\tBUILD\tDESCRIPTION\tIMAGES\n")
+	for _, r := range releases {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Revision, r.DeployedAt.Format(time.RFC3339), orNone(r.Version), orNone(r.BuildID), orNone(r.Description), orNone(strings.Join(r.Images, ",")))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to flush writer: %v", err)
+	}
+	d.printf("%s", buf.String())
+	return nil
+}
+
+// RollbackToRevision redeploys the objects of a release of an application in a namespace, and
+// waits for them to be ready. If revision is 0, the release before the latest one is redeployed.
+// Redeploying a release records a new release.
+func (d *Deployer) RollbackToRevision(ctx context.Context, clusterName, clusterLocation, clusterProject, appName, namespace string, revision int, waitTimeout time.Duration) error {
+	d.printf("Rolling back %q.\n", appName)
+
+	target := ClusterTarget{
+		Name:     clusterName,
+		Location: clusterLocation,
+	}
+	clusterProject, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject)
+	if err != nil {
+		return err
+	}
+	target.Project = clusterProject
+	if namespace == "" {
+		namespace = d.contextNamespace
+	}
+
+	releases, err := release.List(ctx, appName, namespace, d.Clients.Kubectl)
+	if err != nil {
+		return err
+	}
+	if len(releases) == 0 {
+		return fmt.Errorf("no releases of %q found in namespace %q", appName, namespace)
+	}
+	r, err := release.Find(releases, revision)
+	if err != nil {
+		return fmt.Errorf("failed to find release to roll back to: %v", err)
+	}
+	objs, err := r.Objects(ctx)
+	if err != nil {
+		return err
+	}
+	d.printf("Redeploying revision %d: %v\n", r.Revision, objs)
+
+	rd := *d
+	rd.releaseDescription = fmt.Sprintf("Rolled back to revision %d", r.Revision)
+	// Objects are in the namespaces they were deployed to.
+	_, err = rd.applyObjects(ctx, target, objs, "", waitTimeout)
+	return err
+}
+
+// recordRelease stores a release of the applied objs of an application in the cluster, and deletes
+// the oldest releases if there are more than d.ReleaseHistoryMax. The release is stored in the
+// application's namespace (see applicationNamespace) with server-side apply, so that its compressed
+// manifests are not copied into a last-applied-configuration annotation, which would limit the size
+// of releases. Objects of multiple applications, or without the app.kubernetes.io/name label, are
+// not recorded.
+func (d *Deployer) recordRelease(ctx context.Context, objs resource.Objects, namespace string) error {
+	appNames := objectAppNames(objs)
+	if len(appNames) != 1 {
+		d.printf("Not recording release because objects must have the same %s label. This label can be set with the --app|-a flag in the prepare phase.\n", appNameLabelKey)
+		return nil
+	}
+	appName := appNames[0]
+
+	releaseNamespace, err := d.applicationNamespace(objs, namespace)
+	if err != nil {
+		return err
+	}
+	var version string
+	deployed := make(resource.Objects, 0, len(objs))
+	for _, obj := range objs {
+		o := &resource.Object{Unstructured: obj.DeepCopy()}
+		ns, err := d.effectiveNamespace(o, namespace)
+		if err != nil {
+			return err
+		}
+		if ns != "" {
+			o.SetNamespace(ns)
+		}
+		if v := o.GetLabels()[appVersionLabelKey]; v != "" && version == "" {
+			version = v
+		}
+		deployed = append(deployed, o)
+	}
+
+	releases, err := release.List(ctx, appName, releaseNamespace, d.Clients.Kubectl)
+	if err != nil {
+		return err
+	}
+	revision := 1
+	if len(releases) > 0 {
+		revision = releases[len(releases)-1].Revision + 1
+	}
+
+	r, err := release.New(appName, releaseNamespace, revision, deployed, d.PodTemplatePaths)
+	if err != nil {
+		return fmt.Errorf("failed to create release: %v", err)
+	}
+	r.Version = version
+	r.BuildID = d.BuildID
+	r.Description = d.releaseDescription
+	if r.Description == "" {
+		r.Description = "Deployed"
+	}
+	secret, err := r.ToSecret()
+	if err != nil {
+		return err
+	}
+	secretString, err := resource.EncodeToYAMLString(secret)
+	if err != nil {
+		return fmt.Errorf("failed to encode release to string: %v", err)
+	}
+	if err := cluster.ServerSideApplyConfigFromString(ctx, secretString, releaseNamespace, false, d.Clients.Kubectl); err != nil {
+		return fmt.Errorf("failed to save release: %v", err)
+	}
+	d.printf("Recorded revision %d of %q in namespace %q.\n", revision, appName, releaseNamespace)
+
+	if d.ReleaseHistoryMax > 0 {
+		d.deleteOldReleases(ctx, appName, releaseNamespace, append(releases, r))
+	}
+	return nil
+}
+
+// deleteOldReleases deletes the oldest of releases, which are sorted from oldest to newest, so that
+// at most d.ReleaseHistoryMax are kept. Releases that fail to be deleted are reported and left for
+// a later deployment to delete, and do not stop newer releases from being deleted.
+func (d *Deployer) deleteOldReleases(ctx context.Context, appName, namespace string, releases []*release.Release) {
+	if len(releases) <= d.ReleaseHistoryMax {
+		return
+	}
+	var failed []string
+	for _, r := range releases[:len(releases)-d.ReleaseHistoryMax] {
+		name := release.SecretName(appName, r.Revision)
+		err := cluster.DeleteDeployedObject(ctx, "Secret", name, namespace, d.Clients.Kubectl)
+		if err != nil && !services.IsNotFound(err) {
+			failed = append(failed, fmt.Sprintf("%q: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		d.warnf("Failed to delete old release(s) of %q in namespace %q, which will be deleted by the next deployment:\n  %s", appName, namespace, strings.Join(failed, "\n  "))
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
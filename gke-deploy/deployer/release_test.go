@@ -0,0 +1,339 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/release"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+// releaseKubectl records the release Secrets that are server-side applied, whose contents are not
+// deterministic. Other configs are applied with the embedded TestKubectl.
+type releaseKubectl struct {
+	*testservices.TestKubectl
+
+	applied []*release.Release
+}
+
+func (k *releaseKubectl) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	obj, err := resource.DecodeFromYAML(ctx, []byte(configString))
+	if err != nil {
+		return err
+	}
+	if resource.ObjectKind(obj) != "Secret" {
+		return k.TestKubectl.ServerSideApplyFromString(ctx, configString, namespace, fieldManager, forceConflicts)
+	}
+	if fieldManager != cluster.FieldManager {
+		return fmt.Errorf("release applied with field manager %q; want %q", fieldManager, cluster.FieldManager)
+	}
+	r, err := release.FromSecret(obj)
+	if err != nil {
+		return err
+	}
+	k.applied = append(k.applied, r)
+	return nil
+}
+
+func TestRecordRelease(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+	testDeploymentUnlabeledFile := "testing/prune/deployment-unlabeled.yaml"
+	testDeploymentNoNamespaceFile := "testing/prune/deployment-no-namespace.yaml"
+
+	tests := []struct {
+		name string
+
+		objs              resource.Objects
+		namespace         string
+		contextNamespace  string
+		existing          []int
+		releaseHistoryMax int
+		deleteResponse    map[string]map[string][]error
+
+		wantRevision  int
+		wantNamespace string
+		wantRecorded  bool
+	}{{
+		name: "First release",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+
+		wantRevision:  1,
+		wantNamespace: "default",
+		wantRecorded:  true,
+	}, {
+		name: "Release in namespace",
+
+		objs:      resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		namespace: "foobar",
+
+		wantRevision:  1,
+		wantNamespace: "foobar",
+		wantRecorded:  true,
+	}, {
+		name: "Release in current context's namespace",
+
+		objs:             resource.Objects{newObjectFromFile(t, testDeploymentNoNamespaceFile)},
+		contextNamespace: "foobar",
+
+		wantRevision:  1,
+		wantNamespace: "foobar",
+		wantRecorded:  true,
+	}, {
+		name: "Delete oldest releases",
+
+		objs:              resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		existing:          []int{2, 3, 1},
+		releaseHistoryMax: 2,
+		deleteResponse: map[string]map[string][]error{
+			"Secret": {
+				"gke-deploy.release.test-app.v1": {nil},
+				"gke-deploy.release.test-app.v2": {nil},
+			},
+		},
+
+		wantRevision:  4,
+		wantNamespace: "default",
+		wantRecorded:  true,
+	}, {
+		name: "Failure to delete an old release does not stop deleting others",
+
+		objs:              resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		existing:          []int{1, 2, 3, 4},
+		releaseHistoryMax: 2,
+		deleteResponse: map[string]map[string][]error{
+			"Secret": {
+				"gke-deploy.release.test-app.v1": {fmt.Errorf("failed to delete")},
+				"gke-deploy.release.test-app.v2": {&services.KubernetesError{Reason: metav1.StatusReasonNotFound, Code: 404, Message: "not found"}},
+				"gke-deploy.release.test-app.v3": {nil},
+			},
+		},
+
+		wantRevision:  5,
+		wantNamespace: "default",
+		wantRecorded:  true,
+	}, {
+		name: "Unlimited releases",
+
+		objs:     resource.Objects{newObjectFromFile(t, testDeploymentFile)},
+		existing: []int{1, 2},
+
+		wantRevision:  3,
+		wantNamespace: "default",
+		wantRecorded:  true,
+	}, {
+		name: "No app name",
+
+		objs: resource.Objects{newObjectFromFile(t, testDeploymentUnlabeledFile)},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var secrets []*resource.Object
+			for _, revision := range tc.existing {
+				secrets = append(secrets, newReleaseSecret(t, tc.wantNamespace, revision))
+			}
+			ks := &releaseKubectl{
+				TestKubectl: &testservices.TestKubectl{
+					DeleteResponse: tc.deleteResponse,
+				},
+			}
+			if tc.wantRecorded {
+				ks.GetWithSelectorResponse = map[string]map[string][]testservices.GetResponse{
+					release.Selector("test-app"): {
+						tc.wantNamespace: {
+							{
+								Res: releaseListYAML(t, secrets...),
+								Err: nil,
+							},
+						},
+					},
+				}
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: ks,
+				},
+				BuildID:           "build-1",
+				ReleaseHistoryMax: tc.releaseHistoryMax,
+				contextNamespace:  tc.contextNamespace,
+			}
+
+			if err := d.recordRelease(ctx, tc.objs, tc.namespace); err != nil {
+				t.Fatalf("recordRelease(ctx, %v, %s) = %v; want <nil>", tc.objs, tc.namespace, err)
+			}
+
+			if !tc.wantRecorded {
+				if len(ks.applied) != 0 {
+					t.Errorf("recordRelease(ctx, %v, %s) recorded %v; want no releases", tc.objs, tc.namespace, ks.applied)
+				}
+				return
+			}
+			if len(ks.applied) != 1 {
+				t.Fatalf("recordRelease(ctx, %v, %s) recorded %d releases; want 1", tc.objs, tc.namespace, len(ks.applied))
+			}
+			r := ks.applied[0]
+			if r.Name != "test-app" || r.Namespace != tc.wantNamespace || r.Revision != tc.wantRevision || r.BuildID != "build-1" || r.Description != "Deployed" {
+				t.Errorf("recordRelease(ctx, %v, %s) recorded %+v; want revision %d of test-app in namespace %s by build-1", tc.objs, tc.namespace, r, tc.wantRevision, tc.wantNamespace)
+			}
+			objs, err := r.Objects(ctx)
+			if err != nil {
+				t.Fatalf("failed to decode objects of recorded release: %v", err)
+			}
+			if len(objs) != 1 || objs[0].GetNamespace() != tc.wantNamespace {
+				t.Errorf("recordRelease(ctx, %v, %s) recorded objects %v; want objects in namespace %s", tc.objs, tc.namespace, objs, tc.wantNamespace)
+			}
+			if len(ks.DeleteResponse) != 0 {
+				t.Errorf("recordRelease(ctx, %v, %s) did not delete all of the expected releases. got %v; want []", tc.objs, tc.namespace, ks.DeleteResponse)
+			}
+		})
+	}
+}
+
+func TestRollbackToRevision(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/prune/deployment.yaml"
+
+	var secrets []*resource.Object
+	for _, revision := range []int{1, 2} {
+		secrets = append(secrets, newReleaseSecret(t, "default", revision))
+	}
+	ks := &releaseKubectl{
+		TestKubectl: &testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testDeploymentFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Deployment": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, "testing/deployment-ready.yaml")),
+							Err: nil,
+						},
+					},
+				},
+			},
+			GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+				release.Selector("test-app"): {
+					"default": {
+						{
+							Res: releaseListYAML(t, secrets...),
+							Err: nil,
+						},
+						{
+							Res: releaseListYAML(t, secrets...),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+	}
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: ks,
+			OS:      &services.OS{},
+		},
+		RecordRelease: true,
+	}
+
+	if err := d.RollbackToRevision(ctx, "", "", "", "test-app", "", 0, 10*time.Second); err != nil {
+		t.Fatalf("RollbackToRevision(ctx, ..., test-app, ...) = %v; want <nil>", err)
+	}
+	if len(ks.ApplyFromStringResponse) != 0 {
+		t.Errorf("RollbackToRevision(ctx, ..., test-app, ...) did not apply all of the expected configs. got %v; want []", ks.ApplyFromStringResponse)
+	}
+	if len(ks.applied) != 1 {
+		t.Fatalf("RollbackToRevision(ctx, ..., test-app, ...) recorded %d releases; want 1", len(ks.applied))
+	}
+	if r := ks.applied[0]; r.Revision != 3 || r.Description != "Rolled back to revision 1" {
+		t.Errorf("RollbackToRevision(ctx, ..., test-app, ...) recorded %+v; want revision 3 rolled back to revision 1", r)
+	}
+}
+
+func TestRollbackToRevisionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	secrets := []*resource.Object{newReleaseSecret(t, "default", 1)}
+
+	tests := []struct {
+		name string
+
+		revision int
+	}{{
+		name: "No previous revision",
+	}, {
+		name: "Missing revision",
+
+		revision: 2,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &testservices.TestKubectl{
+						GetWithSelectorResponse: map[string]map[string][]testservices.GetResponse{
+							release.Selector("test-app"): {
+								"default": {
+									{
+										Res: releaseListYAML(t, secrets...),
+										Err: nil,
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			if err := d.RollbackToRevision(ctx, "", "", "", "test-app", "", tc.revision, 10*time.Second); err == nil {
+				t.Errorf("RollbackToRevision(ctx, ..., test-app, ..., %d, ...) = <nil>; want error", tc.revision)
+			}
+		})
+	}
+}
+
+// newReleaseSecret returns the Secret of a revision of the test-app release of
+// testing/prune/deployment.yaml.
+func newReleaseSecret(t *testing.T, namespace string, revision int) *resource.Object {
+	r, err := release.New("test-app", namespace, revision, resource.Objects{newObjectFromFile(t, "testing/prune/deployment.yaml")}, nil)
+	if err != nil {
+		t.Fatalf("failed to create release: %v", err)
+	}
+	s, err := r.ToSecret()
+	if err != nil {
+		t.Fatalf("failed to encode release: %v", err)
+	}
+	return s
+}
+
+// releaseListYAML encodes objects as a YAML list, like the output of `kubectl get -o yaml`.
+func releaseListYAML(t *testing.T, objs ...*resource.Object) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: List\nitems:\n")
+	for _, obj := range objs {
+		s, err := resource.EncodeToYAMLString(obj)
+		if err != nil {
+			t.Fatalf("failed to encode object: %v", err)
+		}
+		for i, line := range strings.Split(strings.TrimSpace(s), "\n") {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			fmt.Fprintf(&b, "%s%s\n", prefix, line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,281 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/gcs"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+const (
+	// ResultsStatusSucceeded is the status of a deployment that succeeded.
+	ResultsStatusSucceeded = "Succeeded"
+	// ResultsStatusFailed is the status of a deployment that failed.
+	ResultsStatusFailed = "Failed"
+
+	// objectStateUnknown is the state of objects that were not waited for, e.g., in server dry run
+	// mode.
+	objectStateUnknown = "Unknown"
+)
+
+// Results is a machine-readable record of a deployment, which is saved as JSON so that it can be
+// consumed by later build steps. All methods are no-ops on a nil *Results, so that results are only
+// recorded if requested.
+type Results struct {
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	StartTime time.Time       `json:"startTime"`
+	EndTime   time.Time       `json:"endTime"`
+	Phases    []*PhaseResult  `json:"phases"`
+	Objects   []*ObjectResult `json:"objects"`
+
+	mu sync.Mutex
+}
+
+// PhaseResult is the timing of a phase of a deployment, e.g., "prepare", "apply", or "wait".
+type PhaseResult struct {
+	Name            string    `json:"name"`
+	Cluster         string    `json:"cluster,omitempty"`
+	Location        string    `json:"location,omitempty"`
+	StartTime       time.Time `json:"startTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+
+	done bool
+}
+
+// ObjectResult is the deployed state of an applied object.
+type ObjectResult struct {
+	Cluster   string `json:"cluster,omitempty"`
+	Location  string `json:"location,omitempty"`
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	// State is "Ready", "NotReady", "Failed", or "Unknown" if the object was not waited for.
+	State string `json:"state"`
+	// TimeToReadySeconds is how long it took for the object to be ready after objects were applied.
+	TimeToReadySeconds float64 `json:"timeToReadySeconds,omitempty"`
+	// Addresses are the cluster IP and load balancer IPs or hostnames of Services and Ingresses.
+	Addresses []string `json:"addresses,omitempty"`
+	// Images are the images of the containers in the object's pod template, which are pinned to
+	// digests if they were resolved while preparing.
+	Images []string `json:"images,omitempty"`
+}
+
+// NewResults creates Results of a deployment that starts now.
+func NewResults() *Results {
+	return &Results{
+		StartTime: time.Now(),
+		Phases:    []*PhaseResult{},
+		Objects:   []*ObjectResult{},
+	}
+}
+
+// startPhase records the start of a phase of deploying to a cluster, which is empty if the phase is
+// not specific to a cluster. It returns a function that records the end of the phase. Phases that
+// have not ended when the results are finished end at the same time.
+func (r *Results) startPhase(name string, target ClusterTarget) func() {
+	if r == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := &PhaseResult{
+		Name:      name,
+		Cluster:   target.Name,
+		Location:  target.Location,
+		StartTime: time.Now(),
+	}
+	r.Phases = append(r.Phases, p)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.endPhase(p, time.Now())
+	}
+}
+
+func (r *Results) endPhase(p *PhaseResult, end time.Time) {
+	if p.done {
+		return
+	}
+	p.DurationSeconds = roundSeconds(end.Sub(p.StartTime))
+	p.done = true
+}
+
+// addObjects records the deployed states of objects deployed to a cluster. readyAfter maps the
+// readiness keys of objects to how long it took for them to be ready. If waited is false, the
+// objects were not waited for and their states are unknown. The images of objects are those of
+// their pod templates, which are found with paths. namespaceOf returns the namespace of each object.
+func (r *Results) addObjects(ctx context.Context, target ClusterTarget, objs resource.Objects, paths resource.PodTemplatePaths, namespaceOf func(*resource.Object) (string, error), readyAfter map[string]time.Duration, waited bool) error {
+	if r == nil {
+		return nil
+	}
+	var results []*ObjectResult
+	for _, obj := range objs {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return fmt.Errorf("failed to get name of object: %v", err)
+		}
+		objNamespace, err := namespaceOf(obj)
+		if err != nil {
+			return err
+		}
+		or := &ObjectResult{
+			Cluster:   target.Name,
+			Location:  target.Location,
+			Group:     gvk.Group,
+			Version:   gvk.Version,
+			Kind:      gvk.Kind,
+			Namespace: objNamespace,
+			Name:      name,
+			State:     objectStateUnknown,
+		}
+		if waited {
+			state, _, err := resource.CheckReady(ctx, obj)
+			if err != nil {
+				return fmt.Errorf("failed to check if deployed object with kind %q and name %q is ready: %v", gvk.Kind, name, err)
+			}
+			or.State = state.String()
+			or.Ready = state == resource.Ready
+			if dur, ok := readyAfter[readinessKey(gvk.Kind, name, objNamespace)]; ok {
+				or.TimeToReadySeconds = roundSeconds(dur)
+			}
+		}
+		or.Addresses = objectAddresses(obj)
+		if err := resource.UpdateContainerImages(ctx, resource.Objects{obj}, paths, func(_ *resource.Object, _, image string) (string, error) {
+			or.Images = append(or.Images, image)
+			return image, nil
+		}); err != nil {
+			return fmt.Errorf("failed to get images of deployed object with kind %q and name %q: %v", gvk.Kind, name, err)
+		}
+		results = append(results, or)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Objects = append(r.Objects, results...)
+	return nil
+}
+
+// finish records the end of a deployment, which failed if err is not nil.
+func (r *Results) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.EndTime = time.Now()
+	for _, p := range r.Phases {
+		r.endPhase(p, r.EndTime)
+	}
+	r.Status = ResultsStatusSucceeded
+	r.Error = ""
+	if err != nil {
+		r.Status = ResultsStatusFailed
+		r.Error = err.Error()
+	}
+}
+
+// JSON returns the results encoded as indented JSON.
+func (r *Results) JSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode deployment results: %v", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// SaveResults records the end of the deployment, which failed if deployErr is not nil, and saves the
+// results of d.Results as JSON to filename. Prefix filename with "gs://" to save the results to GCS.
+func (d *Deployer) SaveResults(ctx context.Context, filename string, deployErr error) error {
+	if d.Results == nil {
+		return fmt.Errorf("deployment results were not recorded")
+	}
+	d.Results.finish(deployErr)
+	out, err := d.Results.JSON()
+	if err != nil {
+		return err
+	}
+
+	gcsPath := ""
+	if strings.HasPrefix(filename, "gs://") {
+		tmpDir, err := d.Clients.OS.TempDir(ctx, "", k8sConfigStagingDir)
+		if err != nil {
+			return fmt.Errorf("failed to create tmp directory: %v", err)
+		}
+		defer d.Clients.OS.RemoveAll(ctx, tmpDir)
+		gcsPath = filename
+		filename = filepath.Join(tmpDir, filepath.Base(filename))
+	} else if err := d.Clients.OS.MkdirAll(ctx, filepath.Dir(filename), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory of results file %q: %v", filename, err)
+	}
+	if err := d.Clients.OS.WriteFile(ctx, filename, out, 0644); err != nil {
+		return fmt.Errorf("failed to save deployment results to %q: %v", filename, err)
+	}
+
+	if gcsPath != "" {
+		ss := &gcs.GCS{
+			GcsService: d.Clients.GCS,
+		}
+		if err := ss.Upload(ctx, filename, gcsPath); err != nil {
+			return fmt.Errorf("failed to upload deployment results to GCS %q: %v", gcsPath, err)
+		}
+	}
+	return nil
+}
+
+// objectAddresses returns the cluster IP and the load balancer IPs or hostnames of a Service or an
+// Ingress.
+func objectAddresses(obj *resource.Object) []string {
+	var addrs []string
+	switch resource.ObjectKind(obj) {
+	case "Service":
+		if ip, _, _ := unstructured.NestedString(obj.Object, "spec", "clusterIP"); ip != "" && ip != "None" {
+			addrs = append(addrs, ip)
+		}
+	case "Ingress":
+	default:
+		return nil
+	}
+	ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+	for _, ing := range ingress {
+		ingMap, ok := ing.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ip, _, _ := unstructured.NestedString(ingMap, "ip"); ip != "" {
+			addrs = append(addrs, ip)
+		}
+		if hostname, _, _ := unstructured.NestedString(ingMap, "hostname"); hostname != "" {
+			addrs = append(addrs, hostname)
+		}
+	}
+	return addrs
+}
+
+// roundSeconds returns a duration in seconds, rounded to the nearest 0.1 seconds.
+func roundSeconds(d time.Duration) float64 {
+	return d.Round(time.Second / 10).Seconds()
+}
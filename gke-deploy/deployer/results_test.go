@@ -0,0 +1,149 @@
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestApplySaveResults(t *testing.T) {
+	ctx := context.Background()
+
+	testDeploymentFile := "testing/deployment.yaml"
+	testServiceFile := "testing/service.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+
+	tmpDir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatalf("failed to create tmp directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	resultsFile := filepath.Join(tmpDir, "nested", "results.json")
+	gcsResultsFile := "gs://out/results.json"
+	var uploaded []byte
+
+	d := Deployer{
+		Clients: &services.Clients{
+			Kubectl: &testservices.TestKubectl{
+				ApplyFromStringResponse: map[string][]error{
+					string(fileContents(t, testDeploymentFile)): {nil},
+					string(fileContents(t, testServiceFile)):    {nil},
+				},
+				GetResponse: map[string]map[string][]testservices.GetResponse{
+					"Deployment": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testDeploymentReadyFile)),
+								Err: nil,
+							},
+						},
+					},
+					"Service": {
+						"test-app": []testservices.GetResponse{
+							{
+								Res: string(fileContents(t, testServiceReadyFile)),
+								Err: nil,
+							},
+						},
+					},
+				},
+			},
+			OS: &services.OS{},
+			GCS: &testservices.TestGcsService{CopyResponse: map[string]func(src, dst string) error{
+				gcsResultsFile: func(src, dst string) error {
+					var err error
+					uploaded, err = ioutil.ReadFile(src)
+					return err
+				},
+			}},
+		},
+		Results: NewResults(),
+	}
+
+	if err := d.Apply(ctx, "", "", "", "testing/configs/deployment-and-service", "", 10*time.Second, false); err != nil {
+		t.Fatalf("Apply(ctx, ...) = %v; want <nil>", err)
+	}
+	if err := d.SaveResults(ctx, resultsFile, nil); err != nil {
+		t.Fatalf("SaveResults(ctx, %s, <nil>) = %v; want <nil>", resultsFile, err)
+	}
+
+	got := &Results{}
+	if err := json.Unmarshal(fileContents(t, resultsFile), got); err != nil {
+		t.Fatalf("failed to decode results file %s: %v", resultsFile, err)
+	}
+	if got.Status != ResultsStatusSucceeded || got.Error != "" {
+		t.Errorf("SaveResults(ctx, %s, <nil>) saved status %q and error %q; want status %q and no error", resultsFile, got.Status, got.Error, ResultsStatusSucceeded)
+	}
+	if got.EndTime.Before(got.StartTime) {
+		t.Errorf("SaveResults(ctx, %s, <nil>) saved end time %v before start time %v", resultsFile, got.EndTime, got.StartTime)
+	}
+	var phases []string
+	for _, p := range got.Phases {
+		phases = append(phases, p.Name)
+	}
+	if diff := cmp.Diff([]string{"authorize", "apply", "wait"}, phases); diff != "" {
+		t.Errorf("SaveResults(ctx, %s, <nil>) saved phases with diff (-want +got):\n%s", resultsFile, diff)
+	}
+
+	// Times to be ready depend on how long the test takes.
+	for _, o := range got.Objects {
+		o.TimeToReadySeconds = 0
+	}
+	wantObjects := []*ObjectResult{{
+		Group:     "extensions",
+		Version:   "v1beta1",
+		Kind:      "Deployment",
+		Namespace: "foobar",
+		Name:      "test-app",
+		Ready:     true,
+		State:     "Ready",
+		Images:    []string{"gcr.io/cbd-test/test-app@sha256:1c7c73c049dafddcc82f61bd50c70a8061c301bb63065fca6cff1f1ef10b9afc"},
+	}, {
+		Version:   "v1",
+		Kind:      "Service",
+		Namespace: "foobar",
+		Name:      "test-app",
+		Ready:     true,
+		State:     "Ready",
+		Addresses: []string{"10.31.246.96", "34.74.85.152"},
+	}}
+	if diff := cmp.Diff(wantObjects, got.Objects); diff != "" {
+		t.Errorf("SaveResults(ctx, %s, <nil>) saved objects with diff (-want +got):\n%s", resultsFile, diff)
+	}
+
+	deployErr := fmt.Errorf("failed to apply deployment")
+	if err := d.SaveResults(ctx, gcsResultsFile, deployErr); err != nil {
+		t.Fatalf("SaveResults(ctx, %s, %v) = %v; want <nil>", gcsResultsFile, deployErr, err)
+	}
+	got = &Results{}
+	if err := json.Unmarshal(uploaded, got); err != nil {
+		t.Fatalf("failed to decode uploaded results file: %v", err)
+	}
+	if got.Status != ResultsStatusFailed || got.Error != deployErr.Error() {
+		t.Errorf("SaveResults(ctx, %s, %v) saved status %q and error %q; want status %q and error %q", gcsResultsFile, deployErr, got.Status, got.Error, ResultsStatusFailed, deployErr)
+	}
+}
+
+func TestSaveResultsErrors(t *testing.T) {
+	ctx := context.Background()
+
+	d := Deployer{
+		Clients: &services.Clients{
+			OS: &services.OS{},
+		},
+	}
+	if err := d.SaveResults(ctx, "results.json", nil); err == nil {
+		t.Errorf("SaveResults(ctx, results.json, <nil>) without recorded results = <nil>; want error")
+	}
+}
@@ -0,0 +1,98 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// snapshot is the state of an object in the cluster before it is applied.
+type snapshot struct {
+	kind      string
+	name      string
+	namespace string
+	// obj is the configuration that was previously applied to the object, or nil if the object did
+	// not exist in the cluster before it was applied. Re-applying it only restores the fields that
+	// were previously applied, so fields owned by other managers are left as is.
+	obj *resource.Object
+}
+
+// takeSnapshots saves the current state of each of objs in the cluster, which is taken from live. If
+// namespace is not empty, it overrides the namespace of each object.
+func (d *Deployer) takeSnapshots(objs resource.Objects, namespace string, live liveObjects) ([]*snapshot, error) {
+	snapshots := make([]*snapshot, 0, len(objs))
+	for _, obj := range objs {
+		kind := resource.ObjectKind(obj)
+		name, err := resource.ObjectName(obj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get name of object: %v", err)
+		}
+		objNamespace, err := d.effectiveNamespace(obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		s := &snapshot{
+			kind:      kind,
+			name:      name,
+			namespace: objNamespace,
+		}
+		deployedObj := live.get(kind, name, objNamespace)
+		if deployedObj != nil {
+			s.obj, err = resource.PreviouslyAppliedConfig(deployedObj, obj, cluster.FieldManager, d.ServerSideApply)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get previously applied configuration of deployed object with kind %q and name %q: %v", kind, name, err)
+			}
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// rollback restores the cluster to the state saved in snapshots. Objects that existed before
+// applying are re-applied with their previously applied configuration, and objects that did not exist are deleted. It
+// then waits for the restored objects to be ready.
+func (d *Deployer) rollback(ctx context.Context, snapshots []*snapshot, waitTimeout time.Duration) error {
+	d.printf("\nRolling back deployment.\n")
+
+	restored := make(resource.Objects, 0, len(snapshots))
+	for _, s := range snapshots {
+		if s.obj == nil {
+			d.printf("Deleting object with kind %q and name %q because it did not exist before applying\n", s.kind, s.name)
+			if err := cluster.DeleteDeployedObject(ctx, s.kind, s.name, s.namespace, d.Clients.Kubectl); err != nil {
+				return fmt.Errorf("failed to delete object with kind %q and name %q: %v", s.kind, s.name, err)
+			}
+			continue
+		}
+		d.printf("Restoring previous state of object with kind %q and name %q\n", s.kind, s.name)
+		objString, err := resource.EncodeToYAMLString(s.obj)
+		if err != nil {
+			return fmt.Errorf("failed to encode obj to string")
+		}
+		if err := d.applyConfig(ctx, objString, s.namespace); err != nil {
+			return fmt.Errorf("failed to restore %s configuration with name %q to cluster: %v", s.kind, s.name, err)
+		}
+		restored = append(restored, s.obj)
+	}
+
+	result, err := d.waitForObjects(ctx, restored, "", waitTimeout)
+	if err != nil {
+		return err
+	}
+
+	d.printf("Finished rolling back deployment.\n\n")
+
+	if err := d.printSummary(ctx, result.objs); err != nil {
+		return err
+	}
+
+	if result.failure != "" {
+		return fmt.Errorf("rolled back %s", result.failure)
+	}
+	if result.timedOut {
+		return fmt.Errorf("timed out after %v while waiting for rolled back objects to be ready", waitTimeout)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestApplyRollbackOnFailure(t *testing.T) {
+	ctx := context.Background()
+
+	testServiceFile := "testing/service.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+
+	testServiceManagedFieldsFile := "testing/service-ready-managed-fields.yaml"
+
+	restoredService := encodedPreviouslyAppliedConfig(t, testServiceReadyFile, testServiceFile, false)
+	restoredManagedService := encodedPreviouslyAppliedConfig(t, testServiceManagedFieldsFile, testServiceFile, true)
+
+	tests := []struct {
+		name string
+
+		kubectl         testservices.TestKubectl
+		serverSideApply bool
+
+		want string
+	}{{
+		name: "Restore object that existed before applying",
+
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testServiceFile)): {nil},
+				restoredService:                          {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testServiceUnreadyFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+
+		want: "timed out after 0s while waiting for deployed objects to be ready, rolled back deployment to previously deployed objects",
+	}, {
+		name: "Restore fields owned by gke-deploy with server-side apply",
+
+		kubectl: testservices.TestKubectl{
+			ServerSideApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testServiceFile)): {nil},
+				restoredManagedService:                   {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: string(fileContents(t, testServiceManagedFieldsFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testServiceUnreadyFile)),
+							Err: nil,
+						}, {
+							Res: string(fileContents(t, testServiceReadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+		},
+		serverSideApply: true,
+
+		want: "timed out after 0s while waiting for deployed objects to be ready, rolled back deployment to previously deployed objects",
+	}, {
+		name: "Delete object that did not exist before applying",
+
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testServiceFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: testservices.NotFoundError("Service", "test-app"),
+						}, {
+							Res: string(fileContents(t, testServiceUnreadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"Service": {
+					"test-app": {nil},
+				},
+			},
+		},
+
+		want: "timed out after 0s while waiting for deployed objects to be ready, rolled back deployment to previously deployed objects",
+	}, {
+		name: "Failed to roll back",
+
+		kubectl: testservices.TestKubectl{
+			ApplyFromStringResponse: map[string][]error{
+				string(fileContents(t, testServiceFile)): {nil},
+			},
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: testservices.NotFoundError("Service", "test-app"),
+						}, {
+							Res: string(fileContents(t, testServiceUnreadyFile)),
+							Err: nil,
+						},
+					},
+				},
+			},
+			DeleteResponse: map[string]map[string][]error{
+				"Service": {
+					"test-app": {fmt.Errorf("failed to delete object")},
+				},
+			},
+		},
+
+		want: "timed out after 0s while waiting for deployed objects to be ready, and failed to roll back deployment: failed to delete object with kind \"Service\" and name \"test-app\"",
+	}, {
+		name: "Failed to save state of deployed objects",
+
+		kubectl: testservices.TestKubectl{
+			GetResponse: map[string]map[string][]testservices.GetResponse{
+				"Service": {
+					"test-app": []testservices.GetResponse{
+						{
+							Res: "",
+							Err: fmt.Errorf("failed to get object"),
+						},
+					},
+				},
+			},
+		},
+
+		want: "failed to save state of deployed objects",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: &tc.kubectl,
+					OS:      &services.OS{},
+				},
+				RollbackOnFailure: true,
+				ServerSideApply:   tc.serverSideApply,
+			}
+
+			err := d.Apply(ctx, "", "", "", "testing/configs/service.yaml", "default", 0*time.Minute, false)
+			if err == nil {
+				t.Fatalf("Apply(ctx, testing/configs/service.yaml) = <nil>; want error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Unexpected error: got \"%v\", want substring %s", err, tc.want)
+			}
+
+			// Verify that all expected applies were actually applied
+			if len(tc.kubectl.ApplyFromStringResponse) != 0 {
+				t.Fatalf("Apply(ctx, testing/configs/service.yaml) did not apply all of the expected configs. got %v; want []", tc.kubectl.ApplyFromStringResponse)
+			}
+
+			// Verify that all expected server-side applies were actually applied
+			if len(tc.kubectl.ServerSideApplyFromStringResponse) != 0 {
+				t.Fatalf("Apply(ctx, testing/configs/service.yaml) did not server-side apply all of the expected configs. got %v; want []", tc.kubectl.ServerSideApplyFromStringResponse)
+			}
+
+			// Verify that all expected gets were executed
+			if len(tc.kubectl.GetResponse) != 0 {
+				t.Fatalf("Apply(ctx, testing/configs/service.yaml) did not get all of the expected configs. got %v; want []", tc.kubectl.GetResponse)
+			}
+
+			// Verify that all expected deletes were executed
+			if len(tc.kubectl.DeleteResponse) != 0 {
+				t.Fatalf("Apply(ctx, testing/configs/service.yaml) did not delete all of the expected objects. got %v; want []", tc.kubectl.DeleteResponse)
+			}
+		})
+	}
+}
+
+func encodedPreviouslyAppliedConfig(t *testing.T, deployedFilename, configFilename string, serverSide bool) string {
+	obj, err := resource.PreviouslyAppliedConfig(newObjectFromFile(t, deployedFilename), newObjectFromFile(t, configFilename), "gke-deploy", serverSide)
+	if err != nil {
+		t.Fatalf("failed to get previously applied configuration from file %s: %v", deployedFilename, err)
+	}
+	s, err := resource.EncodeToYAMLString(obj)
+	if err != nil {
+		t.Fatalf("failed to encode object from file %s: %v", deployedFilename, err)
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+package deployer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/cluster"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/core/resource"
+)
+
+// AppSelector returns the label selector of the objects of an application.
+func AppSelector(appName string) string {
+	return fmt.Sprintf("%s=%s", appNameLabelKey, appName)
+}
+
+// Wait waits for objects that were deployed by another tool to be ready, and prints a summary of
+// them. The objects are parsed from config, if set, or else they are the deployed objects that
+// match selector in namespace. If config is set and namespace is not empty, namespace overrides the
+// namespace of each object. It returns an error if any object is not ready before waitTimeout.
+func (d *Deployer) Wait(ctx context.Context, clusterName, clusterLocation, clusterProject, config, selector, namespace string, waitTimeout time.Duration, recursive bool) error {
+	target := ClusterTarget{
+		Name:     clusterName,
+		Location: clusterLocation,
+	}
+	if _, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject); err != nil {
+		return err
+	}
+
+	var objs resource.Objects
+	if config != "" {
+		parsed, err := d.parseConfigs(ctx, config, recursive)
+		if err != nil {
+			return err
+		}
+		objs = parsed
+	} else {
+		if namespace == "" {
+			namespace = d.contextNamespace
+		}
+		found, err := d.getAppObjects(ctx, selector, namespace)
+		if err != nil {
+			return err
+		}
+		objs = found
+	}
+	d.printf("Objects to wait for: %v\n", objs)
+
+	endWait := d.startPhase("wait", target)
+	result, err := d.waitForObjects(ctx, objs, namespace, waitTimeout)
+	if err != nil {
+		return err
+	}
+	endWait()
+
+	d.printf("Finished waiting.\n\n")
+	if err := d.printSummary(ctx, result.objs); err != nil {
+		return err
+	}
+
+	if result.failure != "" {
+		return errors.New(result.failure)
+	}
+	if result.timedOut {
+		return fmt.Errorf("timed out after %v while waiting for deployed objects to be ready", waitTimeout)
+	}
+	return nil
+}
+
+// Status prints a summary of the deployed objects that match selector in namespace, without
+// applying or waiting for anything.
+func (d *Deployer) Status(ctx context.Context, clusterName, clusterLocation, clusterProject, selector, namespace string) error {
+	if _, err := d.authorizeClusterAccess(ctx, clusterName, clusterLocation, clusterProject); err != nil {
+		return err
+	}
+	if namespace == "" {
+		namespace = d.contextNamespace
+	}
+
+	objs, err := d.getAppObjects(ctx, selector, namespace)
+	if err != nil {
+		return err
+	}
+	return d.printSummary(ctx, objs)
+}
+
+// getAppObjects gets the deployed objects that match selector in namespace, skipping objects that
+// are owned by other objects, e.g., the ReplicaSets and Pods of a Deployment, and objects of
+// controllerManagedKinds, e.g., the Endpoints of a Service. Every other namespaced kind of object
+// that the cluster can list is checked, including custom resources.
+func (d *Deployer) getAppObjects(ctx context.Context, selector, namespace string) (resource.Objects, error) {
+	resources, err := cluster.GetAPIResources(ctx, true, []string{"list"}, d.Clients.Kubectl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kinds of deployed objects: %v", err)
+	}
+	var names []string
+	for _, r := range resources {
+		if !controllerManagedKinds[r.Kind] {
+			names = append(names, r.Name)
+		}
+	}
+	found, err := cluster.GetDeployedObjectsWithSelector(ctx, names, selector, namespace, d.Clients.Kubectl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployed objects with selector %q in namespace %q: %v", selector, namespace, err)
+	}
+	var objs resource.Objects
+	for _, obj := range found {
+		if len(obj.GetOwnerReferences()) > 0 || controllerManagedKinds[resource.ObjectKind(obj)] {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("no deployed objects found with selector %q in namespace %q", selector, namespace)
+	}
+	return objs, nil
+}
@@ -0,0 +1,226 @@
+package deployer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/testservices"
+)
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+
+	testDeployedFile := "testing/status/deployed.yaml"
+	testDeployedEmptyFile := "testing/prune/deployed-empty.yaml"
+	testDeploymentReadyFile := "testing/deployment-ready.yaml"
+	testServiceReadyFile := "testing/service-ready.yaml"
+	testServiceUnreadyFile := "testing/service-unready.yaml"
+
+	tests := []struct {
+		name string
+
+		config    string
+		selector  string
+		namespace string
+		// deployedFile is the response of listing the objects that match selector.
+		deployedFile string
+		serviceFile  string
+
+		wantErr string
+	}{{
+		name: "Wait for objects in configs",
+
+		config:      "testing/configs/deployment-and-service",
+		namespace:   "foobar",
+		serviceFile: testServiceReadyFile,
+	}, {
+		name: "Wait for objects of application",
+
+		selector:     AppSelector("test-app"),
+		deployedFile: testDeployedFile,
+		serviceFile:  testServiceReadyFile,
+	}, {
+		name: "Objects not ready",
+
+		selector:     AppSelector("test-app"),
+		deployedFile: testDeployedFile,
+		serviceFile:  testServiceUnreadyFile,
+
+		wantErr: "timed out after 0s while waiting for deployed objects to be ready",
+	}, {
+		name: "No objects of application",
+
+		selector:     AppSelector("test-app"),
+		deployedFile: testDeployedEmptyFile,
+
+		wantErr: "no deployed objects found with selector \"app.kubernetes.io/name=test-app\" in namespace \"default\"",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			kubectl := &testservices.TestKubectl{
+				GetResponse: map[string]map[string][]testservices.GetResponse{},
+			}
+			if tc.deployedFile != "" {
+				kubectl.APIResourcesResponse = apiResourcesResponse(false)
+				kubectl.GetWithSelectorResponse = map[string]map[string][]testservices.GetResponse{
+					tc.selector: {
+						"default": {
+							{
+								Res: string(fileContents(t, tc.deployedFile)),
+								Err: nil,
+							},
+						},
+					},
+				}
+			}
+			if tc.serviceFile != "" {
+				kubectl.GetResponse["Deployment"] = map[string][]testservices.GetResponse{
+					"test-app": {
+						{
+							Res: string(fileContents(t, testDeploymentReadyFile)),
+							Err: nil,
+						},
+					},
+				}
+				kubectl.GetResponse["Service"] = map[string][]testservices.GetResponse{
+					"test-app": {
+						{
+							Res: string(fileContents(t, tc.serviceFile)),
+							Err: nil,
+						},
+					},
+				}
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			waitTimeout := 10 * time.Second
+			if tc.wantErr != "" {
+				waitTimeout = 0
+			}
+			err := d.Wait(ctx, "", "", "", tc.config, tc.selector, tc.namespace, waitTimeout, false)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("Wait(ctx, ...) = %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Wait(ctx, ...) = %v; want <nil>", err)
+			}
+			if len(kubectl.GetWithSelectorResponse) != 0 {
+				t.Errorf("Wait(ctx, ...) did not list all of the expected objects. got %v; want []", kubectl.GetWithSelectorResponse)
+			}
+			if len(kubectl.GetResponse) != 0 {
+				t.Errorf("Wait(ctx, ...) did not get all of the expected objects. got %v; want []", kubectl.GetResponse)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		namespace        string
+		contextNamespace string
+		deployedFile     string
+		apiResourcesErr  error
+
+		wantErr string
+	}{{
+		name: "Objects of application",
+
+		namespace:    "foobar",
+		deployedFile: "testing/status/deployed.yaml",
+	}, {
+		name: "Objects of application in current context's namespace",
+
+		contextNamespace: "foobar",
+		deployedFile:     "testing/status/deployed.yaml",
+	}, {
+		name: "Failed to get kinds of objects",
+
+		namespace:       "foobar",
+		apiResourcesErr: fmt.Errorf("forbidden"),
+
+		wantErr: "failed to get kinds of deployed objects: failed to get api resources: forbidden",
+	}, {
+		name: "No objects of application",
+
+		namespace:    "foobar",
+		deployedFile: "testing/prune/deployed-empty.yaml",
+
+		wantErr: "no deployed objects found with selector \"app.kubernetes.io/name=test-app\" in namespace \"foobar\"",
+	}, {
+		name: "Controller-managed objects are not objects of application",
+
+		// The Endpoints of a Service have the Service's labels.
+		namespace:    "foobar",
+		deployedFile: "testing/status/deployed-controller-managed.yaml",
+
+		wantErr: "no deployed objects found with selector \"app.kubernetes.io/name=test-app\" in namespace \"foobar\"",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Nothing is applied, and objects are not checked individually.
+			kubectl := &testservices.TestKubectl{
+				APIResourcesResponse:     apiResourcesResponse(false),
+				ContextNamespaceResponse: tc.contextNamespace,
+			}
+			if tc.apiResourcesErr != nil {
+				kubectl.APIResourcesResponse[true] = []testservices.GetResponse{
+					{
+						Res: "",
+						Err: tc.apiResourcesErr,
+					},
+				}
+			} else {
+				kubectl.GetWithSelectorResponse = map[string]map[string][]testservices.GetResponse{
+					"app.kubernetes.io/name=test-app": {
+						"foobar": {
+							{
+								Res: string(fileContents(t, tc.deployedFile)),
+								Err: nil,
+							},
+						},
+					},
+				}
+			}
+			d := Deployer{
+				Clients: &services.Clients{
+					Kubectl: kubectl,
+					OS:      &services.OS{},
+				},
+			}
+
+			err := d.Status(ctx, "", "", "", AppSelector("test-app"), tc.namespace)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("Status(ctx, ...) = %v; want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Status(ctx, ...) = %v; want <nil>", err)
+			}
+			if len(kubectl.GetWithSelectorResponse) != 0 {
+				t.Errorf("Status(ctx, ...) did not list the objects. got %v; want []", kubectl.GetWithSelectorResponse)
+			}
+			if len(kubectl.APIResourcesResponse) != 0 {
+				t.Errorf("Status(ctx, ...) did not get the kinds of objects. got %v; want []", kubectl.APIResourcesResponse)
+			}
+		})
+	}
+}
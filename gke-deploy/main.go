@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd"
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/cmd/common"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
+		var ee *common.ExitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.Code)
+		}
 		os.Exit(1)
 	}
 }
@@ -3,7 +3,9 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/exec"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -11,11 +13,13 @@ import (
 
 // Clients is a wrapper around HTTP clients and CLIs.
 type Clients struct {
-	Gcloud  GcloudService
-	Kubectl KubectlService
-	OS      OSService
-	Remote  RemoteService
-	GCS     GcsService
+	Gcloud    GcloudService
+	Kubectl   KubectlService
+	OS        OSService
+	Remote    RemoteService
+	GCS       GcsService
+	Kustomize KustomizeService
+	Helm      HelmService
 }
 
 // OSService is an interface for os operations.
@@ -39,7 +43,24 @@ type GcloudService interface {
 type KubectlService interface {
 	Apply(ctx context.Context, filename, namespace string) error
 	ApplyFromString(ctx context.Context, configString, namespace string) error
+	ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error
 	Get(ctx context.Context, kind, name, namespace, format string, ignoreNotFound bool) (string, error)
+	GetWithSelector(ctx context.Context, kinds, selector, namespace, format string) (string, error)
+	GetEvents(ctx context.Context, kind, name, namespace, format string) (string, error)
+	Delete(ctx context.Context, kind, name, namespace string) error
+	DeleteWithPreconditions(ctx context.Context, kind, name, namespace, uid, resourceVersion string) error
+	APIResources(ctx context.Context, namespaced bool, verbs []string) (string, error)
+	ContextNamespace(ctx context.Context) (string, error)
+}
+
+// KustomizeService is an interface for building kustomizations.
+type KustomizeService interface {
+	Build(ctx context.Context, dir string) (string, error)
+}
+
+// HelmService is an interface for rendering Helm charts.
+type HelmService interface {
+	Template(ctx context.Context, releaseName, chart, namespace string, valuesFiles, setValues []string) (string, error)
 }
 
 // RemoteService is an interface for github.com/google/go-containerregistry/pkg/v1/remote.
@@ -52,8 +73,27 @@ type GcsService interface {
 	Copy(ctx context.Context, src, dst string, recursive bool) error
 }
 
-// NewClients returns a new Clients object with default services.
-func NewClients(ctx context.Context, useGcloud, printCommands bool, serverDryRun bool) (*Clients, error) {
+// Values of how requests are sent to the Kubernetes API server.
+const (
+	// KubernetesBackendAuto runs kubectl if it is installed, else sends requests to the Kubernetes
+	// API server directly.
+	KubernetesBackendAuto = "auto"
+	// KubernetesBackendKubectl runs kubectl.
+	KubernetesBackendKubectl = "kubectl"
+	// KubernetesBackendAPI sends requests to the Kubernetes API server directly.
+	KubernetesBackendAPI = "api"
+)
+
+// NewClients returns a new Clients object with default services. kubernetesBackend is how requests
+// are sent to the Kubernetes API server, one of the KubernetesBackend* values.
+func NewClients(ctx context.Context, useGcloud, printCommands bool, serverDryRun bool, kubernetesBackend string) (*Clients, error) {
+	return NewClientsWithKubeconfig(ctx, "", useGcloud, printCommands, serverDryRun, kubernetesBackend)
+}
+
+// NewClientsWithKubeconfig returns a new Clients object with default services, whose cluster
+// credentials are written to and read from a kubeconfig file instead of the default one, so that
+// clusters can be accessed concurrently. If kubeconfig is empty, the default kubeconfig file is used.
+func NewClientsWithKubeconfig(ctx context.Context, kubeconfig string, useGcloud, printCommands bool, serverDryRun bool, kubernetesBackend string) (*Clients, error) {
 	oss, err := NewOS(ctx)
 	if err != nil {
 		return nil, err
@@ -64,9 +104,10 @@ func NewClients(ctx context.Context, useGcloud, printCommands bool, serverDryRun
 		if err != nil {
 			return nil, err
 		}
+		svc.kubeconfig = kubeconfig
 		gs = svc
 	}
-	ks, err := NewKubectl(ctx, printCommands, serverDryRun)
+	ks, err := newKubernetesBackend(ctx, kubernetesBackend, kubeconfig, printCommands, serverDryRun)
 	if err != nil {
 		return nil, err
 	}
@@ -80,11 +121,50 @@ func NewClients(ctx context.Context, useGcloud, printCommands bool, serverDryRun
 		return nil, err
 	}
 
+	kzs, err := NewKustomize(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hs, err := NewHelm(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Clients{
-		OS:      oss,
-		Gcloud:  gs,
-		Kubectl: ks,
-		Remote:  rs,
-		GCS:     ss,
+		OS:        oss,
+		Gcloud:    gs,
+		Kubectl:   ks,
+		Remote:    rs,
+		GCS:       ss,
+		Kustomize: kzs,
+		Helm:      hs,
 	}, nil
 }
+
+// newKubernetesBackend returns the KubectlService of kubernetesBackend. With KubernetesBackendAuto,
+// kubectl is used if it is installed, else requests are sent to the Kubernetes API server directly.
+func newKubernetesBackend(ctx context.Context, kubernetesBackend, kubeconfig string, printCommands, serverDryRun bool) (KubectlService, error) {
+	switch kubernetesBackend {
+	case KubernetesBackendAuto, "":
+		if _, err := exec.LookPath("kubectl"); err != nil {
+			return newKubernetesBackend(ctx, KubernetesBackendAPI, kubeconfig, printCommands, serverDryRun)
+		}
+		return newKubernetesBackend(ctx, KubernetesBackendKubectl, kubeconfig, printCommands, serverDryRun)
+	case KubernetesBackendKubectl:
+		svc, err := NewKubectl(ctx, printCommands, serverDryRun)
+		if err != nil {
+			return nil, fmt.Errorf("kubectl must be installed and in PATH to use the %q Kubernetes backend: %v", KubernetesBackendKubectl, err)
+		}
+		svc.kubeconfig = kubeconfig
+		return svc, nil
+	case KubernetesBackendAPI:
+		svc, err := NewKubernetes(ctx, printCommands, serverDryRun)
+		if err != nil {
+			return nil, err
+		}
+		svc.kubeconfig = kubeconfig
+		return svc, nil
+	}
+	return nil, fmt.Errorf("unknown Kubernetes backend %q, must be one of %q, %q, or %q", kubernetesBackend, KubernetesBackendAuto, KubernetesBackendKubectl, KubernetesBackendAPI)
+}
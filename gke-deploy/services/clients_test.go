@@ -0,0 +1,26 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewKubernetesBackend(t *testing.T) {
+	ctx := context.Background()
+
+	ks, err := newKubernetesBackend(ctx, KubernetesBackendAPI, "kubeconfig", false, true)
+	if err != nil {
+		t.Fatalf("newKubernetesBackend(ctx, %s) = _, %v; want <nil>", KubernetesBackendAPI, err)
+	}
+	k, ok := ks.(*Kubernetes)
+	if !ok {
+		t.Fatalf("newKubernetesBackend(ctx, %s) = %T; want *Kubernetes", KubernetesBackendAPI, ks)
+	}
+	if k.kubeconfig != "kubeconfig" || !k.serverDryRun {
+		t.Errorf("newKubernetesBackend(ctx, %s) = %+v; want kubeconfig and server dry run set", KubernetesBackendAPI, k)
+	}
+
+	if _, err := newKubernetesBackend(ctx, "foo", "", false, false); err == nil {
+		t.Errorf("newKubernetesBackend(ctx, foo) = _, <nil>; want error")
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubernetesError is an error returned by the Kubernetes API server, either directly or as reported
+// by kubectl. Use IsNotFound, IsForbidden, and IsConflict to check for specific errors, including
+// errors that wrap a KubernetesError.
+type KubernetesError struct {
+	Reason  metav1.StatusReason
+	Code    int32
+	Message string
+	// Causes has details about the error, e.g., the fields that conflict with other field managers
+	// when using server-side apply.
+	Causes []metav1.StatusCause
+}
+
+func (e *KubernetesError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns true if err is a KubernetesError because an object does not exist.
+func IsNotFound(err error) bool {
+	return ReasonForError(err) == metav1.StatusReasonNotFound
+}
+
+// IsForbidden returns true if err is a KubernetesError because the caller does not have permission
+// to perform the request.
+func IsForbidden(err error) bool {
+	return ReasonForError(err) == metav1.StatusReasonForbidden
+}
+
+// IsConflict returns true if err is a KubernetesError because the request conflicts with the state
+// of an object, e.g., the object was modified concurrently.
+func IsConflict(err error) bool {
+	return ReasonForError(err) == metav1.StatusReasonConflict
+}
+
+// FieldManagerConflicts returns the causes of err that are conflicts with other field managers
+// when using server-side apply. Each cause has the conflicting field and a message naming the
+// field manager that owns it.
+func FieldManagerConflicts(err error) []metav1.StatusCause {
+	var ke *KubernetesError
+	if !errors.As(err, &ke) || ke.Reason != metav1.StatusReasonConflict {
+		return nil
+	}
+	var conflicts []metav1.StatusCause
+	for _, c := range ke.Causes {
+		if c.Type == metav1.CauseTypeFieldManagerConflict {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+// ReasonForError returns the reason of the KubernetesError wrapped by err, or
+// metav1.StatusReasonUnknown if err does not wrap a KubernetesError.
+func ReasonForError(err error) metav1.StatusReason {
+	var ke *KubernetesError
+	if errors.As(err, &ke) {
+		return ke.Reason
+	}
+	return metav1.StatusReasonUnknown
+}
+
+// discoveryFailedMessage is printed by kubectl when some API groups cannot be discovered, e.g.,
+// unavailable aggregated APIs, in which case the resources of the other groups are still printed.
+const discoveryFailedMessage = "unable to retrieve the complete list of server APIs"
+
+var (
+	// kubectlErrorRegexp matches errors printed by kubectl for failed requests, e.g.,
+	// `Error from server (NotFound): deployments.apps "foo" not found`.
+	kubectlErrorRegexp = regexp.MustCompile(`Error from server \((\w+)\)`)
+
+	// kubectlApplyConflictRegexp matches the conflicts printed by `kubectl apply --server-side`,
+	// e.g., `conflict with "kube-controller-manager" using apps/v1: .spec.replicas`, or
+	// `conflicts with "kubectl" using apps/v1:` followed by a line for each field, e.g.,
+	// `- .spec.replicas`.
+	kubectlApplyConflictRegexp = regexp.MustCompile(`conflicts? with ("[^"]+"(?: using [^\s:]+)?):((?: \S+)|(?:\n- \S+)+)`)
+
+	reasonCodes = map[metav1.StatusReason]int32{
+		metav1.StatusReasonUnauthorized:  http.StatusUnauthorized,
+		metav1.StatusReasonForbidden:     http.StatusForbidden,
+		metav1.StatusReasonNotFound:      http.StatusNotFound,
+		metav1.StatusReasonAlreadyExists: http.StatusConflict,
+		metav1.StatusReasonConflict:      http.StatusConflict,
+		metav1.StatusReasonInvalid:       http.StatusUnprocessableEntity,
+		metav1.StatusReasonBadRequest:    http.StatusBadRequest,
+		metav1.StatusReasonTimeout:       http.StatusGatewayTimeout,
+	}
+)
+
+// kubectlError returns a KubernetesError if err contains an error from the API server as printed by
+// kubectl, else err.
+func kubectlError(err error) error {
+	if conflicts := kubectlApplyConflictRegexp.FindAllStringSubmatch(err.Error(), -1); conflicts != nil {
+		var causes []metav1.StatusCause
+		for _, c := range conflicts {
+			for _, field := range strings.Fields(strings.Replace(c[2], "\n- ", " ", -1)) {
+				causes = append(causes, metav1.StatusCause{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: "conflict with " + c[1],
+					Field:   field,
+				})
+			}
+		}
+		return &KubernetesError{
+			Reason:  metav1.StatusReasonConflict,
+			Code:    http.StatusConflict,
+			Message: err.Error(),
+			Causes:  causes,
+		}
+	}
+	m := kubectlErrorRegexp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	reason := metav1.StatusReason(m[1])
+	return &KubernetesError{
+		Reason:  reason,
+		Code:    reasonCodes[reason],
+		Message: err.Error(),
+	}
+}
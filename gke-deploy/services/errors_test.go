@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReasonForError(t *testing.T) {
+	tests := []struct {
+		name string
+
+		err error
+
+		want metav1.StatusReason
+	}{{
+		name: "KubernetesError",
+
+		err: &KubernetesError{Reason: metav1.StatusReasonNotFound},
+
+		want: metav1.StatusReasonNotFound,
+	}, {
+		name: "Wrapped KubernetesError",
+
+		err: fmt.Errorf("failed to apply: %w", &KubernetesError{Reason: metav1.StatusReasonForbidden}),
+
+		want: metav1.StatusReasonForbidden,
+	}, {
+		name: "kubectl error",
+
+		err: kubectlError(fmt.Errorf(`Error from server (Conflict): Operation cannot be fulfilled on deployments.apps "test-app": the object has been modified exit status 1`)),
+
+		want: metav1.StatusReasonConflict,
+	}, {
+		name: "Other error",
+
+		err: kubectlError(fmt.Errorf("exec: \"kubectl\": executable file not found in $PATH")),
+
+		want: metav1.StatusReasonUnknown,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ReasonForError(tc.err); got != tc.want {
+				t.Errorf("ReasonForError(%v) = %q; want %q", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFieldManagerConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+
+		err error
+
+		want []metav1.StatusCause
+	}{{
+		name: "kubectl single conflict",
+
+		err: kubectlError(fmt.Errorf(`error: Apply failed with 1 conflict: conflict with "kube-controller-manager" using apps/v1: .spec.replicas
+Please review the fields above--they currently have other managers. exit status 1`)),
+
+		want: []metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kube-controller-manager" using apps/v1`,
+			Field:   ".spec.replicas",
+		}},
+	}, {
+		name: "kubectl multiple conflicts",
+
+		err: kubectlError(fmt.Errorf(`error: Apply failed with 2 conflicts: conflicts with "kubectl" using apps/v1:
+- .spec.replicas
+- .spec.template.spec.containers[name="app"].image
+Please review the fields above--they currently have other managers. exit status 1`)),
+
+		want: []metav1.StatusCause{{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kubectl" using apps/v1`,
+			Field:   ".spec.replicas",
+		}, {
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: `conflict with "kubectl" using apps/v1`,
+			Field:   `.spec.template.spec.containers[name="app"].image`,
+		}},
+	}, {
+		name: "Not a conflict",
+
+		err: &KubernetesError{Reason: metav1.StatusReasonNotFound},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if diff := cmp.Diff(tc.want, FieldManagerConflicts(tc.err)); diff != "" {
+				t.Errorf("FieldManagerConflicts(%v) produced diff (-want +got):\n%s", tc.err, diff)
+			}
+		})
+	}
+}
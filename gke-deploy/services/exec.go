@@ -13,6 +13,12 @@ import (
 )
 
 func runCommandWithStdinRedirection(ctx context.Context, printCommand bool, name, input string, args ...string) (string, error) {
+	return runCommandWithStdinRedirectionAndEnv(ctx, printCommand, nil, name, input, args...)
+}
+
+// runCommandWithStdinRedirectionAndEnv is like runCommandWithStdinRedirection, but adds env to the
+// environment of the command.
+func runCommandWithStdinRedirectionAndEnv(ctx context.Context, printCommand bool, env []string, name, input string, args ...string) (string, error) {
 	if printCommand {
 		fmt.Printf("\n--------------------------------------------------------------------------------\n")
 		fmt.Printf("> Running command\n\n")
@@ -20,7 +26,13 @@ func runCommandWithStdinRedirection(ctx context.Context, printCommand bool, name
 		fmt.Printf("\n--------------------------------------------------------------------------------\n\n")
 	}
 	cmd := exec.CommandContext(ctx, name, args...)
-	cmd.Stderr = os.Stderr
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// Keep stderr in the returned error, as well as printing it, so that errors from the server can
+	// be inspected.
+	var buf bytes.Buffer
+	cmd.Stderr = io.MultiWriter(os.Stderr, &buf)
 	// Example taken from https://golang.org/src/os/exec/example_test.go
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -32,12 +44,17 @@ func runCommandWithStdinRedirection(ctx context.Context, printCommand bool, name
 	}()
 	out, err := cmd.Output()
 	if err != nil {
-		return "", err
+		return "", errors.Errorf("%s %s", buf.String(), err.Error())
 	}
 	return string(out), nil
 }
 
 func runCommand(ctx context.Context, printCommand bool, name string, args ...string) (string, error) {
+	return runCommandWithEnv(ctx, printCommand, nil, name, args...)
+}
+
+// runCommandWithEnv is like runCommand, but adds env to the environment of the command.
+func runCommandWithEnv(ctx context.Context, printCommand bool, env []string, name string, args ...string) (string, error) {
 	if printCommand {
 		fmt.Printf("\n--------------------------------------------------------------------------------\n")
 		fmt.Printf("> Running command\n\n")
@@ -45,12 +62,25 @@ func runCommand(ctx context.Context, printCommand bool, name string, args ...str
 		fmt.Printf("\n--------------------------------------------------------------------------------\n\n")
 	}
 	cmd := exec.CommandContext(ctx, name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	var buf bytes.Buffer
 	cmd.Stderr = &buf
 	cmd.Stdin = os.Stdin
 	out, err := cmd.Output()
 	if err != nil {
-		return "", errors.Errorf("%s %s", buf.String(), err.Error())
+		// Return the output too, which some commands still print when they partially fail.
+		return string(out), errors.Errorf("%s %s", buf.String(), err.Error())
 	}
 	return string(out), nil
 }
+
+// kubeconfigEnv returns the environment that makes kubectl and gcloud use a kubeconfig file, or nil if
+// kubeconfig is empty, in which case the KUBECONFIG environment variable or ~/.kube/config is used.
+func kubeconfigEnv(kubeconfig string) []string {
+	if kubeconfig == "" {
+		return nil
+	}
+	return []string{fmt.Sprintf("KUBECONFIG=%s", kubeconfig)}
+}
@@ -10,6 +10,9 @@ import (
 // Gcloud implements the GcloudService interface.
 type Gcloud struct {
 	printCommands bool
+	// kubeconfig is the kubeconfig file that cluster credentials are written to instead of the default
+	// one, if not empty.
+	kubeconfig string
 }
 
 // NewGcloud returns a new Gcloud object.
@@ -18,14 +21,14 @@ func NewGcloud(ctx context.Context, printCommands bool) (*Gcloud, error) {
 		return nil, err
 	}
 	return &Gcloud{
-		printCommands,
+		printCommands: printCommands,
 	}, nil
 }
 
 // ContainerClustersGetCredentials calls `gcloud container clusters get-credentials <clusterName> --zone=<clusterLocation> --project=<clusterProject>`.
 // Both region and zone can be passed to the --zone flag.
 func (g *Gcloud) ContainerClustersGetCredentials(ctx context.Context, clusterName, clusterLocation, clusterProject string) error {
-	if _, err := runCommand(ctx, g.printCommands, "gcloud", "container", "clusters", "get-credentials", clusterName, fmt.Sprintf("--zone=%s", clusterLocation), fmt.Sprintf("--project=%s", clusterProject), "--quiet"); err != nil {
+	if _, err := runCommandWithEnv(ctx, g.printCommands, kubeconfigEnv(g.kubeconfig), "gcloud", "container", "clusters", "get-credentials", clusterName, fmt.Sprintf("--zone=%s", clusterLocation), fmt.Sprintf("--project=%s", clusterProject), "--quiet"); err != nil {
 		return fmt.Errorf("command to get cluster credentials failed: %v", err)
 	}
 	return nil
@@ -0,0 +1,810 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// defaultKubeVersion is the Kubernetes version in .Capabilities of rendered charts, like in
+// `helm template`, which does not connect to a cluster.
+const defaultKubeVersion = "v1.20.0"
+
+// defaultAPIVersions are the API versions in .Capabilities.APIVersions of rendered charts.
+var defaultAPIVersions = []string{
+	"v1",
+	"admissionregistration.k8s.io/v1",
+	"apiextensions.k8s.io/v1",
+	"apps/v1",
+	"autoscaling/v1",
+	"autoscaling/v2beta1",
+	"autoscaling/v2beta2",
+	"batch/v1",
+	"batch/v1beta1",
+	"networking.k8s.io/v1",
+	"networking.k8s.io/v1beta1",
+	"policy/v1beta1",
+	"rbac.authorization.k8s.io/v1",
+	"storage.k8s.io/v1",
+}
+
+// Helm implements the HelmService interface.
+// Charts are rendered in-process like `helm template`, with Go templates and the sprig functions
+// that Helm provides, so helm does not need to be installed.
+type Helm struct{}
+
+// NewHelm returns a new Helm object.
+func NewHelm(ctx context.Context) (*Helm, error) {
+	return &Helm{}, nil
+}
+
+// Template renders chart like `helm template <releaseName> <chart> --namespace <namespace> -f <valuesFile>... --set <setValue>...`.
+// chart is a local chart directory or packaged chart (.tgz). The rendered templates, including those
+// of enabled subcharts, are returned as YAML documents preceded by a "# Source: <template>" comment.
+func (h *Helm) Template(ctx context.Context, releaseName, chart, namespace string, valuesFiles, setValues []string) (string, error) {
+	c, err := loadChart(chart)
+	if err != nil {
+		return "", fmt.Errorf("failed to load chart: %v", err)
+	}
+	vals := make(map[string]interface{})
+	for _, f := range valuesFiles {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("failed to read values file %q: %v", f, err)
+		}
+		fileVals := make(map[string]interface{})
+		if err := yaml.Unmarshal(data, &fileVals); err != nil {
+			return "", fmt.Errorf("failed to parse values file %q: %v", f, err)
+		}
+		vals = mergeValues(vals, fileVals)
+	}
+	for _, v := range setValues {
+		if err := parseSetValue(v, vals); err != nil {
+			return "", fmt.Errorf("failed to parse --set %q: %v", v, err)
+		}
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	release := map[string]interface{}{
+		"Name":      releaseName,
+		"Namespace": namespace,
+		"IsInstall": true,
+		"IsUpgrade": false,
+		"Revision":  1,
+		"Service":   "Helm",
+	}
+	rendered, err := renderChart(c, vals, release)
+	if err != nil {
+		return "", fmt.Errorf("failed to render chart: %v", err)
+	}
+	var b strings.Builder
+	for _, r := range rendered {
+		fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", r.name, r.content)
+	}
+	return b.String(), nil
+}
+
+// helmChart is a loaded Helm chart.
+type helmChart struct {
+	metadata  chartMetadata
+	values    map[string]interface{}
+	templates []chartFile
+	// files are the chart's files other than Chart.yaml, values.yaml, its templates, and its
+	// subcharts, which templates can read with .Files.
+	files     chartFiles
+	subcharts []*helmChart
+}
+
+type chartFile struct {
+	name string
+	data []byte
+}
+
+// chartMetadata is the contents of a chart's Chart.yaml file, which templates read with .Chart.
+type chartMetadata struct {
+	APIVersion   string             `json:"apiVersion"`
+	Name         string             `json:"name"`
+	Version      string             `json:"version"`
+	AppVersion   string             `json:"appVersion,omitempty"`
+	Description  string             `json:"description,omitempty"`
+	Type         string             `json:"type,omitempty"`
+	KubeVersion  string             `json:"kubeVersion,omitempty"`
+	Home         string             `json:"home,omitempty"`
+	Icon         string             `json:"icon,omitempty"`
+	Sources      []string           `json:"sources,omitempty"`
+	Keywords     []string           `json:"keywords,omitempty"`
+	Annotations  map[string]string  `json:"annotations,omitempty"`
+	Deprecated   bool               `json:"deprecated,omitempty"`
+	Dependencies []*chartDependency `json:"dependencies,omitempty"`
+}
+
+// chartDependency is a subchart in the dependencies of Chart.yaml.
+type chartDependency struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	Alias     string `json:"alias,omitempty"`
+}
+
+// loadChart loads a chart from a directory or packaged chart.
+func loadChart(name string) (*helmChart, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	var files []chartFile
+	if fi.IsDir() {
+		files, err = readChartDir(name)
+	} else {
+		var f *os.File
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files, err = readChartArchive(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newChart(files)
+}
+
+// readChartDir reads the files in a chart directory, with paths relative to dir.
+func readChartDir(dir string) ([]chartFile, error) {
+	var files []chartFile
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, chartFile{name: filepath.ToSlash(rel), data: data})
+		return nil
+	})
+	return files, err
+}
+
+// readChartArchive reads the files in a packaged chart, whose files are in a directory named after
+// the chart, with paths relative to that directory.
+func readChartArchive(r io.Reader) ([]chartFile, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var files []chartFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		parts := strings.SplitN(path.Clean(filepath.ToSlash(hdr.Name)), "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, chartFile{name: parts[1], data: data})
+	}
+	return files, nil
+}
+
+// newChart returns the chart of files, whose paths are relative to the chart's directory.
+func newChart(files []chartFile) (*helmChart, error) {
+	c := &helmChart{
+		values: make(map[string]interface{}),
+		files:  make(chartFiles),
+	}
+	subchartFiles := make(map[string][]chartFile)
+	var subchartArchives []chartFile
+	foundMetadata := false
+	for _, f := range files {
+		switch {
+		case f.name == "Chart.yaml":
+			if err := yaml.Unmarshal(f.data, &c.metadata); err != nil {
+				return nil, fmt.Errorf("failed to parse Chart.yaml: %v", err)
+			}
+			foundMetadata = true
+		case f.name == "values.yaml":
+			if err := yaml.Unmarshal(f.data, &c.values); err != nil {
+				return nil, fmt.Errorf("failed to parse values.yaml: %v", err)
+			}
+			if c.values == nil {
+				c.values = make(map[string]interface{})
+			}
+		case strings.HasPrefix(f.name, "templates/"):
+			c.templates = append(c.templates, f)
+		case strings.HasPrefix(f.name, "charts/"):
+			rest := strings.TrimPrefix(f.name, "charts/")
+			if i := strings.Index(rest, "/"); i >= 0 {
+				sub := rest[:i]
+				subchartFiles[sub] = append(subchartFiles[sub], chartFile{name: rest[i+1:], data: f.data})
+			} else if strings.HasSuffix(rest, ".tgz") {
+				subchartArchives = append(subchartArchives, f)
+			}
+		default:
+			c.files[f.name] = f.data
+		}
+	}
+	if !foundMetadata {
+		return nil, fmt.Errorf("chart has no Chart.yaml file")
+	}
+	if c.metadata.Name == "" {
+		return nil, fmt.Errorf("chart name in Chart.yaml cannot be empty")
+	}
+
+	var subNames []string
+	for sub := range subchartFiles {
+		subNames = append(subNames, sub)
+	}
+	sort.Strings(subNames)
+	for _, sub := range subNames {
+		s, err := newChart(subchartFiles[sub])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subchart %q: %v", sub, err)
+		}
+		c.subcharts = append(c.subcharts, s)
+	}
+	for _, f := range subchartArchives {
+		files, err := readChartArchive(bytes.NewReader(f.data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read subchart %q: %v", f.name, err)
+		}
+		s, err := newChart(files)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load subchart %q: %v", f.name, err)
+		}
+		c.subcharts = append(c.subcharts, s)
+	}
+	return c, nil
+}
+
+// renderedTemplate is the output of a chart's template.
+type renderedTemplate struct {
+	name    string
+	content string
+}
+
+// chartScope is a chart and the values it is rendered with.
+type chartScope struct {
+	chart  *helmChart
+	values map[string]interface{}
+	// path is the chart's template path prefix, e.g., "parent/charts/child".
+	path string
+}
+
+// renderChart renders the templates of c and its enabled subcharts with vals overriding the
+// chart's default values. Like Helm, templates whose names start with "_" only define named
+// templates, NOTES.txt is not rendered, and templates that render to whitespace are skipped.
+func renderChart(c *helmChart, vals map[string]interface{}, release map[string]interface{}) ([]renderedTemplate, error) {
+	var scopes []chartScope
+	if err := collectScopes(c, coalesceValues(c.values, vals), c.metadata.Name, &scopes); err != nil {
+		return nil, err
+	}
+
+	t := template.New("gotpl").Option("missingkey=zero")
+	includedNames := make(map[string]int)
+	t.Funcs(helmFuncMap(t, includedNames))
+	// Every template is parsed before any is rendered, so that named templates that are defined in
+	// any chart can be included.
+	var names []string
+	topValues := make(map[string]map[string]interface{})
+	for _, s := range scopes {
+		for _, f := range s.chart.templates {
+			name := s.path + "/" + f.name
+			if _, err := t.New(name).Parse(string(f.data)); err != nil {
+				return nil, fmt.Errorf("failed to parse template %q: %v", name, err)
+			}
+			names = append(names, name)
+			topValues[name] = map[string]interface{}{
+				"Values":       s.values,
+				"Release":      release,
+				"Chart":        s.chart.metadata.templateValues(),
+				"Files":        s.chart.files,
+				"Capabilities": defaultCapabilities(),
+				"Template": map[string]interface{}{
+					"Name":     name,
+					"BasePath": s.path + "/templates",
+				},
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var rendered []renderedTemplate
+	for _, name := range names {
+		base := path.Base(name)
+		if strings.HasPrefix(base, "_") || base == "NOTES.txt" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.ExecuteTemplate(&buf, name, topValues[name]); err != nil {
+			return nil, fmt.Errorf("failed to render template %q: %v", name, err)
+		}
+		out := strings.Replace(buf.String(), "<no value>", "", -1)
+		if strings.TrimSpace(out) == "" {
+			continue
+		}
+		rendered = append(rendered, renderedTemplate{name: name, content: strings.TrimSpace(out)})
+	}
+	return rendered, nil
+}
+
+// collectScopes adds the scope of c, rendered with vals, and of its enabled subcharts to scopes.
+// Like Helm, the values of a subchart are the parent's values under the subchart's name (or alias)
+// overriding the subchart's default values, and the global values are shared with subcharts.
+func collectScopes(c *helmChart, vals map[string]interface{}, chartPath string, scopes *[]chartScope) error {
+	*scopes = append(*scopes, chartScope{chart: c, values: vals, path: chartPath})
+	global, _ := vals["global"].(map[string]interface{})
+	for _, sub := range c.subcharts {
+		name := sub.metadata.Name
+		var dep *chartDependency
+		for _, d := range c.metadata.Dependencies {
+			if d.Name == sub.metadata.Name {
+				dep = d
+				break
+			}
+		}
+		if dep != nil {
+			if dep.Alias != "" {
+				name = dep.Alias
+			}
+			if !conditionEnabled(vals, dep.Condition) {
+				continue
+			}
+		}
+		parentVals, _ := vals[name].(map[string]interface{})
+		subVals := coalesceValues(sub.values, parentVals)
+		if global != nil {
+			subGlobal, _ := subVals["global"].(map[string]interface{})
+			subVals["global"] = coalesceValues(subGlobal, global)
+		}
+		vals[name] = subVals
+		if err := collectScopes(sub, subVals, chartPath+"/charts/"+name, scopes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conditionEnabled returns false if the first path of the comma-separated condition paths that is
+// set in vals is false.
+func conditionEnabled(vals map[string]interface{}, condition string) bool {
+	for _, p := range strings.Split(condition, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		var cur interface{} = vals
+		for _, key := range strings.Split(p, ".") {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				cur = nil
+				break
+			}
+			cur = m[key]
+		}
+		if b, ok := cur.(bool); ok {
+			return b
+		}
+	}
+	return true
+}
+
+// templateValues returns the fields of m that templates read with .Chart, e.g., .Chart.Name.
+func (m chartMetadata) templateValues() map[string]interface{} {
+	return map[string]interface{}{
+		"APIVersion":   m.APIVersion,
+		"Name":         m.Name,
+		"Version":      m.Version,
+		"AppVersion":   m.AppVersion,
+		"Description":  m.Description,
+		"Type":         m.Type,
+		"KubeVersion":  m.KubeVersion,
+		"Home":         m.Home,
+		"Icon":         m.Icon,
+		"Sources":      m.Sources,
+		"Keywords":     m.Keywords,
+		"Annotations":  m.Annotations,
+		"Deprecated":   m.Deprecated,
+		"Dependencies": m.Dependencies,
+	}
+}
+
+// apiVersionSet is the type of .Capabilities.APIVersions.
+type apiVersionSet []string
+
+// Has returns true if the set contains apiVersion.
+func (s apiVersionSet) Has(apiVersion string) bool {
+	for _, v := range s {
+		if v == apiVersion {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultCapabilities() map[string]interface{} {
+	version := strings.TrimPrefix(defaultKubeVersion, "v")
+	parts := strings.SplitN(version, ".", 3)
+	return map[string]interface{}{
+		"KubeVersion": map[string]interface{}{
+			"Version":    defaultKubeVersion,
+			"GitVersion": defaultKubeVersion,
+			"Major":      parts[0],
+			"Minor":      parts[1],
+		},
+		"APIVersions": apiVersionSet(defaultAPIVersions),
+	}
+}
+
+// chartFiles is the type of .Files, which maps the paths of a chart's files to their contents.
+type chartFiles map[string][]byte
+
+// Get returns the contents of a file as a string, or "" if it does not exist.
+func (f chartFiles) Get(name string) string {
+	return string(f[name])
+}
+
+// GetBytes returns the contents of a file, or nil if it does not exist.
+func (f chartFiles) GetBytes(name string) []byte {
+	return f[name]
+}
+
+// Lines returns the lines of a file.
+func (f chartFiles) Lines(name string) []string {
+	data, ok := f[name]
+	if !ok {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// Glob returns the files whose paths match pattern, with the syntax of path.Match.
+func (f chartFiles) Glob(pattern string) chartFiles {
+	matched := make(chartFiles)
+	for name, data := range f {
+		if ok, _ := path.Match(pattern, name); ok {
+			matched[name] = data
+		}
+	}
+	return matched
+}
+
+// AsConfig returns the files as the YAML data of a ConfigMap, keyed by their base names.
+func (f chartFiles) AsConfig() string {
+	m := make(map[string]string)
+	for name, data := range f {
+		m[path.Base(name)] = string(data)
+	}
+	out, err := yaml.Marshal(m)
+	if err != nil || len(m) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// AsSecrets returns the files as the base64-encoded YAML data of a Secret, keyed by their base
+// names.
+func (f chartFiles) AsSecrets() string {
+	m := make(map[string]string)
+	for name, data := range f {
+		m[path.Base(name)] = base64.StdEncoding.EncodeToString(data)
+	}
+	out, err := yaml.Marshal(m)
+	if err != nil || len(m) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(string(out), "\n")
+}
+
+// helmFuncMap returns the functions of Helm templates: the sprig functions other than those that
+// read environment variables, and Helm's include, tpl, required, lookup, and conversion functions.
+func helmFuncMap(t *template.Template, includedNames map[string]int) template.FuncMap {
+	f := sprig.TxtFuncMap()
+	delete(f, "env")
+	delete(f, "expandenv")
+
+	f["toYaml"] = func(v interface{}) string {
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSuffix(string(out), "\n")
+	}
+	f["fromYaml"] = func(s string) map[string]interface{} {
+		m := make(map[string]interface{})
+		if err := yaml.Unmarshal([]byte(s), &m); err != nil {
+			m["Error"] = err.Error()
+		}
+		return m
+	}
+	f["fromYamlArray"] = func(s string) []interface{} {
+		var a []interface{}
+		if err := yaml.Unmarshal([]byte(s), &a); err != nil {
+			a = []interface{}{err.Error()}
+		}
+		return a
+	}
+	f["toJson"] = func(v interface{}) string {
+		out, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(out)
+	}
+	f["fromJson"] = func(s string) map[string]interface{} {
+		m := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(s), &m); err != nil {
+			m["Error"] = err.Error()
+		}
+		return m
+	}
+	f["fromJsonArray"] = func(s string) []interface{} {
+		var a []interface{}
+		if err := json.Unmarshal([]byte(s), &a); err != nil {
+			a = []interface{}{err.Error()}
+		}
+		return a
+	}
+	f["required"] = func(warn string, val interface{}) (interface{}, error) {
+		if val == nil {
+			return val, errors.New(warn)
+		}
+		if s, ok := val.(string); ok && s == "" {
+			return val, errors.New(warn)
+		}
+		return val, nil
+	}
+	// Like `helm template`, nothing is looked up in a cluster.
+	f["lookup"] = func(apiVersion, kind, namespace, name string) (map[string]interface{}, error) {
+		return map[string]interface{}{}, nil
+	}
+	f["include"] = func(name string, data interface{}) (string, error) {
+		if includedNames[name] > 1000 {
+			return "", fmt.Errorf("rendering template has a nested reference name: %s", name)
+		}
+		includedNames[name]++
+		defer func() { includedNames[name]-- }()
+		var buf bytes.Buffer
+		if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	f["tpl"] = func(text string, data interface{}) (string, error) {
+		clone, err := t.Clone()
+		if err != nil {
+			return "", err
+		}
+		// The clone's include and tpl functions render with the clone, which has the templates
+		// defined in text.
+		clone.Funcs(helmFuncMap(clone, includedNames))
+		tt, err := clone.New("tpl").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("cannot parse template %q: %v", text, err)
+		}
+		var buf bytes.Buffer
+		if err := tt.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("error during tpl function execution for %q: %v", text, err)
+		}
+		return strings.Replace(buf.String(), "<no value>", "", -1), nil
+	}
+	return f
+}
+
+// mergeValues returns a copy of base with the values of override, recursively merging maps. Null
+// values in override are kept, like the values files and --set values merged by Helm, so that they
+// can delete the chart's default values when coalesced with coalesceValues.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	return overlayValues(base, override, false)
+}
+
+// coalesceValues returns a copy of the chart's default values with the values of vals, recursively
+// merging maps. Like Helm, a null value in vals deletes the key.
+func coalesceValues(defaults, vals map[string]interface{}) map[string]interface{} {
+	return overlayValues(defaults, vals, true)
+}
+
+func overlayValues(base, override map[string]interface{}, deleteNulls bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = overlayValues(m, nil, deleteNulls)
+		}
+		out[k] = v
+	}
+	for k, v := range override {
+		if v == nil && deleteNulls {
+			delete(out, k)
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			if baseMap, ok := out[k].(map[string]interface{}); ok {
+				out[k] = overlayValues(baseMap, m, deleteNulls)
+				continue
+			}
+			v = overlayValues(m, nil, deleteNulls)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// parseSetValue sets the values of s, in the format of `helm --set`, in vals, e.g.,
+// "a.b=c,d[0]=e,f={g,h}". Values are typed like Helm: true and false are booleans, integers are
+// int64s, and null deletes the chart's default value. Commas and dots in keys and values can be
+// escaped with "\".
+func parseSetValue(s string, vals map[string]interface{}) error {
+	for _, pair := range splitUnescaped(s, ',', true) {
+		if pair == "" {
+			continue
+		}
+		i := indexUnescaped(pair, '=')
+		if i < 0 {
+			return fmt.Errorf("key %q has no value", pair)
+		}
+		key, raw := pair[:i], pair[i+1:]
+		var value interface{}
+		if strings.HasPrefix(raw, "{") && strings.HasSuffix(raw, "}") {
+			list := []interface{}{}
+			for _, item := range splitUnescaped(raw[1:len(raw)-1], ',', false) {
+				list = append(list, typedSetValue(unescape(item)))
+			}
+			value = list
+		} else {
+			value = typedSetValue(unescape(raw))
+		}
+		if err := setValuePath(vals, splitUnescaped(key, '.', false), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setValuePath sets the value at the path of keys, which may have list indexes, e.g., "a[0]".
+func setValuePath(vals map[string]interface{}, keys []string, value interface{}) error {
+	key := unescape(keys[0])
+	index := -1
+	if i := strings.Index(key, "["); i >= 0 && strings.HasSuffix(key, "]") {
+		n, err := strconv.Atoi(key[i+1 : len(key)-1])
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid list index in %q", key)
+		}
+		key, index = key[:i], n
+	}
+	if key == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+	last := len(keys) == 1
+
+	if index < 0 {
+		if last {
+			vals[key] = value
+			return nil
+		}
+		next, ok := vals[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			vals[key] = next
+		}
+		return setValuePath(next, keys[1:], value)
+	}
+
+	list, _ := vals[key].([]interface{})
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	if last {
+		list[index] = value
+	} else {
+		next, ok := list[index].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			list[index] = next
+		}
+		if err := setValuePath(next, keys[1:], value); err != nil {
+			return err
+		}
+	}
+	vals[key] = list
+	return nil
+}
+
+// typedSetValue returns the typed value of a --set value.
+func typedSetValue(s string) interface{} {
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	// Like Helm, numbers with leading zeros are strings, e.g., zip codes.
+	if s == "0" || (s != "" && s[0] != '0') {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	}
+	return s
+}
+
+// splitUnescaped splits s at each sep that is not escaped with "\", nor inside "{...}" if
+// skipBraces is true. Escapes are kept in the returned parts.
+func splitUnescaped(s string, sep byte, skipBraces bool) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case skipBraces && s[i] == '{':
+			depth++
+		case skipBraces && s[i] == '}' && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// indexUnescaped returns the index of the first c in s that is not escaped with "\", or -1.
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testChart = "testing/chart/test-app"
+
+func TestHelmTemplate(t *testing.T) {
+	ctx := context.Background()
+
+	configMap := `---
+# Source: test-app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app-test-app
+data:
+  app.conf: |
+    port=8080
+  greeting: Hello, my-app
+`
+
+	tests := []struct {
+		name string
+
+		chart       string
+		namespace   string
+		valuesFiles []string
+		setValues   []string
+
+		want string
+	}{{
+		name: "Chart directory",
+
+		chart: testChart,
+
+		want: `---
+# Source: test-app/charts/cache/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app-cache
+  labels:
+    env: dev
+    size: 1Gi
+spec:
+  ports:
+  - port: 6379
+` + configMap + `---
+# Source: test-app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app-test-app
+  namespace: default
+  labels:
+    chart: test-app-0.1.0
+    env: dev
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: test-app
+        image: "my-image:latest"
+`,
+	}, {
+		name: "Values files and set values",
+
+		chart:       testChart,
+		namespace:   "foobar",
+		valuesFiles: []string{"testing/chart/values.yaml"},
+		setValues:   []string{"image=other-image:1.0,global.env=prod", "cache.enabled=false"},
+
+		want: configMap + `---
+# Source: test-app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app-test-app
+  namespace: foobar
+  labels:
+    chart: test-app-0.1.0
+    env: prod
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: test-app
+        image: "other-image:1.0"
+`,
+	}, {
+		name: "Subchart values",
+
+		chart:       testChart,
+		valuesFiles: []string{"testing/chart/values.yaml"},
+		setValues:   []string{"cache.port=6380"},
+
+		want: `---
+# Source: test-app/charts/cache/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: my-app-cache
+  labels:
+    env: dev
+    size: 2Gi
+spec:
+  ports:
+  - port: 6380
+` + configMap + `---
+# Source: test-app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-app-test-app
+  namespace: default
+  labels:
+    chart: test-app-0.1.0
+    env: dev
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: test-app
+        image: "my-image:latest"
+`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHelm(ctx)
+			if err != nil {
+				t.Fatalf("NewHelm(ctx) = _, %v; want <nil>", err)
+			}
+			got, err := h.Template(ctx, "my-app", tc.chart, tc.namespace, tc.valuesFiles, tc.setValues)
+			if err != nil {
+				t.Fatalf("Template(ctx, my-app, %s, %s, %v, %v) = _, %v; want <nil>", tc.chart, tc.namespace, tc.valuesFiles, tc.setValues, err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Template(ctx, my-app, %s, %s, %v, %v) produced diff (-want +got):\n%s", tc.chart, tc.namespace, tc.valuesFiles, tc.setValues, diff)
+			}
+		})
+	}
+}
+
+func TestHelmTemplatePackagedChart(t *testing.T) {
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "chart")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	packaged := filepath.Join(dir, "test-app-0.1.0.tgz")
+	writeTestChartArchive(t, testChart, packaged)
+
+	h, err := NewHelm(ctx)
+	if err != nil {
+		t.Fatalf("NewHelm(ctx) = _, %v; want <nil>", err)
+	}
+	want, err := h.Template(ctx, "my-app", testChart, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Template(ctx, my-app, %s) = _, %v; want <nil>", testChart, err)
+	}
+	got, err := h.Template(ctx, "my-app", packaged, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Template(ctx, my-app, %s) = _, %v; want <nil>", packaged, err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Template(ctx, my-app, %s) produced diff from chart directory (-want +got):\n%s", packaged, diff)
+	}
+}
+
+func TestHelmTemplateErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		chart     string
+		setValues []string
+	}{{
+		name: "Chart does not exist",
+
+		chart: "testing/chart/not-found",
+	}, {
+		name: "Not a chart",
+
+		chart: "testing/chart",
+	}, {
+		name: "Missing required value",
+
+		chart:     testChart,
+		setValues: []string{"image=null"},
+	}, {
+		name: "Set value without value",
+
+		chart:     testChart,
+		setValues: []string{"image"},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHelm(ctx)
+			if err != nil {
+				t.Fatalf("NewHelm(ctx) = _, %v; want <nil>", err)
+			}
+			if _, err := h.Template(ctx, "my-app", tc.chart, "", nil, tc.setValues); err == nil {
+				t.Errorf("Template(ctx, my-app, %s, %v) = _, <nil>; want error", tc.chart, tc.setValues)
+			}
+		})
+	}
+}
+
+func TestParseSetValue(t *testing.T) {
+	tests := []struct {
+		name string
+
+		base map[string]interface{}
+		set  string
+
+		want map[string]interface{}
+	}{{
+		name: "Nested keys and typed values",
+
+		set: "a.b=c,d=1,e=true,f=007",
+
+		want: map[string]interface{}{
+			"a": map[string]interface{}{"b": "c"},
+			"d": int64(1),
+			"e": true,
+			"f": "007",
+		},
+	}, {
+		name: "Lists and list indexes",
+
+		set: "a={x,y},b[1].c=z",
+
+		want: map[string]interface{}{
+			"a": []interface{}{"x", "y"},
+			"b": []interface{}{nil, map[string]interface{}{"c": "z"}},
+		},
+	}, {
+		name: "Escaped commas and dots",
+
+		set: `a\.b=c\,d`,
+
+		want: map[string]interface{}{
+			"a.b": "c,d",
+		},
+	}, {
+		name: "Null is kept to delete the default value",
+
+		base: map[string]interface{}{"a": map[string]interface{}{"b": "c", "d": "e"}},
+		set:  "a.b=null",
+
+		want: map[string]interface{}{
+			"a": map[string]interface{}{"b": nil, "d": "e"},
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vals := tc.base
+			if vals == nil {
+				vals = make(map[string]interface{})
+			}
+			if err := parseSetValue(tc.set, vals); err != nil {
+				t.Fatalf("parseSetValue(%s) = %v; want <nil>", tc.set, err)
+			}
+			if diff := cmp.Diff(tc.want, vals); diff != "" {
+				t.Errorf("parseSetValue(%s) produced diff (-want +got):\n%s", tc.set, diff)
+			}
+		})
+	}
+}
+
+// writeTestChartArchive packages the chart in dir like `helm package`.
+func writeTestChartArchive(t *testing.T, dir, filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", filename, err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:     filepath.ToSlash(filepath.Join(filepath.Base(dir), rel)),
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to package chart %s: %v", dir, err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to package chart %s: %v", dir, err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to package chart %s: %v", dir, err)
+	}
+}
@@ -2,8 +2,14 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"os/exec"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // Kubectl implements the KubectlService interface.
@@ -12,6 +18,8 @@ import (
 type Kubectl struct {
 	printCommands bool
 	serverDryRun  bool
+	// kubeconfig is the kubeconfig file to use instead of the default one, if not empty.
+	kubeconfig string
 }
 
 // NewKubectl returns a new Kubectl object.
@@ -20,8 +28,8 @@ func NewKubectl(ctx context.Context, printCommands bool, serverDryRun bool) (*Ku
 		return nil, err
 	}
 	return &Kubectl{
-		printCommands,
-		serverDryRun,
+		printCommands: printCommands,
+		serverDryRun:  serverDryRun,
 	}, nil
 }
 
@@ -34,8 +42,8 @@ func (k *Kubectl) Apply(ctx context.Context, filename, namespace string) error {
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	}
-	if _, err := runCommand(ctx, k.printCommands, "kubectl", args...); err != nil {
-		return fmt.Errorf("command to apply kubernetes config(s) to cluster failed: %v", err)
+	if _, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...); err != nil {
+		return fmt.Errorf("command to apply kubernetes config(s) to cluster failed: %w", kubectlError(err))
 	}
 	return nil
 }
@@ -49,8 +57,26 @@ func (k *Kubectl) ApplyFromString(ctx context.Context, configString, namespace s
 	if namespace != "" {
 		args = append(args, "-n", namespace)
 	}
-	if _, err := runCommandWithStdinRedirection(ctx, k.printCommands, "kubectl", configString, args...); err != nil {
-		return fmt.Errorf("command to apply kubernetes config from string to cluster failed: %v", err)
+	if _, err := runCommandWithStdinRedirectionAndEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", configString, args...); err != nil {
+		return fmt.Errorf("command to apply kubernetes config from string to cluster failed: %w", kubectlError(err))
+	}
+	return nil
+}
+
+// ServerSideApplyFromString calls `kubectl apply --server-side --field-manager=<fieldManager> -f - -n <namespace> < ${configString}`.
+func (k *Kubectl) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	args := []string{"apply", "--server-side", fmt.Sprintf("--field-manager=%s", fieldManager), "-f", "-"}
+	if forceConflicts {
+		args = append(args, "--force-conflicts")
+	}
+	if k.serverDryRun {
+		args = append(args, "--server-dry-run")
+	}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	if _, err := runCommandWithStdinRedirectionAndEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", configString, args...); err != nil {
+		return fmt.Errorf("command to server-side apply kubernetes config from string to cluster failed: %w", kubectlError(err))
 	}
 	return nil
 }
@@ -70,9 +96,166 @@ func (k *Kubectl) Get(ctx context.Context, kind, name, namespace, format string,
 	if ignoreNotFound {
 		args = append(args, "--ignore-not-found=true")
 	}
-	out, err := runCommand(ctx, k.printCommands, "kubectl", args...)
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...)
+	if err != nil {
+		return "", fmt.Errorf("command to get kubernetes config: %w", kubectlError(err))
+	}
+	return out, nil
+}
+
+// GetWithSelector calls `kubectl get <kinds> -l <selector> -n <namespace> --output=<format>`.
+// kinds may be a comma-separated list of kinds.
+func (k *Kubectl) GetWithSelector(ctx context.Context, kinds, selector, namespace, format string) (string, error) {
+	args := []string{"get", kinds, "-l", selector}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	if format != "" {
+		args = append(args, fmt.Sprintf("--output=%s", format))
+	}
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...)
 	if err != nil {
-		return "", fmt.Errorf("command to get kubernetes config: %v", err)
+		return "", fmt.Errorf("command to get kubernetes configs with selector: %w", kubectlError(err))
 	}
 	return out, nil
 }
+
+// GetEvents calls `kubectl get events --field-selector=involvedObject.kind=<kind>,involvedObject.name=<name> -n <namespace> --output=<format>`.
+func (k *Kubectl) GetEvents(ctx context.Context, kind, name, namespace, format string) (string, error) {
+	args := []string{"get", "events", fmt.Sprintf("--field-selector=%s", eventFieldSelector(kind, name))}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	if format != "" {
+		args = append(args, fmt.Sprintf("--output=%s", format))
+	}
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...)
+	if err != nil {
+		return "", fmt.Errorf("command to get kubernetes events failed: %w", kubectlError(err))
+	}
+	return out, nil
+}
+
+// Delete calls `kubectl delete <kind> <name> -n <namespace> --ignore-not-found=true`.
+func (k *Kubectl) Delete(ctx context.Context, kind, name, namespace string) error {
+	args := []string{"delete", kind, name}
+	if namespace != "" {
+		args = append(args, "-n", namespace)
+	}
+	args = append(args, "--ignore-not-found=true")
+	if k.serverDryRun {
+		// `kubectl delete` does not have the --server-dry-run flag.
+		args = append(args, "--dry-run=server")
+	}
+	if _, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...); err != nil {
+		return fmt.Errorf("command to delete kubernetes object from cluster failed: %w", kubectlError(err))
+	}
+	return nil
+}
+
+// DeleteWithPreconditions calls `kubectl delete --raw <path> -f -` with DeleteOptions that only
+// delete the object if it still has uid and resourceVersion, which are not checked if empty.
+// `kubectl delete <kind> <name>` does not support preconditions, so the object's path is found with
+// `kubectl api-resources`. Like Delete, an object that does not exist is ignored.
+func (k *Kubectl) DeleteWithPreconditions(ctx context.Context, kind, name, namespace, uid, resourceVersion string) error {
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", "api-resources", "--no-headers")
+	if err != nil && !(out != "" && strings.Contains(err.Error(), discoveryFailedMessage)) {
+		return fmt.Errorf("command to get kubernetes api resources failed: %w", kubectlError(err))
+	}
+	r, ok := parseAPIResource(out, kind)
+	if !ok {
+		return fmt.Errorf("failed to find api resource of kind %q", kind)
+	}
+	if !r.Namespaced {
+		namespace = ""
+	} else if namespace == "" {
+		if namespace, err = k.ContextNamespace(ctx); err != nil {
+			return err
+		}
+	}
+	path := resourcePath(r, namespace, name)
+	if k.serverDryRun {
+		path += "?dryRun=All"
+	}
+	body, err := json.Marshal(deleteOptionsWithPreconditions(uid, resourceVersion))
+	if err != nil {
+		return fmt.Errorf("failed to encode delete options: %v", err)
+	}
+	if _, err := runCommandWithStdinRedirectionAndEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", string(body), "delete", "--raw", path, "-f", "-"); err != nil {
+		if err := kubectlError(err); !IsNotFound(err) {
+			return fmt.Errorf("command to delete kubernetes object from cluster failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseAPIResource finds the resource of kind in the output of `kubectl api-resources --no-headers`,
+// whose columns are NAME, SHORTNAMES (which may be empty), APIVERSION, NAMESPACED, and KIND. The
+// first resource of kind is the one of the preferred version of its API group.
+func parseAPIResource(out, kind string) (metav1.APIResource, bool) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[len(fields)-1] != kind {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(fields[len(fields)-3])
+		if err != nil {
+			continue
+		}
+		return metav1.APIResource{
+			Name:       fields[0],
+			Group:      gv.Group,
+			Version:    gv.Version,
+			Namespaced: fields[len(fields)-2] == "true",
+			Kind:       kind,
+		}, true
+	}
+	return metav1.APIResource{}, false
+}
+
+// resourcePath returns the API path of the object with name of resource r in namespace, which is
+// empty for cluster-scoped resources.
+func resourcePath(r metav1.APIResource, namespace, name string) string {
+	p := "/apis/" + r.Group + "/" + r.Version
+	if r.Group == "" {
+		p = "/api/" + r.Version
+	}
+	if namespace != "" {
+		p += "/namespaces/" + url.PathEscape(namespace)
+	}
+	p += "/" + r.Name
+	if name != "" {
+		p += "/" + url.PathEscape(name)
+	}
+	return p
+}
+
+// APIResources calls `kubectl api-resources --verbs=<verbs> --namespaced=<namespaced> --no-headers`,
+// whose columns are NAME, SHORTNAMES (which may be empty), APIVERSION, NAMESPACED, and KIND. API
+// groups that cannot be discovered, e.g., unavailable aggregated APIs, are skipped.
+func (k *Kubectl) APIResources(ctx context.Context, namespaced bool, verbs []string) (string, error) {
+	args := []string{"api-resources", fmt.Sprintf("--verbs=%s", strings.Join(verbs, ",")), fmt.Sprintf("--namespaced=%t", namespaced), "--no-headers"}
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", args...)
+	if err != nil && !(out != "" && strings.Contains(err.Error(), discoveryFailedMessage)) {
+		return "", fmt.Errorf("command to get kubernetes api resources failed: %w", kubectlError(err))
+	}
+	return out, nil
+}
+
+// ContextNamespace calls `kubectl config view --minify --output=jsonpath={.contexts[0].context.namespace}`
+// to get the current context's namespace, which is "default" if it is not set.
+func (k *Kubectl) ContextNamespace(ctx context.Context) (string, error) {
+	out, err := runCommandWithEnv(ctx, k.printCommands, kubeconfigEnv(k.kubeconfig), "kubectl", "config", "view", "--minify", "--output=jsonpath={.contexts[0].context.namespace}")
+	if err != nil {
+		return "", fmt.Errorf("command to get current context's namespace failed: %w", kubectlError(err))
+	}
+	if namespace := strings.TrimSpace(out); namespace != "" {
+		return namespace, nil
+	}
+	return "default", nil
+}
+
+// eventFieldSelector returns a field selector for the events of an object.
+func eventFieldSelector(kind, name string) string {
+	return fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", kind, name)
+}
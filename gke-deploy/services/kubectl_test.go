@@ -0,0 +1,79 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseAPIResource(t *testing.T) {
+	out := `bindings                                       v1                                true         Binding
+namespaces                        ns           v1                                false        Namespace
+deployments                       deploy       apps/v1                           true         Deployment
+leases                                         coordination.k8s.io/v1            true         Lease
+`
+
+	tests := []struct {
+		name string
+
+		kind string
+
+		want   metav1.APIResource
+		wantOK bool
+	}{{
+		name: "Core resource",
+
+		kind: "Namespace",
+
+		want: metav1.APIResource{
+			Name:       "namespaces",
+			Version:    "v1",
+			Namespaced: false,
+			Kind:       "Namespace",
+		},
+		wantOK: true,
+	}, {
+		name: "Resource with short names",
+
+		kind: "Deployment",
+
+		want: metav1.APIResource{
+			Name:       "deployments",
+			Group:      "apps",
+			Version:    "v1",
+			Namespaced: true,
+			Kind:       "Deployment",
+		},
+		wantOK: true,
+	}, {
+		name: "Resource without short names",
+
+		kind: "Lease",
+
+		want: metav1.APIResource{
+			Name:       "leases",
+			Group:      "coordination.k8s.io",
+			Version:    "v1",
+			Namespaced: true,
+			Kind:       "Lease",
+		},
+		wantOK: true,
+	}, {
+		name: "Unknown kind",
+
+		kind: "Certificate",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := parseAPIResource(out, tc.kind)
+			if ok != tc.wantOK {
+				t.Fatalf("parseAPIResource(out, %s) = _, %t; want %t", tc.kind, ok, tc.wantOK)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("parseAPIResource(out, %s) produced diff (-want +got):\n%s", tc.kind, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,650 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	// Register the gcp auth provider of the kubeconfig files written by
+	// `gcloud container clusters get-credentials`.
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Kubernetes implements the KubectlService interface by sending requests directly to the
+// Kubernetes API server of the current context's cluster with the k8s.io/client-go dynamic and
+// discovery clients, so a kubectl binary is not needed. Like `kubectl apply`, objects are applied
+// with a three-way merge between the last applied configuration, the new configuration, and the
+// live object. Built-in objects are patched with a strategic merge patch and custom resources with a
+// JSON merge patch.
+// The service account that is calling this must have permission to access the cluster.
+type Kubernetes struct {
+	printCommands bool
+	serverDryRun  bool
+	// kubeconfig is the kubeconfig file to use instead of the default one, if not empty.
+	kubeconfig string
+
+	// mu guards the clients, which are created on first use because the kubeconfig file may be
+	// written after this is created, e.g., by `gcloud container clusters get-credentials`.
+	mu sync.Mutex
+	// namespace is the current context's namespace.
+	namespace string
+	dynamic   dynamic.Interface
+	discovery discovery.CachedDiscoveryInterface
+	mapper    meta.RESTMapper
+}
+
+// NewKubernetes returns a new Kubernetes object.
+func NewKubernetes(ctx context.Context, printCommands bool, serverDryRun bool) (*Kubernetes, error) {
+	return &Kubernetes{
+		printCommands: printCommands,
+		serverDryRun:  serverDryRun,
+	}, nil
+}
+
+// Apply applies the configs in a file, directory, or URL, like `kubectl apply -f <filename> -n <namespace>`.
+func (k *Kubernetes) Apply(ctx context.Context, filename, namespace string) error {
+	data, err := readConfigs(ctx, filename)
+	if err != nil {
+		return fmt.Errorf("failed to read kubernetes config(s) %q: %v", filename, err)
+	}
+	if err := k.applyConfigs(ctx, data, namespace); err != nil {
+		return fmt.Errorf("request to apply kubernetes config(s) to cluster failed: %w", err)
+	}
+	return nil
+}
+
+// ApplyFromString applies the configs in configString, like `kubectl apply -f - -n <namespace> < ${configString}`.
+func (k *Kubernetes) ApplyFromString(ctx context.Context, configString, namespace string) error {
+	if err := k.applyConfigs(ctx, []byte(configString), namespace); err != nil {
+		return fmt.Errorf("request to apply kubernetes config from string to cluster failed: %w", err)
+	}
+	return nil
+}
+
+// Get gets an object, like `kubectl get <kind> <name> -n <namespace> --output=<format>`. kind may
+// be in the form <kind>/<name> if name is empty. If both are empty, all objects of kind are listed.
+// Only the "yaml" and "json" formats are supported.
+func (k *Kubernetes) Get(ctx context.Context, kind, name, namespace, format string, ignoreNotFound bool) (string, error) {
+	if name == "" {
+		if i := strings.Index(kind, "/"); i >= 0 {
+			kind, name = kind[:i], kind[i+1:]
+		}
+	}
+	out, err := k.get(ctx, kind, name, namespace, format)
+	if err != nil {
+		if ignoreNotFound && IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("request to get kubernetes config failed: %w", err)
+	}
+	return out, nil
+}
+
+func (k *Kubernetes) get(ctx context.Context, kind, name, namespace, format string) (string, error) {
+	ri, err := k.resourceForKind(ctx, kind, namespace)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		list, err := ri.List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return "", apiError(err)
+		}
+		return formatObject(newList(list), format)
+	}
+	obj, err := ri.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", apiError(err)
+	}
+	return formatObject(obj.Object, format)
+}
+
+// GetWithSelector lists objects, like `kubectl get <kinds> -l <selector> -n <namespace> --output=<format>`.
+// kinds may be a comma-separated list of kinds.
+func (k *Kubernetes) GetWithSelector(ctx context.Context, kinds, selector, namespace, format string) (string, error) {
+	all := &unstructured.UnstructuredList{}
+	for _, kind := range strings.Split(kinds, ",") {
+		ri, err := k.resourceForKind(ctx, kind, namespace)
+		if err != nil {
+			return "", fmt.Errorf("request to get kubernetes configs with selector failed: %w", err)
+		}
+		list, err := ri.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return "", fmt.Errorf("request to get kubernetes configs with selector failed: %w", apiError(err))
+		}
+		all.Items = append(all.Items, list.Items...)
+	}
+	return formatObject(newList(all), format)
+}
+
+// GetEvents lists the events of an object, like
+// `kubectl get events --field-selector=involvedObject.kind=<kind>,involvedObject.name=<name> -n <namespace> --output=<format>`.
+func (k *Kubernetes) GetEvents(ctx context.Context, kind, name, namespace, format string) (string, error) {
+	ri, err := k.resourceForKind(ctx, "Event", namespace)
+	if err != nil {
+		return "", fmt.Errorf("request to get kubernetes events failed: %w", err)
+	}
+	list, err := ri.List(ctx, metav1.ListOptions{FieldSelector: eventFieldSelector(kind, name)})
+	if err != nil {
+		return "", fmt.Errorf("request to get kubernetes events failed: %w", apiError(err))
+	}
+	return formatObject(newList(list), format)
+}
+
+// Delete deletes an object if it exists, like `kubectl delete <kind> <name> -n <namespace> --ignore-not-found=true`.
+func (k *Kubernetes) Delete(ctx context.Context, kind, name, namespace string) error {
+	return k.DeleteWithPreconditions(ctx, kind, name, namespace, "", "")
+}
+
+// DeleteWithPreconditions deletes an object if it exists and still has uid and resourceVersion,
+// which are not checked if empty. If the object has changed, the API server responds with a
+// conflict.
+func (k *Kubernetes) DeleteWithPreconditions(ctx context.Context, kind, name, namespace, uid, resourceVersion string) error {
+	ri, err := k.resourceForKind(ctx, kind, namespace)
+	if err != nil {
+		return fmt.Errorf("request to delete kubernetes object from cluster failed: %w", err)
+	}
+	opts := deleteOptionsWithPreconditions(uid, resourceVersion)
+	if k.serverDryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	if err := ri.Delete(ctx, name, opts); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("request to delete kubernetes object from cluster failed: %w", apiError(err))
+	}
+	return nil
+}
+
+// APIResources lists the resources whose objects support all of verbs, like
+// `kubectl api-resources --verbs=<verbs> --namespaced=<namespaced> --no-headers`, whose columns
+// are NAME, SHORTNAMES (which may be empty), APIVERSION, NAMESPACED, and KIND. API groups that
+// cannot be discovered, e.g., unavailable aggregated APIs, are skipped.
+func (k *Kubernetes) APIResources(ctx context.Context, namespaced bool, verbs []string) (string, error) {
+	if err := k.loadClients(ctx); err != nil {
+		return "", err
+	}
+	lists, err := discovery.ServerPreferredResources(k.discovery)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return "", fmt.Errorf("request to get kubernetes api resources failed: %w", apiError(err))
+	}
+	var b strings.Builder
+	for _, list := range discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: verbs}, lists) {
+		for _, r := range list.APIResources {
+			if r.Namespaced != namespaced {
+				continue
+			}
+			fields := []string{r.Name}
+			if len(r.ShortNames) > 0 {
+				fields = append(fields, strings.Join(r.ShortNames, ","))
+			}
+			fields = append(fields, list.GroupVersion, strconv.FormatBool(r.Namespaced), r.Kind)
+			b.WriteString(strings.Join(fields, " ") + "\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// ContextNamespace returns the current context's namespace, which is "default" if it is not set,
+// like `kubectl config view --minify --output=jsonpath={.contexts[0].context.namespace}`.
+func (k *Kubernetes) ContextNamespace(ctx context.Context) (string, error) {
+	if err := k.loadClients(ctx); err != nil {
+		return "", err
+	}
+	return k.namespace, nil
+}
+
+// applyConfigs applies each object in data, which may contain multiple YAML or JSON documents.
+func (k *Kubernetes) applyConfigs(ctx context.Context, data []byte, namespace string) error {
+	objs, err := decodeObjects(data)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := k.applyObject(ctx, obj, namespace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServerSideApplyFromString applies the configs in configString with server-side apply, like
+// `kubectl apply --server-side --field-manager=<fieldManager> -f - -n <namespace> < ${configString}`.
+// If forceConflicts is true, fields managed by other field managers are taken over instead of
+// failing with a conflict.
+func (k *Kubernetes) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	objs, err := decodeObjects([]byte(configString))
+	if err != nil {
+		return fmt.Errorf("request to server-side apply kubernetes config from string to cluster failed: %v", err)
+	}
+	for _, obj := range objs {
+		ri, err := k.objectResource(ctx, obj, namespace)
+		if err != nil {
+			return fmt.Errorf("request to server-side apply kubernetes config from string to cluster failed: %w", err)
+		}
+		body, err := obj.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		opts := metav1.PatchOptions{FieldManager: fieldManager}
+		if forceConflicts {
+			opts.Force = &forceConflicts
+		}
+		if k.serverDryRun {
+			opts.DryRun = []string{metav1.DryRunAll}
+		}
+		if _, err := ri.Patch(ctx, obj.GetName(), types.ApplyPatchType, body, opts); err != nil {
+			return fmt.Errorf("request to server-side apply kubernetes config from string to cluster failed: %w", apiError(err))
+		}
+	}
+	return nil
+}
+
+// objectResource returns the client of the resource of obj. The namespace of namespaced objects is
+// set to namespace if it is not empty, else the current context's namespace if obj does not have
+// one.
+func (k *Kubernetes) objectResource(ctx context.Context, obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	if obj.GetAPIVersion() == "" || obj.GetKind() == "" {
+		return nil, fmt.Errorf("object must have apiVersion and kind")
+	}
+	if obj.GetName() == "" {
+		return nil, fmt.Errorf("%s object must have a name", obj.GetKind())
+	}
+	if err := k.loadClients(ctx); err != nil {
+		return nil, err
+	}
+	gvk := obj.GroupVersionKind()
+	mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return k.dynamic.Resource(mapping.Resource), nil
+	}
+	if namespace != "" && obj.GetNamespace() != "" && namespace != obj.GetNamespace() {
+		return nil, fmt.Errorf("the namespace from the provided object %q does not match the namespace %q", obj.GetNamespace(), namespace)
+	}
+	switch {
+	case namespace != "":
+		obj.SetNamespace(namespace)
+	case obj.GetNamespace() == "":
+		obj.SetNamespace(k.namespace)
+	}
+	return k.dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+func (k *Kubernetes) applyObject(ctx context.Context, obj *unstructured.Unstructured, namespace string) error {
+	ri, err := k.objectResource(ctx, obj, namespace)
+	if err != nil {
+		return err
+	}
+
+	// Record the configuration being applied, to be able to tell which fields were removed from it
+	// the next time it is applied.
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	delete(annotations, lastAppliedConfigAnnotation)
+	obj.SetAnnotations(annotations)
+	lastApplied, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	annotations[lastAppliedConfigAnnotation] = string(lastApplied)
+	obj.SetAnnotations(annotations)
+	modified, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	var dryRun []string
+	if k.serverDryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+
+	live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := ri.Create(ctx, obj, metav1.CreateOptions{DryRun: dryRun}); err != nil {
+			return apiError(err)
+		}
+		return nil
+	}
+	if err != nil {
+		return apiError(err)
+	}
+	current, err := live.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	// If the object was not applied before, fields are not removed from the live object.
+	original := []byte(live.GetAnnotations()[lastAppliedConfigAnnotation])
+
+	// Like kubectl, fall back to a JSON merge patch for custom resources, whose lists cannot be
+	// merged because their patch strategies are unknown.
+	var patch []byte
+	patchType := types.MergePatchType
+	if versioned, err := scheme.Scheme.New(obj.GroupVersionKind()); err == nil {
+		lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return err
+		}
+		patch, err = strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+		if err != nil {
+			return fmt.Errorf("failed to create patch of %s object with name %q: %v", obj.GetKind(), obj.GetName(), err)
+		}
+		patchType = types.StrategicMergePatchType
+	} else {
+		patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current)
+		if err != nil {
+			return fmt.Errorf("failed to create patch of %s object with name %q: %v", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+	if _, err := ri.Patch(ctx, obj.GetName(), patchType, patch, metav1.PatchOptions{DryRun: dryRun}); err != nil {
+		return apiError(err)
+	}
+	return nil
+}
+
+// resourceForKind returns the client of the resource of kind in namespace, or the current context's
+// namespace if namespace is empty. kind may be a kind, resource, singular name, or short name,
+// optionally followed by "." and the API group, e.g., "Deployment", "deploy", or
+// "customresourcedefinition.apiextensions.k8s.io". The preferred version of each group is used.
+func (k *Kubernetes) resourceForKind(ctx context.Context, kind, namespace string) (dynamic.ResourceInterface, error) {
+	if err := k.loadClients(ctx); err != nil {
+		return nil, err
+	}
+	// Like kubectl, kinds with a version (e.g., "deployments.v1.apps") are looked for with the
+	// version first.
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(strings.TrimSpace(kind)))
+	var gvk schema.GroupVersionKind
+	if fullySpecified != nil {
+		gvk, _ = k.mapper.KindFor(*fullySpecified)
+	}
+	if gvk.Empty() {
+		var err error
+		gvk, err = k.mapper.KindFor(groupResource.WithVersion(""))
+		if err != nil {
+			return nil, fmt.Errorf("the server doesn't have a resource type %q", kind)
+		}
+	}
+	mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return k.dynamic.Resource(mapping.Resource), nil
+	}
+	if namespace == "" {
+		namespace = k.namespace
+	}
+	return k.dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// loadClients creates the clients of the current context's cluster, if they were not created yet.
+// Like kubectl, the kubeconfig files in the KUBECONFIG environment variable or ~/.kube/config are
+// merged, unless kubeconfig is set. If no kubeconfig file exists, the in-cluster configuration of
+// a Pod's service account is used.
+func (k *Kubernetes) loadClients(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.dynamic != nil {
+		return nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load kubernetes configuration: %v", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return fmt.Errorf("failed to load kubernetes configuration: %v", err)
+	}
+	return k.setClients(config, namespace)
+}
+
+// setClients creates the clients of the cluster of config, whose current namespace is namespace.
+func (k *Kubernetes) setClients(config *rest.Config, namespace string) error {
+	config = rest.CopyConfig(config)
+	config.UserAgent = "gke-deploy"
+	if k.printCommands {
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &printingRoundTripper{rt}
+		})
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes discovery client: %v", err)
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	// The discovery information is cached, and refreshed if a kind is not found, e.g., because it
+	// is a custom resource whose CustomResourceDefinition was just applied.
+	cached := memory.NewMemCacheClient(dc)
+	k.namespace = namespace
+	k.discovery = cached
+	k.mapper = restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, nil)
+	k.dynamic = client
+	return nil
+}
+
+// printingRoundTripper prints the requests that are sent to the API server.
+type printingRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (p *printingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	fmt.Printf("\n--------------------------------------------------------------------------------\n")
+	fmt.Printf("> Sending request\n\n")
+	fmt.Printf("   %s %s\n", req.Method, req.URL)
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := ioutil.ReadAll(body)
+			body.Close()
+			if len(data) > 0 {
+				fmt.Printf("   %s\n", data)
+			}
+		}
+	}
+	fmt.Printf("\n--------------------------------------------------------------------------------\n\n")
+	return p.rt.RoundTrip(req)
+}
+
+// apiError returns a KubernetesError if err is an error returned by the API server, else err.
+func apiError(err error) error {
+	status, ok := err.(apierrors.APIStatus)
+	if !ok {
+		return err
+	}
+	s := status.Status()
+	ke := &KubernetesError{
+		Reason:  s.Reason,
+		Code:    s.Code,
+		Message: fmt.Sprintf("Error from server (%s): %s", s.Reason, s.Message),
+	}
+	if s.Details != nil {
+		ke.Causes = s.Details.Causes
+	}
+	return ke
+}
+
+// readConfigs reads the configs in a file, the YAML and JSON files in a directory, or a URL.
+// filename "-" reads from stdin.
+func readConfigs(ctx context.Context, filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	if strings.HasPrefix(filename, "http://") || strings.HasPrefix(filename, "https://") {
+		req, err := http.NewRequest(http.MethodGet, filename, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("server responded with status code %d", resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return ioutil.ReadFile(filename)
+	}
+	files, err := ioutil.ReadDir(filename)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(filename, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n---\n")
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeObjects decodes the objects in data, which may contain multiple YAML or JSON documents.
+// Items of List objects are returned as separate objects.
+func decodeObjects(data []byte) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %v", err)
+		}
+		j, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse config: %v", err)
+		}
+		if string(bytes.TrimSpace(j)) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(j); err != nil {
+			return nil, fmt.Errorf("failed to decode object: %v", err)
+		}
+		if obj.IsList() {
+			if err := obj.EachListItem(func(item runtime.Object) error {
+				objs = append(objs, item.(*unstructured.Unstructured))
+				return nil
+			}); err != nil {
+				return nil, fmt.Errorf("failed to decode list: %v", err)
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func formatObject(obj interface{}, format string) (string, error) {
+	switch format {
+	case "yaml":
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	case "json":
+		out, err := json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return "", err
+		}
+		return string(out) + "\n", nil
+	}
+	return "", fmt.Errorf("unsupported output format %q", format)
+}
+
+// newList returns the objects of list in a List, like the output of `kubectl get` for multiple
+// objects.
+func newList(list *unstructured.UnstructuredList) map[string]interface{} {
+	items := make([]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		items = append(items, item.Object)
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items":      items,
+		"metadata": map[string]interface{}{
+			"resourceVersion": "",
+		},
+	}
+}
+
+// deleteOptionsWithPreconditions returns the DeleteOptions of deleting an object only if it still
+// has uid and resourceVersion, which are not checked if empty.
+func deleteOptionsWithPreconditions(uid, resourceVersion string) metav1.DeleteOptions {
+	propagation := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "DeleteOptions",
+		},
+		PropagationPolicy: &propagation,
+	}
+	if uid == "" && resourceVersion == "" {
+		return opts
+	}
+	opts.Preconditions = &metav1.Preconditions{}
+	if uid != "" {
+		u := types.UID(uid)
+		opts.Preconditions.UID = &u
+	}
+	if resourceVersion != "" {
+		opts.Preconditions.ResourceVersion = &resourceVersion
+	}
+	return opts
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	testDeploymentPath = "/apis/apps/v1/namespaces/default/deployments/test-app"
+	testDeployment     = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"test-app","namespace":"default","labels":{"app":"test-app"}},"spec":{"replicas":1}}`
+)
+
+var testDiscovery = map[string]string{
+	"/api":                 `{"kind":"APIVersions","versions":["v1"]}`,
+	"/api/v1":              `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"namespaces","singularName":"","namespaced":false,"kind":"Namespace","shortNames":["ns"],"verbs":["create","delete","get","list"]},{"name":"services","singularName":"","namespaced":true,"kind":"Service","shortNames":["svc"],"verbs":["create","delete","get","list"]},{"name":"services/status","singularName":"","namespaced":true,"kind":"Service"},{"name":"events","singularName":"","namespaced":true,"kind":"Event","shortNames":["ev"],"verbs":["create","get","list"]}]}`,
+	"/apis":                `{"kind":"APIGroupList","groups":[{"name":"apps","versions":[{"groupVersion":"apps/v1","version":"v1"}],"preferredVersion":{"groupVersion":"apps/v1","version":"v1"}},{"name":"example.com","versions":[{"groupVersion":"example.com/v1","version":"v1"}],"preferredVersion":{"groupVersion":"example.com/v1","version":"v1"}}]}`,
+	"/apis/apps/v1":        `{"kind":"APIResourceList","groupVersion":"apps/v1","resources":[{"name":"deployments","singularName":"","namespaced":true,"kind":"Deployment","shortNames":["deploy"],"verbs":["create","delete","get","list"]}]}`,
+	"/apis/example.com/v1": `{"kind":"APIResourceList","groupVersion":"example.com/v1","resources":[{"name":"foos","singularName":"","namespaced":true,"kind":"Foo","verbs":["create","delete","get","list"]}]}`,
+}
+
+// testAPIServer is a fake Kubernetes API server that stores objects by path and records the
+// requests that modify them.
+type testAPIServer struct {
+	objects  map[string]string
+	requests []string
+	// patchTypes are the content types of PATCH requests.
+	patchTypes []string
+}
+
+func (s *testAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+	}
+	if r.Method == http.MethodPatch {
+		s.patchTypes = append(s.patchTypes, r.Header.Get("Content-Type"))
+	}
+	if d, ok := testDiscovery[r.URL.Path]; ok {
+		w.Write([]byte(d))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if obj, ok := s.objects[r.URL.Path]; ok {
+			w.Write([]byte(obj))
+			return
+		}
+		if r.URL.Path == "/api/v1/namespaces/default/services" {
+			w.Write([]byte(`{"kind":"ServiceList","apiVersion":"v1","items":[{"metadata":{"name":"test-app","labels":{"app":"test-app"}}}]}`))
+			return
+		}
+		if r.URL.Path == "/api/v1/namespaces/default/events" && r.URL.Query().Get("fieldSelector") == "involvedObject.kind=Pod,involvedObject.name=test-app-1234" {
+			w.Write([]byte(`{"kind":"EventList","apiVersion":"v1","items":[{"metadata":{"name":"test-app-1234.1"},"reason":"BackOff","type":"Warning"}]}`))
+			return
+		}
+	case http.MethodPost:
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+		return
+	case http.MethodPatch:
+		if obj, ok := s.objects[r.URL.Path]; ok {
+			w.Write([]byte(obj))
+			return
+		}
+	case http.MethodDelete:
+		if _, ok := s.objects[r.URL.Path]; ok {
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","message":"not found","reason":"NotFound","code":404}`))
+}
+
+func newTestKubernetes(t *testing.T, objects map[string]string, serverDryRun bool) (*Kubernetes, *testAPIServer) {
+	s := &testAPIServer{objects: objects}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	k, err := NewKubernetes(context.Background(), false, serverDryRun)
+	if err != nil {
+		t.Fatalf("NewKubernetes() = _, %v; want <nil>", err)
+	}
+	if err := k.setClients(&rest.Config{Host: srv.URL, BearerToken: "token"}, "default"); err != nil {
+		t.Fatalf("setClients() = %v; want <nil>", err)
+	}
+	return k, s
+}
+
+func TestKubernetesApplyFromString(t *testing.T) {
+	ctx := context.Background()
+
+	lastApplied := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{},"labels":{"app":"test-app"},"name":"test-app","namespace":"default"},"spec":{"replicas":1}}`
+	deployed := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"test-app","namespace":"default","uid":"1234","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"` + strings.Replace(lastApplied, `"`, `\"`, -1) + `\n"},"labels":{"app":"test-app"}},"spec":{"replicas":1,"strategy":{"type":"RollingUpdate"}}}`
+
+	serviceLastApplied := `{"apiVersion":"v1","kind":"Service","metadata":{"annotations":{},"name":"test-app","namespace":"default"},"spec":{"ports":[{"port":80,"targetPort":8080}]}}`
+	deployedService := `{"apiVersion":"v1","kind":"Service","metadata":{"name":"test-app","namespace":"default","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"` + strings.Replace(serviceLastApplied, `"`, `\"`, -1) + `\n"}},"spec":{"ports":[{"port":80,"targetPort":8080,"nodePort":32619,"protocol":"TCP"}]}}`
+
+	fooLastApplied := `{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"annotations":{},"name":"test-app","namespace":"default"},"spec":{"items":["a","b"]}}`
+	deployedFoo := `{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"test-app","namespace":"default","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"` + strings.Replace(fooLastApplied, `"`, `\"`, -1) + `\n"}},"spec":{"items":["a","b"]}}`
+
+	tests := []struct {
+		name string
+
+		objects      map[string]string
+		config       string
+		namespace    string
+		serverDryRun bool
+
+		want           []string
+		wantPatchTypes []string
+	}{{
+		name: "Create object",
+
+		config: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\n  labels:\n    app: test-app\nspec:\n  replicas: 1\n",
+
+		want: []string{
+			`POST /apis/apps/v1/namespaces/default/deployments {"apiVersion":"apps/v1","kind":"Deployment","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"` + strings.Replace(lastApplied, `"`, `\"`, -1) + `\n"},"labels":{"app":"test-app"},"name":"test-app","namespace":"default"},"spec":{"replicas":1}}`,
+		},
+	}, {
+		name: "Create object in server dry run mode",
+
+		config:       "apiVersion: v1\nkind: Service\nmetadata:\n  name: test-app\n",
+		namespace:    "foobar",
+		serverDryRun: true,
+
+		want: []string{
+			`POST /api/v1/namespaces/foobar/services?dryRun=All {"apiVersion":"v1","kind":"Service","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"v1\",\"kind\":\"Service\",\"metadata\":{\"annotations\":{},\"name\":\"test-app\",\"namespace\":\"foobar\"}}\n"},"name":"test-app","namespace":"foobar"}}`,
+		},
+	}, {
+		name: "Unchanged object",
+
+		objects: map[string]string{
+			testDeploymentPath: deployed,
+		},
+		config: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\n  labels:\n    app: test-app\nspec:\n  replicas: 1\n",
+	}, {
+		name: "Changed object",
+
+		objects: map[string]string{
+			testDeploymentPath: deployed,
+		},
+		config: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\nspec:\n  replicas: 3\n",
+
+		want: []string{
+			`PATCH /apis/apps/v1/namespaces/default/deployments/test-app {"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"apps/v1\",\"kind\":\"Deployment\",\"metadata\":{\"annotations\":{},\"name\":\"test-app\",\"namespace\":\"default\"},\"spec\":{\"replicas\":3}}\n"},"labels":null},"spec":{"replicas":3}}`,
+		},
+		wantPatchTypes: []string{"application/strategic-merge-patch+json"},
+	}, {
+		name: "Changed Service ports keep nodePorts",
+
+		objects: map[string]string{
+			"/api/v1/namespaces/default/services/test-app": deployedService,
+		},
+		config: "apiVersion: v1\nkind: Service\nmetadata:\n  name: test-app\nspec:\n  ports:\n  - port: 80\n    targetPort: 9090\n",
+
+		want: []string{
+			`PATCH /api/v1/namespaces/default/services/test-app {"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"v1\",\"kind\":\"Service\",\"metadata\":{\"annotations\":{},\"name\":\"test-app\",\"namespace\":\"default\"},\"spec\":{\"ports\":[{\"port\":80,\"targetPort\":9090}]}}\n"}},"spec":{"$setElementOrder/ports":[{"port":80}],"ports":[{"port":80,"targetPort":9090}]}}`,
+		},
+		wantPatchTypes: []string{"application/strategic-merge-patch+json"},
+	}, {
+		name: "Changed custom resource",
+
+		objects: map[string]string{
+			"/apis/example.com/v1/namespaces/default/foos/test-app": deployedFoo,
+		},
+		config: "apiVersion: example.com/v1\nkind: Foo\nmetadata:\n  name: test-app\nspec:\n  items:\n  - a\n",
+
+		want: []string{
+			`PATCH /apis/example.com/v1/namespaces/default/foos/test-app {"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"example.com/v1\",\"kind\":\"Foo\",\"metadata\":{\"annotations\":{},\"name\":\"test-app\",\"namespace\":\"default\"},\"spec\":{\"items\":[\"a\"]}}\n"}},"spec":{"items":["a"]}}`,
+		},
+		wantPatchTypes: []string{"application/merge-patch+json"},
+	}, {
+		name: "Multiple objects",
+
+		config: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: foobar\n---\napiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: Service\n  metadata:\n    name: test-app\n",
+
+		want: []string{
+			`POST /api/v1/namespaces {"apiVersion":"v1","kind":"Namespace","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"v1\",\"kind\":\"Namespace\",\"metadata\":{\"annotations\":{},\"name\":\"foobar\"}}\n"},"name":"foobar"}}`,
+			`POST /api/v1/namespaces/default/services {"apiVersion":"v1","kind":"Service","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"apiVersion\":\"v1\",\"kind\":\"Service\",\"metadata\":{\"annotations\":{},\"name\":\"test-app\",\"namespace\":\"default\"}}\n"},"name":"test-app","namespace":"default"}}`,
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k, s := newTestKubernetes(t, tc.objects, tc.serverDryRun)
+
+			if err := k.ApplyFromString(ctx, tc.config, tc.namespace); err != nil {
+				t.Fatalf("ApplyFromString(ctx, %s, %s) = %v; want <nil>", tc.config, tc.namespace, err)
+			}
+			if diff := cmp.Diff(tc.want, s.requests); diff != "" {
+				t.Errorf("ApplyFromString(ctx, %s, %s) sent unexpected requests (-want +got):\n%s", tc.config, tc.namespace, diff)
+			}
+			if diff := cmp.Diff(tc.wantPatchTypes, s.patchTypes); diff != "" {
+				t.Errorf("ApplyFromString(ctx, %s, %s) sent unexpected patch types (-want +got):\n%s", tc.config, tc.namespace, diff)
+			}
+		})
+	}
+}
+
+func TestKubernetesApplyFromStringErrors(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+
+		config    string
+		namespace string
+	}{{
+		name: "Unknown kind",
+
+		config: "apiVersion: apps/v1\nkind: Foo\nmetadata:\n  name: test-app\n",
+	}, {
+		name: "Unknown group version",
+
+		config: "apiVersion: foo/v1\nkind: Foo\nmetadata:\n  name: test-app\n",
+	}, {
+		name: "Missing name",
+
+		config: "apiVersion: v1\nkind: Service\nmetadata:\n  labels:\n    app: test-app\n",
+	}, {
+		name: "Mismatched namespace",
+
+		config:    "apiVersion: v1\nkind: Service\nmetadata:\n  name: test-app\n  namespace: foo\n",
+		namespace: "bar",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k, _ := newTestKubernetes(t, nil, false)
+
+			if err := k.ApplyFromString(ctx, tc.config, tc.namespace); err == nil {
+				t.Errorf("ApplyFromString(ctx, %s, %s) = <nil>; want error", tc.config, tc.namespace)
+			}
+		})
+	}
+}
+
+func TestKubernetesServerSideApplyFromString(t *testing.T) {
+	ctx := context.Background()
+
+	config := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: test-app\nspec:\n  replicas: 3\n"
+
+	tests := []struct {
+		name string
+
+		forceConflicts bool
+		serverDryRun   bool
+
+		want []string
+	}{{
+		name: "Server-side apply",
+
+		want: []string{
+			`PATCH /apis/apps/v1/namespaces/default/deployments/test-app?fieldManager=gke-deploy {"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"test-app","namespace":"default"},"spec":{"replicas":3}}`,
+		},
+	}, {
+		name: "Force conflicts in server dry run mode",
+
+		forceConflicts: true,
+		serverDryRun:   true,
+
+		want: []string{
+			`PATCH /apis/apps/v1/namespaces/default/deployments/test-app?dryRun=All&fieldManager=gke-deploy&force=true {"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"test-app","namespace":"default"},"spec":{"replicas":3}}`,
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k, s := newTestKubernetes(t, map[string]string{testDeploymentPath: testDeployment}, tc.serverDryRun)
+
+			if err := k.ServerSideApplyFromString(ctx, config, "", "gke-deploy", tc.forceConflicts); err != nil {
+				t.Fatalf("ServerSideApplyFromString(ctx, %s, gke-deploy, %t) = %v; want <nil>", config, tc.forceConflicts, err)
+			}
+			if diff := cmp.Diff(tc.want, s.requests); diff != "" {
+				t.Errorf("ServerSideApplyFromString(ctx, %s, gke-deploy, %t) sent unexpected requests (-want +got):\n%s", config, tc.forceConflicts, diff)
+			}
+		})
+	}
+}
+
+func TestKubernetesGet(t *testing.T) {
+	ctx := context.Background()
+
+	k, _ := newTestKubernetes(t, map[string]string{testDeploymentPath: testDeployment}, false)
+
+	for _, kind := range []string{"Deployment", "deployments", "deploy", "deployment.apps"} {
+		got, err := k.Get(ctx, kind, "test-app", "", "yaml", false)
+		if err != nil {
+			t.Fatalf("Get(ctx, %s, test-app) = _, %v; want <nil>", kind, err)
+		}
+		want := "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    app: test-app\n  name: test-app\n  namespace: default\nspec:\n  replicas: 1\n"
+		if got != want {
+			t.Errorf("Get(ctx, %s, test-app) = %q; want %q", kind, got, want)
+		}
+	}
+
+	got, err := k.Get(ctx, "deployment/test-app", "", "default", "json", false)
+	if err != nil {
+		t.Fatalf("Get(ctx, deployment/test-app) = _, %v; want <nil>", err)
+	}
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(got), &obj); err != nil || obj["kind"] != "Deployment" {
+		t.Errorf("Get(ctx, deployment/test-app) = %q; want Deployment in JSON", got)
+	}
+
+	if _, err := k.Get(ctx, "Deployment", "not-found", "", "yaml", false); !IsNotFound(err) {
+		t.Errorf("Get(ctx, Deployment, not-found, ignoreNotFound=false) = _, %v; want NotFound error", err)
+	}
+	if got, err := k.Get(ctx, "Deployment", "not-found", "", "yaml", true); got != "" || err != nil {
+		t.Errorf("Get(ctx, Deployment, not-found, ignoreNotFound=true) = %q, %v; want \"\", <nil>", got, err)
+	}
+	if _, err := k.Get(ctx, "Foo", "test-app", "", "yaml", false); err == nil {
+		t.Errorf("Get(ctx, Foo, test-app) = _, <nil>; want error")
+	}
+}
+
+func TestKubernetesGetWithSelector(t *testing.T) {
+	ctx := context.Background()
+
+	k, _ := newTestKubernetes(t, nil, false)
+
+	got, err := k.GetWithSelector(ctx, "Service", "app=test-app", "", "yaml")
+	if err != nil {
+		t.Fatalf("GetWithSelector(ctx, Service, app=test-app) = _, %v; want <nil>", err)
+	}
+	want := "apiVersion: v1\nitems:\n- apiVersion: v1\n  kind: Service\n  metadata:\n    labels:\n      app: test-app\n    name: test-app\nkind: List\nmetadata:\n  resourceVersion: \"\"\n"
+	if got != want {
+		t.Errorf("GetWithSelector(ctx, Service, app=test-app) = %q; want %q", got, want)
+	}
+}
+
+func TestKubernetesGetEvents(t *testing.T) {
+	ctx := context.Background()
+
+	k, _ := newTestKubernetes(t, nil, false)
+
+	got, err := k.GetEvents(ctx, "Pod", "test-app-1234", "default", "yaml")
+	if err != nil {
+		t.Fatalf("GetEvents(ctx, Pod, test-app-1234, default) = _, %v; want <nil>", err)
+	}
+	want := "apiVersion: v1\nitems:\n- apiVersion: v1\n  kind: Event\n  metadata:\n    name: test-app-1234.1\n  reason: BackOff\n  type: Warning\nkind: List\nmetadata:\n  resourceVersion: \"\"\n"
+	if got != want {
+		t.Errorf("GetEvents(ctx, Pod, test-app-1234, default) = %q; want %q", got, want)
+	}
+}
+
+func TestKubernetesDelete(t *testing.T) {
+	ctx := context.Background()
+
+	k, s := newTestKubernetes(t, map[string]string{testDeploymentPath: testDeployment}, false)
+
+	if err := k.Delete(ctx, "Deployment", "test-app", "default"); err != nil {
+		t.Fatalf("Delete(ctx, Deployment, test-app) = %v; want <nil>", err)
+	}
+	if err := k.Delete(ctx, "Deployment", "not-found", "default"); err != nil {
+		t.Fatalf("Delete(ctx, Deployment, not-found) = %v; want <nil>", err)
+	}
+	want := []string{
+		`DELETE /apis/apps/v1/namespaces/default/deployments/test-app {"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Background"}`,
+		`DELETE /apis/apps/v1/namespaces/default/deployments/not-found {"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Background"}`,
+	}
+	if diff := cmp.Diff(want, s.requests); diff != "" {
+		t.Errorf("Delete(ctx, ...) sent unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestKubernetesDeleteServerDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	k, s := newTestKubernetes(t, map[string]string{testDeploymentPath: testDeployment}, true)
+
+	if err := k.Delete(ctx, "Deployment", "test-app", "default"); err != nil {
+		t.Fatalf("Delete(ctx, Deployment, test-app) = %v; want <nil>", err)
+	}
+	want := []string{
+		`DELETE /apis/apps/v1/namespaces/default/deployments/test-app {"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Background","dryRun":["All"]}`,
+	}
+	if diff := cmp.Diff(want, s.requests); diff != "" {
+		t.Errorf("Delete(ctx, ...) in server dry run mode sent unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestKubernetesDeleteWithPreconditions(t *testing.T) {
+	ctx := context.Background()
+
+	k, s := newTestKubernetes(t, map[string]string{testDeploymentPath: testDeployment}, false)
+
+	if err := k.DeleteWithPreconditions(ctx, "Deployment", "test-app", "default", "1234", "5"); err != nil {
+		t.Fatalf("DeleteWithPreconditions(ctx, Deployment, test-app, default, 1234, 5) = %v; want <nil>", err)
+	}
+	if err := k.DeleteWithPreconditions(ctx, "Deployment", "not-found", "", "", "5"); err != nil {
+		t.Fatalf("DeleteWithPreconditions(ctx, Deployment, not-found, , , 5) = %v; want <nil>", err)
+	}
+	want := []string{
+		`DELETE /apis/apps/v1/namespaces/default/deployments/test-app {"kind":"DeleteOptions","apiVersion":"v1","preconditions":{"uid":"1234","resourceVersion":"5"},"propagationPolicy":"Background"}`,
+		`DELETE /apis/apps/v1/namespaces/default/deployments/not-found {"kind":"DeleteOptions","apiVersion":"v1","preconditions":{"resourceVersion":"5"},"propagationPolicy":"Background"}`,
+	}
+	if diff := cmp.Diff(want, s.requests); diff != "" {
+		t.Errorf("DeleteWithPreconditions(ctx, ...) sent unexpected requests (-want +got):\n%s", diff)
+	}
+}
+
+func TestKubernetesAPIResources(t *testing.T) {
+	ctx := context.Background()
+	k, _ := newTestKubernetes(t, nil, false)
+
+	tests := []struct {
+		name string
+
+		namespaced bool
+		verbs      []string
+
+		want string
+	}{{
+		// Events cannot be deleted, so they are not listed.
+		name: "Namespaced resources that can be listed and deleted",
+
+		namespaced: true,
+		verbs:      []string{"list", "delete"},
+
+		want: "services svc v1 true Service\ndeployments deploy apps/v1 true Deployment\nfoos example.com/v1 true Foo\n",
+	}, {
+		name: "Namespaced resources that can be listed",
+
+		namespaced: true,
+		verbs:      []string{"list"},
+
+		want: "services svc v1 true Service\nevents ev v1 true Event\ndeployments deploy apps/v1 true Deployment\nfoos example.com/v1 true Foo\n",
+	}, {
+		name: "Cluster-scoped resources",
+
+		verbs: []string{"list", "delete"},
+
+		want: "namespaces ns v1 false Namespace\n",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := k.APIResources(ctx, tc.namespaced, tc.verbs)
+			if err != nil {
+				t.Fatalf("APIResources(ctx, %t, %v) = _, %v; want _, <nil>", tc.namespaced, tc.verbs, err)
+			}
+			if got != tc.want {
+				t.Errorf("APIResources(ctx, %t, %v) = %q; want %q", tc.namespaced, tc.verbs, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKubernetesKubeconfig(t *testing.T) {
+	ctx := context.Background()
+
+	s := &testAPIServer{objects: map[string]string{"/apis/apps/v1/namespaces/foobar/deployments/test-app": testDeployment}}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	config := `apiVersion: v1
+kind: Config
+current-context: test-context
+clusters:
+- name: test-cluster
+  cluster:
+    server: ` + srv.URL + `
+contexts:
+- name: test-context
+  context:
+    cluster: test-cluster
+    user: test-user
+    namespace: foobar
+users:
+- name: test-user
+  user:
+    token: test-token
+`
+	if err := ioutil.WriteFile(kubeconfig, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write kubeconfig file: %v", err)
+	}
+
+	k, err := NewKubernetes(ctx, false, false)
+	if err != nil {
+		t.Fatalf("NewKubernetes() = _, %v; want <nil>", err)
+	}
+	k.kubeconfig = kubeconfig
+
+	// Objects are deleted from the current context's namespace if no namespace is given.
+	if err := k.Delete(ctx, "Deployment", "test-app", ""); err != nil {
+		t.Fatalf("Delete(ctx, Deployment, test-app) = %v; want <nil>", err)
+	}
+	want := []string{
+		`DELETE /apis/apps/v1/namespaces/foobar/deployments/test-app {"kind":"DeleteOptions","apiVersion":"v1","propagationPolicy":"Background"}`,
+	}
+	if diff := cmp.Diff(want, s.requests); diff != "" {
+		t.Errorf("Delete(ctx, ...) sent unexpected requests (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// Kustomize implements the KustomizeService interface.
+// Kustomizations are built in-process with the kustomize API, so neither the kustomize CLI nor
+// kubectl is needed.
+type Kustomize struct {
+	kustomizer *krusty.Kustomizer
+}
+
+// NewKustomize returns a new Kustomize object.
+func NewKustomize(ctx context.Context) (*Kustomize, error) {
+	opts := krusty.MakeDefaultOptions()
+	// Like `kustomize build`, objects are sorted by the kustomization's sortOptions, or else so
+	// that, e.g., Namespaces and CustomResourceDefinitions come before the objects that need them.
+	opts.Reorder = krusty.ReorderOptionUnspecified
+	return &Kustomize{
+		kustomizer: krusty.MakeKustomizer(opts),
+	}, nil
+}
+
+// Build builds the kustomization in dir, like `kustomize build <dir>`.
+func (k *Kustomize) Build(ctx context.Context, dir string) (string, error) {
+	resMap, err := k.kustomizer.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to build kustomization: %v", err)
+	}
+	out, err := resMap.AsYaml()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode built kustomization: %v", err)
+	}
+	return string(out), nil
+}
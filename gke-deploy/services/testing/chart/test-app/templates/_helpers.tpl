@@ -0,0 +1,3 @@
+{{- define "test-app.fullname" -}}
+{{ .Release.Name }}-{{ .Chart.Name }}
+{{- end -}}
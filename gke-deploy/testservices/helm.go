@@ -0,0 +1,26 @@
+package testservices
+
+import (
+	"context"
+	"fmt"
+)
+
+// TestHelm implements the HelmService interface.
+type TestHelm struct {
+	TemplateResponse map[string]TemplateResponse
+}
+
+// TemplateResponse represents a response tuple for a Template function call.
+type TemplateResponse struct {
+	Res string
+	Err error
+}
+
+// Template returns the rendered configs of a chart.
+func (h *TestHelm) Template(ctx context.Context, releaseName, chart, namespace string, valuesFiles, setValues []string) (string, error) {
+	resp, ok := h.TemplateResponse[chart]
+	if !ok {
+		panic(fmt.Sprintf("TemplateResponse has no response for chart %q", chart))
+	}
+	return resp.Res, resp.Err
+}
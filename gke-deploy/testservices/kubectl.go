@@ -3,13 +3,25 @@ package testservices
 import (
 	"context"
 	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/GoogleCloudPlatform/cloud-builders/gke-deploy/services"
 )
 
 // TestKubectl implements the KubectlService interface.
 type TestKubectl struct {
-	ApplyResponse           map[string][]error
-	ApplyFromStringResponse map[string][]error
-	GetResponse             map[string]map[string][]GetResponse
+	ApplyResponse                     map[string][]error
+	ApplyFromStringResponse           map[string][]error
+	ServerSideApplyFromStringResponse map[string][]error
+	GetResponse                       map[string]map[string][]GetResponse
+	GetWithSelectorResponse           map[string]map[string][]GetResponse
+	GetEventsResponse                 map[string]map[string][]GetResponse
+	DeleteResponse                    map[string]map[string][]error
+	DeleteWithPreconditionsResponse   map[string]map[string][]DeleteWithPreconditionsResponse
+	APIResourcesResponse              map[bool][]GetResponse
+	// ContextNamespaceResponse is the current context's namespace, which is "default" if empty.
+	ContextNamespaceResponse string
 }
 
 // StatResponse represents a response tuple for a Stat function call.
@@ -18,6 +30,14 @@ type GetResponse struct {
 	Err error
 }
 
+// DeleteWithPreconditionsResponse is the response of a DeleteWithPreconditions function call with
+// the expected preconditions.
+type DeleteWithPreconditionsResponse struct {
+	UID             string
+	ResourceVersion string
+	Err             error
+}
+
 // Apply calls `kubectl apply -f <filename> -n <namespace>`.
 func (k *TestKubectl) Apply(ctx context.Context, filename, namespace string) error {
 	errors, ok := k.ApplyResponse[filename]
@@ -54,6 +74,24 @@ func (k *TestKubectl) ApplyFromString(ctx context.Context, configString, namespa
 	return err
 }
 
+// ServerSideApplyFromString calls `kubectl apply --server-side --field-manager=<fieldManager> -f - -n <namespace> < ${configString}`.
+func (k *TestKubectl) ServerSideApplyFromString(ctx context.Context, configString, namespace, fieldManager string, forceConflicts bool) error {
+	errors, ok := k.ServerSideApplyFromStringResponse[configString]
+	if !ok {
+		panic(fmt.Sprintf("ServerSideApplyFromStringResponse has no response for configs %q", configString))
+	}
+	if len(errors) == 0 {
+		panic(fmt.Sprintf("ServerSideApplyFromStringResponse ran out of responses for configs %q", configString))
+	}
+	err := errors[0]
+	if len(errors) == 1 {
+		delete(k.ServerSideApplyFromStringResponse, configString)
+	} else {
+		k.ServerSideApplyFromStringResponse[configString] = k.ServerSideApplyFromStringResponse[configString][1:]
+	}
+	return err
+}
+
 // Get calls `kubectl get <kind> <name> -n <namespace> --output=<format>`.
 func (k *TestKubectl) Get(ctx context.Context, kind, name, namespace, format string, ignoreNotFound bool) (string, error) {
 	resp, ok := k.GetResponse[kind][name]
@@ -75,5 +113,140 @@ func (k *TestKubectl) Get(ctx context.Context, kind, name, namespace, format str
 	} else {
 		k.GetResponse[kind][name] = k.GetResponse[kind][name][1:]
 	}
+	if ignoreNotFound && services.IsNotFound(err) {
+		return "", nil
+	}
+	return res, err
+}
+
+// NotFoundError returns the error of getting an object with kind and name that does not exist.
+func NotFoundError(kind, name string) error {
+	return &services.KubernetesError{
+		Reason:  metav1.StatusReasonNotFound,
+		Code:    404,
+		Message: fmt.Sprintf("%s %q not found", kind, name),
+	}
+}
+
+// GetWithSelector calls `kubectl get <kinds> -l <selector> -n <namespace> --output=<format>`.
+func (k *TestKubectl) GetWithSelector(ctx context.Context, kinds, selector, namespace, format string) (string, error) {
+	resp, ok := k.GetWithSelectorResponse[selector][namespace]
+	if !ok {
+		panic(fmt.Sprintf("GetWithSelectorResponse has no response for selector %q and namespace %q", selector, namespace))
+	}
+
+	if len(resp) == 0 {
+		panic(fmt.Sprintf("GetWithSelectorResponse ran out of responses for selector %q and namespace %q", selector, namespace))
+	}
+	res := resp[0].Res
+	err := resp[0].Err
+
+	if len(resp) == 1 {
+		delete(k.GetWithSelectorResponse[selector], namespace)
+		if len(k.GetWithSelectorResponse[selector]) == 0 {
+			delete(k.GetWithSelectorResponse, selector)
+		}
+	} else {
+		k.GetWithSelectorResponse[selector][namespace] = k.GetWithSelectorResponse[selector][namespace][1:]
+	}
 	return res, err
 }
+
+// GetEvents calls `kubectl get events --field-selector=involvedObject.kind=<kind>,involvedObject.name=<name> -n <namespace> --output=<format>`.
+func (k *TestKubectl) GetEvents(ctx context.Context, kind, name, namespace, format string) (string, error) {
+	resp, ok := k.GetEventsResponse[kind][name]
+	if !ok {
+		panic(fmt.Sprintf("GetEventsResponse has no response for kind %q and name %q", kind, name))
+	}
+
+	if len(resp) == 0 {
+		panic(fmt.Sprintf("GetEventsResponse ran out of responses for kind %q and name %q", kind, name))
+	}
+	res := resp[0].Res
+	err := resp[0].Err
+
+	if len(resp) == 1 {
+		delete(k.GetEventsResponse[kind], name)
+		if len(k.GetEventsResponse[kind]) == 0 {
+			delete(k.GetEventsResponse, kind)
+		}
+	} else {
+		k.GetEventsResponse[kind][name] = k.GetEventsResponse[kind][name][1:]
+	}
+	return res, err
+}
+
+// Delete calls `kubectl delete <kind> <name> -n <namespace> --ignore-not-found=true`.
+func (k *TestKubectl) Delete(ctx context.Context, kind, name, namespace string) error {
+	errors, ok := k.DeleteResponse[kind][name]
+	if !ok {
+		panic(fmt.Sprintf("DeleteResponse has no response for kind %q and name %q", kind, name))
+	}
+	if len(errors) == 0 {
+		panic(fmt.Sprintf("DeleteResponse ran out of responses for kind %q and name %q", kind, name))
+	}
+	err := errors[0]
+
+	if len(errors) == 1 {
+		delete(k.DeleteResponse[kind], name)
+		if len(k.DeleteResponse[kind]) == 0 {
+			delete(k.DeleteResponse, kind)
+		}
+	} else {
+		k.DeleteResponse[kind][name] = k.DeleteResponse[kind][name][1:]
+	}
+	return err
+}
+
+// DeleteWithPreconditions calls `kubectl delete --raw <path> -f -` with DeleteOptions that have
+// preconditions on uid and resourceVersion.
+func (k *TestKubectl) DeleteWithPreconditions(ctx context.Context, kind, name, namespace, uid, resourceVersion string) error {
+	resp, ok := k.DeleteWithPreconditionsResponse[kind][name]
+	if !ok {
+		panic(fmt.Sprintf("DeleteWithPreconditionsResponse has no response for kind %q and name %q", kind, name))
+	}
+	if len(resp) == 0 {
+		panic(fmt.Sprintf("DeleteWithPreconditionsResponse ran out of responses for kind %q and name %q", kind, name))
+	}
+	if resp[0].UID != uid || resp[0].ResourceVersion != resourceVersion {
+		panic(fmt.Sprintf("DeleteWithPreconditionsResponse has no response for kind %q and name %q with uid %q and resource version %q", kind, name, uid, resourceVersion))
+	}
+	err := resp[0].Err
+
+	if len(resp) == 1 {
+		delete(k.DeleteWithPreconditionsResponse[kind], name)
+		if len(k.DeleteWithPreconditionsResponse[kind]) == 0 {
+			delete(k.DeleteWithPreconditionsResponse, kind)
+		}
+	} else {
+		k.DeleteWithPreconditionsResponse[kind][name] = k.DeleteWithPreconditionsResponse[kind][name][1:]
+	}
+	return err
+}
+
+// APIResources calls `kubectl api-resources --verbs=<verbs> --namespaced=<namespaced> --no-headers`.
+func (k *TestKubectl) APIResources(ctx context.Context, namespaced bool, verbs []string) (string, error) {
+	resp, ok := k.APIResourcesResponse[namespaced]
+	if !ok {
+		panic(fmt.Sprintf("APIResourcesResponse has no response for namespaced %t", namespaced))
+	}
+	if len(resp) == 0 {
+		panic(fmt.Sprintf("APIResourcesResponse ran out of responses for namespaced %t", namespaced))
+	}
+	res := resp[0].Res
+	err := resp[0].Err
+	if len(resp) == 1 {
+		delete(k.APIResourcesResponse, namespaced)
+	} else {
+		k.APIResourcesResponse[namespaced] = k.APIResourcesResponse[namespaced][1:]
+	}
+	return res, err
+}
+
+// ContextNamespace calls `kubectl config view --minify --output=jsonpath={.contexts[0].context.namespace}`.
+func (k *TestKubectl) ContextNamespace(ctx context.Context) (string, error) {
+	if k.ContextNamespaceResponse == "" {
+		return "default", nil
+	}
+	return k.ContextNamespaceResponse, nil
+}
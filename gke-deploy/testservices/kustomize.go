@@ -0,0 +1,26 @@
+package testservices
+
+import (
+	"context"
+	"fmt"
+)
+
+// TestKustomize implements the KustomizeService interface.
+type TestKustomize struct {
+	BuildResponse map[string]BuildResponse
+}
+
+// BuildResponse represents a response tuple for a Build function call.
+type BuildResponse struct {
+	Res string
+	Err error
+}
+
+// Build returns the built configs of a kustomization directory.
+func (k *TestKustomize) Build(ctx context.Context, dir string) (string, error) {
+	resp, ok := k.BuildResponse[dir]
+	if !ok {
+		panic(fmt.Sprintf("BuildResponse has no response for dir %q", dir))
+	}
+	return resp.Res, resp.Err
+}